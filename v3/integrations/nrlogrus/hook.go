@@ -0,0 +1,81 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package nrlogrus
+
+import (
+	"fmt"
+	"strings"
+
+	newrelic "github.com/newrelic/go-agent/v3/newrelic"
+	"github.com/sirupsen/logrus"
+)
+
+// Hook is a logrus.Hook which records log entries with New Relic.  Entries
+// whose context contains a transaction are recorded using
+// Transaction.RecordLog so that they are linked to the transaction's trace,
+// and all other entries are recorded using Application.RecordLog.
+//
+//	l := logrus.New()
+//	l.AddHook(nrlogrus.NewHook(app))
+//	l.WithContext(ctx).Info("processing order")
+//
+// Log forwarding must be enabled using
+// newrelic.ConfigAppLogForwardingEnabled for entries to be sent to New Relic.
+type Hook struct {
+	app *newrelic.Application
+}
+
+// NewHook creates a Hook which records log entries using the application
+// provided.
+func NewHook(app *newrelic.Application) *Hook {
+	return &Hook{app: app}
+}
+
+// Levels implements logrus.Hook.  Entries of every level are recorded.
+func (h *Hook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook.  Fire is called while the logger is locked, so
+// an entry which cannot be recorded is reported by returning the error rather
+// than by logging it: the agent may be using the same logger through
+// Transform.
+func (h *Hook) Fire(e *logrus.Entry) error {
+	// Agent log messages sent to the same logger using Transform are not
+	// recorded, since doing so could produce further agent log messages.
+	if c, ok := e.Data["component"]; ok && c == "newrelic" {
+		return nil
+	}
+	data := newrelic.LogData{
+		Timestamp:  e.Time,
+		Severity:   strings.ToUpper(e.Level.String()),
+		Message:    e.Message,
+		Attributes: attributesFromFields(e.Data),
+	}
+	if txn := newrelic.FromContext(e.Context); nil != txn {
+		return txn.RecordLog(data)
+	}
+	return h.app.RecordLog(data)
+}
+
+// attributesFromFields converts logrus fields into log attributes.  Values
+// which are not valid attribute types are converted to strings.
+func attributesFromFields(fields logrus.Fields) map[string]interface{} {
+	if 0 == len(fields) {
+		return nil
+	}
+	attrs := make(map[string]interface{}, len(fields))
+	for key, val := range fields {
+		switch v := val.(type) {
+		case string, bool, int, int8, int16, int32, int64, uint, uint8,
+			uint16, uint32, uint64, float32, float64:
+			attrs[key] = v
+		case error:
+			attrs[key] = v.Error()
+		default:
+			attrs[key] = fmt.Sprint(v)
+		}
+	}
+	return attrs
+}
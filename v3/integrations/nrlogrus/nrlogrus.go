@@ -2,7 +2,8 @@
 // SPDX-License-Identifier: Apache-2.0
 
 // Package nrlogrus sends go-agent log messages to
-// https://github.com/sirupsen/logrus.
+// https://github.com/sirupsen/logrus, and records logrus entries with New
+// Relic.
 //
 // Use this package if you are using logrus in your application and would like
 // the go-agent log messages to end up in the same place.  If you are using
@@ -23,7 +24,12 @@
 //		nrlogrus.ConfigLogger(l),
 //	)
 //
-// This package requires logrus version v1.1.0 and above.
+// To forward your application's logrus entries to New Relic, add a Hook to
+// your logger:
+//
+//	l.AddHook(nrlogrus.NewHook(app))
+//
+// This package requires logrus version v1.4.0 and above.
 package nrlogrus
 
 import (
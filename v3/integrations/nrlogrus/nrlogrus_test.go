@@ -5,9 +5,16 @@ package nrlogrus
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/newrelic/go-agent/v3/internal"
+	"github.com/newrelic/go-agent/v3/internal/integrationsupport"
+	newrelic "github.com/newrelic/go-agent/v3/newrelic"
 	"github.com/sirupsen/logrus"
 )
 
@@ -47,3 +54,102 @@ func TestLogrus(t *testing.T) {
 		t.Error(s)
 	}
 }
+
+func enableLogForwarding(cfg *newrelic.Config) {
+	cfg.ApplicationLogging.Forwarding.Enabled = true
+}
+
+func TestHook(t *testing.T) {
+	app := integrationsupport.NewTestApp(nil, enableLogForwarding)
+	l := logrus.New()
+	l.SetOutput(&bytes.Buffer{})
+	l.AddHook(NewHook(app.Application))
+
+	l.WithFields(logrus.Fields{
+		"color": "gray",
+		"err":   errors.New("oops"),
+		"legs":  4,
+		"tusks": []string{"left", "right"},
+	}).Warn("elephant")
+
+	app.ExpectLogEvents(t, []internal.WantLog{{
+		Severity: "WARNING",
+		Message:  "elephant",
+		Attributes: map[string]interface{}{
+			"color": "gray",
+			"err":   "oops",
+			"legs":  4,
+			"tusks": "[left right]",
+		},
+	}})
+	app.ExpectMetrics(t, []internal.WantMetric{
+		{Name: "Logging/lines", Forced: true, Data: []float64{1, 0, 0, 0, 0, 0}},
+		{Name: "Logging/lines/WARNING", Forced: true, Data: []float64{1, 0, 0, 0, 0, 0}},
+	})
+}
+
+func TestHookTransaction(t *testing.T) {
+	app := integrationsupport.NewTestApp(nil, enableLogForwarding)
+	l := logrus.New()
+	l.SetOutput(&bytes.Buffer{})
+	l.AddHook(NewHook(app.Application))
+
+	txn := app.StartTransaction("hello")
+	ctx := newrelic.NewContext(context.Background(), txn)
+	l.WithContext(ctx).Info("tiger")
+	app.ExpectLogEvents(t, []internal.WantLog{})
+	txn.End()
+
+	app.ExpectLogEvents(t, []internal.WantLog{{
+		Severity: "INFO",
+		Message:  "tiger",
+	}})
+}
+
+func TestHookIgnoresAgentMessages(t *testing.T) {
+	app := integrationsupport.NewTestApp(nil, enableLogForwarding)
+	l := logrus.New()
+	l.SetOutput(&bytes.Buffer{})
+	l.AddHook(NewHook(app.Application))
+
+	Transform(l).Info("agent message", nil)
+	app.ExpectLogEvents(t, []internal.WantLog{})
+}
+
+func TestHookRejectedEntryWithTransform(t *testing.T) {
+	l := logrus.New()
+	l.SetOutput(&bytes.Buffer{})
+	app := integrationsupport.NewTestApp(nil, enableLogForwarding, func(cfg *newrelic.Config) {
+		cfg.Logger = Transform(l)
+	})
+	l.AddHook(NewHook(app.Application))
+
+	// Entries which cannot be recorded must not be logged through the agent
+	// logger, which is locked while the hook fires.
+	fields := make(logrus.Fields)
+	for i := 0; i < 65; i++ {
+		fields[fmt.Sprintf("field%d", i)] = i
+	}
+	txn := app.StartTransaction("hello")
+	ctx := newrelic.NewContext(context.Background(), txn)
+	txn.End()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.WithFields(fields).Info("too many fields")
+		l.WithContext(ctx).Info("after end")
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("rejected entry deadlocked")
+	}
+	app.ExpectLogEvents(t, []internal.WantLog{})
+	// The rejected entries are not counted.
+	app.ExpectMetrics(t, []internal.WantMetric{
+		{Name: "OtherTransaction/Go/hello", Forced: true, Data: nil},
+		{Name: "OtherTransaction/all", Forced: true, Data: nil},
+		{Name: "OtherTransactionTotalTime/Go/hello", Forced: false, Data: nil},
+		{Name: "OtherTransactionTotalTime", Forced: true, Data: nil},
+	})
+}
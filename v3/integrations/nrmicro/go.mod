@@ -5,7 +5,7 @@ module github.com/newrelic/go-agent/v3/integrations/nrmicro
 go 1.13
 
 require (
-	github.com/golang/protobuf v1.3.2
+	github.com/golang/protobuf v1.3.3
 	github.com/micro/go-micro v1.8.0
-	github.com/newrelic/go-agent/v3 v3.4.0
+	github.com/newrelic/go-agent/v3 v3.10.0
 )
@@ -15,8 +15,6 @@ import (
 	"github.com/micro/go-micro/registry"
 	"github.com/micro/go-micro/server"
 
-	"github.com/newrelic/go-agent/v3/internal"
-	"github.com/newrelic/go-agent/v3/internal/integrationsupport"
 	"github.com/newrelic/go-agent/v3/newrelic"
 )
 
@@ -199,22 +197,23 @@ func SubscriberWrapper(app *newrelic.Application) server.SubscriberWrapper {
 			return fn
 		}
 		return func(ctx context.Context, m server.Message) (err error) {
-			namer := internal.MessageMetricKey{
+			txn := app.StartTransaction(m.Topic())
+			defer txn.End()
+			msgReq := newrelic.MessageRequest{
 				Library:         "Micro",
-				DestinationType: string(newrelic.MessageTopic),
+				DestinationType: newrelic.MessageTopic,
 				DestinationName: m.Topic(),
-				Consumer:        true,
+				RoutingKey:      m.Topic(),
 			}
-			txn := app.StartTransaction(namer.Name())
-			defer txn.End()
-			integrationsupport.AddAgentAttribute(txn, newrelic.AttributeMessageRoutingKey, m.Topic(), nil)
 			if md, ok := metadata.FromContext(ctx); ok {
 				hdrs := http.Header{}
 				for k, v := range md {
 					hdrs.Set(k, v)
 				}
-				txn.AcceptDistributedTraceHeaders(newrelic.TransportHTTP, hdrs)
+				msgReq.Header = hdrs
+				msgReq.Transport = newrelic.TransportHTTP
 			}
+			txn.SetMessageRequest(msgReq)
 			ctx = newrelic.NewContext(ctx, txn)
 			err = fn(ctx, m)
 			if err != nil {
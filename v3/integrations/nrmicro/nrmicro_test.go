@@ -908,12 +908,12 @@ func TestServerSubscribe(t *testing.T) {
 	s.Stop()
 
 	app.ExpectMetrics(t, []internal.WantMetric{
-		{Name: "OtherTransaction/Go/Message/Micro/Topic/Named/topic", Scope: "", Forced: true, Data: nil},
+		{Name: "OtherTransaction/Message/Micro/Topic/Named/topic", Scope: "", Forced: true, Data: nil},
 		{Name: "OtherTransaction/all", Scope: "", Forced: true, Data: nil},
 		{Name: "OtherTransactionTotalTime", Scope: "", Forced: true, Data: nil},
-		{Name: "OtherTransactionTotalTime/Go/Message/Micro/Topic/Named/topic", Scope: "", Forced: false, Data: nil},
+		{Name: "OtherTransactionTotalTime/Message/Micro/Topic/Named/topic", Scope: "", Forced: false, Data: nil},
 		{Name: "Custom/segment", Scope: "", Forced: false, Data: nil},
-		{Name: "Custom/segment", Scope: "OtherTransaction/Go/Message/Micro/Topic/Named/topic", Forced: false, Data: nil},
+		{Name: "Custom/segment", Scope: "OtherTransaction/Message/Micro/Topic/Named/topic", Forced: false, Data: nil},
 		{Name: "TransportDuration/App/123/456/HTTP/allOther", Scope: "", Forced: false, Data: nil},
 		{Name: "Supportability/TraceContext/Accept/Success", Scope: "", Forced: true, Data: nil},
 		{Name: "DurationByCaller/App/123/456/HTTP/all", Scope: "", Forced: false, Data: nil},
@@ -933,8 +933,8 @@ func TestServerSubscribe(t *testing.T) {
 		{
 			Intrinsics: map[string]interface{}{
 				"category":         "generic",
-				"name":             "OtherTransaction/Go/Message/Micro/Topic/Named/topic",
-				"transaction.name": "OtherTransaction/Go/Message/Micro/Topic/Named/topic",
+				"name":             "OtherTransaction/Message/Micro/Topic/Named/topic",
+				"transaction.name": "OtherTransaction/Message/Micro/Topic/Named/topic",
 				"nr.entryPoint":    true,
 				"parentId":         internal.MatchAnything,
 				"trustedParentId":  internal.MatchAnything,
@@ -954,7 +954,7 @@ func TestServerSubscribe(t *testing.T) {
 		{
 			Intrinsics: map[string]interface{}{
 				"guid":                     internal.MatchAnything,
-				"name":                     "OtherTransaction/Go/Message/Micro/Topic/Named/topic",
+				"name":                     "OtherTransaction/Message/Micro/Topic/Named/topic",
 				"parent.account":           123,
 				"parent.app":               456,
 				"parent.transportDuration": internal.MatchAnything,
@@ -973,12 +973,12 @@ func TestServerSubscribe(t *testing.T) {
 		},
 	})
 	app.ExpectTxnTraces(t, []internal.WantTxnTrace{{
-		MetricName: "OtherTransaction/Go/Message/Micro/Topic/Named/topic",
+		MetricName: "OtherTransaction/Message/Micro/Topic/Named/topic",
 		Root: internal.WantTraceSegment{
 			SegmentName: "ROOT",
 			Attributes:  map[string]interface{}{},
 			Children: []internal.WantTraceSegment{{
-				SegmentName: "OtherTransaction/Go/Message/Micro/Topic/Named/topic",
+				SegmentName: "OtherTransaction/Message/Micro/Topic/Named/topic",
 				Attributes:  map[string]interface{}{"exclusive_duration_millis": internal.MatchAnything},
 				Children: []internal.WantTraceSegment{{
 					SegmentName: "Custom/segment",
@@ -1016,24 +1016,24 @@ func TestServerSubscribeWithError(t *testing.T) {
 	s.Stop()
 
 	app.ExpectMetrics(t, []internal.WantMetric{
-		{Name: "OtherTransaction/Go/Message/Micro/Topic/Named/topic", Scope: "", Forced: true, Data: nil},
+		{Name: "OtherTransaction/Message/Micro/Topic/Named/topic", Scope: "", Forced: true, Data: nil},
 		{Name: "OtherTransaction/all", Scope: "", Forced: true, Data: nil},
 		{Name: "OtherTransactionTotalTime", Scope: "", Forced: true, Data: nil},
-		{Name: "OtherTransactionTotalTime/Go/Message/Micro/Topic/Named/topic", Scope: "", Forced: false, Data: nil},
+		{Name: "OtherTransactionTotalTime/Message/Micro/Topic/Named/topic", Scope: "", Forced: false, Data: nil},
 		{Name: "DurationByCaller/Unknown/Unknown/Unknown/HTTP/all", Scope: "", Forced: false, Data: nil},
 		{Name: "DurationByCaller/Unknown/Unknown/Unknown/HTTP/allOther", Scope: "", Forced: false, Data: nil},
 		{Name: "Errors/all", Scope: "", Forced: true, Data: nil},
 		{Name: "Errors/allOther", Scope: "", Forced: true, Data: nil},
 		{Name: "ErrorsByCaller/Unknown/Unknown/Unknown/HTTP/all", Scope: "", Forced: false, Data: nil},
 		{Name: "ErrorsByCaller/Unknown/Unknown/Unknown/HTTP/allOther", Scope: "", Forced: false, Data: nil},
-		{Name: "Errors/OtherTransaction/Go/Message/Micro/Topic/Named/topic", Scope: "", Forced: true, Data: nil},
+		{Name: "Errors/OtherTransaction/Message/Micro/Topic/Named/topic", Scope: "", Forced: true, Data: nil},
 	})
 	app.ExpectSpanEvents(t, []internal.WantEvent{
 		{
 			Intrinsics: map[string]interface{}{
 				"category":         "generic",
-				"name":             "OtherTransaction/Go/Message/Micro/Topic/Named/topic",
-				"transaction.name": "OtherTransaction/Go/Message/Micro/Topic/Named/topic",
+				"name":             "OtherTransaction/Message/Micro/Topic/Named/topic",
+				"transaction.name": "OtherTransaction/Message/Micro/Topic/Named/topic",
 				"nr.entryPoint":    true,
 			},
 			UserAttributes: map[string]interface{}{},
@@ -1045,19 +1045,19 @@ func TestServerSubscribeWithError(t *testing.T) {
 		},
 	})
 	app.ExpectTxnTraces(t, []internal.WantTxnTrace{{
-		MetricName: "OtherTransaction/Go/Message/Micro/Topic/Named/topic",
+		MetricName: "OtherTransaction/Message/Micro/Topic/Named/topic",
 		Root: internal.WantTraceSegment{
 			SegmentName: "ROOT",
 			Attributes:  map[string]interface{}{},
 			Children: []internal.WantTraceSegment{{
-				SegmentName: "OtherTransaction/Go/Message/Micro/Topic/Named/topic",
+				SegmentName: "OtherTransaction/Message/Micro/Topic/Named/topic",
 				Attributes:  map[string]interface{}{"exclusive_duration_millis": internal.MatchAnything},
 				Children:    []internal.WantTraceSegment{},
 			}},
 		},
 	}})
 	app.ExpectErrors(t, []internal.WantError{{
-		TxnName: "OtherTransaction/Go/Message/Micro/Topic/Named/topic",
+		TxnName: "OtherTransaction/Message/Micro/Topic/Named/topic",
 		Msg:     "subscriber error",
 		Klass:   "*errors.errorString",
 	}})
@@ -1065,7 +1065,7 @@ func TestServerSubscribeWithError(t *testing.T) {
 		Intrinsics: map[string]interface{}{
 			"error.message":   "subscriber error",
 			"error.class":     "*errors.errorString",
-			"transactionName": "OtherTransaction/Go/Message/Micro/Topic/Named/topic",
+			"transactionName": "OtherTransaction/Message/Micro/Topic/Named/topic",
 			"traceId":         internal.MatchAnything,
 			"priority":        internal.MatchAnything,
 			"guid":            internal.MatchAnything,
@@ -6,6 +6,5 @@ go 1.10
 require (
 	// v1.5.0 is the first mysql version to support gomod
 	github.com/go-sql-driver/mysql v1.5.0
-	// v3.3.0 includes the new location of ParseQuery
-	github.com/newrelic/go-agent/v3 v3.3.0
+	github.com/newrelic/go-agent/v3 v3.10.0
 )
@@ -62,8 +62,9 @@ var (
 		BaseSegment: newrelic.DatastoreSegment{
 			Product: newrelic.DatastoreMySQL,
 		},
-		ParseQuery: sqlparse.ParseQuery,
-		ParseDSN:   parseDSN,
+		ParseQuery:   sqlparse.ParseQuery,
+		ExplainQuery: sqlparse.ExplainQuery("EXPLAIN "),
+		ParseDSN:     parseDSN,
 	}
 )
 
@@ -7,5 +7,5 @@ go 1.11
 require (
 	// v1.8.0 is the first nats version with a go.mod.
 	github.com/nats-io/nats.go v1.8.0
-	github.com/newrelic/go-agent/v3 v3.4.0
+	github.com/newrelic/go-agent/v3 v3.10.0
 )
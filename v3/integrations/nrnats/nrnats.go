@@ -7,8 +7,6 @@ import (
 	"strings"
 
 	nats "github.com/nats-io/nats.go"
-	"github.com/newrelic/go-agent/v3/internal"
-	"github.com/newrelic/go-agent/v3/internal/integrationsupport"
 	newrelic "github.com/newrelic/go-agent/v3/newrelic"
 )
 
@@ -48,18 +46,17 @@ func SubWrapper(app *newrelic.Application, f func(msg *nats.Msg)) func(msg *nats
 		return f
 	}
 	return func(msg *nats.Msg) {
-		namer := internal.MessageMetricKey{
-			Library:         "NATS",
-			DestinationType: string(newrelic.MessageTopic),
-			DestinationName: msg.Subject,
-			Consumer:        true,
-		}
-		txn := app.StartTransaction(namer.Name())
+		txn := app.StartTransaction(msg.Subject)
 		defer txn.End()
 
-		integrationsupport.AddAgentAttribute(txn, newrelic.AttributeMessageRoutingKey, msg.Sub.Subject, nil)
-		integrationsupport.AddAgentAttribute(txn, newrelic.AttributeMessageQueueName, msg.Sub.Queue, nil)
-		integrationsupport.AddAgentAttribute(txn, newrelic.AttributeMessageReplyTo, msg.Reply, nil)
+		txn.SetMessageRequest(newrelic.MessageRequest{
+			Library:         "NATS",
+			DestinationType: newrelic.MessageTopic,
+			DestinationName: msg.Subject,
+			RoutingKey:      msg.Sub.Subject,
+			QueueName:       msg.Sub.Queue,
+			ReplyTo:         msg.Reply,
+		})
 
 		f(msg)
 	}
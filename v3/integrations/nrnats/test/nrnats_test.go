@@ -160,13 +160,13 @@ func TestSubWrapper(t *testing.T) {
 		{Name: "OtherTransactionTotalTime", Scope: "", Forced: true, Data: nil},
 		{Name: "DurationByCaller/Unknown/Unknown/Unknown/Unknown/all", Scope: "", Forced: false, Data: nil},
 		{Name: "DurationByCaller/Unknown/Unknown/Unknown/Unknown/allOther", Scope: "", Forced: false, Data: nil},
-		{Name: "OtherTransaction/Go/Message/NATS/Topic/Named/subject2", Scope: "", Forced: true, Data: nil},
-		{Name: "OtherTransactionTotalTime/Go/Message/NATS/Topic/Named/subject2", Scope: "", Forced: false, Data: nil},
+		{Name: "OtherTransaction/Message/NATS/Topic/Named/subject2", Scope: "", Forced: true, Data: nil},
+		{Name: "OtherTransactionTotalTime/Message/NATS/Topic/Named/subject2", Scope: "", Forced: false, Data: nil},
 	})
 	app.ExpectTxnEvents(t, []internal.WantEvent{
 		{
 			Intrinsics: map[string]interface{}{
-				"name":     "OtherTransaction/Go/Message/NATS/Topic/Named/subject2",
+				"name":     "OtherTransaction/Message/NATS/Topic/Named/subject2",
 				"guid":     internal.MatchAnything,
 				"priority": internal.MatchAnything,
 				"sampled":  internal.MatchAnything,
@@ -0,0 +1,20 @@
+module github.com/newrelic/go-agent/v3/integrations/nrotel
+
+// As of Feb 2024, the OpenTelemetry API requires go 1.20:
+// https://github.com/open-telemetry/opentelemetry-go/blob/main/go.mod
+go 1.20
+
+require (
+	github.com/newrelic/go-agent/v3 v3.10.0
+	go.opentelemetry.io/otel v1.24.0
+	go.opentelemetry.io/otel/trace v1.24.0
+)
+
+require (
+	github.com/golang/protobuf v1.3.3 // indirect
+	golang.org/x/net v0.0.0-20190311183353-d8887717615a // indirect
+	golang.org/x/sys v0.0.0-20190215142949-d0b11bdaac8a // indirect
+	golang.org/x/text v0.3.0 // indirect
+	google.golang.org/genproto v0.0.0-20190819201941-24fa4b261c55 // indirect
+	google.golang.org/grpc v1.27.0 // indirect
+)
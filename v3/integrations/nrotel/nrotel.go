@@ -0,0 +1,391 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package nrotel records spans created with the OpenTelemetry API
+// (https://pkg.go.dev/go.opentelemetry.io/otel/trace) as New Relic
+// transactions and segments.
+//
+// Use this package when the libraries your application depends on are
+// instrumented with OpenTelemetry.  Create a TracerProvider using your
+// Application and register it as the global provider, or pass it to the
+// library directly:
+//
+//	otel.SetTracerProvider(nrotel.NewTracerProvider(app))
+//
+// A span started with a context that does not contain a Transaction begins a
+// new Transaction, which ends when the span ends.  A span started with a
+// context that contains a Transaction, either because the parent span was
+// created by this package or because the context was created by
+// newrelic.NewContext, becomes a segment of that Transaction.  The returned
+// context contains both the span and the Transaction, so that
+// newrelic.FromContext may be used to add custom instrumentation within an
+// OpenTelemetry span.
+//
+// Spans whose attributes follow the OpenTelemetry semantic conventions are
+// recorded as the corresponding New Relic type: client spans with "db.system"
+// become DatastoreSegments, client spans with "http.request.method" become
+// ExternalSegments and producer and consumer spans with "messaging.system"
+// become message segments.  Server and consumer root spans are recorded as
+// web and message transactions.  Other attributes are added as custom
+// attributes.
+//
+// As with segments, child spans must be started and ended on the goroutine of
+// their Transaction.  Use Transaction.NewGoroutine and newrelic.NewContext to
+// create spans in another goroutine.  Events and links are recorded on the
+// spans of segments, but not on the spans of transactions.  Errors recorded on
+// a root span are noticed by the Transaction, while errors recorded on a child
+// span are only noticed by its segment.
+package nrotel
+
+import (
+	"context"
+	"sync"
+
+	"github.com/newrelic/go-agent/v3/internal"
+	"github.com/newrelic/go-agent/v3/newrelic"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+)
+
+func init() { internal.TrackUsage("integration", "opentelemetry") }
+
+// TracerProvider is an OpenTelemetry trace.TracerProvider that records spans
+// using a newrelic.Application.
+type TracerProvider struct {
+	embedded.TracerProvider
+
+	app *newrelic.Application
+}
+
+var _ trace.TracerProvider = &TracerProvider{}
+
+// NewTracerProvider returns a TracerProvider that records spans using the
+// Application provided.  If app is nil, the spans are not recorded.
+func NewTracerProvider(app *newrelic.Application) *TracerProvider {
+	return &TracerProvider{app: app}
+}
+
+// Tracer returns a trace.Tracer.  The name and options are not used.
+func (tp *TracerProvider) Tracer(name string, options ...trace.TracerOption) trace.Tracer {
+	return &tracer{provider: tp}
+}
+
+type tracer struct {
+	embedded.Tracer
+
+	provider *TracerProvider
+}
+
+// Start implements trace.Tracer.
+func (tr *tracer) Start(ctx context.Context, name string, options ...trace.SpanStartOption) (context.Context, trace.Span) {
+	cfg := trace.NewSpanStartConfig(options...)
+
+	var txn *newrelic.Transaction
+	if !cfg.NewRoot() {
+		if parent, ok := trace.SpanFromContext(ctx).(*span); ok && !parent.isEnded() {
+			txn = parent.txn
+		} else {
+			txn = newrelic.FromContext(ctx)
+		}
+	}
+
+	s := &span{
+		provider:   tr.provider,
+		name:       name,
+		kind:       cfg.SpanKind(),
+		attributes: make(map[attribute.Key]attribute.Value),
+	}
+	s.setAttributes(cfg.Attributes())
+
+	if nil != txn {
+		s.txn = txn
+		s.segment = txn.StartSegment(name)
+		s.start = s.segment.StartTime
+		for _, l := range cfg.Links() {
+			s.addLink(l)
+		}
+	} else if nil != tr.provider.app {
+		s.txn = tr.provider.app.StartTransaction(name)
+		s.root = true
+		s.startTransaction(trace.SpanContextFromContext(ctx))
+	}
+	s.spanContext = spanContextFromTransaction(s.txn)
+
+	if nil != s.txn {
+		ctx = newrelic.NewContext(ctx, s.txn)
+	}
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+// span is a trace.Span which is recorded as either a Transaction or a
+// segment of a Transaction.
+type span struct {
+	embedded.Span
+
+	provider    *TracerProvider
+	txn         *newrelic.Transaction
+	root        bool
+	start       newrelic.SegmentStartTime
+	spanContext trace.SpanContext
+	kind        trace.SpanKind
+	// segment is the segment of a child span, on which its events, links
+	// and errors are recorded.  It is ended as the segment type matching
+	// the span's attributes.
+	segment *newrelic.Segment
+	// request is true if the semantic convention attributes of a root span
+	// were recorded as its web or message request.
+	request bool
+
+	sync.Mutex
+	ended         bool
+	name          string
+	attributes    map[attribute.Key]attribute.Value
+	statusError   bool
+	statusMessage string
+	errorNoticed  bool
+}
+
+var _ trace.Span = &span{}
+
+func (s *span) isEnded() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.ended
+}
+
+// startTransaction records the request information of a root span.  When
+// the span has a remote parent, its trace context is accepted as the
+// inbound distributed tracing payload.
+func (s *span) startTransaction(parent trace.SpanContext) {
+	transport := newrelic.TransportOther
+	switch s.kind {
+	case trace.SpanKindServer:
+		transport = newrelic.TransportHTTP
+	case trace.SpanKindConsumer:
+		transport = newrelic.TransportQueue
+	}
+
+	if parent.IsValid() && parent.IsRemote() {
+		s.txn.AcceptDistributedTraceHeaders(transport, traceContextHeaders(parent))
+	}
+
+	switch s.kind {
+	case trace.SpanKindServer:
+		if r, ok := webRequest(s.attributes); ok {
+			s.txn.SetWebRequest(r)
+			s.request = true
+		}
+	case trace.SpanKindConsumer:
+		if r, ok := messageRequest(s.attributes); ok {
+			s.txn.SetMessageRequest(r)
+			s.request = true
+		}
+	}
+}
+
+func (s *span) addLink(l trace.Link) {
+	if !l.SpanContext.IsValid() {
+		return
+	}
+	s.segment.AddLink(newrelic.TraceMetadata{
+		TraceID: l.SpanContext.TraceID().String(),
+		SpanID:  l.SpanContext.SpanID().String(),
+	})
+}
+
+// End implements trace.Span.  The span's Transaction or segment is ended.
+func (s *span) End(options ...trace.SpanEndOption) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.ended || nil == s.txn {
+		s.ended = true
+		return
+	}
+	s.ended = true
+
+	if s.statusError && !s.errorNoticed {
+		msg := s.statusMessage
+		if "" == msg {
+			msg = s.name
+		}
+		s.noticeError(newrelic.Error{
+			Message: msg,
+			Class:   spanStatusErrorClass,
+		})
+	}
+
+	if s.root {
+		s.endTransaction()
+	} else {
+		s.endSegment()
+	}
+}
+
+// spanStatusErrorClass is the error class used when a span's status is set
+// to codes.Error without an error being recorded.
+const spanStatusErrorClass = "SpanStatusError"
+
+func (s *span) endTransaction() {
+	if code, ok := httpStatusCode(s.attributes); ok && s.kind == trace.SpanKindServer {
+		s.txn.SetWebResponse(nil).WriteHeader(code)
+	}
+	for key, val := range s.attributes {
+		if !s.request || !isMappedAttribute(key) {
+			s.txn.AddAttribute(string(key), attributeValue(val))
+		}
+	}
+	s.txn.End()
+}
+
+func (s *span) endSegment() {
+	seg := newSegment(s.start, s.name, s.kind, s.attributes)
+	_, generic := seg.(*newrelic.Segment)
+	for key, val := range s.attributes {
+		if generic || !isMappedAttribute(key) {
+			seg.AddAttribute(string(key), attributeValue(val))
+		}
+	}
+	seg.End()
+}
+
+// AddEvent implements trace.Span.  The event is added to the span of the
+// segment.
+func (s *span) AddEvent(name string, options ...trace.EventOption) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.ended || s.root || nil == s.txn {
+		return
+	}
+	cfg := trace.NewEventConfig(options...)
+	var attrs map[string]interface{}
+	if kvs := cfg.Attributes(); len(kvs) > 0 {
+		attrs = make(map[string]interface{}, len(kvs))
+		for _, kv := range kvs {
+			attrs[string(kv.Key)] = attributeValue(kv.Value)
+		}
+	}
+	s.segment.AddEvent(name, attrs)
+}
+
+// IsRecording implements trace.Span.
+func (s *span) IsRecording() bool {
+	s.Lock()
+	defer s.Unlock()
+	return !s.ended && nil != s.txn
+}
+
+// RecordError implements trace.Span.  The error of a root span is noticed by
+// the Transaction, and the error of a child span is noticed by its segment:
+// use RecordError on the root span, or newrelic.FromContext and
+// Transaction.NoticeError, when the error makes the Transaction fail.
+func (s *span) RecordError(err error, options ...trace.EventOption) {
+	if nil == err {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+
+	if s.ended || nil == s.txn {
+		return
+	}
+	s.errorNoticed = true
+	s.noticeError(err)
+}
+
+func (s *span) noticeError(err error) {
+	if s.root {
+		s.txn.NoticeError(err)
+	} else {
+		s.segment.NoticeError(err)
+	}
+}
+
+// SpanContext implements trace.Span.  It contains the distributed tracing
+// identifiers of the Transaction or segment.
+func (s *span) SpanContext() trace.SpanContext {
+	return s.spanContext
+}
+
+// SetStatus implements trace.Span.  If the code is codes.Error and no error
+// has been recorded, an error with the description is noticed when the span
+// ends.
+func (s *span) SetStatus(code codes.Code, description string) {
+	s.Lock()
+	defer s.Unlock()
+
+	switch code {
+	case codes.Error:
+		s.statusError = true
+		s.statusMessage = description
+	case codes.Ok:
+		s.statusError = false
+		s.statusMessage = ""
+	}
+}
+
+// SetName implements trace.Span.
+func (s *span) SetName(name string) {
+	s.Lock()
+	defer s.Unlock()
+	s.name = name
+	if s.root && !s.ended {
+		s.txn.SetName(name)
+	}
+}
+
+// SetAttributes implements trace.Span.
+func (s *span) SetAttributes(kv ...attribute.KeyValue) {
+	s.Lock()
+	defer s.Unlock()
+	s.setAttributes(kv)
+}
+
+func (s *span) setAttributes(kvs []attribute.KeyValue) {
+	for _, kv := range kvs {
+		if kv.Valid() {
+			s.attributes[kv.Key] = kv.Value
+		}
+	}
+}
+
+// TracerProvider implements trace.Span.
+func (s *span) TracerProvider() trace.TracerProvider {
+	return s.provider
+}
+
+// spanContextFromTransaction returns the OpenTelemetry span context of the
+// Transaction's currently active segment.  The span context is invalid if
+// distributed tracing is disabled.
+func spanContextFromTransaction(txn *newrelic.Transaction) trace.SpanContext {
+	md := txn.GetTraceMetadata()
+	traceID, err := trace.TraceIDFromHex(padHex(md.TraceID, 32))
+	if nil != err {
+		return trace.SpanContext{}
+	}
+	spanID, err := trace.SpanIDFromHex(padHex(md.SpanID, 16))
+	if nil != err {
+		return trace.SpanContext{}
+	}
+	var flags trace.TraceFlags
+	if txn.IsSampled() {
+		flags = trace.FlagsSampled
+	}
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: flags,
+	})
+}
+
+// padHex pads the identifier with leading zeros: trace identifiers created by
+// older agents are shorter than those used by OpenTelemetry.
+func padHex(id string, length int) string {
+	for len(id) < length && "" != id {
+		id = "0" + id
+	}
+	return id
+}
@@ -0,0 +1,381 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package nrotel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/newrelic/go-agent/v3/internal"
+	"github.com/newrelic/go-agent/v3/internal/integrationsupport"
+	"github.com/newrelic/go-agent/v3/newrelic"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func distributedTracingReplyFields(reply *internal.ConnectReply) {
+	reply.AccountID = "123"
+	reply.AppID = "456"
+	reply.PrimaryAppID = "456"
+	reply.TrustedAccountKey = "123"
+	reply.SetSampleEverything()
+}
+
+func newTestTracer() (integrationsupport.ExpectApp, trace.Tracer) {
+	app := integrationsupport.NewTestApp(distributedTracingReplyFields,
+		integrationsupport.DTEnabledCfgFn)
+	return app, NewTracerProvider(app.Application).Tracer("test")
+}
+
+func TestRootAndChildSpans(t *testing.T) {
+	app, tracer := newTestTracer()
+
+	ctx, root := tracer.Start(context.Background(), "root")
+	txn := newrelic.FromContext(ctx)
+	if nil == txn {
+		t.Fatal("transaction not added to context")
+	}
+	if !root.IsRecording() || !root.SpanContext().IsValid() {
+		t.Error(root.IsRecording(), root.SpanContext())
+	}
+	if root.SpanContext().TraceID().String() != txn.GetTraceMetadata().TraceID {
+		t.Error(root.SpanContext().TraceID(), txn.GetTraceMetadata().TraceID)
+	}
+
+	childCtx, child := tracer.Start(ctx, "child", trace.WithAttributes(attribute.String("color", "red")))
+	if newrelic.FromContext(childCtx) != txn {
+		t.Error("child span did not use the transaction")
+	}
+	if child.SpanContext().SpanID() == root.SpanContext().SpanID() ||
+		child.SpanContext().TraceID() != root.SpanContext().TraceID() {
+		t.Error(child.SpanContext(), root.SpanContext())
+	}
+	child.SetName("renamed")
+	child.SetAttributes(attribute.Int("size", 3))
+	child.End()
+	root.SetAttributes(attribute.Bool("cached", true))
+	root.End()
+	if root.IsRecording() {
+		t.Error("span recording after end")
+	}
+	// Ending a span twice has no effect.
+	root.End()
+
+	app.ExpectSpanEvents(t, []internal.WantEvent{
+		{
+			Intrinsics: map[string]interface{}{
+				"name":     "Custom/renamed",
+				"sampled":  true,
+				"category": "generic",
+				"parentId": internal.MatchAnything,
+			},
+			UserAttributes: map[string]interface{}{
+				"color": "red",
+				"size":  3,
+			},
+			AgentAttributes: map[string]interface{}{},
+		},
+		{
+			Intrinsics: map[string]interface{}{
+				"name":             "OtherTransaction/Go/root",
+				"transaction.name": "OtherTransaction/Go/root",
+				"sampled":          true,
+				"category":         "generic",
+				"nr.entryPoint":    true,
+			},
+			UserAttributes: map[string]interface{}{
+				"cached": true,
+			},
+			AgentAttributes: map[string]interface{}{},
+		},
+	})
+	app.ExpectTxnEvents(t, []internal.WantEvent{
+		{
+			Intrinsics: map[string]interface{}{
+				"name":     "OtherTransaction/Go/root",
+				"guid":     internal.MatchAnything,
+				"priority": internal.MatchAnything,
+				"sampled":  true,
+				"traceId":  internal.MatchAnything,
+			},
+			UserAttributes: map[string]interface{}{
+				"cached": true,
+			},
+		},
+	})
+}
+
+func TestSpanWithExistingTransaction(t *testing.T) {
+	app, tracer := newTestTracer()
+	txn := app.StartTransaction("txn")
+	ctx := newrelic.NewContext(context.Background(), txn)
+
+	_, s := tracer.Start(ctx, "child")
+	s.End()
+	txn.End()
+
+	app.ExpectMetricsPresent(t, []internal.WantMetric{
+		{Name: "OtherTransaction/Go/txn", Forced: true},
+		{Name: "Custom/child", Scope: "OtherTransaction/Go/txn"},
+	})
+}
+
+func TestNewRootSpan(t *testing.T) {
+	app, tracer := newTestTracer()
+	ctx, parent := tracer.Start(context.Background(), "parent")
+	_, s := tracer.Start(ctx, "other", trace.WithNewRoot())
+	s.End()
+	parent.End()
+
+	app.ExpectMetricsPresent(t, []internal.WantMetric{
+		{Name: "OtherTransaction/Go/parent", Forced: true},
+		{Name: "OtherTransaction/Go/other", Forced: true},
+	})
+}
+
+func TestDatastoreSpan(t *testing.T) {
+	app, tracer := newTestTracer()
+	ctx, root := tracer.Start(context.Background(), "root")
+	_, s := tracer.Start(ctx, "SELECT users", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.sql.table", "users"),
+		attribute.String("db.operation", "SELECT"),
+		attribute.String("db.statement", "SELECT * FROM users WHERE id = $1"),
+		attribute.String("server.address", "db.example.com"),
+		attribute.Int("server.port", 5432),
+		attribute.String("region", "west"),
+	))
+	s.End()
+	root.End()
+
+	app.ExpectMetricsPresent(t, []internal.WantMetric{
+		{Name: "Datastore/statement/Postgres/users/SELECT", Scope: "OtherTransaction/Go/root"},
+		{Name: "Datastore/instance/Postgres/db.example.com/5432"},
+	})
+	app.ExpectSpanEvents(t, []internal.WantEvent{
+		{
+			Intrinsics: map[string]interface{}{
+				"name":      "Datastore/statement/Postgres/users/SELECT",
+				"sampled":   true,
+				"category":  "datastore",
+				"component": "Postgres",
+				"span.kind": "client",
+				"parentId":  internal.MatchAnything,
+			},
+			UserAttributes: map[string]interface{}{
+				"region": "west",
+			},
+			AgentAttributes: map[string]interface{}{
+				"db.statement":  "SELECT * FROM users WHERE id = $1",
+				"db.collection": "users",
+				"peer.address":  "db.example.com:5432",
+				"peer.hostname": "db.example.com",
+			},
+		},
+		{
+			Intrinsics: map[string]interface{}{
+				"name":             "OtherTransaction/Go/root",
+				"transaction.name": "OtherTransaction/Go/root",
+				"sampled":          true,
+				"category":         "generic",
+				"nr.entryPoint":    true,
+			},
+			UserAttributes:  map[string]interface{}{},
+			AgentAttributes: map[string]interface{}{},
+		},
+	})
+}
+
+func TestExternalSpan(t *testing.T) {
+	app, tracer := newTestTracer()
+	ctx, root := tracer.Start(context.Background(), "root")
+	_, s := tracer.Start(ctx, "GET", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("http.request.method", "GET"),
+		attribute.String("url.full", "http://example.com/users?id=1"),
+	))
+	s.SetAttributes(attribute.Int("http.response.status_code", 404))
+	s.End()
+	root.End()
+
+	app.ExpectMetricsPresent(t, []internal.WantMetric{
+		{Name: "External/example.com/http/GET", Scope: "OtherTransaction/Go/root"},
+	})
+	app.ExpectSpanEvents(t, []internal.WantEvent{
+		{
+			Intrinsics: map[string]interface{}{
+				"name":      "External/example.com/http/GET",
+				"sampled":   true,
+				"category":  "http",
+				"component": "http",
+				"span.kind": "client",
+				"parentId":  internal.MatchAnything,
+			},
+			UserAttributes: map[string]interface{}{},
+			AgentAttributes: map[string]interface{}{
+				"http.url":        "http://example.com/users",
+				"http.method":     "GET",
+				"http.statusCode": 404,
+			},
+		},
+		{
+			Intrinsics: map[string]interface{}{
+				"name":             "OtherTransaction/Go/root",
+				"transaction.name": "OtherTransaction/Go/root",
+				"sampled":          true,
+				"category":         "generic",
+				"nr.entryPoint":    true,
+			},
+			UserAttributes:  map[string]interface{}{},
+			AgentAttributes: map[string]interface{}{},
+		},
+	})
+}
+
+func TestServerSpanWithRemoteParent(t *testing.T) {
+	app, tracer := newTestTracer()
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x0a, 0xf7, 0x65, 0x19, 0x16, 0xcd, 0x43, 0xdd, 0x84, 0x48, 0xeb, 0x21, 0x1c, 0x80, 0x31, 0x9c},
+		SpanID:     trace.SpanID{0xb7, 0xad, 0x6b, 0x71, 0x69, 0x20, 0x33, 0x31},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), parent)
+	_, s := tracer.Start(ctx, "GET /users", trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+		attribute.String("http.request.method", "GET"),
+		attribute.String("url.scheme", "http"),
+		attribute.String("server.address", "example.com"),
+		attribute.String("url.path", "/users"),
+	))
+	if s.SpanContext().TraceID() != parent.TraceID() {
+		t.Error(s.SpanContext().TraceID(), parent.TraceID())
+	}
+	s.SetAttributes(attribute.Int("http.response.status_code", 200))
+	s.End()
+
+	app.ExpectMetricsPresent(t, []internal.WantMetric{
+		{Name: "WebTransaction/Go/GET /users", Forced: true},
+		{Name: "Apdex/Go/GET /users"},
+		{Name: "Supportability/TraceContext/Accept/Success", Forced: true},
+	})
+	app.ExpectTxnEvents(t, []internal.WantEvent{
+		{
+			Intrinsics: map[string]interface{}{
+				"name":                 "WebTransaction/Go/GET /users",
+				"guid":                 internal.MatchAnything,
+				"priority":             internal.MatchAnything,
+				"sampled":              internal.MatchAnything,
+				"traceId":              "0af7651916cd43dd8448eb211c80319c",
+				"parentSpanId":         "b7ad6b7169203331",
+				"nr.apdexPerfZone":     internal.MatchAnything,
+				"parent.transportType": "HTTP",
+			},
+			AgentAttributes: map[string]interface{}{
+				"request.method":   "GET",
+				"request.uri":      "http://example.com/users",
+				"httpResponseCode": "200",
+				"http.statusCode":  200,
+			},
+		},
+	})
+}
+
+func TestSpanStatusError(t *testing.T) {
+	app, tracer := newTestTracer()
+	_, s := tracer.Start(context.Background(), "failing")
+	s.SetStatus(codes.Error, "request failed")
+	s.End()
+
+	_, s = tracer.Start(context.Background(), "recorded")
+	s.RecordError(errors.New("oops"))
+	s.SetStatus(codes.Error, "request failed")
+	s.End()
+
+	app.ExpectErrors(t, []internal.WantError{
+		{TxnName: "OtherTransaction/Go/failing", Msg: "request failed", Klass: spanStatusErrorClass},
+		{TxnName: "OtherTransaction/Go/recorded", Msg: "oops", Klass: "*errors.errorString"},
+	})
+}
+
+func TestChildSpanError(t *testing.T) {
+	app, tracer := newTestTracer()
+	ctx, root := tracer.Start(context.Background(), "root")
+	childCtx, child := tracer.Start(ctx, "child")
+	_, grandchild := tracer.Start(childCtx, "grandchild")
+	// The error is recorded on the child while the grandchild is open.
+	child.RecordError(errors.New("oops"))
+	grandchild.End()
+	_, failing := tracer.Start(ctx, "failing")
+	failing.SetStatus(codes.Error, "request failed")
+	failing.End()
+	child.End()
+	root.End()
+
+	// Errors of child spans do not make the transaction fail.
+	app.ExpectErrors(t, []internal.WantError{})
+	app.ExpectSpanEvents(t, []internal.WantEvent{
+		{
+			Intrinsics: map[string]interface{}{
+				"name":     "Custom/grandchild",
+				"sampled":  true,
+				"category": "generic",
+				"parentId": internal.MatchAnything,
+			},
+			UserAttributes:  map[string]interface{}{},
+			AgentAttributes: map[string]interface{}{},
+		},
+		{
+			Intrinsics: map[string]interface{}{
+				"name":     "Custom/failing",
+				"sampled":  true,
+				"category": "generic",
+				"parentId": internal.MatchAnything,
+			},
+			UserAttributes: map[string]interface{}{},
+			AgentAttributes: map[string]interface{}{
+				"error.class":   spanStatusErrorClass,
+				"error.message": "request failed",
+			},
+		},
+		{
+			Intrinsics: map[string]interface{}{
+				"name":     "Custom/child",
+				"sampled":  true,
+				"category": "generic",
+				"parentId": internal.MatchAnything,
+			},
+			UserAttributes: map[string]interface{}{},
+			AgentAttributes: map[string]interface{}{
+				"error.class":   "*errors.errorString",
+				"error.message": "oops",
+			},
+		},
+		{
+			Intrinsics: map[string]interface{}{
+				"name":             "OtherTransaction/Go/root",
+				"transaction.name": "OtherTransaction/Go/root",
+				"sampled":          true,
+				"category":         "generic",
+				"nr.entryPoint":    true,
+			},
+			UserAttributes:  map[string]interface{}{},
+			AgentAttributes: map[string]interface{}{},
+		},
+	})
+}
+
+func TestNilApplication(t *testing.T) {
+	tracer := NewTracerProvider(nil).Tracer("test")
+	ctx, s := tracer.Start(context.Background(), "root")
+	if nil != newrelic.FromContext(ctx) {
+		t.Error("transaction added to context")
+	}
+	if s.IsRecording() || s.SpanContext().IsValid() {
+		t.Error(s.IsRecording(), s.SpanContext())
+	}
+	s.AddEvent("event")
+	s.RecordError(errors.New("oops"))
+	s.End()
+}
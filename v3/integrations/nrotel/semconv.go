@@ -0,0 +1,289 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package nrotel
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/newrelic/go-agent/v3/newrelic"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Semantic convention attribute keys.  Where a key has been renamed, the
+// current key is listed before the deprecated one.  See
+// https://opentelemetry.io/docs/specs/semconv/
+var (
+	keysDBSystem     = []attribute.Key{"db.system"}
+	keysDBCollection = []attribute.Key{"db.collection.name", "db.sql.table", "db.mongodb.collection"}
+	keysDBOperation  = []attribute.Key{"db.operation.name", "db.operation"}
+	keysDBQuery      = []attribute.Key{"db.query.text", "db.statement"}
+	keysDBName       = []attribute.Key{"db.namespace", "db.name"}
+
+	keysServerAddress = []attribute.Key{"server.address", "net.peer.name"}
+	keysServerPort    = []attribute.Key{"server.port", "net.peer.port"}
+
+	keysHTTPMethod     = []attribute.Key{"http.request.method", "http.method"}
+	keysHTTPStatusCode = []attribute.Key{"http.response.status_code", "http.status_code"}
+	keysURLFull        = []attribute.Key{"url.full", "http.url"}
+	keysURLScheme      = []attribute.Key{"url.scheme", "http.scheme"}
+	keysURLPath        = []attribute.Key{"url.path"}
+	keysURLQuery       = []attribute.Key{"url.query"}
+	keysHTTPTarget     = []attribute.Key{"http.target"}
+	keysHTTPHost       = []attribute.Key{"http.host"}
+
+	keysMessagingSystem      = []attribute.Key{"messaging.system"}
+	keysMessagingDestination = []attribute.Key{"messaging.destination.name", "messaging.destination"}
+	keysMessagingTemporary   = []attribute.Key{"messaging.destination.temporary", "messaging.temp_destination"}
+
+	// mappedKeys contains the keys which are recorded as fields of
+	// transactions and segments rather than as custom attributes.
+	mappedKeys = func() map[attribute.Key]bool {
+		m := make(map[attribute.Key]bool)
+		for _, keys := range [][]attribute.Key{
+			keysDBSystem, keysDBCollection, keysDBOperation, keysDBQuery, keysDBName,
+			keysServerAddress, keysServerPort,
+			keysHTTPMethod, keysHTTPStatusCode, keysURLFull, keysURLScheme,
+			keysURLPath, keysURLQuery, keysHTTPTarget, keysHTTPHost,
+			keysMessagingSystem, keysMessagingDestination, keysMessagingTemporary,
+		} {
+			for _, key := range keys {
+				m[key] = true
+			}
+		}
+		return m
+	}()
+)
+
+// datastoreProducts maps the values of the "db.system" attribute to
+// DatastoreProducts.  Other values are used as the product unchanged.
+var datastoreProducts = map[string]newrelic.DatastoreProduct{
+	"cassandra":     newrelic.DatastoreCassandra,
+	"couchdb":       newrelic.DatastoreCouchDB,
+	"derby":         newrelic.DatastoreDerby,
+	"dynamodb":      newrelic.DatastoreDynamoDB,
+	"elasticsearch": newrelic.DatastoreElasticsearch,
+	"firebird":      newrelic.DatastoreFirebird,
+	"db2":           newrelic.DatastoreIBMDB2,
+	"informix":      newrelic.DatastoreInformix,
+	"memcached":     newrelic.DatastoreMemcached,
+	"mongodb":       newrelic.DatastoreMongoDB,
+	"mssql":         newrelic.DatastoreMSSQL,
+	"mysql":         newrelic.DatastoreMySQL,
+	"oracle":        newrelic.DatastoreOracle,
+	"postgresql":    newrelic.DatastorePostgres,
+	"redis":         newrelic.DatastoreRedis,
+	"sqlite":        newrelic.DatastoreSQLite,
+}
+
+func isMappedAttribute(key attribute.Key) bool {
+	return mappedKeys[key]
+}
+
+func lookupString(attrs map[attribute.Key]attribute.Value, keys []attribute.Key) string {
+	for _, key := range keys {
+		if val, ok := attrs[key]; ok {
+			return val.Emit()
+		}
+	}
+	return ""
+}
+
+func lookupInt(attrs map[attribute.Key]attribute.Value, keys []attribute.Key) (int, bool) {
+	for _, key := range keys {
+		val, ok := attrs[key]
+		if !ok {
+			continue
+		}
+		switch val.Type() {
+		case attribute.INT64:
+			return int(val.AsInt64()), true
+		case attribute.STRING:
+			if i, err := strconv.Atoi(val.AsString()); nil == err {
+				return i, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func lookupBool(attrs map[attribute.Key]attribute.Value, keys []attribute.Key) bool {
+	for _, key := range keys {
+		if val, ok := attrs[key]; ok && val.Type() == attribute.BOOL {
+			return val.AsBool()
+		}
+	}
+	return false
+}
+
+// attributeValue converts an attribute value into a type supported by
+// AddAttribute.  Slices are converted into strings.
+func attributeValue(val attribute.Value) interface{} {
+	switch val.Type() {
+	case attribute.BOOL:
+		return val.AsBool()
+	case attribute.INT64:
+		return val.AsInt64()
+	case attribute.FLOAT64:
+		return val.AsFloat64()
+	case attribute.STRING:
+		return val.AsString()
+	default:
+		return val.Emit()
+	}
+}
+
+func httpStatusCode(attrs map[attribute.Key]attribute.Value) (int, bool) {
+	return lookupInt(attrs, keysHTTPStatusCode)
+}
+
+// requestURL builds the URL of an HTTP request from either the full URL or
+// its components.
+func requestURL(attrs map[attribute.Key]attribute.Value) *url.URL {
+	if full := lookupString(attrs, keysURLFull); "" != full {
+		if u, err := url.Parse(full); nil == err {
+			return u
+		}
+	}
+	u := &url.URL{
+		Scheme: lookupString(attrs, keysURLScheme),
+		Host:   lookupString(attrs, keysServerAddress),
+	}
+	if "" == u.Host {
+		u.Host = lookupString(attrs, keysHTTPHost)
+	}
+	if port, ok := lookupInt(attrs, keysServerPort); ok && "" != u.Host {
+		u.Host = fmt.Sprintf("%s:%d", u.Host, port)
+	}
+	if target := lookupString(attrs, keysHTTPTarget); "" != target {
+		if t, err := url.ParseRequestURI(target); nil == err {
+			u.Path = t.Path
+			u.RawQuery = t.RawQuery
+		}
+	} else {
+		u.Path = lookupString(attrs, keysURLPath)
+		u.RawQuery = lookupString(attrs, keysURLQuery)
+	}
+	if "" == u.Host && "" == u.Path {
+		return nil
+	}
+	return u
+}
+
+// webRequest returns the request information of a server span.
+func webRequest(attrs map[attribute.Key]attribute.Value) (newrelic.WebRequest, bool) {
+	method := lookupString(attrs, keysHTTPMethod)
+	if "" == method {
+		return newrelic.WebRequest{}, false
+	}
+	r := newrelic.WebRequest{
+		Method:    method,
+		URL:       requestURL(attrs),
+		Transport: newrelic.TransportHTTP,
+	}
+	if nil != r.URL {
+		r.Host = r.URL.Host
+		if strings.EqualFold(r.URL.Scheme, "https") {
+			r.Transport = newrelic.TransportHTTPS
+		}
+	}
+	return r, true
+}
+
+// messageRequest returns the message information of a consumer span.
+func messageRequest(attrs map[attribute.Key]attribute.Value) (newrelic.MessageRequest, bool) {
+	system := lookupString(attrs, keysMessagingSystem)
+	if "" == system {
+		return newrelic.MessageRequest{}, false
+	}
+	return newrelic.MessageRequest{
+		Library:              system,
+		DestinationName:      lookupString(attrs, keysMessagingDestination),
+		DestinationTemporary: lookupBool(attrs, keysMessagingTemporary),
+		Transport:            newrelic.TransportQueue,
+	}, true
+}
+
+// traceContextHeaders returns the W3C trace context headers of a remote
+// span, which are accepted as the inbound distributed tracing payload.
+func traceContextHeaders(sc trace.SpanContext) http.Header {
+	hdrs := http.Header{}
+	hdrs.Set(newrelic.DistributedTraceW3CTraceParentHeader, fmt.Sprintf("00-%s-%s-%s",
+		sc.TraceID(), sc.SpanID(), sc.TraceFlags()))
+	if ts := sc.TraceState().String(); "" != ts {
+		hdrs.Set(newrelic.DistributedTraceW3CTraceStateHeader, ts)
+	}
+	return hdrs
+}
+
+// segment is implemented by all segment types.
+type segment interface {
+	AddAttribute(key string, val interface{})
+	End()
+}
+
+// newSegment returns the segment which records a child span.  The type of
+// the segment depends on the span's kind and attributes.
+func newSegment(start newrelic.SegmentStartTime, name string, kind trace.SpanKind, attrs map[attribute.Key]attribute.Value) segment {
+	if system := lookupString(attrs, keysDBSystem); "" != system {
+		product, ok := datastoreProducts[system]
+		if !ok {
+			product = newrelic.DatastoreProduct(system)
+		}
+		s := &newrelic.DatastoreSegment{
+			StartTime:          start,
+			Product:            product,
+			Collection:         lookupString(attrs, keysDBCollection),
+			Operation:          lookupString(attrs, keysDBOperation),
+			ParameterizedQuery: lookupString(attrs, keysDBQuery),
+			Host:               lookupString(attrs, keysServerAddress),
+			DatabaseName:       lookupString(attrs, keysDBName),
+		}
+		if port, ok := lookupInt(attrs, keysServerPort); ok {
+			s.PortPathOrID = strconv.Itoa(port)
+		}
+		return s
+	}
+
+	if method := lookupString(attrs, keysHTTPMethod); "" != method && kind == trace.SpanKindClient {
+		s := &newrelic.ExternalSegment{
+			StartTime: start,
+			Procedure: method,
+		}
+		if u := requestURL(attrs); nil != u {
+			s.URL = u.String()
+		}
+		if code, ok := httpStatusCode(attrs); ok {
+			s.SetStatusCode(code)
+		}
+		return s
+	}
+
+	if system := lookupString(attrs, keysMessagingSystem); "" != system {
+		switch kind {
+		case trace.SpanKindProducer:
+			return &newrelic.MessageProducerSegment{
+				StartTime:            start,
+				Library:              system,
+				DestinationType:      newrelic.MessageQueue,
+				DestinationName:      lookupString(attrs, keysMessagingDestination),
+				DestinationTemporary: lookupBool(attrs, keysMessagingTemporary),
+			}
+		case trace.SpanKindConsumer:
+			return &newrelic.MessageConsumerSegment{
+				StartTime:            start,
+				Library:              system,
+				DestinationType:      newrelic.MessageQueue,
+				DestinationName:      lookupString(attrs, keysMessagingDestination),
+				DestinationTemporary: lookupBool(attrs, keysMessagingTemporary),
+			}
+		}
+	}
+
+	return &newrelic.Segment{StartTime: start, Name: name}
+}
@@ -73,8 +73,9 @@ var (
 		BaseSegment: newrelic.DatastoreSegment{
 			Product: newrelic.DatastorePostgres,
 		},
-		ParseQuery: sqlparse.ParseQuery,
-		ParseDSN:   parseDSN(os.Getenv),
+		ParseQuery:   sqlparse.ParseQuery,
+		ExplainQuery: sqlparse.ExplainQuery("EXPLAIN "),
+		ParseDSN:     parseDSN(os.Getenv),
 	}
 )
 
@@ -6,6 +6,5 @@ go 1.9
 
 require (
 	github.com/mattn/go-sqlite3 v1.0.0
-	// v3.3.0 includes the new location of ParseQuery
-	github.com/newrelic/go-agent/v3 v3.3.0
+	github.com/newrelic/go-agent/v3 v3.10.0
 )
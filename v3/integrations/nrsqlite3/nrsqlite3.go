@@ -88,8 +88,9 @@ var (
 		BaseSegment: newrelic.DatastoreSegment{
 			Product: newrelic.DatastoreSQLite,
 		},
-		ParseQuery: sqlparse.ParseQuery,
-		ParseDSN:   parseDSN,
+		ParseQuery:   sqlparse.ParseQuery,
+		ExplainQuery: sqlparse.ExplainQuery("EXPLAIN QUERY PLAN "),
+		ParseDSN:     parseDSN,
 	}
 )
 
@@ -5,8 +5,6 @@ package nrstan
 
 import (
 	stan "github.com/nats-io/stan.go"
-	"github.com/newrelic/go-agent/v3/internal"
-	"github.com/newrelic/go-agent/v3/internal/integrationsupport"
 	newrelic "github.com/newrelic/go-agent/v3/newrelic"
 )
 
@@ -19,17 +17,16 @@ func StreamingSubWrapper(app *newrelic.Application, f func(msg *stan.Msg)) func(
 		return f
 	}
 	return func(msg *stan.Msg) {
-		namer := internal.MessageMetricKey{
-			Library:         "STAN",
-			DestinationType: string(newrelic.MessageTopic),
-			DestinationName: msg.MsgProto.Subject,
-			Consumer:        true,
-		}
-		txn := app.StartTransaction(namer.Name())
+		txn := app.StartTransaction(msg.MsgProto.Subject)
 		defer txn.End()
 
-		integrationsupport.AddAgentAttribute(txn, newrelic.AttributeMessageRoutingKey, msg.MsgProto.Subject, nil)
-		integrationsupport.AddAgentAttribute(txn, newrelic.AttributeMessageReplyTo, msg.MsgProto.Reply, nil)
+		txn.SetMessageRequest(newrelic.MessageRequest{
+			Library:         "STAN",
+			DestinationType: newrelic.MessageTopic,
+			DestinationName: msg.MsgProto.Subject,
+			RoutingKey:      msg.MsgProto.Subject,
+			ReplyTo:         msg.MsgProto.Reply,
+		})
 
 		f(msg)
 	}
@@ -0,0 +1,103 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package nrzap
+
+import (
+	"fmt"
+	"strings"
+
+	newrelic "github.com/newrelic/go-agent/v3/newrelic"
+	"go.uber.org/zap/zapcore"
+)
+
+// WrapCore returns a zapcore.Core which writes entries to core and also
+// records them with New Relic using Application.RecordLog.  Entries are
+// recorded when they are enabled by core.
+//
+//	logger := zap.New(nrzap.WrapCore(core, app))
+//
+// Log forwarding must be enabled using
+// newrelic.ConfigAppLogForwardingEnabled for entries to be sent to New Relic.
+func WrapCore(core zapcore.Core, app *newrelic.Application) zapcore.Core {
+	return zapcore.NewTee(core, &recordingCore{
+		LevelEnabler: core,
+		app:          app,
+	})
+}
+
+// WrapTransactionCore is like WrapCore, but records entries using
+// Transaction.RecordLog so that they are linked to the transaction's trace.
+// Use it to create a logger for the duration of a transaction:
+//
+//	txnLogger := zap.New(nrzap.WrapTransactionCore(core, txn))
+func WrapTransactionCore(core zapcore.Core, txn *newrelic.Transaction) zapcore.Core {
+	return zapcore.NewTee(core, &recordingCore{
+		LevelEnabler: core,
+		txn:          txn,
+	})
+}
+
+// recordingCore is a zapcore.Core which records entries with New Relic.
+type recordingCore struct {
+	zapcore.LevelEnabler
+	app    *newrelic.Application
+	txn    *newrelic.Transaction
+	fields []zapcore.Field
+}
+
+func (c *recordingCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.fields = make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	clone.fields = append(clone.fields, c.fields...)
+	clone.fields = append(clone.fields, fields...)
+	return &clone
+}
+
+func (c *recordingCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *recordingCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	data := newrelic.LogData{
+		Timestamp:  ent.Time,
+		Severity:   strings.ToUpper(ent.Level.String()),
+		Message:    ent.Message,
+		Attributes: attributesFromFields(c.fields, fields),
+	}
+	if nil != c.txn {
+		return c.txn.RecordLog(data)
+	}
+	return c.app.RecordLog(data)
+}
+
+func (c *recordingCore) Sync() error { return nil }
+
+// attributesFromFields converts zap fields into log attributes.  Values which
+// are not valid attribute types, such as arrays and objects, are converted to
+// strings.
+func attributesFromFields(fieldSets ...[]zapcore.Field) map[string]interface{} {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, fields := range fieldSets {
+		for _, f := range fields {
+			f.AddTo(enc)
+		}
+	}
+	if 0 == len(enc.Fields) {
+		return nil
+	}
+	attrs := make(map[string]interface{}, len(enc.Fields))
+	for key, val := range enc.Fields {
+		switch v := val.(type) {
+		case string, bool, int, int8, int16, int32, int64, uint, uint8,
+			uint16, uint32, uint64, float32, float64:
+			attrs[key] = v
+		default:
+			attrs[key] = fmt.Sprint(v)
+		}
+	}
+	return attrs
+}
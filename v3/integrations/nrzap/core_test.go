@@ -0,0 +1,76 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package nrzap
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/newrelic/go-agent/v3/internal"
+	"github.com/newrelic/go-agent/v3/internal/integrationsupport"
+	newrelic "github.com/newrelic/go-agent/v3/newrelic"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func enableLogForwarding(cfg *newrelic.Config) {
+	cfg.ApplicationLogging.Forwarding.Enabled = true
+}
+
+func newTestCore(buf *bytes.Buffer) zapcore.Core {
+	return zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(buf),
+		zap.InfoLevel,
+	)
+}
+
+func TestWrapCore(t *testing.T) {
+	app := integrationsupport.NewTestApp(nil, enableLogForwarding)
+	buf := &bytes.Buffer{}
+	logger := zap.New(WrapCore(newTestCore(buf), app.Application)).
+		With(zap.String("color", "gray"))
+
+	logger.Warn("elephant",
+		zap.Int("legs", 4),
+		zap.Error(errors.New("oops")),
+		zap.Strings("tusks", []string{"left", "right"}),
+	)
+	logger.Debug("mouse")
+
+	if s := buf.String(); !strings.Contains(s, "elephant") || strings.Contains(s, "mouse") {
+		t.Error(s)
+	}
+	app.ExpectLogEvents(t, []internal.WantLog{{
+		Severity: "WARN",
+		Message:  "elephant",
+		Attributes: map[string]interface{}{
+			"color": "gray",
+			"legs":  4,
+			"error": "oops",
+			"tusks": "[left right]",
+		},
+	}})
+	app.ExpectMetrics(t, []internal.WantMetric{
+		{Name: "Logging/lines", Forced: true, Data: []float64{1, 0, 0, 0, 0, 0}},
+		{Name: "Logging/lines/WARN", Forced: true, Data: []float64{1, 0, 0, 0, 0, 0}},
+	})
+}
+
+func TestWrapTransactionCore(t *testing.T) {
+	app := integrationsupport.NewTestApp(nil, enableLogForwarding)
+	txn := app.StartTransaction("hello")
+	logger := zap.New(WrapTransactionCore(newTestCore(&bytes.Buffer{}), txn))
+
+	logger.Info("tiger")
+	app.ExpectLogEvents(t, []internal.WantLog{})
+	txn.End()
+
+	app.ExpectLogEvents(t, []internal.WantLog{{
+		Severity: "INFO",
+		Message:  "tiger",
+	}})
+}
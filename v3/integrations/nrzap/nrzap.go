@@ -4,6 +4,10 @@
 // Package nrzap supports https://github.com/uber-go/zap
 //
 // Wrap your zap Logger using nrzap.Transform to send agent log messages to zap.
+//
+// To record your application's zap entries with New Relic, wrap your
+// zapcore.Core using nrzap.WrapCore, or nrzap.WrapTransactionCore to link the
+// entries to a transaction.
 package nrzap
 
 import (
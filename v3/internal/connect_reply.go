@@ -120,6 +120,7 @@ type EventHarvestConfig struct {
 		CustomEvents *uint `json:"custom_event_data,omitempty"`
 		ErrorEvents  *uint `json:"error_event_data,omitempty"`
 		SpanEvents   *uint `json:"span_event_data,omitempty"`
+		LogEvents    *uint `json:"log_event_data,omitempty"`
 	} `json:"harvest_limits"`
 }
 
@@ -202,12 +203,30 @@ func CalculateApdexThreshold(c *ConnectReply, txnName string) time.Duration {
 const (
 	webMetricPrefix        = "WebTransaction/Go"
 	backgroundMetricPrefix = "OtherTransaction/Go"
+	messageMetricPrefix    = "OtherTransaction"
 )
 
 // CreateFullTxnName uses collector rules and the appropriate metric prefix to
 // construct the full transaction metric name from the name given by the
 // consumer.
 func CreateFullTxnName(input string, reply *ConnectReply, isWeb bool) string {
+	prefix := backgroundMetricPrefix
+	if isWeb {
+		prefix = webMetricPrefix
+	}
+	return createFullTxnName(input, reply, prefix)
+}
+
+// CreateFullMessageTxnName uses collector rules to construct the full
+// transaction metric name of a message consumer transaction.  The input is
+// expected to be the name returned by MessageMetricKey.Name, eg.
+// "Message/RabbitMQ/Queue/Named/MyQueue", resulting in
+// "OtherTransaction/Message/RabbitMQ/Queue/Named/MyQueue".
+func CreateFullMessageTxnName(input string, reply *ConnectReply) string {
+	return createFullTxnName(input, reply, messageMetricPrefix)
+}
+
+func createFullTxnName(input string, reply *ConnectReply, prefix string) string {
 	var afterURLRules string
 	if "" != input {
 		afterURLRules = reply.URLRules.Apply(input)
@@ -216,11 +235,6 @@ func CreateFullTxnName(input string, reply *ConnectReply, isWeb bool) string {
 		}
 	}
 
-	prefix := backgroundMetricPrefix
-	if isWeb {
-		prefix = webMetricPrefix
-	}
-
 	var beforeNameRules string
 	if strings.HasPrefix(afterURLRules, "/") {
 		beforeNameRules = prefix + afterURLRules
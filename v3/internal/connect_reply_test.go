@@ -65,6 +65,39 @@ func TestCreateFullTxnNameTxnRulesIgnore(t *testing.T) {
 	}
 }
 
+func TestCreateFullMessageTxnName(t *testing.T) {
+	emptyReply := ConnectReplyDefaults()
+
+	tcs := []struct {
+		input  string
+		expect string
+	}{
+		{"Message/RabbitMQ/Queue/Named/myQueue", "OtherTransaction/Message/RabbitMQ/Queue/Named/myQueue"},
+		{"Message/Kafka/Topic/Temp", "OtherTransaction/Message/Kafka/Topic/Temp"},
+	}
+
+	for _, tc := range tcs {
+		if out := CreateFullMessageTxnName(tc.input, emptyReply); out != tc.expect {
+			t.Error(tc.input, out, tc.expect)
+		}
+	}
+}
+
+func TestCreateFullMessageTxnNameTxnRulesIgnore(t *testing.T) {
+	js := `[{
+		"match_expression":"^OtherTransaction/Message/RabbitMQ/.*$",
+		"ignore":true
+	}]`
+	reply := ConnectReplyDefaults()
+	err := json.Unmarshal([]byte(js), &reply.TxnNameRules)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if out := CreateFullMessageTxnName("Message/RabbitMQ/Queue/Named/myQueue", reply); out != "" {
+		t.Error(out)
+	}
+}
+
 func TestCalculateApdexThreshold(t *testing.T) {
 	reply := ConnectReplyDefaults()
 	threshold := CalculateApdexThreshold(reply, "WebTransaction/Go/hello")
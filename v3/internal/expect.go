@@ -45,6 +45,17 @@ type WantEvent struct {
 	AgentAttributes map[string]interface{}
 }
 
+// WantLog is a log event expectation.  Timestamp is compared if it is
+// non-zero.  Use MatchAnyString to accept any TraceID or SpanID.
+type WantLog struct {
+	Severity   string
+	Message    string
+	SpanID     string
+	TraceID    string
+	Timestamp  int64
+	Attributes map[string]interface{}
+}
+
 // WantTxnTrace is a transaction trace expectation.
 type WantTxnTrace struct {
 	// DurationMillis is compared if non-nil.
@@ -123,4 +134,6 @@ type Expect interface {
 	ExpectSlowQueries(t Validator, want []WantSlowQuery)
 
 	ExpectSpanEvents(t Validator, want []WantEvent)
+
+	ExpectLogEvents(t Validator, want []WantLog)
 }
@@ -23,4 +23,7 @@ const (
 	// MaxErrorEvents is the maximum number of Error Events that can be captured
 	// per 60-second harvest cycle
 	MaxErrorEvents = 100
+	// MaxLogEvents is the maximum number of Log Events that can be captured
+	// per 60-second harvest cycle
+	MaxLogEvents = 10 * 1000
 )
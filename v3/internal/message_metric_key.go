@@ -12,6 +12,16 @@ type MessageMetricKey struct {
 	DestinationTemp bool
 }
 
+func (key MessageMetricKey) destination() string {
+	if key.DestinationTemp {
+		return "Temp"
+	}
+	if key.DestinationName == "" {
+		return "Named/Unknown"
+	}
+	return "Named/" + key.DestinationName
+}
+
 // Name returns the metric name value for this MessageMetricKey to be used for
 // scoped and unscoped metrics.
 //
@@ -23,21 +33,27 @@ type MessageMetricKey struct {
 // OtherTransaction/Message/{Library}/{DestinationType}/Named/{Destination Name}
 // OtherTransaction/Message/{Library}/{DestinationType}/Temp
 func (key MessageMetricKey) Name() string {
-	var destination string
-	if key.DestinationTemp {
-		destination = "Temp"
-	} else if key.DestinationName == "" {
-		destination = "Named/Unknown"
-	} else {
-		destination = "Named/" + key.DestinationName
-	}
-
 	if key.Consumer {
 		return "Message/" + key.Library +
 			"/" + key.DestinationType +
-			"/" + destination
+			"/" + key.destination()
+	}
+	return key.SegmentName()
+}
+
+// SegmentName returns the metric name value for message producer and consumer
+// segments:
+//
+// MessageBroker/{Library}/{Destination Type}/Produce/Named/{Destination Name}
+// MessageBroker/{Library}/{Destination Type}/Consume/Named/{Destination Name}
+// MessageBroker/{Library}/{Destination Type}/{Action}/Temp
+func (key MessageMetricKey) SegmentName() string {
+	action := "Produce"
+	if key.Consumer {
+		action = "Consume"
 	}
 	return "MessageBroker/" + key.Library +
 		"/" + key.DestinationType +
-		"/Produce/" + destination
+		"/" + action +
+		"/" + key.destination()
 }
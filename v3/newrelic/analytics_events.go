@@ -92,6 +92,15 @@ func (events *analyticsEvents) Merge(other *analyticsEvents) {
 }
 
 func (events *analyticsEvents) CollectorJSON(agentRunID string) ([]byte, error) {
+	return events.collectorJSON(agentRunID, func(buf *bytes.Buffer, e analyticsEvent) {
+		e.WriteJSON(buf)
+	})
+}
+
+// collectorJSON creates the collector JSON using writeEvent to write each
+// event, which allows a single event of the reservoir to be written as several
+// events of the payload.
+func (events *analyticsEvents) collectorJSON(agentRunID string, writeEvent func(*bytes.Buffer, analyticsEvent)) ([]byte, error) {
 	if 0 == len(events.events) {
 		return nil, nil
 	}
@@ -115,7 +124,7 @@ func (events *analyticsEvents) CollectorJSON(agentRunID string) ([]byte, error)
 		if i > 0 {
 			buf.WriteByte(',')
 		}
-		e.WriteJSON(buf)
+		writeEvent(buf, e)
 	}
 	buf.WriteByte(']')
 	buf.WriteByte(']')
@@ -30,6 +30,9 @@ type appRun struct {
 	// exists here since it is specific to a set of rules and is shared
 	// between transactions.
 	rulesCache *rulesCache
+	// messageRulesCache is the rulesCache used for message consumer
+	// transaction names, which have a different prefix.
+	messageRulesCache *rulesCache
 
 	// harvestConfig contains configuration related to event limits and
 	// flexible harvest periods.  This field is created once at appRun
@@ -43,10 +46,11 @@ const (
 
 func newAppRun(config config, reply *internal.ConnectReply) *appRun {
 	run := &appRun{
-		Reply:           reply,
-		AttributeConfig: createAttributeConfig(config, reply.SecurityPolicies.AttributesInclude.Enabled()),
-		Config:          config,
-		rulesCache:      newRulesCache(txnNameCacheLimit),
+		Reply:             reply,
+		AttributeConfig:   createAttributeConfig(config, reply.SecurityPolicies.AttributesInclude.Enabled()),
+		Config:            config,
+		rulesCache:        newRulesCache(txnNameCacheLimit),
+		messageRulesCache: newRulesCache(txnNameCacheLimit),
 	}
 
 	// Overwrite local settings with any server-side-config settings
@@ -122,6 +126,9 @@ func newAppRun(config config, reply *internal.ConnectReply) *appRun {
 		MaxCustomEvents: run.MaxCustomEvents(),
 		MaxErrorEvents:  run.MaxErrorEvents(),
 		MaxSpanEvents:   run.MaxSpanEvents(),
+		MaxLogEvents:    run.MaxLogEvents(),
+
+		LogCommonAttributes: logCommonAttributes(run),
 	}
 
 	return run
@@ -165,6 +172,24 @@ func newServerlessConnectReply(config config) *internal.ConnectReply {
 	return reply
 }
 
+// newOTLPConnectReply creates the reply used in place of a connect response
+// when the OTLP exporter is enabled.  The default sampling target is kept so
+// that the adaptive sampler behaves as it does when connected.
+func newOTLPConnectReply() *internal.ConnectReply {
+	reply := internal.ConnectReplyDefaults()
+	reply.RunID = otlpAgentRunID
+	return reply
+}
+
+func (run *appRun) responseCodeIsExpected(code int) bool {
+	for _, expectedCode := range run.Config.ErrorCollector.ExpectedStatusCodes {
+		if code == expectedCode {
+			return true
+		}
+	}
+	return false
+}
+
 func (run *appRun) responseCodeIsError(code int) bool {
 	// Response codes below 100 are allowed to be errors to support gRPC.
 	if code < 400 && code >= 100 {
@@ -189,6 +214,7 @@ func (run *appRun) ptrTxnEvents() *uint    { return run.Reply.EventData.Limits.T
 func (run *appRun) ptrCustomEvents() *uint { return run.Reply.EventData.Limits.CustomEvents }
 func (run *appRun) ptrErrorEvents() *uint  { return run.Reply.EventData.Limits.ErrorEvents }
 func (run *appRun) ptrSpanEvents() *uint   { return run.Reply.EventData.Limits.SpanEvents }
+func (run *appRun) ptrLogEvents() *uint    { return run.Reply.EventData.Limits.LogEvents }
 
 func (run *appRun) MaxTxnEvents() int { return run.limit(run.Config.maxTxnEvents(), run.ptrTxnEvents) }
 func (run *appRun) MaxCustomEvents() int {
@@ -198,6 +224,13 @@ func (run *appRun) MaxErrorEvents() int {
 	return run.limit(internal.MaxErrorEvents, run.ptrErrorEvents)
 }
 func (run *appRun) MaxSpanEvents() int { return run.limit(maxSpanEvents, run.ptrSpanEvents) }
+func (run *appRun) MaxLogEvents() int {
+	// Avoid allocating a reservoir for log events which are never sent.
+	if !run.Config.logForwardingEnabled() {
+		return 0
+	}
+	return run.limit(run.Config.maxLogEvents(), run.ptrLogEvents)
+}
 
 func (run *appRun) limit(dflt int, field func() *uint) int {
 	if nil != field() {
@@ -215,6 +248,7 @@ func (run *appRun) ReportPeriods() map[harvestTypes]time.Duration {
 		harvestCustomEvents: run.ptrCustomEvents,
 		harvestErrorEvents:  run.ptrErrorEvents,
 		harvestSpanEvents:   run.ptrSpanEvents,
+		harvestLogEvents:    run.ptrLogEvents,
 	} {
 		if nil != run && fn() != nil {
 			configurable |= tp
@@ -242,3 +276,16 @@ func (run *appRun) createTransactionName(input string, isWeb bool) string {
 	}
 	return name
 }
+
+func (run *appRun) createMessageTransactionName(input string) string {
+	// Message transactions are never web transactions, so the isWeb field
+	// of the rules cache key is always false.
+	if name := run.messageRulesCache.find(input, false); "" != name {
+		return name
+	}
+	name := internal.CreateFullMessageTxnName(input, run.Reply)
+	if "" != name {
+		run.messageRulesCache.set(input, false, name)
+	}
+	return name
+}
@@ -145,7 +145,8 @@ func TestEventHarvestFieldsAllPopulated(t *testing.T) {
 					"analytic_event_data": 1,
 					"custom_event_data": 2,
 					"span_event_data": 3,
-					"error_event_data": 4
+					"error_event_data": 4,
+					"log_event_data": 5
 				}
 			}
 		}}`), internal.PreconnectReply{})
@@ -275,6 +276,37 @@ func TestEventHarvestFieldsOnlyCustomEvents(t *testing.T) {
 	})
 }
 
+func TestEventHarvestFieldsLogEvents(t *testing.T) {
+	reply, err := internal.UnmarshalConnectReply([]byte(`{"return_value":{
+			"event_harvest_config": {
+				"report_period_ms": 5000,
+				"harvest_limits": { "log_event_data": 3 }
+			}}}`), internal.PreconnectReply{})
+	if nil != err {
+		t.Fatal(err)
+	}
+	cfg := defaultConfig()
+	cfg.ApplicationLogging.Forwarding.Enabled = true
+	run := newAppRun(config{Config: cfg}, reply)
+	assertHarvestConfig(t, run.harvestConfig, expectHarvestConfig{
+		maxTxnEvents:    internal.MaxTxnEvents,
+		maxCustomEvents: internal.MaxCustomEvents,
+		maxErrorEvents:  internal.MaxErrorEvents,
+		maxSpanEvents:   maxSpanEvents,
+		maxLogEvents:    3,
+		periods: map[harvestTypes]time.Duration{
+			harvestTypesAll ^ harvestLogEvents: 60 * time.Second,
+			harvestLogEvents:                   5 * time.Second,
+		},
+	})
+
+	// Log events are not stored when forwarding is disabled.
+	run = newAppRun(config{Config: defaultConfig()}, reply)
+	if max := run.harvestConfig.MaxLogEvents; max != 0 {
+		t.Error(max)
+	}
+}
+
 func TestConfigurableHarvestNegativeReportPeriod(t *testing.T) {
 	h, err := internal.UnmarshalConnectReply([]byte(`{"return_value":{
 			"event_harvest_config": {
@@ -366,6 +398,7 @@ type expectHarvestConfig struct {
 	maxCustomEvents int
 	maxErrorEvents  int
 	maxSpanEvents   int
+	maxLogEvents    int
 	periods         map[harvestTypes]time.Duration
 }
 
@@ -387,6 +420,9 @@ func assertHarvestConfig(t testing.TB, hc harvestConfig, expect expectHarvestCon
 	if max := hc.MaxErrorEvents; max != expect.maxErrorEvents {
 		t.Error(max, expect.maxErrorEvents)
 	}
+	if max := hc.MaxLogEvents; max != expect.maxLogEvents {
+		t.Error(max, expect.maxLogEvents)
+	}
 	if periods := hc.ReportPeriods; !reflect.DeepEqual(periods, expect.periods) {
 		t.Error(periods, expect.periods)
 	}
@@ -74,6 +74,58 @@ func (app *Application) RecordCustomMetric(name string, value float64) {
 	}
 }
 
+// RecordMetric records a value of a dimensional metric.  Unlike
+// RecordCustomMetric, each distinct set of attributes creates its own time
+// series of the metric, so attributes can be used to break a metric down by
+// dimensions such as region or customer tier without encoding them into the
+// metric name.  Attribute values must be numbers, strings, or booleans.
+// Values are aggregated according to the metric type during each harvest
+// period and sent to New Relic as a dimensional metric payload.
+//
+// The number of time series that may be recorded in each harvest period is
+// limited to 10000, and to 1000 per metric name.  Values beyond these limits
+// are dropped.  Attributes are not recorded in high security mode.
+// Dimensional metrics are not currently supported in serverless mode.
+//
+//	app.RecordMetric(newrelic.MetricCount, "Orders", 1, map[string]interface{}{
+//		"region": "us-east",
+//	})
+func (app *Application) RecordMetric(metricType MetricType, name string, value float64, attributes map[string]interface{}) {
+	if nil == app {
+		return
+	}
+	if nil == app.app {
+		return
+	}
+	err := app.app.RecordMetric(metricType, name, value, attributes)
+	if err != nil {
+		app.app.Error("unable to record metric", map[string]interface{}{
+			"metric-name": name,
+			"reason":      err.Error(),
+		})
+	}
+}
+
+// RecordLog records a log record which is not part of a Transaction.  The
+// record is counted by the Logging/lines metrics, and is sent to New Relic as
+// a log event if Config.ApplicationLogging.Forwarding.Enabled is true.  Use
+// Transaction.RecordLog for records logged during a transaction, so that
+// they are linked to its trace.  Nothing is recorded if
+// Config.ApplicationLogging.Enabled is false.
+//
+// An error is returned if the record's attributes are invalid.  Unlike the
+// other methods, RecordLog does not log its errors, so that it may be called
+// by a logging integration while the logger used by the agent is locked.
+func (app *Application) RecordLog(data LogData) error {
+	if nil == app {
+		return nil
+	}
+	if nil == app.app {
+		return nil
+	}
+	return app.app.RecordLog(data)
+}
+
 // WaitForConnection blocks until the application is connected, is
 // incapable of being connected, or the timeout has been reached.  This
 // method is useful for short-lived processes since the application will
@@ -87,8 +87,24 @@ const (
 //		newrelic.AttributeMessageCorrelationID,
 //	)
 //
-// When not using a supported instrumentation package, you can add these
-// attributes manually using the Transaction.AddAttribute
+// When not using a supported instrumentation package, use
+// Transaction.SetMessageRequest
+// (https://godoc.org/github.com/newrelic/go-agent/v3/newrelic#Transaction.SetMessageRequest)
+// to name the transaction and add these attributes as agent attributes:
+//
+//	txn := app.StartTransaction("consume")
+//	txn.SetMessageRequest(newrelic.MessageRequest{
+//		Library:         "RabbitMQ",
+//		DestinationType: newrelic.MessageExchange,
+//		DestinationName: "MyExchange",
+//		RoutingKey:      "myRoutingKey",
+//		QueueName:       "myQueueName",
+//	})
+//	// ... consume a message ...
+//	txn.End()
+//
+// Alternatively, you can add these attributes manually using the
+// Transaction.AddAttribute
 // (https://godoc.org/github.com/newrelic/go-agent/v3/newrelic#Transaction.AddAttribute)
 // API.  In this case, these attributes will be included on all destintations
 // by default.
@@ -117,6 +133,23 @@ const (
 	AttributeMessageCorrelationID = "message.correlationId"
 )
 
+// Attributes of traced errors.  These attributes describe a single error and
+// only appear on traced errors.
+//
+// To disable the capture of one of these attributes, "error.chain" for
+// example, modify your Config like this:
+//
+//	cfg.ErrorCollector.Attributes.Exclude = append(cfg.ErrorCollector.Attributes.Exclude,
+//		newrelic.AttributeErrorChain)
+const (
+	// The errors wrapped by the noticed error, as a JSON array of objects
+	// with the class, message and stack trace of each error.
+	AttributeErrorChain = "error.chain"
+	// The stack traces of all goroutines when the error is a panic recorded
+	// with PanicPolicyGoroutineDump, truncated to 64 KiB.
+	AttributeErrorGoroutines = "error.goroutines"
+)
+
 // Attributes destined for Span Events. These attributes appear only on Span
 // Events and are not available to transaction events, error events, or traced
 // errors.
@@ -138,6 +171,7 @@ const (
 	SpanAttributeAWSRegion               = "aws.region"
 	SpanAttributeErrorClass              = "error.class"
 	SpanAttributeErrorMessage            = "error.message"
+	SpanAttributeErrorExpected           = "error.expected"
 	SpanAttributeParentType              = "parent.type"
 	SpanAttributeParentApp               = "parent.app"
 	SpanAttributeParentAccount           = "parent.account"
@@ -52,6 +52,8 @@ var (
 		AttributeMessageExchangeType:        destNone,
 		AttributeMessageReplyTo:             destNone,
 		AttributeMessageCorrelationID:       destNone,
+		AttributeErrorChain:                 destError,
+		AttributeErrorGoroutines:            destError,
 
 		// Span specific attributes
 		SpanAttributeDBStatement:             usualDests,
@@ -66,6 +68,7 @@ var (
 		SpanAttributeAWSRegion:               usualDests,
 		SpanAttributeErrorClass:              usualDests,
 		SpanAttributeErrorMessage:            usualDests,
+		SpanAttributeErrorExpected:           usualDests,
 		SpanAttributeParentType:              usualDests,
 		SpanAttributeParentApp:               usualDests,
 		SpanAttributeParentAccount:           usualDests,
@@ -85,12 +88,13 @@ const (
 	destBrowser
 	destSpan
 	destSegment
+	destLog
 )
 
 const (
 	destNone destinationSet = 0
 	// destAll contains all destinations.
-	destAll destinationSet = destTxnEvent | destTxnTrace | destError | destBrowser | destSpan | destSegment
+	destAll destinationSet = destTxnEvent | destTxnTrace | destError | destBrowser | destSpan | destSegment | destLog
 )
 
 const (
@@ -214,6 +218,7 @@ func createAttributeConfig(input config, includeEnabled bool) *attributeConfig {
 	processDest(c, includeEnabled, &input.BrowserMonitoring.Attributes, destBrowser)
 	processDest(c, includeEnabled, &input.SpanEvents.Attributes, destSpan)
 	processDest(c, includeEnabled, &input.TransactionTracer.Segments.Attributes, destSegment)
+	processDest(c, includeEnabled, &input.ApplicationLogging.Forwarding.Attributes, destLog)
 
 	sort.Sort(byMatch(c.wildcardModifiers))
 
@@ -320,6 +325,26 @@ func (e invalidFloatAttrValue) Error() string {
 
 }
 
+// requestAttributes returns the agent attributes describing the request and
+// the response code.
+func (a *attributes) requestAttributes() map[string]interface{} {
+	if nil == a {
+		return nil
+	}
+	attrs := make(map[string]interface{})
+	for key, val := range a.Agent {
+		if !strings.HasPrefix(key, "request.") && key != AttributeResponseCode {
+			continue
+		}
+		if nil != val.otherVal {
+			attrs[key] = val.otherVal
+		} else {
+			attrs[key] = val.stringVal
+		}
+	}
+	return attrs
+}
+
 func truncateStringValueIfLong(val string) string {
 	if len(val) > attributeValueLengthLimit {
 		return stringLengthByteLimit(val, attributeValueLengthLimit)
@@ -439,23 +464,34 @@ func writeAttributeValueJSON(w *jsonFieldsWriter, key string, val interface{}) {
 }
 
 func agentAttributesJSON(a *attributes, buf *bytes.Buffer, d destinationSet) {
+	agentAttributesWithExtraJSON(a, buf, d, nil)
+}
+
+// agentAttributesWithExtraJSON writes the agent attributes followed by the
+// extra agent attributes, which describe a single event such as a traced
+// error.  The extra attributes are filtered using the same configuration.
+func agentAttributesWithExtraJSON(a *attributes, buf *bytes.Buffer, d destinationSet, extra agentAttributes) {
 	if nil == a {
 		buf.WriteString("{}")
 		return
 	}
 	w := jsonFieldsWriter{buf: buf}
 	buf.WriteByte('{')
-	for id, val := range a.Agent {
-		if 0 != a.config.agentDests[id]&d {
+	writeAgentAttributes(&w, a.config, a.Agent, d)
+	writeAgentAttributes(&w, a.config, extra, d)
+	buf.WriteByte('}')
+}
+
+func writeAgentAttributes(w *jsonFieldsWriter, config *attributeConfig, attrs agentAttributes, d destinationSet) {
+	for id, val := range attrs {
+		if 0 != config.agentDests[id]&d {
 			if val.stringVal != "" {
 				w.stringField(id, val.stringVal)
 			} else {
-				writeAttributeValueJSON(&w, id, val.otherVal)
+				writeAttributeValueJSON(w, id, val.otherVal)
 			}
 		}
 	}
-	buf.WriteByte('}')
-
 }
 
 func userAttributesJSON(a *attributes, buf *bytes.Buffer, d destinationSet, extraAttributes map[string]interface{}) {
@@ -511,6 +547,15 @@ func requestAgentAttributes(a *attributes, method string, hdrs http.Header, u *u
 	}
 }
 
+// messageAgentAttributes gathers agent attributes from a consumed message.
+func messageAgentAttributes(a *attributes, r MessageRequest) {
+	a.Agent.Add(AttributeMessageRoutingKey, r.RoutingKey, nil)
+	a.Agent.Add(AttributeMessageQueueName, r.QueueName, nil)
+	a.Agent.Add(AttributeMessageExchangeType, r.ExchangeType, nil)
+	a.Agent.Add(AttributeMessageReplyTo, r.ReplyTo, nil)
+	a.Agent.Add(AttributeMessageCorrelationID, r.CorrelationID, nil)
+}
+
 // responseHeaderAttributes gather agent attributes from the response headers.
 func responseHeaderAttributes(a *attributes, h http.Header) {
 	if nil == h {
@@ -36,6 +36,9 @@ const (
 	cmdTxnTraces    = "transaction_sample_data"
 	cmdSlowSQLs     = "sql_trace_data"
 	cmdSpanEvents   = "span_event_data"
+	cmdLogEvents    = "log_event_data"
+
+	cmdDimensionalMetrics = "dimensional_metric_data"
 )
 
 // rpmCmd contains fields specific to an individual call made to RPM.
@@ -73,6 +73,35 @@ type Config struct {
 		Enabled bool
 	}
 
+	// ApplicationLogging controls the capture of log records recorded using
+	// Application.RecordLog, Transaction.RecordLog, or the logging
+	// integrations.
+	ApplicationLogging struct {
+		// Enabled controls whether log records are captured at all.
+		// When it is false, the settings below have no effect.
+		Enabled bool
+		// Forwarding controls whether log records are sent to New
+		// Relic as log events.  Logs recorded by a transaction share
+		// its priority, and include its trace and span IDs.
+		Forwarding struct {
+			// Enabled controls whether log events are sent.  It is
+			// false by default.
+			Enabled bool
+			// MaxSamplesStored limits the number of log events
+			// stored and reported in a given 60-second period.  The
+			// default and maximum value is 10000.
+			MaxSamplesStored int
+			// Attributes controls the attributes included with log
+			// events.
+			Attributes AttributeDestinationConfig
+		}
+		// Metrics controls whether the Logging/lines metrics, which
+		// count log records in total and by severity, are created.
+		Metrics struct {
+			Enabled bool
+		}
+	}
+
 	// TransactionEvents controls the behavior of transaction analytics
 	// events.
 	TransactionEvents struct {
@@ -99,6 +128,34 @@ type Config struct {
 		// greater than or equal to 400 or less than 100 -- with the exception
 		// of 0, 5, and 404 -- are turned into errors.
 		IgnoreStatusCodes []int
+		// ExpectedStatusCodes controls which http response codes turned
+		// into errors are marked as expected.  Expected errors are
+		// recorded as traced errors and error events, but they are not
+		// counted in the error metrics and do not make the transaction
+		// frustrating for apdex.
+		ExpectedStatusCodes []int
+		// ExpectedClasses contains the classes of the errors which are
+		// marked as expected.
+		ExpectedClasses []string
+		// ExpectedMessages maps error classes to messages.  Errors of
+		// the class whose message contains one of the messages are
+		// marked as expected.
+		ExpectedMessages map[string][]string
+		// IgnoreClasses contains the classes of the errors which are
+		// not recorded.
+		IgnoreClasses []string
+		// IgnoreMessages maps error classes to messages.  Errors of the
+		// class whose message contains one of the messages are not
+		// recorded.
+		IgnoreMessages map[string][]string
+		// ErrorGroupCallback, when set, is called when the transaction
+		// ends for each of its errors.  The fingerprint it returns is
+		// recorded as the error.group.name attribute to group the
+		// errors in New Relic.  Without a callback, or when it returns
+		// an empty string or panics, DefaultErrorGroup is used.  The
+		// callback is not called with the transaction locked, but the
+		// transaction has ended.
+		ErrorGroupCallback ErrorGroupCallback `json:"-"`
 		// Attributes controls the attributes included with errors.
 		Attributes AttributeDestinationConfig
 		// RecordPanics controls whether or not a deferred
@@ -106,6 +163,12 @@ type Config struct {
 		// as errors, and then re-panic them.  By default, this is
 		// set to false.
 		RecordPanics bool
+		// PanicPolicy controls whether the recorded panics are
+		// re-panicked and whether the stack traces of all goroutines
+		// are recorded with them.  It has no effect unless
+		// RecordPanics is true.  By default, this is set to
+		// PanicPolicyRepanic.
+		PanicPolicy PanicPolicy
 	}
 
 	// TransactionTracer controls the capture of transaction traces.
@@ -243,6 +306,24 @@ type Config struct {
 		Enabled bool
 		// Attributes controls the attributes included on Spans.
 		Attributes AttributeDestinationConfig
+		// TailSampling controls tail-based sampling of span events.
+		// When enabled, the span events of every transaction are
+		// buffered until the transaction ends.  Rules are then
+		// evaluated in order, and the first rule which matches with a
+		// SamplingKeep or SamplingDrop decision decides.  If no rule
+		// decides, the span events are kept if the transaction was
+		// sampled, if it has an error and KeepErrors is true, or if its
+		// duration is at least MinDuration when MinDuration is
+		// non-zero.  Transactions whose span events are kept are
+		// marked as sampled and their priority is raised.  The
+		// decision applies both to span events sent to New Relic and
+		// to those sent to the Infinite Tracing trace observer.
+		TailSampling struct {
+			Enabled     bool
+			MinDuration time.Duration
+			KeepErrors  bool
+			Rules       []SamplingRule
+		}
 	}
 
 	// InfiniteTracing controls behavior related to Infinite Tracing tail based
@@ -288,12 +369,35 @@ type Config struct {
 		QueryParameters struct {
 			Enabled bool
 		}
+		// RecordSQL controls how DatastoreSegment.ParameterizedQuery is
+		// recorded in transaction traces, slow queries, and span events.
+		// By default, RecordSQLObfuscated replaces the literal values of
+		// queries with "?" using the quoting rules of the segment's
+		// Product.  RecordSQLRaw records queries unchanged, and
+		// RecordSQLOff does not record them.  High security mode and
+		// the record_sql security policy limit RecordSQLRaw to
+		// RecordSQLObfuscated.
+		RecordSQL RecordSQLMode
 		// SlowQuery controls the capture of slow query traces.  Slow
 		// query traces show you instances of your slowest datastore
 		// segments.
 		SlowQuery struct {
 			Enabled   bool
 			Threshold time.Duration
+			// ExplainPlans controls the capture of the plans of slow
+			// queries made using instrumentation which supports it,
+			// such as the nrmysql, nrpq, and nrsqlite3 integrations.
+			// When enabled, an EXPLAIN statement is run on a separate
+			// connection after a slow query, and its result is sent
+			// with the slow query trace.  MaxPerMinute limits the
+			// number of EXPLAIN statements run.  Plans are not
+			// captured in high security mode or when RecordSQL is
+			// RecordSQLOff, and the literals within plans are
+			// obfuscated unless RecordSQL is RecordSQLRaw.
+			ExplainPlans struct {
+				Enabled      bool
+				MaxPerMinute int
+			}
 		}
 	}
 
@@ -305,9 +409,48 @@ type Config struct {
 
 	// RuntimeSampler controls the collection of runtime statistics like
 	// CPU/Memory usage, goroutine count, and GC pauses.
+	//
+	// The categories below add metrics beginning with "Go/Runtime/".  All
+	// but Process are read from the runtime/metrics package, which
+	// requires Go 1.17 or later, and statistics unknown to the running Go
+	// version are skipped.
 	RuntimeSampler struct {
 		// Enabled controls whether runtime statistics are captured.
 		Enabled bool
+		// Scheduler reports the scheduler latency, which is the time
+		// goroutines spend runnable before running, as a histogram
+		// summary with 50th, 95th and 99th percentiles, and GOMAXPROCS.
+		Scheduler struct {
+			Enabled bool
+		}
+		// GC reports the heap size targeted by the garbage collector,
+		// and the number of completed GC cycles and the memory allocated
+		// on the heap since the previous sample.  Sizes are in MiB.
+		GC struct {
+			Enabled bool
+		}
+		// Heap reports the fraction of the heap spans which is unused
+		// by heap objects, and the free and released heap memory in
+		// MiB.
+		Heap struct {
+			Enabled bool
+		}
+		// Sync reports the time goroutines spent blocked on a
+		// sync.Mutex or sync.RWMutex since the previous sample.  This
+		// requires Go 1.20 or later.
+		Sync struct {
+			Enabled bool
+		}
+		// Cgo reports the number of calls from Go to C since the
+		// previous sample.
+		Cgo struct {
+			Enabled bool
+		}
+		// Process reports the number of threads and open file
+		// descriptors of the process, read from /proc on Linux.
+		Process struct {
+			Enabled bool
+		}
 	}
 
 	// ServerlessMode contains fields which control behavior when running in
@@ -337,6 +480,159 @@ type Config struct {
 		PrimaryAppID      string
 	}
 
+	// OTLPExporter controls the local OTLP exporter mode.  When enabled,
+	// the agent does not connect to New Relic.  Instead, span events,
+	// metrics, and custom, transaction, and error events are posted to an
+	// OpenTelemetry collector using OTLP/HTTP.  Transaction traces, error
+	// traces, and slow queries are not exported.  ConfigOTLPExporter sets
+	// Enabled and Endpoint.
+	//
+	// https://github.com/open-telemetry/opentelemetry-specification/blob/main/specification/protocol/otlp.md
+	OTLPExporter struct {
+		Enabled bool
+		// Endpoint is the base URL of the OTLP/HTTP receiver, for
+		// example "http://localhost:4318".  The signal paths
+		// "/v1/traces", "/v1/metrics", and "/v1/logs" are appended to
+		// it.
+		Endpoint string
+		// Headers are added to every export request.  This can be used
+		// to provide authentication required by the receiver.
+		Headers map[string]string
+		// Encoding is the encoding of the request bodies.  By
+		// default, this is set to OTLPEncodingProtobuf.
+		Encoding OTLPEncoding
+	}
+
+	// HarvestSinks receive the agent's data at each harvest, in addition
+	// to New Relic (or the OTLP receiver when OTLPExporter is enabled).
+	// ConfigHarvestSink appends to this list.
+	HarvestSinks []HarvestSink
+
+	// Sampling overrides the sampling decision of transactions when
+	// distributed tracing is enabled.  Rules are evaluated in order and
+	// the first rule which matches the transaction is used.  If no rule
+	// matches, Sampler is called when it is non-nil.  Otherwise, the
+	// agent's adaptive sampler makes the decision.  For example, to always
+	// keep checkout transactions and drop health checks:
+	//
+	//	cfg.Sampling.Rules = []newrelic.SamplingRule{
+	//		{TransactionName: "/checkout*", Decision: newrelic.SamplingKeep},
+	//		{Attribute: newrelic.AttributeRequestURI, AttributeValue: "*/health*", Decision: newrelic.SamplingDrop},
+	//	}
+	//
+	Sampling struct {
+		Rules   []SamplingRule
+		Sampler Sampler
+	}
+
+	// HarvestSpool controls the buffering of harvest data on disk.  When
+	// enabled, data which could not be sent to New Relic because the
+	// collector was unreachable is written to segment files in Directory
+	// instead of being kept in memory.  The spooled data is sent once the
+	// collector is reachable again, including after the process restarts.
+	// The spool is not used in ServerlessMode or with the OTLP exporter.
+	// ConfigHarvestSpool sets Enabled and Directory.
+	HarvestSpool struct {
+		Enabled bool
+		// Directory contains the segment files.  It is created if it
+		// does not exist.  A directory must not be shared by multiple
+		// applications or processes running at the same time.
+		Directory string
+		// MaxBytes limits the total size of the segment files.  When
+		// the limit is reached, the oldest segments are removed.
+		MaxBytes int64
+		// SegmentBytes is the size at which a new segment file is
+		// started.  It must not exceed MaxBytes.  Payloads larger than
+		// SegmentBytes are not spooled.
+		SegmentBytes int64
+		// Sync controls when segment files are flushed to stable
+		// storage.
+		Sync SpoolSyncPolicy
+	}
+
+	// DebugTraces controls the local debugging mode.  When enabled, the
+	// segments and span events of each finished transaction are written to
+	// Directory, both as JSON and in the Chrome trace event format which
+	// can be opened in chrome://tracing or Perfetto.  The segments are the
+	// ones recorded for the transaction trace: Set
+	// TransactionTracer.Segments.Threshold to zero to record every
+	// segment.  Span events are included when the transaction is sampled.
+	// Debug traces are written even when Enabled is false, so that they can
+	// be used without a New Relic account.  Writing the files slows down
+	// every transaction, so this mode is meant for local development only.
+	// ConfigDebugTraces sets Enabled and Directory.
+	DebugTraces struct {
+		Enabled bool
+		// Directory contains the files.  It is created if it does not
+		// exist.
+		Directory string
+	}
+
+	// Prometheus controls the Prometheus exposition of the agent's metrics
+	// by Application.PrometheusHandler.  When enabled, runtime statistics,
+	// apdex, transaction durations, datastore and external calls, and
+	// custom metrics are aggregated for the lifetime of the application in
+	// addition to being sent to New Relic, and the handler writes them in
+	// the Prometheus text format.  Runtime statistics require
+	// RuntimeSampler.Enabled.  The aggregation works even when Enabled is
+	// false.  ConfigPrometheusEnabled sets Enabled.
+	Prometheus struct {
+		Enabled bool
+		// Buckets are the upper bounds, in seconds, of the buckets of
+		// the transaction duration histograms.  They must be
+		// increasing.  When empty, DefaultPrometheusBuckets are used.
+		Buckets []float64
+	}
+
+	// Profiling controls continuous profiling.  When enabled, the
+	// runtime/pprof profiles of Types are captured every Period and
+	// delivered with the next harvest of metrics and traces to the sinks
+	// registered using ConfigHarvestSink, see HarvestData.Profiles.
+	// Profiles are not sent to New Relic.  When SlowTransactionThreshold is
+	// positive, a transaction taking longer triggers an additional capture,
+	// at most once per Period, whose profiles carry the name and trace ID
+	// of the transaction.  Profiling also enables ProfilerLabels, which
+	// makes it possible to attribute CPU samples to transactions.
+	// ConfigProfiling sets Enabled and Types.
+	Profiling struct {
+		Enabled bool
+		// Types are the profiles captured.  The default is CPU, heap,
+		// and goroutine profiles.
+		Types []ProfileType
+		// Period is the time between scheduled captures.
+		Period time.Duration
+		// CPUDuration is the time CPU profiles are sampled.  It must
+		// not exceed Period.
+		CPUDuration time.Duration
+		// SlowTransactionThreshold enables captures triggered by slow
+		// transactions when positive.
+		SlowTransactionThreshold time.Duration
+		// MutexProfileFraction and BlockProfileRate are passed to
+		// runtime.SetMutexProfileFraction and
+		// runtime.SetBlockProfileRate when positive.  The mutex and
+		// block profiles are empty unless these rates are set here or
+		// by the application.
+		MutexProfileFraction int
+		BlockProfileRate     int
+	}
+
+	// ProfilerLabels controls whether transactions and segments set
+	// runtime/pprof labels on the goroutine which runs them, so that CPU
+	// and goroutine profiles can be broken down by transaction, segment,
+	// and trace.  It is implied by Profiling.Enabled.  The labels
+	// "transaction", "trace.id" (when distributed tracing is enabled), and
+	// "segment" are set from the start of the transaction, and for each
+	// segment started using Transaction.StartSegment, until End restores
+	// the labels set before the segment.  Goroutines using a transaction
+	// created with Transaction.NewGoroutine get the labels when they start
+	// a segment.  The labels are added to those of the context set using
+	// Transaction.SetProfilerLabelsContext, which Transaction.End
+	// restores; without it, End removes the labels.  Labels require Go 1.9
+	// or later.  ConfigProfilerLabels sets Enabled.
+	ProfilerLabels struct {
+		Enabled bool
+	}
+
 	// Host can be used to override the New Relic endpoint.
 	Host string
 
@@ -382,6 +678,11 @@ func defaultConfig() Config {
 	c.TransactionEvents.Enabled = true
 	c.TransactionEvents.Attributes.Enabled = true
 	c.TransactionEvents.MaxSamplesStored = internal.MaxTxnEvents
+	c.ApplicationLogging.Enabled = true
+	c.ApplicationLogging.Forwarding.Enabled = false
+	c.ApplicationLogging.Forwarding.MaxSamplesStored = internal.MaxLogEvents
+	c.ApplicationLogging.Forwarding.Attributes.Enabled = true
+	c.ApplicationLogging.Metrics.Enabled = true
 	c.HighSecurity = false
 	c.ErrorCollector.Enabled = true
 	c.ErrorCollector.CaptureEvents = true
@@ -392,6 +693,7 @@ func defaultConfig() Config {
 		http.StatusNotFound, // 404
 	}
 	c.ErrorCollector.Attributes.Enabled = true
+	c.ErrorCollector.PanicPolicy = PanicPolicyRepanic
 	c.Utilization.DetectAWS = true
 	c.Utilization.DetectAzure = true
 	c.Utilization.DetectPCF = true
@@ -400,6 +702,12 @@ func defaultConfig() Config {
 	c.Utilization.DetectKubernetes = true
 	c.Attributes.Enabled = true
 	c.RuntimeSampler.Enabled = true
+	c.RuntimeSampler.Scheduler.Enabled = true
+	c.RuntimeSampler.GC.Enabled = true
+	c.RuntimeSampler.Heap.Enabled = true
+	c.RuntimeSampler.Sync.Enabled = true
+	c.RuntimeSampler.Cgo.Enabled = true
+	c.RuntimeSampler.Process.Enabled = true
 
 	c.TransactionTracer.Enabled = true
 	c.TransactionTracer.Threshold.IsApdexFailing = true
@@ -417,12 +725,15 @@ func defaultConfig() Config {
 	c.DistributedTracer.Enabled = false
 	c.SpanEvents.Enabled = true
 	c.SpanEvents.Attributes.Enabled = true
+	c.SpanEvents.TailSampling.KeepErrors = true
 
 	c.DatastoreTracer.InstanceReporting.Enabled = true
 	c.DatastoreTracer.DatabaseNameReporting.Enabled = true
 	c.DatastoreTracer.QueryParameters.Enabled = true
+	c.DatastoreTracer.RecordSQL = RecordSQLObfuscated
 	c.DatastoreTracer.SlowQuery.Enabled = true
 	c.DatastoreTracer.SlowQuery.Threshold = 10 * time.Millisecond
+	c.DatastoreTracer.SlowQuery.ExplainPlans.MaxPerMinute = 10
 
 	c.ServerlessMode.ApdexThreshold = 500 * time.Millisecond
 	c.ServerlessMode.Enabled = false
@@ -433,6 +744,14 @@ func defaultConfig() Config {
 	c.InfiniteTracing.TraceObserver.Port = 443
 	c.InfiniteTracing.SpanEvents.QueueSize = 10000
 
+	c.HarvestSpool.MaxBytes = 64 * 1024 * 1024
+	c.HarvestSpool.SegmentBytes = 4 * 1024 * 1024
+	c.HarvestSpool.Sync = SpoolSyncSegment
+	c.OTLPExporter.Encoding = OTLPEncodingProtobuf
+	c.Profiling.Types = []ProfileType{ProfileCPU, ProfileHeap, ProfileGoroutine}
+	c.Profiling.Period = 60 * time.Second
+	c.Profiling.CPUDuration = 10 * time.Second
+
 	return c
 }
 
@@ -448,17 +767,32 @@ var (
 	errAppNameLimit                     = fmt.Errorf("max of %d rollup application names", appNameLimit)
 	errHighSecurityWithSecurityPolicies = errors.New("SecurityPoliciesToken and HighSecurity are incompatible; please ensure HighSecurity is set to false if SecurityPoliciesToken is a non-empty string and a security policy has been set for your account")
 	errInfTracingServerless             = errors.New("ServerlessMode cannot be used with Infinite Tracing")
+	errOTLPServerless                   = errors.New("ServerlessMode cannot be used with the OTLP exporter")
+	errOTLPEndpointMissing              = errors.New("OTLPExporter.Endpoint required when the OTLP exporter is enabled")
+	errOTLPEncoding                     = errors.New("OTLPExporter.Encoding must be OTLPEncodingProtobuf or OTLPEncodingJSON")
+	errSpoolDirectoryMissing            = errors.New("HarvestSpool.Directory required when the harvest spool is enabled")
+	errSpoolSize                        = errors.New("HarvestSpool.MaxBytes and HarvestSpool.SegmentBytes must be positive, and SegmentBytes must not exceed MaxBytes")
+	errDebugTracesDirectoryMissing      = errors.New("DebugTraces.Directory required when debug traces are enabled")
+	errPrometheusBuckets                = errors.New("Prometheus.Buckets must be increasing")
+	errProfilingDuration                = errors.New("Profiling.Period and Profiling.CPUDuration must be positive, and CPUDuration must not exceed Period")
+	errUnknownProfileType               = errors.New("unknown profile type")
 )
 
+// profilerLabelsEnabled returns whether pprof labels are set on goroutines.
+func (c Config) profilerLabelsEnabled() bool {
+	return c.ProfilerLabels.Enabled || c.Profiling.Enabled
+}
+
 // validate checks the config for improper fields.  If the config is invalid,
 // newrelic.NewApplication returns an error.
 func (c Config) validate() error {
-	if c.Enabled && !c.ServerlessMode.Enabled {
+	if c.Enabled && !c.ServerlessMode.Enabled && !c.OTLPExporter.Enabled {
 		if len(c.License) != licenseLength {
 			return errLicenseLen
 		}
 	} else {
-		// The License may be empty when the agent is not enabled.
+		// The License may be empty when the agent is not enabled or
+		// is not sending data to New Relic.
 		if len(c.License) != licenseLength && len(c.License) != 0 {
 			return errLicenseLen
 		}
@@ -475,6 +809,48 @@ func (c Config) validate() error {
 	if "" != c.InfiniteTracing.TraceObserver.Host && c.ServerlessMode.Enabled {
 		return errInfTracingServerless
 	}
+	if c.OTLPExporter.Enabled {
+		if c.ServerlessMode.Enabled {
+			return errOTLPServerless
+		}
+		if "" == c.OTLPExporter.Endpoint {
+			return errOTLPEndpointMissing
+		}
+		switch c.OTLPExporter.Encoding {
+		case OTLPEncodingProtobuf, OTLPEncodingJSON:
+		default:
+			return errOTLPEncoding
+		}
+	}
+	if c.HarvestSpool.Enabled {
+		if "" == c.HarvestSpool.Directory {
+			return errSpoolDirectoryMissing
+		}
+		if c.HarvestSpool.MaxBytes <= 0 || c.HarvestSpool.SegmentBytes <= 0 ||
+			c.HarvestSpool.SegmentBytes > c.HarvestSpool.MaxBytes {
+			return errSpoolSize
+		}
+	}
+	if c.DebugTraces.Enabled && "" == c.DebugTraces.Directory {
+		return errDebugTracesDirectoryMissing
+	}
+	for i := 1; i < len(c.Prometheus.Buckets); i++ {
+		if c.Prometheus.Buckets[i] <= c.Prometheus.Buckets[i-1] {
+			return errPrometheusBuckets
+		}
+	}
+	if c.Profiling.Enabled {
+		if c.Profiling.Period <= 0 || c.Profiling.CPUDuration <= 0 || c.Profiling.CPUDuration > c.Profiling.Period {
+			return errProfilingDuration
+		}
+		for _, tp := range c.Profiling.Types {
+			switch tp {
+			case ProfileCPU, ProfileHeap, ProfileMutex, ProfileBlock, ProfileGoroutine:
+			default:
+				return errUnknownProfileType
+			}
+		}
+	}
 
 	return nil
 }
@@ -509,6 +885,28 @@ func (c Config) maxTxnEvents() int {
 	return configured
 }
 
+// maxLogEvents returns the configured maximum number of Log Events if it has
+// been configured and is less than the default maximum; otherwise it returns
+// the default max.
+func (c Config) maxLogEvents() int {
+	configured := c.ApplicationLogging.Forwarding.MaxSamplesStored
+	if configured < 0 || configured > internal.MaxLogEvents {
+		return internal.MaxLogEvents
+	}
+	return configured
+}
+
+// logForwardingEnabled returns whether log events are sent.
+func (c Config) logForwardingEnabled() bool {
+	return c.ApplicationLogging.Enabled && c.ApplicationLogging.Forwarding.Enabled
+}
+
+// logMetricsEnabled returns whether the metrics counting log lines are
+// created.
+func (c Config) logMetricsEnabled() bool {
+	return c.ApplicationLogging.Enabled && c.ApplicationLogging.Metrics.Enabled
+}
+
 func copyDestConfig(c AttributeDestinationConfig) AttributeDestinationConfig {
 	cp := c
 	if nil != c.Include {
@@ -522,6 +920,18 @@ func copyDestConfig(c AttributeDestinationConfig) AttributeDestinationConfig {
 	return cp
 }
 
+func copyErrorMessages(messages map[string][]string) map[string][]string {
+	if nil == messages {
+		return nil
+	}
+	cp := make(map[string][]string, len(messages))
+	for class, msgs := range messages {
+		cp[class] = make([]string, len(msgs))
+		copy(cp[class], msgs)
+	}
+	return cp
+}
+
 func copyConfigReferenceFields(cfg Config) Config {
 	cp := cfg
 	if nil != cfg.Labels {
@@ -535,6 +945,50 @@ func copyConfigReferenceFields(cfg Config) Config {
 		copy(ignored, cfg.ErrorCollector.IgnoreStatusCodes)
 		cp.ErrorCollector.IgnoreStatusCodes = ignored
 	}
+	if nil != cfg.ErrorCollector.ExpectedStatusCodes {
+		expected := make([]int, len(cfg.ErrorCollector.ExpectedStatusCodes))
+		copy(expected, cfg.ErrorCollector.ExpectedStatusCodes)
+		cp.ErrorCollector.ExpectedStatusCodes = expected
+	}
+	if nil != cfg.ErrorCollector.ExpectedClasses {
+		cp.ErrorCollector.ExpectedClasses = make([]string, len(cfg.ErrorCollector.ExpectedClasses))
+		copy(cp.ErrorCollector.ExpectedClasses, cfg.ErrorCollector.ExpectedClasses)
+	}
+	if nil != cfg.ErrorCollector.IgnoreClasses {
+		cp.ErrorCollector.IgnoreClasses = make([]string, len(cfg.ErrorCollector.IgnoreClasses))
+		copy(cp.ErrorCollector.IgnoreClasses, cfg.ErrorCollector.IgnoreClasses)
+	}
+	cp.ErrorCollector.ExpectedMessages = copyErrorMessages(cfg.ErrorCollector.ExpectedMessages)
+	cp.ErrorCollector.IgnoreMessages = copyErrorMessages(cfg.ErrorCollector.IgnoreMessages)
+
+	if nil != cfg.OTLPExporter.Headers {
+		cp.OTLPExporter.Headers = make(map[string]string, len(cfg.OTLPExporter.Headers))
+		for key, val := range cfg.OTLPExporter.Headers {
+			cp.OTLPExporter.Headers[key] = val
+		}
+	}
+
+	if nil != cfg.HarvestSinks {
+		cp.HarvestSinks = make([]HarvestSink, len(cfg.HarvestSinks))
+		copy(cp.HarvestSinks, cfg.HarvestSinks)
+	}
+
+	if nil != cfg.Sampling.Rules {
+		cp.Sampling.Rules = make([]SamplingRule, len(cfg.Sampling.Rules))
+		copy(cp.Sampling.Rules, cfg.Sampling.Rules)
+	}
+	if nil != cfg.SpanEvents.TailSampling.Rules {
+		cp.SpanEvents.TailSampling.Rules = make([]SamplingRule, len(cfg.SpanEvents.TailSampling.Rules))
+		copy(cp.SpanEvents.TailSampling.Rules, cfg.SpanEvents.TailSampling.Rules)
+	}
+	if nil != cfg.Prometheus.Buckets {
+		cp.Prometheus.Buckets = make([]float64, len(cfg.Prometheus.Buckets))
+		copy(cp.Prometheus.Buckets, cfg.Prometheus.Buckets)
+	}
+	if nil != cfg.Profiling.Types {
+		cp.Profiling.Types = make([]ProfileType, len(cfg.Profiling.Types))
+		copy(cp.Profiling.Types, cfg.Profiling.Types)
+	}
 
 	cp.Attributes = copyDestConfig(cfg.Attributes)
 	cp.ErrorCollector.Attributes = copyDestConfig(cfg.ErrorCollector.Attributes)
@@ -542,6 +996,7 @@ func copyConfigReferenceFields(cfg Config) Config {
 	cp.TransactionTracer.Attributes = copyDestConfig(cfg.TransactionTracer.Attributes)
 	cp.BrowserMonitoring.Attributes = copyDestConfig(cfg.BrowserMonitoring.Attributes)
 	cp.SpanEvents.Attributes = copyDestConfig(cfg.SpanEvents.Attributes)
+	cp.ApplicationLogging.Forwarding.Attributes = copyDestConfig(cfg.ApplicationLogging.Forwarding.Attributes)
 	cp.TransactionTracer.Segments.Attributes = copyDestConfig(cfg.TransactionTracer.Segments.Attributes)
 
 	return cp
@@ -554,6 +1009,24 @@ func transportSetting(t http.RoundTripper) interface{} {
 	return fmt.Sprintf("%T", t)
 }
 
+func harvestSinksSetting(sinks []HarvestSink) interface{} {
+	if 0 == len(sinks) {
+		return nil
+	}
+	types := make([]string, len(sinks))
+	for i, s := range sinks {
+		types[i] = fmt.Sprintf("%T", s)
+	}
+	return types
+}
+
+func samplerSetting(s Sampler) interface{} {
+	if nil == s {
+		return nil
+	}
+	return fmt.Sprintf("%T", s)
+}
+
 func loggerSetting(lg Logger) interface{} {
 	if nil == lg {
 		return nil
@@ -577,6 +1050,12 @@ func (s settings) MarshalJSON() ([]byte, error) {
 	c.Transport = nil
 	l := c.Logger
 	c.Logger = nil
+	// OTLP headers may contain credentials for the receiver.
+	c.OTLPExporter.Headers = nil
+	sinks := c.HarvestSinks
+	c.HarvestSinks = nil
+	sampler := c.Sampling.Sampler
+	c.Sampling.Sampler = nil
 
 	js, err := json.Marshal(c)
 	if nil != err {
@@ -592,6 +1071,13 @@ func (s settings) MarshalJSON() ([]byte, error) {
 	delete(fields, `License`)
 	fields[`Transport`] = transportSetting(transport)
 	fields[`Logger`] = loggerSetting(l)
+	fields[`HarvestSinks`] = harvestSinksSetting(sinks)
+	if sampling, ok := fields[`Sampling`].(map[string]interface{}); ok {
+		sampling[`Sampler`] = samplerSetting(sampler)
+	}
+	if ec, ok := fields[`ErrorCollector`].(map[string]interface{}); ok {
+		ec[`ErrorGroupCallback`] = nil != c.ErrorCollector.ErrorGroupCallback
+	}
 
 	// Browser monitoring support.
 	if c.BrowserMonitoring.Enabled {
@@ -620,6 +1106,17 @@ func (l labels) MarshalJSON() ([]byte, error) {
 	return json.Marshal(ls)
 }
 
+// eventHarvestConfig returns the event harvest limits requested at connect.
+// The log event limit is requested only if log forwarding is enabled.
+func (c Config) eventHarvestConfig() internal.EventHarvestConfig {
+	cfg := internal.DefaultEventHarvestConfig(c.maxTxnEvents())
+	if c.logForwardingEnabled() {
+		max := uint(c.maxLogEvents())
+		cfg.Limits.LogEvents = &max
+	}
+	return cfg
+}
+
 func configConnectJSONInternal(c Config, pid int, util *utilization.Data, e environment, version string, securityPolicies *internal.SecurityPolicies, metadata map[string]string) ([]byte, error) {
 	return json.Marshal([]interface{}{struct {
 		Pid              int                         `json:"pid"`
@@ -663,7 +1160,7 @@ func configConnectJSONInternal(c Config, pid int, util *utilization.Data, e envi
 		Util:             util,
 		SecurityPolicies: securityPolicies,
 		Metadata:         metadata,
-		EventData:        internal.DefaultEventHarvestConfig(c.maxTxnEvents()),
+		EventData:        c.eventHarvestConfig(),
 	}})
 }
 
@@ -36,6 +36,88 @@ func ConfigDistributedTracerEnabled(enabled bool) ConfigOption {
 	return func(cfg *Config) { cfg.DistributedTracer.Enabled = enabled }
 }
 
+// ConfigAppLogEnabled populates the Config's ApplicationLogging.Enabled
+// setting.
+func ConfigAppLogEnabled(enabled bool) ConfigOption {
+	return func(cfg *Config) { cfg.ApplicationLogging.Enabled = enabled }
+}
+
+// ConfigAppLogForwardingEnabled populates the Config's
+// ApplicationLogging.Forwarding.Enabled setting.
+func ConfigAppLogForwardingEnabled(enabled bool) ConfigOption {
+	return func(cfg *Config) { cfg.ApplicationLogging.Forwarding.Enabled = enabled }
+}
+
+// ConfigAppLogMetricsEnabled populates the Config's
+// ApplicationLogging.Metrics.Enabled setting.
+func ConfigAppLogMetricsEnabled(enabled bool) ConfigOption {
+	return func(cfg *Config) { cfg.ApplicationLogging.Metrics.Enabled = enabled }
+}
+
+// ConfigOTLPExporter enables the local OTLP exporter mode: instead of
+// connecting to New Relic, the agent will post its data using OTLP/HTTP to the
+// OpenTelemetry collector at endpoint, for example "http://localhost:4318".
+// See Config.OTLPExporter for more information.
+func ConfigOTLPExporter(endpoint string) ConfigOption {
+	return func(cfg *Config) {
+		cfg.OTLPExporter.Enabled = true
+		cfg.OTLPExporter.Endpoint = endpoint
+	}
+}
+
+// ConfigHarvestSink adds a HarvestSink which will receive the agent's data at
+// each harvest.  See Config.HarvestSinks for more information.
+func ConfigHarvestSink(sink HarvestSink) ConfigOption {
+	return func(cfg *Config) { cfg.HarvestSinks = append(cfg.HarvestSinks, sink) }
+}
+
+// ConfigHarvestSpool enables the buffering of harvest data in directory when
+// the New Relic collector is unreachable.  See Config.HarvestSpool for more
+// information.
+func ConfigHarvestSpool(directory string) ConfigOption {
+	return func(cfg *Config) {
+		cfg.HarvestSpool.Enabled = true
+		cfg.HarvestSpool.Directory = directory
+	}
+}
+
+// ConfigDebugTraces enables the local debugging mode: the segments of each
+// finished transaction are written to directory as JSON and Chrome trace files.
+// See Config.DebugTraces for more information.
+func ConfigDebugTraces(directory string) ConfigOption {
+	return func(cfg *Config) {
+		cfg.DebugTraces.Enabled = true
+		cfg.DebugTraces.Directory = directory
+	}
+}
+
+// ConfigPrometheusEnabled enables or disables the Prometheus exposition of the
+// agent's metrics.  See Config.Prometheus and Application.PrometheusHandler for
+// more information.
+func ConfigPrometheusEnabled(enabled bool) ConfigOption {
+	return func(cfg *Config) { cfg.Prometheus.Enabled = enabled }
+}
+
+// ConfigProfiling enables continuous profiling.  The profiles of the types
+// given are captured, or CPU, heap, and goroutine profiles if none are given.
+// See Config.Profiling for more information.
+//
+//	newrelic.ConfigProfiling(newrelic.ProfileCPU, newrelic.ProfileMutex)
+func ConfigProfiling(types ...ProfileType) ConfigOption {
+	return func(cfg *Config) {
+		cfg.Profiling.Enabled = true
+		if len(types) > 0 {
+			cfg.Profiling.Types = types
+		}
+	}
+}
+
+// ConfigProfilerLabels enables or disables the pprof labels set by transactions
+// and segments.  See Config.ProfilerLabels for more information.
+func ConfigProfilerLabels(enabled bool) ConfigOption {
+	return func(cfg *Config) { cfg.ProfilerLabels.Enabled = enabled }
+}
+
 // ConfigLogger populates the Config's Logger.
 func ConfigLogger(l Logger) ConfigOption {
 	return func(cfg *Config) { cfg.Logger = l }
@@ -53,9 +135,13 @@ func ConfigDebugLogger(w io.Writer) ConfigOption {
 
 // ConfigFromEnvironment populates the config based on environment variables:
 //
+//  NEW_RELIC_APPLICATION_LOGGING_ENABLED             sets ApplicationLogging.Enabled using strconv.ParseBool
+//  NEW_RELIC_APPLICATION_LOGGING_FORWARDING_ENABLED  sets ApplicationLogging.Forwarding.Enabled using strconv.ParseBool
+//  NEW_RELIC_APPLICATION_LOGGING_METRICS_ENABLED     sets ApplicationLogging.Metrics.Enabled using strconv.ParseBool
 //  NEW_RELIC_APP_NAME                                sets AppName
 //  NEW_RELIC_ATTRIBUTES_EXCLUDE                      sets Attributes.Exclude using a comma-separated list, eg. "request.headers.host,request.method"
 //  NEW_RELIC_ATTRIBUTES_INCLUDE                      sets Attributes.Include using a comma-separated list
+//  NEW_RELIC_DEBUG_TRACES_DIRECTORY                  enables DebugTraces and sets DebugTraces.Directory
 //  NEW_RELIC_DISTRIBUTED_TRACING_ENABLED             sets DistributedTracer.Enabled using strconv.ParseBool
 //  NEW_RELIC_ENABLED                                 sets Enabled using strconv.ParseBool
 //  NEW_RELIC_HIGH_SECURITY                           sets HighSecurity using strconv.ParseBool
@@ -68,6 +154,7 @@ func ConfigDebugLogger(w io.Writer) ConfigOption {
 //  NEW_RELIC_LOG                                     sets Logger to log to either "stdout" or "stderr" (filenames are not supported)
 //  NEW_RELIC_LOG_LEVEL                               controls the NEW_RELIC_LOG level, must be "debug" for debug, or empty for info
 //  NEW_RELIC_PROCESS_HOST_DISPLAY_NAME               sets HostDisplayName
+//  NEW_RELIC_PROMETHEUS_ENABLED                      sets Prometheus.Enabled using strconv.ParseBool
 //  NEW_RELIC_SECURITY_POLICIES_TOKEN                 sets SecurityPoliciesToken
 //  NEW_RELIC_UTILIZATION_BILLING_HOSTNAME            sets Utilization.BillingHostname
 //  NEW_RELIC_UTILIZATION_LOGICAL_PROCESSORS          sets Utilization.LogicalProcessors using strconv.Atoi
@@ -114,6 +201,10 @@ func configFromEnvironment(getenv func(string) string) ConfigOption {
 		assignBool(&cfg.DistributedTracer.Enabled, "NEW_RELIC_DISTRIBUTED_TRACING_ENABLED")
 		assignBool(&cfg.Enabled, "NEW_RELIC_ENABLED")
 		assignBool(&cfg.HighSecurity, "NEW_RELIC_HIGH_SECURITY")
+		assignBool(&cfg.ApplicationLogging.Enabled, "NEW_RELIC_APPLICATION_LOGGING_ENABLED")
+		assignBool(&cfg.ApplicationLogging.Forwarding.Enabled, "NEW_RELIC_APPLICATION_LOGGING_FORWARDING_ENABLED")
+		assignBool(&cfg.ApplicationLogging.Metrics.Enabled, "NEW_RELIC_APPLICATION_LOGGING_METRICS_ENABLED")
+		assignBool(&cfg.Prometheus.Enabled, "NEW_RELIC_PROMETHEUS_ENABLED")
 		assignString(&cfg.SecurityPoliciesToken, "NEW_RELIC_SECURITY_POLICIES_TOKEN")
 		assignString(&cfg.Host, "NEW_RELIC_HOST")
 		assignString(&cfg.HostDisplayName, "NEW_RELIC_PROCESS_HOST_DISPLAY_NAME")
@@ -139,6 +230,11 @@ func configFromEnvironment(getenv func(string) string) ConfigOption {
 			cfg.Attributes.Exclude = strings.Split(env, ",")
 		}
 
+		if env := getenv("NEW_RELIC_DEBUG_TRACES_DIRECTORY"); env != "" {
+			cfg.DebugTraces.Enabled = true
+			cfg.DebugTraces.Directory = env
+		}
+
 		if env := getenv("NEW_RELIC_LOG"); env != "" {
 			if dest := getLogDest(env); dest != nil {
 				if isDebugEnv(getenv("NEW_RELIC_LOG_LEVEL")) {
@@ -45,6 +45,10 @@ func TestConfigFromEnvironment(t *testing.T) {
 			return "456"
 		case "NEW_RELIC_INFINITE_TRACING_SPAN_EVENTS_QUEUE_SIZE":
 			return "98765"
+		case "NEW_RELIC_DEBUG_TRACES_DIRECTORY":
+			return "/tmp/traces"
+		case "NEW_RELIC_PROMETHEUS_ENABLED":
+			return "true"
 		}
 		return ""
 	})
@@ -66,6 +70,9 @@ func TestConfigFromEnvironment(t *testing.T) {
 	expect.InfiniteTracing.TraceObserver.Host = "myhost.com"
 	expect.InfiniteTracing.TraceObserver.Port = 456
 	expect.InfiniteTracing.SpanEvents.QueueSize = 98765
+	expect.DebugTraces.Enabled = true
+	expect.DebugTraces.Directory = "/tmp/traces"
+	expect.Prometheus.Enabled = true
 
 	cfg := defaultConfig()
 	cfgOpt(&cfg)
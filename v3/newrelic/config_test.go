@@ -12,6 +12,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/newrelic/go-agent/v3/internal"
 	"github.com/newrelic/go-agent/v3/internal/crossagent"
@@ -84,6 +85,8 @@ func TestCopyConfigReferenceFieldsPresent(t *testing.T) {
 	cfg.AppName = "my appname"
 	cfg.License = "0123456789012345678901234567890123456789"
 	cfg.Labels["zip"] = "zap"
+	cfg.OTLPExporter.Headers = map[string]string{"api-key": "secret"}
+	cfg.HarvestSinks = []HarvestSink{&sinkRecorder{}}
 	cfg.ErrorCollector.IgnoreStatusCodes = append(cfg.ErrorCollector.IgnoreStatusCodes, 405)
 	cfg.Attributes.Include = append(cfg.Attributes.Include, "1")
 	cfg.Attributes.Exclude = append(cfg.Attributes.Exclude, "2")
@@ -99,13 +102,35 @@ func TestCopyConfigReferenceFieldsPresent(t *testing.T) {
 	cfg.SpanEvents.Attributes.Exclude = append(cfg.SpanEvents.Attributes.Exclude, "12")
 	cfg.TransactionTracer.Segments.Attributes.Include = append(cfg.TransactionTracer.Segments.Attributes.Include, "13")
 	cfg.TransactionTracer.Segments.Attributes.Exclude = append(cfg.TransactionTracer.Segments.Attributes.Exclude, "14")
+	cfg.ApplicationLogging.Forwarding.Attributes.Include = append(cfg.ApplicationLogging.Forwarding.Attributes.Include, "15")
+	cfg.ApplicationLogging.Forwarding.Attributes.Exclude = append(cfg.ApplicationLogging.Forwarding.Attributes.Exclude, "16")
 	cfg.Transport = &http.Transport{}
 	cfg.Logger = NewLogger(os.Stdout)
+	cfg.Sampling.Rules = []SamplingRule{{TransactionName: "/checkout*", Decision: SamplingKeep}}
+	cfg.Sampling.Sampler = samplerFunc(func(SamplingParameters) SamplingResult { return SamplingResult{} })
+	cfg.SpanEvents.TailSampling.Rules = []SamplingRule{{TransactionName: "/health", Decision: SamplingDrop}}
+	cfg.Prometheus.Buckets = []float64{0.5, 1}
+	cfg.ErrorCollector.ExpectedStatusCodes = []int{409}
+	cfg.ErrorCollector.ExpectedClasses = []string{"*errors.errorString"}
+	cfg.ErrorCollector.ExpectedMessages = map[string][]string{"net.OpError": {"refused"}}
+	cfg.ErrorCollector.IgnoreClasses = []string{"context.Canceled"}
+	cfg.ErrorCollector.IgnoreMessages = map[string][]string{"panic": {"aborted"}}
+	cfg.ErrorCollector.ErrorGroupCallback = DefaultErrorGroup
 
 	cp := copyConfigReferenceFields(cfg)
 
 	cfg.Labels["zop"] = "zup"
+	cfg.OTLPExporter.Headers["api-key"] = "changed"
+	cfg.HarvestSinks[0] = nil
+	cfg.Sampling.Rules[0].Decision = SamplingDrop
+	cfg.SpanEvents.TailSampling.Rules[0].Decision = SamplingKeep
+	cfg.Prometheus.Buckets[0] = 0.25
 	cfg.ErrorCollector.IgnoreStatusCodes[0] = 201
+	cfg.ErrorCollector.ExpectedStatusCodes[0] = 410
+	cfg.ErrorCollector.ExpectedClasses[0] = "zap"
+	cfg.ErrorCollector.ExpectedMessages["net.OpError"][0] = "zap"
+	cfg.ErrorCollector.IgnoreClasses[0] = "zap"
+	cfg.ErrorCollector.IgnoreMessages["panic"] = nil
 	cfg.Attributes.Include[0] = "zap"
 	cfg.Attributes.Exclude[0] = "zap"
 	cfg.TransactionEvents.Attributes.Include[0] = "zap"
@@ -120,6 +145,8 @@ func TestCopyConfigReferenceFieldsPresent(t *testing.T) {
 	cfg.SpanEvents.Attributes.Exclude[0] = "zap"
 	cfg.TransactionTracer.Segments.Attributes.Include[0] = "zap"
 	cfg.TransactionTracer.Segments.Attributes.Exclude[0] = "zap"
+	cfg.ApplicationLogging.Forwarding.Attributes.Include[0] = "zap"
+	cfg.ApplicationLogging.Forwarding.Attributes.Exclude[0] = "zap"
 
 	expect := internal.CompactJSONString(`[
 	{
@@ -129,6 +156,15 @@ func TestCopyConfigReferenceFieldsPresent(t *testing.T) {
 		"host":"my-hostname",
 		"settings":{
 			"AppName":"my appname",
+			"ApplicationLogging":{
+				"Enabled":true,
+				"Forwarding":{
+					"Attributes":{"Enabled":true,"Exclude":["16"],"Include":["15"]},
+					"Enabled":false,
+					"MaxSamplesStored":10000
+				},
+				"Metrics":{"Enabled":true}
+			},
 			"Attributes":{"Enabled":true,"Exclude":["2"],"Include":["1"]},
 			"BrowserMonitoring":{
 				"Attributes":{"Enabled":false,"Exclude":["10"],"Include":["9"]},
@@ -140,11 +176,14 @@ func TestCopyConfigReferenceFieldsPresent(t *testing.T) {
 				"DatabaseNameReporting":{"Enabled":true},
 				"InstanceReporting":{"Enabled":true},
 				"QueryParameters":{"Enabled":true},
+				"RecordSQL":"obfuscated",
 				"SlowQuery":{
 					"Enabled":true,
+					"ExplainPlans":{"Enabled":false,"MaxPerMinute":10},
 					"Threshold":10000000
 				}
 			},
+			"DebugTraces":{"Directory":"","Enabled":false},
 			"DistributedTracer":{"Enabled":false,"ExcludeNewRelicHeader":false},
 			"Enabled":true,
 			"Error":null,
@@ -152,9 +191,18 @@ func TestCopyConfigReferenceFieldsPresent(t *testing.T) {
 				"Attributes":{"Enabled":true,"Exclude":["6"],"Include":["5"]},
 				"CaptureEvents":true,
 				"Enabled":true,
+				"ErrorGroupCallback":true,
+				"ExpectedClasses":["*errors.errorString"],
+				"ExpectedMessages":{"net.OpError":["refused"]},
+				"ExpectedStatusCodes":[409],
+				"IgnoreClasses":["context.Canceled"],
+				"IgnoreMessages":{"panic":["aborted"]},
 				"IgnoreStatusCodes":[0,5,404,405],
+				"PanicPolicy":"repanic",
 				"RecordPanics":false
 			},
+			"HarvestSinks":["*newrelic.sinkRecorder"],
+			"HarvestSpool":{"Directory":"","Enabled":false,"MaxBytes":67108864,"SegmentBytes":4194304,"Sync":"segment"},
 			"Heroku":{
 				"DynoNamePrefixesToShorten":["scheduler","run"],
 				"UseDynoNames":true
@@ -171,7 +219,31 @@ func TestCopyConfigReferenceFieldsPresent(t *testing.T) {
 			},
 			"Labels":{"zip":"zap"},
 			"Logger":"*logger.logFile",
-			"RuntimeSampler":{"Enabled":true},
+			"OTLPExporter":{"Enabled":false,"Encoding":"protobuf","Endpoint":"","Headers":null},
+			"ProfilerLabels":{"Enabled":false},
+			"Profiling":{
+				"BlockProfileRate":0,
+				"CPUDuration":10000000000,
+				"Enabled":false,
+				"MutexProfileFraction":0,
+				"Period":60000000000,
+				"SlowTransactionThreshold":0,
+				"Types":["cpu","heap","goroutine"]
+			},
+			"Prometheus":{"Buckets":[0.5,1],"Enabled":false},
+			"RuntimeSampler":{
+				"Cgo":{"Enabled":true},
+				"Enabled":true,
+				"GC":{"Enabled":true},
+				"Heap":{"Enabled":true},
+				"Process":{"Enabled":true},
+				"Scheduler":{"Enabled":true},
+				"Sync":{"Enabled":true}
+			},
+			"Sampling":{
+				"Rules":[{"Attribute":"","AttributeValue":"","Decision":"keep","HasError":false,"Priority":0,"TransactionName":"/checkout*"}],
+				"Sampler":"newrelic.samplerFunc"
+			},
 			"SecurityPoliciesToken":"",
 			"ServerlessMode":{
 				"AccountID":"",
@@ -184,7 +256,11 @@ func TestCopyConfigReferenceFieldsPresent(t *testing.T) {
 				"Attributes":{
 					"Enabled":true,"Exclude":["12"],"Include":["11"]
 				},
-				"Enabled":true
+				"Enabled":true,
+				"TailSampling":{
+					"Enabled":false,"KeepErrors":true,"MinDuration":0,
+					"Rules":[{"Attribute":"","AttributeValue":"","Decision":"drop","HasError":false,"Priority":0,"TransactionName":"/health"}]
+				}
 			},
 			"TransactionEvents":{
 				"Attributes":{"Enabled":true,"Exclude":["4"],"Include":["3"]},
@@ -282,6 +358,9 @@ func TestCopyConfigReferenceFieldsPresent(t *testing.T) {
 	if out != expect {
 		t.Error(out)
 	}
+	if h := cp.OTLPExporter.Headers["api-key"]; h != "secret" {
+		t.Error(h)
+	}
 }
 
 func TestCopyConfigReferenceFieldsAbsent(t *testing.T) {
@@ -301,6 +380,15 @@ func TestCopyConfigReferenceFieldsAbsent(t *testing.T) {
 		"host":"my-hostname",
 		"settings":{
 			"AppName":"my appname",
+			"ApplicationLogging":{
+				"Enabled":true,
+				"Forwarding":{
+					"Attributes":{"Enabled":true,"Exclude":null,"Include":null},
+					"Enabled":false,
+					"MaxSamplesStored":10000
+				},
+				"Metrics":{"Enabled":true}
+			},
 			"Attributes":{"Enabled":true,"Exclude":null,"Include":null},
 			"BrowserMonitoring":{
 				"Attributes":{
@@ -316,11 +404,14 @@ func TestCopyConfigReferenceFieldsAbsent(t *testing.T) {
 				"DatabaseNameReporting":{"Enabled":true},
 				"InstanceReporting":{"Enabled":true},
 				"QueryParameters":{"Enabled":true},
+				"RecordSQL":"obfuscated",
 				"SlowQuery":{
 					"Enabled":true,
+					"ExplainPlans":{"Enabled":false,"MaxPerMinute":10},
 					"Threshold":10000000
 				}
 			},
+			"DebugTraces":{"Directory":"","Enabled":false},
 			"DistributedTracer":{"Enabled":false,"ExcludeNewRelicHeader":false},
 			"Enabled":true,
 			"Error":null,
@@ -328,9 +419,18 @@ func TestCopyConfigReferenceFieldsAbsent(t *testing.T) {
 				"Attributes":{"Enabled":true,"Exclude":null,"Include":null},
 				"CaptureEvents":true,
 				"Enabled":true,
+				"ErrorGroupCallback":false,
+				"ExpectedClasses":null,
+				"ExpectedMessages":null,
+				"ExpectedStatusCodes":null,
+				"IgnoreClasses":null,
+				"IgnoreMessages":null,
 				"IgnoreStatusCodes":null,
+				"PanicPolicy":"repanic",
 				"RecordPanics":false
 			},
+			"HarvestSinks":null,
+			"HarvestSpool":{"Directory":"","Enabled":false,"MaxBytes":67108864,"SegmentBytes":4194304,"Sync":"segment"},
 			"Heroku":{
 				"DynoNamePrefixesToShorten":["scheduler","run"],
 				"UseDynoNames":true
@@ -347,7 +447,28 @@ func TestCopyConfigReferenceFieldsAbsent(t *testing.T) {
 			},
 			"Labels":null,
 			"Logger":null,
-			"RuntimeSampler":{"Enabled":true},
+			"OTLPExporter":{"Enabled":false,"Encoding":"protobuf","Endpoint":"","Headers":null},
+			"ProfilerLabels":{"Enabled":false},
+			"Profiling":{
+				"BlockProfileRate":0,
+				"CPUDuration":10000000000,
+				"Enabled":false,
+				"MutexProfileFraction":0,
+				"Period":60000000000,
+				"SlowTransactionThreshold":0,
+				"Types":["cpu","heap","goroutine"]
+			},
+			"Prometheus":{"Buckets":null,"Enabled":false},
+			"RuntimeSampler":{
+				"Cgo":{"Enabled":true},
+				"Enabled":true,
+				"GC":{"Enabled":true},
+				"Heap":{"Enabled":true},
+				"Process":{"Enabled":true},
+				"Scheduler":{"Enabled":true},
+				"Sync":{"Enabled":true}
+			},
+			"Sampling":{"Rules":null,"Sampler":null},
 			"SecurityPoliciesToken":"",
 			"ServerlessMode":{
 				"AccountID":"",
@@ -358,7 +479,8 @@ func TestCopyConfigReferenceFieldsAbsent(t *testing.T) {
 			},
 			"SpanEvents":{
 				"Attributes":{"Enabled":true,"Exclude":null,"Include":null},
-				"Enabled":true
+				"Enabled":true,
+				"TailSampling":{"Enabled":false,"KeepErrors":true,"MinDuration":0,"Rules":null}
 			},
 			"TransactionEvents":{
 				"Attributes":{"Enabled":true,"Exclude":null,"Include":null},
@@ -572,6 +694,99 @@ func TestValidateServerless(t *testing.T) {
 	}
 }
 
+func TestValidateOTLPExporter(t *testing.T) {
+	// The License can be empty when the OTLP exporter is enabled.
+	c := defaultConfig()
+	c.AppName = "my app"
+	c.OTLPExporter.Enabled = true
+	c.OTLPExporter.Endpoint = "http://localhost:4318"
+	if err := c.validate(); nil != err {
+		t.Error(err)
+	}
+
+	c.OTLPExporter.Endpoint = ""
+	if err := c.validate(); err != errOTLPEndpointMissing {
+		t.Error(err)
+	}
+
+	c.OTLPExporter.Endpoint = "http://localhost:4318"
+	c.OTLPExporter.Encoding = "xml"
+	if err := c.validate(); err != errOTLPEncoding {
+		t.Error(err)
+	}
+
+	c.OTLPExporter.Encoding = OTLPEncodingJSON
+	c.ServerlessMode.Enabled = true
+	if err := c.validate(); err != errOTLPServerless {
+		t.Error(err)
+	}
+}
+
+func TestValidateHarvestSpool(t *testing.T) {
+	c := defaultConfig()
+	c.AppName = "my app"
+	c.License = testLicenseKey
+	c.HarvestSpool.Enabled = true
+	if err := c.validate(); err != errSpoolDirectoryMissing {
+		t.Error(err)
+	}
+	c.HarvestSpool.Directory = "/tmp/spool"
+	if err := c.validate(); nil != err {
+		t.Error(err)
+	}
+	for _, sizes := range [][2]int64{{0, 1}, {1, 0}, {-1, -1}, {1, 2}} {
+		c.HarvestSpool.MaxBytes = sizes[0]
+		c.HarvestSpool.SegmentBytes = sizes[1]
+		if err := c.validate(); err != errSpoolSize {
+			t.Error(sizes, err)
+		}
+	}
+}
+
+func TestValidateDebugTraces(t *testing.T) {
+	c := defaultConfig()
+	c.Enabled = false
+	c.DebugTraces.Enabled = true
+	if err := c.validate(); err != errDebugTracesDirectoryMissing {
+		t.Error(err)
+	}
+	c.DebugTraces.Directory = "/tmp/traces"
+	if err := c.validate(); nil != err {
+		t.Error(err)
+	}
+}
+
+func TestValidatePrometheusBuckets(t *testing.T) {
+	c := defaultConfig()
+	c.Enabled = false
+	c.Prometheus.Buckets = []float64{0.1, 1, 1}
+	if err := c.validate(); err != errPrometheusBuckets {
+		t.Error(err)
+	}
+	c.Prometheus.Buckets = []float64{0.1, 1, 10}
+	if err := c.validate(); nil != err {
+		t.Error(err)
+	}
+}
+
+func TestValidateProfiling(t *testing.T) {
+	c := defaultConfig()
+	c.Enabled = false
+	c.Profiling.Enabled = true
+	if err := c.validate(); nil != err {
+		t.Error(err)
+	}
+	c.Profiling.CPUDuration = 2 * c.Profiling.Period
+	if err := c.validate(); err != errProfilingDuration {
+		t.Error(err)
+	}
+	c.Profiling.CPUDuration = time.Second
+	c.Profiling.Types = []ProfileType{ProfileMutex, "threads"}
+	if err := c.validate(); err != errUnknownProfileType {
+		t.Error(err)
+	}
+}
+
 func TestPreconnectHost(t *testing.T) {
 	testcases := []struct {
 		license  string
@@ -0,0 +1,284 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package newrelic
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	debugTraceSuffix       = ".json"
+	debugChromeTraceSuffix = ".trace.json"
+	// maxDebugTraceNameLen limits the length of the transaction name used
+	// in file names.
+	maxDebugTraceNameLen = 100
+
+	// These are the process identifiers of the segments and the span
+	// events in Chrome traces.
+	chromeSegmentsPID = 1
+	chromeSpansPID    = 2
+)
+
+// debugTraceWriter writes the segment tree of each finished transaction to
+// the directory of Config.DebugTraces.
+type debugTraceWriter struct {
+	// seq is first to ensure 64 bit alignment for atomic operations.
+	seq uint64
+	dir string
+	lg  Logger
+}
+
+func newDebugTraceWriter(dir string, lg Logger) (*debugTraceWriter, error) {
+	if err := os.MkdirAll(dir, 0755); nil != err {
+		return nil, err
+	}
+	return &debugTraceWriter{dir: dir, lg: lg}, nil
+}
+
+// debugTrace is the JSON written for each transaction.  Segments contains the
+// transaction trace nodes nested by goroutine and time, and Spans contains the
+// span events.
+type debugTrace struct {
+	Name           string          `json:"name"`
+	Start          time.Time       `json:"start"`
+	DurationMillis float64         `json:"duration_ms"`
+	TraceID        string          `json:"trace_id,omitempty"`
+	Segments       []*debugSegment `json:"segments"`
+	Spans          []debugSpan     `json:"spans"`
+}
+
+type debugSegment struct {
+	Name           string                     `json:"name"`
+	StartMillis    float64                    `json:"start_ms"`
+	DurationMillis float64                    `json:"duration_ms"`
+	Thread         uint64                     `json:"thread"`
+	Attributes     map[string]json.RawMessage `json:"attributes,omitempty"`
+	Children       []*debugSegment            `json:"children,omitempty"`
+}
+
+type debugSpan struct {
+	GUID            string                     `json:"guid"`
+	ParentID        string                     `json:"parent_id,omitempty"`
+	Name            string                     `json:"name"`
+	Category        spanCategory               `json:"category"`
+	StartMillis     float64                    `json:"start_ms"`
+	DurationMillis  float64                    `json:"duration_ms"`
+	AgentAttributes map[string]json.RawMessage `json:"agent_attributes,omitempty"`
+	UserAttributes  map[string]json.RawMessage `json:"user_attributes,omitempty"`
+}
+
+// chromeTraceEvent is a complete event of the Chrome trace event format,
+// which is understood by chrome://tracing and Perfetto.  Timestamps and
+// durations are in microseconds.
+type chromeTraceEvent struct {
+	Name      string                     `json:"name"`
+	Category  string                     `json:"cat,omitempty"`
+	Phase     string                     `json:"ph"`
+	Timestamp int64                      `json:"ts"`
+	Duration  int64                      `json:"dur,omitempty"`
+	PID       int                        `json:"pid"`
+	TID       uint64                     `json:"tid"`
+	Args      map[string]json.RawMessage `json:"args,omitempty"`
+}
+
+type chromeTrace struct {
+	TraceEvents     []chromeTraceEvent `json:"traceEvents"`
+	DisplayTimeUnit string             `json:"displayTimeUnit"`
+}
+
+func durationMillis(d time.Duration) float64 {
+	return d.Seconds() * 1000.0
+}
+
+// debugAttributes converts the attributes into JSON values.
+func debugAttributes(attrs spanAttributeMap) map[string]json.RawMessage {
+	if 0 == len(attrs) {
+		return nil
+	}
+	m := make(map[string]json.RawMessage, len(attrs))
+	for key, val := range attrs {
+		buf := &bytes.Buffer{}
+		val.WriteJSON(buf)
+		m[key] = json.RawMessage(buf.Bytes())
+	}
+	return m
+}
+
+// debugSegmentChildren nests the sorted trace nodes of a thread in the same
+// way as printChildren, and returns the index of the next node.
+func debugSegmentChildren(start time.Time, nodes sortedTraceNodes, next int, stop *segmentStamp, threadID uint64) ([]*debugSegment, int) {
+	var children []*debugSegment
+	for next < len(nodes) {
+		n := nodes[next]
+		if n.threadID != threadID {
+			break
+		}
+		if nil != stop && n.start.Stamp >= *stop {
+			break
+		}
+		seg := &debugSegment{
+			Name:           n.name,
+			StartMillis:    durationMillis(n.start.Time.Sub(start)),
+			DurationMillis: durationMillis(n.duration),
+			Thread:         n.threadID,
+			Attributes:     debugAttributes(n.attributes),
+		}
+		seg.Children, next = debugSegmentChildren(start, nodes, next+1, &n.stop.Stamp, threadID)
+		children = append(children, seg)
+	}
+	return children, next
+}
+
+func newDebugTrace(txn *txn) *debugTrace {
+	trace := &debugTrace{
+		Name:           txn.FinalName,
+		Start:          txn.Start,
+		DurationMillis: durationMillis(txn.Duration),
+		TraceID:        txn.BetterCAT.TraceID,
+		Segments:       []*debugSegment{},
+		Spans:          []debugSpan{},
+	}
+	nodes := make(sortedTraceNodes, len(txn.TxnTrace.nodes))
+	for i := range nodes {
+		nodes[i] = &txn.TxnTrace.nodes[i]
+	}
+	sort.Sort(nodes)
+	for next := 0; next < len(nodes); {
+		var children []*debugSegment
+		children, next = debugSegmentChildren(txn.Start, nodes, next, nil, nodes[next].threadID)
+		trace.Segments = append(trace.Segments, children...)
+	}
+	if !txn.shouldCollectSpanEvents() {
+		// Span events of segments are recorded even when the
+		// transaction is not sampled.
+		return trace
+	}
+	for _, evt := range txn.SpanEvents {
+		trace.Spans = append(trace.Spans, debugSpan{
+			GUID:            evt.GUID,
+			ParentID:        evt.ParentID,
+			Name:            evt.Name,
+			Category:        evt.Category,
+			StartMillis:     durationMillis(evt.Timestamp.Sub(txn.Start)),
+			DurationMillis:  durationMillis(evt.Duration),
+			AgentAttributes: debugAttributes(evt.AgentAttributes),
+			UserAttributes:  debugAttributes(evt.UserAttributes),
+		})
+	}
+	return trace
+}
+
+// newChromeTrace converts the trace into the Chrome trace event format.  The
+// segments are shown in one process with a thread for each goroutine, below
+// the transaction itself, and the span events are shown in another process.
+func newChromeTrace(trace *debugTrace) *chromeTrace {
+	ct := &chromeTrace{DisplayTimeUnit: "ms"}
+	start := trace.Start.UnixNano() / 1000
+	micros := func(millis float64) int64 { return int64(millis * 1000.0) }
+	metadata := func(pid int, name string) {
+		js, _ := json.Marshal(name)
+		ct.TraceEvents = append(ct.TraceEvents, chromeTraceEvent{
+			Name:  "process_name",
+			Phase: "M",
+			PID:   pid,
+			Args:  map[string]json.RawMessage{"name": js},
+		})
+	}
+	metadata(chromeSegmentsPID, "Segments")
+	ct.TraceEvents = append(ct.TraceEvents, chromeTraceEvent{
+		Name:      trace.Name,
+		Category:  "Transaction",
+		Phase:     "X",
+		Timestamp: start,
+		Duration:  micros(trace.DurationMillis),
+		PID:       chromeSegmentsPID,
+	})
+	var addSegments func(segs []*debugSegment)
+	addSegments = func(segs []*debugSegment) {
+		for _, seg := range segs {
+			ct.TraceEvents = append(ct.TraceEvents, chromeTraceEvent{
+				Name:      seg.Name,
+				Category:  "Segment",
+				Phase:     "X",
+				Timestamp: start + micros(seg.StartMillis),
+				Duration:  micros(seg.DurationMillis),
+				PID:       chromeSegmentsPID,
+				TID:       seg.Thread,
+				Args:      seg.Attributes,
+			})
+			addSegments(seg.Children)
+		}
+	}
+	addSegments(trace.Segments)
+	if len(trace.Spans) > 0 {
+		metadata(chromeSpansPID, "Spans")
+	}
+	for _, span := range trace.Spans {
+		ct.TraceEvents = append(ct.TraceEvents, chromeTraceEvent{
+			Name:      span.Name,
+			Category:  string(span.Category),
+			Phase:     "X",
+			Timestamp: start + micros(span.StartMillis),
+			Duration:  micros(span.DurationMillis),
+			PID:       chromeSpansPID,
+			Args:      span.AgentAttributes,
+		})
+	}
+	return ct
+}
+
+// debugTraceFileName returns the name of the files of a transaction without
+// the suffix.  The names sort by the start of the transaction.
+func debugTraceFileName(start time.Time, seq uint64, name string) string {
+	safe := []byte(name)
+	for i, c := range safe {
+		if !isDebugTraceNameChar(c) {
+			safe[i] = '_'
+		}
+	}
+	if len(safe) > maxDebugTraceNameLen {
+		safe = safe[:maxDebugTraceNameLen]
+	}
+	return fmt.Sprintf("%s-%06d-%s", start.UTC().Format("20060102T150405.000000000"), seq, safe)
+}
+
+func isDebugTraceNameChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') ||
+		c == '-' || c == '.'
+}
+
+// write writes the JSON and Chrome trace files of the transaction.  It is
+// called when the transaction ends, while the transaction is locked.
+func (w *debugTraceWriter) write(txn *txn) {
+	trace := newDebugTrace(txn)
+	seq := atomic.AddUint64(&w.seq, 1)
+	base := filepath.Join(w.dir, debugTraceFileName(trace.Start, seq, trace.Name))
+
+	for _, f := range []struct {
+		path string
+		v    interface{}
+	}{
+		{path: base + debugTraceSuffix, v: trace},
+		{path: base + debugChromeTraceSuffix, v: newChromeTrace(trace)},
+	} {
+		js, err := json.MarshalIndent(f.v, "", "  ")
+		if nil == err {
+			err = ioutil.WriteFile(f.path, js, 0644)
+		}
+		if nil != err {
+			w.lg.Warn("unable to write debug trace", map[string]interface{}{
+				"path":  f.path,
+				"error": err.Error(),
+			})
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package newrelic
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/newrelic/go-agent/v3/internal"
+)
+
+func debugTraceTestApp(t *testing.T, replyfn func(*internal.ConnectReply), cfgfn func(*Config)) (expectApp, string, func()) {
+	dir, err := ioutil.TempDir("", "debugtraces")
+	if nil != err {
+		t.Fatal(err)
+	}
+	tapp := testApp(replyfn, func(cfg *Config) {
+		ConfigDebugTraces(dir)(cfg)
+		cfg.TransactionTracer.Segments.Threshold = 0
+		if nil != cfgfn {
+			cfgfn(cfg)
+		}
+	}, t)
+	return tapp, dir, func() { os.RemoveAll(dir) }
+}
+
+func readDebugTrace(t *testing.T, dir, suffix string, v interface{}) {
+	names, err := filepath.Glob(filepath.Join(dir, "*"+suffix))
+	if nil != err {
+		t.Fatal(err)
+	}
+	var matched []string
+	for _, name := range names {
+		// The JSON suffix is also the end of the Chrome trace suffix.
+		if suffix == debugTraceSuffix && strings.HasSuffix(name, debugChromeTraceSuffix) {
+			continue
+		}
+		matched = append(matched, name)
+	}
+	if len(matched) != 1 {
+		t.Fatal(matched)
+	}
+	js, err := ioutil.ReadFile(matched[0])
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(js, v); nil != err {
+		t.Fatal(err)
+	}
+}
+
+func TestDebugTraces(t *testing.T) {
+	tapp, dir, cleanup := debugTraceTestApp(t, nil, nil)
+	defer cleanup()
+
+	txn := tapp.StartTransaction("hello/world")
+	outer := txn.StartSegment("outer")
+	inner := txn.StartSegment("inner")
+	time.Sleep(time.Millisecond)
+	inner.End()
+	outer.End()
+	async := txn.NewGoroutine()
+	async.StartSegment("async").End()
+	txn.End()
+
+	var trace debugTrace
+	readDebugTrace(t, dir, debugTraceSuffix, &trace)
+	if trace.Name != "OtherTransaction/Go/hello/world" {
+		t.Error(trace.Name)
+	}
+	if len(trace.Segments) != 2 {
+		t.Fatal(len(trace.Segments))
+	}
+	out := trace.Segments[0]
+	if out.Name != "Custom/outer" || out.Thread != 0 || len(out.Children) != 1 {
+		t.Fatal(out.Name, out.Thread, len(out.Children))
+	}
+	if in := out.Children[0]; in.Name != "Custom/inner" || in.DurationMillis < 1 || in.DurationMillis > out.DurationMillis {
+		t.Error(in.Name, in.DurationMillis, out.DurationMillis)
+	}
+	if as := trace.Segments[1]; as.Name != "Custom/async" || as.Thread == 0 {
+		t.Error(as.Name, as.Thread)
+	}
+
+	var ct struct {
+		TraceEvents []chromeTraceEvent `json:"traceEvents"`
+	}
+	readDebugTrace(t, dir, debugChromeTraceSuffix, &ct)
+	var names []string
+	for _, e := range ct.TraceEvents {
+		if e.PID == chromeSegmentsPID && e.Phase == "X" {
+			names = append(names, e.Name)
+		}
+	}
+	expect := "OtherTransaction/Go/hello/world,Custom/outer,Custom/inner,Custom/async"
+	if strings.Join(names, ",") != expect {
+		t.Error(names)
+	}
+}
+
+func TestDebugTracesSpans(t *testing.T) {
+	tapp, dir, cleanup := debugTraceTestApp(t, distributedTracingReplyFields, enableBetterCAT)
+	defer cleanup()
+
+	txn := tapp.StartTransaction("hello")
+	txn.StartSegment("segment").End()
+	txn.End()
+
+	var trace debugTrace
+	readDebugTrace(t, dir, debugTraceSuffix, &trace)
+	if len(trace.Spans) != 2 {
+		t.Fatal(trace.Spans)
+	}
+	seg, root := trace.Spans[0], trace.Spans[1]
+	if root.Name != "OtherTransaction/Go/hello" || seg.Name != "Custom/segment" || seg.ParentID != root.GUID {
+		t.Error(root, seg)
+	}
+	if trace.TraceID == "" {
+		t.Error("missing trace id")
+	}
+}
+
+func TestDebugTracesIgnored(t *testing.T) {
+	tapp, dir, cleanup := debugTraceTestApp(t, nil, nil)
+	defer cleanup()
+
+	txn := tapp.StartTransaction("hello")
+	txn.Ignore()
+	txn.End()
+
+	names, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(names) != 0 {
+		t.Error(names)
+	}
+}
+
+func TestDebugTraceFileName(t *testing.T) {
+	start := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	name := debugTraceFileName(start, 7, "WebTransaction/Go/GET /users/{id}")
+	if name != "20200102T030405.000000006-000007-WebTransaction_Go_GET__users__id_" {
+		t.Error(name)
+	}
+	long := debugTraceFileName(start, 7, strings.Repeat("a", 200))
+	if !strings.HasSuffix(long, "-"+strings.Repeat("a", maxDebugTraceNameLen)) {
+		t.Error(long)
+	}
+}
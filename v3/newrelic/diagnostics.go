@@ -0,0 +1,379 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package newrelic
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/newrelic/go-agent/v3/internal"
+)
+
+const (
+	// maxDiagnosticsRequests is the number of recent harvest requests
+	// kept for the diagnostics handler.
+	maxDiagnosticsRequests = 50
+	// diagnosticsTimeout limits the time the diagnostics handler waits
+	// for the application's processing goroutine.
+	diagnosticsTimeout = time.Second
+
+	traceObserverMetricPrefix = "Supportability/InfiniteTracing/"
+)
+
+// DiagnosticsHandler returns an http.Handler which responds with the state of
+// the agent as JSON:  The connection state, the limits and report periods of
+// the current connection, the fill levels and the numbers of items seen and
+// sent of the event reservoirs, the supportability metrics of the Infinite
+// Tracing trace observer, the configuration and security policies applied by
+// the server, and the results of recent harvest requests.  Secrets such as the
+// license key and the request headers of the connection are not included.
+//
+// The handler is meant to be mounted on an internal administration port:
+//
+//	mux := http.NewServeMux()
+//	mux.Handle("/debug/newrelic", app.DiagnosticsHandler())
+//	go http.ListenAndServe("localhost:6060", mux)
+func (app *Application) DiagnosticsHandler() http.Handler {
+	if nil == app || nil == app.app {
+		return http.NotFoundHandler()
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		js, err := json.MarshalIndent(app.app.diagnostics(time.Now()), "", "  ")
+		if nil != err {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(js)
+	})
+}
+
+// appDiagnostics contains the information gathered for the diagnostics handler
+// as the application runs.
+type appDiagnostics struct {
+	sync.Mutex
+	// totals contains the numbers of items seen and sent of each reservoir
+	// since the application was created.
+	totals map[string]*diagnosticsTotals
+	// observer contains the supportability metrics of the trace observer
+	// since the application was created.
+	observer map[string]float64
+	// requests are the most recent harvest requests, oldest first.
+	requests []diagnosticsRequest
+}
+
+type diagnosticsTotals struct {
+	Seen float64 `json:"seen"`
+	Sent float64 `json:"sent"`
+}
+
+type diagnosticsRequest struct {
+	Time         time.Time `json:"time"`
+	Destination  string    `json:"destination"`
+	Endpoint     string    `json:"endpoint"`
+	DurationMS   float64   `json:"duration_ms"`
+	StatusCode   int       `json:"status_code,omitempty"`
+	PayloadBytes int       `json:"payload_bytes"`
+	Error        string    `json:"error,omitempty"`
+	RetainData   bool      `json:"retain_data,omitempty"`
+}
+
+// diagnosticsReservoir is the state of a reservoir of the harvest being
+// gathered.
+type diagnosticsReservoir struct {
+	Capacity int     `json:"capacity"`
+	Stored   int     `json:"stored"`
+	Seen     float64 `json:"seen"`
+	// Totals is set by the handler.
+	Totals *diagnosticsTotals `json:"totals,omitempty"`
+}
+
+type diagnosticsConnection struct {
+	State      string `json:"state"`
+	Error      string `json:"error,omitempty"`
+	RunID      string `json:"run_id,omitempty"`
+	EntityGUID string `json:"entity_guid,omitempty"`
+	Collector  string `json:"collector,omitempty"`
+}
+
+type diagnosticsRun struct {
+	ReportPeriodsMS       map[string]int64 `json:"report_periods_ms"`
+	Limits                map[string]int   `json:"limits"`
+	MaxPayloadSizeInBytes int              `json:"max_payload_size_in_bytes"`
+	SamplingTarget        uint64           `json:"sampling_target"`
+	SamplingTargetPeriodS int              `json:"sampling_target_period_in_seconds"`
+}
+
+type diagnosticsServerConfig struct {
+	ApdexThresholdSeconds  float64                     `json:"apdex_t"`
+	CollectAnalyticsEvents bool                        `json:"collect_analytics_events"`
+	CollectCustomEvents    bool                        `json:"collect_custom_events"`
+	CollectTraces          bool                        `json:"collect_traces"`
+	CollectErrors          bool                        `json:"collect_errors"`
+	CollectErrorEvents     bool                        `json:"collect_error_events"`
+	CollectSpanEvents      bool                        `json:"collect_span_events"`
+	AgentConfig            interface{}                 `json:"agent_config"`
+	EventHarvestConfig     internal.EventHarvestConfig `json:"event_harvest_config"`
+}
+
+type diagnosticsTraceObserver struct {
+	Enabled   bool               `json:"enabled"`
+	Connected bool               `json:"connected"`
+	Metrics   map[string]float64 `json:"metrics"`
+}
+
+// diagnostics is the JSON of the diagnostics handler.
+type diagnostics struct {
+	Time             time.Time                       `json:"time"`
+	AppName          string                          `json:"app_name"`
+	AgentVersion     string                          `json:"agent_version"`
+	Connection       diagnosticsConnection           `json:"connection"`
+	Run              *diagnosticsRun                 `json:"run"`
+	Reservoirs       map[string]diagnosticsReservoir `json:"reservoirs"`
+	TraceObserver    diagnosticsTraceObserver        `json:"trace_observer"`
+	ServerConfig     *diagnosticsServerConfig        `json:"server_side_config"`
+	SecurityPolicies *internal.SecurityPolicies      `json:"security_policies"`
+	Requests         []diagnosticsRequest            `json:"recent_requests"`
+}
+
+// harvestTypeNames names the harvest types in the diagnostics.
+var harvestTypeNames = []struct {
+	tp   harvestTypes
+	name string
+}{
+	{tp: harvestMetricsTraces, name: "metrics_traces"},
+	{tp: harvestSpanEvents, name: "span_events"},
+	{tp: harvestCustomEvents, name: "custom_events"},
+	{tp: harvestTxnEvents, name: "transaction_events"},
+	{tp: harvestErrorEvents, name: "error_events"},
+	{tp: harvestLogEvents, name: "log_events"},
+}
+
+func newAppDiagnostics() *appDiagnostics {
+	return &appDiagnostics{
+		totals:   make(map[string]*diagnosticsTotals),
+		observer: make(map[string]float64),
+	}
+}
+
+// harvestReservoirs returns the reservoirs of the harvest by name.  Nil
+// reservoirs are not part of the harvest.
+func harvestReservoirs(h *harvest) map[string]*analyticsEvents {
+	m := make(map[string]*analyticsEvents, 5)
+	if nil != h.SpanEvents {
+		m["span_events"] = h.SpanEvents.analyticsEvents
+	}
+	if nil != h.CustomEvents {
+		m["custom_events"] = h.CustomEvents.analyticsEvents
+	}
+	if nil != h.TxnEvents {
+		m["transaction_events"] = h.TxnEvents.analyticsEvents
+	}
+	if nil != h.ErrorEvents {
+		m["error_events"] = h.ErrorEvents.analyticsEvents
+	}
+	if nil != h.LogEvents {
+		m["log_events"] = h.LogEvents.analyticsEvents
+	}
+	return m
+}
+
+// reservoirDiagnostics returns the state of the reservoirs of the harvest
+// being gathered.  It must be called by the goroutine which owns the
+// harvest.
+func reservoirDiagnostics(h *harvest) map[string]diagnosticsReservoir {
+	if nil == h {
+		return nil
+	}
+	m := make(map[string]diagnosticsReservoir)
+	for name, events := range harvestReservoirs(h) {
+		m[name] = diagnosticsReservoir{
+			Capacity: events.capacity(),
+			Stored:   len(events.events),
+			Seen:     events.NumSeen(),
+		}
+	}
+	if nil != h.Metrics {
+		m["metrics"] = diagnosticsReservoir{
+			Capacity: h.Metrics.maxTableSize,
+			Stored:   len(h.Metrics.metrics),
+		}
+	}
+	m["error_traces"] = diagnosticsReservoir{
+		Capacity: cap(h.ErrorTraces),
+		Stored:   len(h.ErrorTraces),
+	}
+	if nil != h.SlowSQLs {
+		m["slow_queries"] = diagnosticsReservoir{
+			Capacity: maxHarvestSlowSQLs,
+			Stored:   h.SlowSQLs.Len(),
+		}
+	}
+	return m
+}
+
+// recordHarvest adds the items of the harvest about to be sent to the totals,
+// and the supportability metrics of the trace observer which have been added
+// to its metrics.
+func (d *appDiagnostics) recordHarvest(h *harvest) {
+	if nil == d {
+		return
+	}
+	d.Lock()
+	defer d.Unlock()
+
+	for name, events := range harvestReservoirs(h) {
+		t, ok := d.totals[name]
+		if !ok {
+			t = &diagnosticsTotals{}
+			d.totals[name] = t
+		}
+		t.Seen += events.NumSeen()
+		t.Sent += events.NumSaved()
+	}
+	if nil != h.Metrics {
+		for id, m := range h.Metrics.metrics {
+			if strings.HasPrefix(id.Name, traceObserverMetricPrefix) {
+				d.observer[id.Name] += m.data.countSatisfied
+			}
+		}
+	}
+}
+
+// recordRequest records the result of a harvest request.
+func (d *appDiagnostics) recordRequest(r diagnosticsRequest) {
+	if nil == d {
+		return
+	}
+	d.Lock()
+	defer d.Unlock()
+
+	if len(d.requests) >= maxDiagnosticsRequests {
+		copy(d.requests, d.requests[1:])
+		d.requests = d.requests[:len(d.requests)-1]
+	}
+	d.requests = append(d.requests, r)
+}
+
+func newDiagnosticsRequest(start time.Time, destination, endpoint string, payloadBytes int) diagnosticsRequest {
+	return diagnosticsRequest{
+		Time:         start,
+		Destination:  destination,
+		Endpoint:     endpoint,
+		DurationMS:   time.Since(start).Seconds() * 1000.0,
+		PayloadBytes: payloadBytes,
+	}
+}
+
+// requestReservoirs asks the processing goroutine for the state of the
+// reservoirs.  Nil is returned if the goroutine is not running.
+func (app *app) requestReservoirs() map[string]diagnosticsReservoir {
+	if !app.config.Enabled || app.config.ServerlessMode.Enabled {
+		return nil
+	}
+	reply := make(chan map[string]diagnosticsReservoir, 1)
+	t := time.NewTimer(diagnosticsTimeout)
+	defer t.Stop()
+	select {
+	case app.diagnosticsRequests <- reply:
+		return <-reply
+	case <-app.shutdownStarted:
+	case <-t.C:
+	}
+	return nil
+}
+
+func (app *app) diagnostics(now time.Time) *diagnostics {
+	run, err := app.getState()
+	d := &diagnostics{
+		Time:         now,
+		AppName:      app.config.AppName,
+		AgentVersion: Version,
+		Reservoirs:   app.requestReservoirs(),
+	}
+
+	connected := "" != run.Reply.RunID
+	switch {
+	case !app.config.Enabled:
+		d.Connection.State = "disabled"
+	case app.config.ServerlessMode.Enabled:
+		d.Connection.State = "serverless"
+	case app.config.OTLPExporter.Enabled:
+		d.Connection.State = "otlp"
+	case nil != err:
+		d.Connection.State = "disconnected"
+		d.Connection.Error = err.Error()
+	case connected:
+		d.Connection.State = "connected"
+	default:
+		d.Connection.State = "connecting"
+	}
+	if connected {
+		d.Connection.RunID = run.Reply.RunID.String()
+		d.Connection.EntityGUID = run.Reply.EntityGUID
+		d.Connection.Collector = run.Reply.Collector
+
+		d.Run = &diagnosticsRun{
+			ReportPeriodsMS:       make(map[string]int64),
+			MaxPayloadSizeInBytes: run.Reply.MaxPayloadSizeInBytes,
+			SamplingTarget:        run.Reply.SamplingTarget,
+			SamplingTargetPeriodS: run.Reply.SamplingTargetPeriodInSeconds,
+			Limits: map[string]int{
+				"span_events":        run.harvestConfig.MaxSpanEvents,
+				"custom_events":      run.harvestConfig.MaxCustomEvents,
+				"error_events":       run.harvestConfig.MaxErrorEvents,
+				"transaction_events": run.harvestConfig.MaxTxnEvents,
+				"log_events":         run.harvestConfig.MaxLogEvents,
+			},
+		}
+		for tps, period := range run.harvestConfig.ReportPeriods {
+			for _, n := range harvestTypeNames {
+				if 0 != tps&n.tp {
+					d.Run.ReportPeriodsMS[n.name] = int64(period / time.Millisecond)
+				}
+			}
+		}
+		d.ServerConfig = &diagnosticsServerConfig{
+			ApdexThresholdSeconds:  run.Reply.ApdexThresholdSeconds,
+			CollectAnalyticsEvents: run.Reply.CollectAnalyticsEvents,
+			CollectCustomEvents:    run.Reply.CollectCustomEvents,
+			CollectTraces:          run.Reply.CollectTraces,
+			CollectErrors:          run.Reply.CollectErrors,
+			CollectErrorEvents:     run.Reply.CollectErrorEvents,
+			CollectSpanEvents:      run.Reply.CollectSpanEvents,
+			AgentConfig:            run.Reply.ServerSideConfig,
+			EventHarvestConfig:     run.Reply.EventData,
+		}
+		d.SecurityPolicies = run.Reply.SecurityPolicies.PointerIfPopulated()
+	}
+
+	d.TraceObserver.Enabled = shouldUseTraceObserver(run.Config)
+	if obs := app.getObserver(); nil != obs {
+		d.TraceObserver.Connected = obs.initialConnCompleted()
+	}
+
+	diag := app.diagnosticsState
+	diag.Lock()
+	defer diag.Unlock()
+
+	for name, t := range diag.totals {
+		r := d.Reservoirs[name]
+		cpy := *t
+		r.Totals = &cpy
+		if nil == d.Reservoirs {
+			d.Reservoirs = make(map[string]diagnosticsReservoir)
+		}
+		d.Reservoirs[name] = r
+	}
+	d.TraceObserver.Metrics = make(map[string]float64, len(diag.observer))
+	for name, val := range diag.observer {
+		d.TraceObserver.Metrics[name] = val
+	}
+	d.Requests = make([]diagnosticsRequest, len(diag.requests))
+	copy(d.Requests, diag.requests)
+	return d
+}
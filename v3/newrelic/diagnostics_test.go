@@ -0,0 +1,175 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package newrelic
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/newrelic/go-agent/v3/internal"
+)
+
+func getDiagnostics(t *testing.T, h http.Handler) map[string]interface{} {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/debug/newrelic", nil))
+	if w.Code != http.StatusOK {
+		t.Fatal(w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Error(ct)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &m); nil != err {
+		t.Fatal(err, w.Body.String())
+	}
+	return m
+}
+
+func TestDiagnosticsHandlerNilApp(t *testing.T) {
+	var app *Application
+	w := httptest.NewRecorder()
+	app.DiagnosticsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusNotFound {
+		t.Error(w.Code)
+	}
+}
+
+func TestDiagnosticsHandlerDisabled(t *testing.T) {
+	tapp := testApp(nil, nil, t)
+	m := getDiagnostics(t, tapp.DiagnosticsHandler())
+	conn := m["connection"].(map[string]interface{})
+	if conn["state"] != "disabled" {
+		t.Error(conn)
+	}
+	if m["app_name"] != "my app" || m["agent_version"] != Version {
+		t.Error(m["app_name"], m["agent_version"])
+	}
+	if nil != m["run"] || nil != m["server_side_config"] {
+		t.Error(m["run"], m["server_side_config"])
+	}
+}
+
+func TestDiagnosticsConnected(t *testing.T) {
+	tapp := testApp(nil, nil, t)
+	a := tapp.Private.(*app)
+	reply := internal.ConnectReplyDefaults()
+	reply.RunID = "my-run"
+	reply.EntityGUID = "my-guid"
+	reply.Collector = "collector.newrelic.com"
+	reply.RequestHeadersMap = map[string]string{"secret": "header"}
+	reply.EventData = internal.DefaultEventHarvestConfig(7)
+	a.setState(newAppRun(a.config, reply), nil)
+	a.config.Enabled = true
+
+	// The processing goroutine is not running in tests.
+	go func() {
+		reply := <-a.diagnosticsRequests
+		reply <- map[string]diagnosticsReservoir{
+			"custom_events": {Capacity: 10, Stored: 2, Seen: 3},
+		}
+	}()
+	a.diagnosticsState.recordRequest(diagnosticsRequest{Destination: "collector", Endpoint: "metric_data", StatusCode: 200})
+	a.diagnosticsState.totals["custom_events"] = &diagnosticsTotals{Seen: 30, Sent: 20}
+
+	d := a.diagnostics(now)
+	expect := diagnosticsConnection{
+		State:      "connected",
+		RunID:      "my-run",
+		EntityGUID: "my-guid",
+		Collector:  "collector.newrelic.com",
+	}
+	if d.Connection != expect {
+		t.Error(d.Connection)
+	}
+	if d.Run.Limits["transaction_events"] != 7 {
+		t.Error(d.Run.Limits)
+	}
+	if d.Run.ReportPeriodsMS["metrics_traces"] != 60000 || d.Run.ReportPeriodsMS["span_events"] != 60000 {
+		t.Error(d.Run.ReportPeriodsMS)
+	}
+	r := d.Reservoirs["custom_events"]
+	if r.Capacity != 10 || r.Stored != 2 || r.Seen != 3 || r.Totals.Seen != 30 || r.Totals.Sent != 20 {
+		t.Error(r, r.Totals)
+	}
+	if len(d.Requests) != 1 || d.Requests[0].Endpoint != "metric_data" {
+		t.Error(d.Requests)
+	}
+	if !d.ServerConfig.CollectTraces {
+		t.Error(d.ServerConfig)
+	}
+	js, err := json.Marshal(d)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(js), "secret") {
+		t.Error("request headers included", string(js))
+	}
+}
+
+func TestDiagnosticsDisconnected(t *testing.T) {
+	tapp := testApp(nil, nil, t)
+	a := tapp.Private.(*app)
+	a.setState(nil, errors.New("license exception"))
+	a.config.Enabled = true
+	close(a.shutdownStarted)
+
+	d := a.diagnostics(now)
+	if d.Connection.State != "disconnected" || d.Connection.Error != "license exception" {
+		t.Error(d.Connection)
+	}
+	if nil != d.Reservoirs {
+		t.Error(d.Reservoirs)
+	}
+}
+
+func TestDiagnosticsReservoirs(t *testing.T) {
+	tapp := testApp(nil, nil, t)
+	a := tapp.Private.(*app)
+	for i := 0; i < 3; i++ {
+		tapp.RecordCustomEvent("myEvent", map[string]interface{}{"i": i})
+	}
+	m := reservoirDiagnostics(a.testHarvest)
+	if r := m["custom_events"]; r.Capacity != internal.MaxCustomEvents || r.Stored != 3 || r.Seen != 3 {
+		t.Error(r)
+	}
+	if r := m["metrics"]; r.Capacity != maxMetrics {
+		t.Error(r)
+	}
+	if nil != reservoirDiagnostics(nil) {
+		t.Error("reservoirs of nil harvest")
+	}
+
+	a.testHarvest.Metrics.addCount(observerSeen, 5, forced)
+	a.diagnosticsState.recordHarvest(a.testHarvest)
+	a.diagnosticsState.recordHarvest(a.testHarvest)
+	if tot := a.diagnosticsState.totals["custom_events"]; tot.Seen != 6 || tot.Sent != 6 {
+		t.Error(tot)
+	}
+	if a.diagnosticsState.observer[observerSeen] != 10 {
+		t.Error(a.diagnosticsState.observer)
+	}
+}
+
+func TestDiagnosticsRecentRequests(t *testing.T) {
+	d := newAppDiagnostics()
+	start := time.Now()
+	for i := 0; i < maxDiagnosticsRequests+5; i++ {
+		r := newDiagnosticsRequest(start, "collector", "metric_data", i)
+		d.recordRequest(r)
+	}
+	if len(d.requests) != maxDiagnosticsRequests {
+		t.Fatal(len(d.requests))
+	}
+	if d.requests[0].PayloadBytes != 5 || d.requests[maxDiagnosticsRequests-1].PayloadBytes != maxDiagnosticsRequests+4 {
+		t.Error(d.requests[0], d.requests[maxDiagnosticsRequests-1])
+	}
+	var nilDiagnostics *appDiagnostics
+	nilDiagnostics.recordRequest(diagnosticsRequest{})
+	nilDiagnostics.recordHarvest(&harvest{})
+}
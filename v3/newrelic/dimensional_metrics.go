@@ -0,0 +1,293 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package newrelic
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MetricType is the type of a dimensional metric recorded using
+// Application.RecordMetric.
+type MetricType int
+
+const (
+	// MetricCount is a counter.  The values recorded during each harvest
+	// period are summed.
+	MetricCount MetricType = iota
+	// MetricGauge is a gauge.  The last value recorded during each harvest
+	// period is reported.
+	MetricGauge
+	// MetricSummary is a summary.  The count, sum, minimum, and maximum of
+	// the values recorded during each harvest period are reported.
+	MetricSummary
+)
+
+func (t MetricType) String() string {
+	switch t {
+	case MetricCount:
+		return "count"
+	case MetricGauge:
+		return "gauge"
+	case MetricSummary:
+		return "summary"
+	}
+	return fmt.Sprintf("MetricType(%d)", int(t))
+}
+
+var (
+	errMetricType           = errors.New("invalid metric type")
+	errMetricAttributeLimit = fmt.Errorf("metric attribute limit of %d exceeded",
+		attributeUserLimit)
+)
+
+// dimensionalMetricID identifies a time series: A metric name and type
+// together with one set of attribute values.  attributes is the JSON object
+// of the attributes with its keys sorted, which makes equal sets of
+// attributes produce equal IDs.
+type dimensionalMetricID struct {
+	name       string
+	metricType MetricType
+	attributes string
+}
+
+type dimensionalMetricData struct {
+	count float64
+	sum   float64
+	min   float64
+	max   float64
+	// last is the most recently recorded value, which is the value of a
+	// gauge.
+	last float64
+}
+
+func dimensionalMetricDataFromValue(value float64) dimensionalMetricData {
+	return dimensionalMetricData{
+		count: 1,
+		sum:   value,
+		min:   value,
+		max:   value,
+		last:  value,
+	}
+}
+
+// aggregate combines data with src, which was recorded after data.
+func (data *dimensionalMetricData) aggregate(src dimensionalMetricData) {
+	data.count += src.count
+	data.sum += src.sum
+	if src.min < data.min {
+		data.min = src.min
+	}
+	if src.max > data.max {
+		data.max = src.max
+	}
+	data.last = src.last
+}
+
+type dimensionalMetric struct {
+	attributes map[string]interface{}
+	data       dimensionalMetricData
+}
+
+// dimensionalMetrics aggregates dimensional metrics during a harvest period.
+// The number of time series is limited both in total and per metric name, so
+// that attributes with unbounded values cannot exhaust memory.  Values which
+// would create series beyond these limits are dropped and counted.
+type dimensionalMetrics struct {
+	metricPeriodStart time.Time
+	failedHarvests    int
+	maxSeries         int
+	maxSeriesPerName  int
+	metrics           map[dimensionalMetricID]*dimensionalMetric
+	seriesPerName     map[string]int
+	numDropped        int
+}
+
+func newDimensionalMetrics(now time.Time) *dimensionalMetrics {
+	return &dimensionalMetrics{
+		metricPeriodStart: now,
+		maxSeries:         maxDimensionalMetricSeries,
+		maxSeriesPerName:  maxDimensionalMetricSeriesPerName,
+		metrics:           make(map[dimensionalMetricID]*dimensionalMetric),
+		seriesPerName:     make(map[string]int),
+	}
+}
+
+// dimensionalMetricAttributesJSON returns the JSON object of the attributes
+// with its keys sorted.
+func dimensionalMetricAttributesJSON(attributes map[string]interface{}) string {
+	if 0 == len(attributes) {
+		return ""
+	}
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	w := jsonFieldsWriter{buf: buf}
+	for _, key := range keys {
+		writeAttributeValueJSON(&w, key, attributes[key])
+	}
+	buf.WriteByte('}')
+	return buf.String()
+}
+
+func (dm *dimensionalMetrics) merge(id dimensionalMetricID, m dimensionalMetric) {
+	if to := dm.metrics[id]; nil != to {
+		to.data.aggregate(m.data)
+		return
+	}
+	if len(dm.metrics) >= dm.maxSeries || dm.seriesPerName[id.name] >= dm.maxSeriesPerName {
+		dm.numDropped++
+		return
+	}
+	alloc := new(dimensionalMetric)
+	*alloc = m
+	dm.metrics[id] = alloc
+	dm.seriesPerName[id.name]++
+}
+
+func (dm *dimensionalMetrics) add(name string, metricType MetricType, value float64, attributes map[string]interface{}) {
+	id := dimensionalMetricID{
+		name:       name,
+		metricType: metricType,
+		attributes: dimensionalMetricAttributesJSON(attributes),
+	}
+	dm.merge(id, dimensionalMetric{
+		attributes: attributes,
+		data:       dimensionalMetricDataFromValue(value),
+	})
+}
+
+func (dm *dimensionalMetrics) mergeFailed(from *dimensionalMetrics) {
+	fails := from.failedHarvests + 1
+	if fails >= failedMetricAttemptsLimit {
+		return
+	}
+	if from.metricPeriodStart.Before(dm.metricPeriodStart) {
+		dm.metricPeriodStart = from.metricPeriodStart
+	}
+	dm.failedHarvests = fails
+	for id, m := range from.metrics {
+		// The failed data was recorded before the current data, so it
+		// must not replace the current value of a gauge.
+		if to := dm.metrics[id]; nil != to {
+			data := m.data
+			data.aggregate(to.data)
+			to.data = data
+			continue
+		}
+		dm.merge(id, *m)
+	}
+}
+
+// MergeIntoHarvest implements harvestable.
+func (dm *dimensionalMetrics) MergeIntoHarvest(h *harvest) {
+	h.DimensionalMetrics.mergeFailed(dm)
+}
+
+// Data prepares the JSON of the dimensional_metric_data payload.  The values
+// of each series are sent in the format of its type.
+func (dm *dimensionalMetrics) Data(agentRunID string, harvestStart time.Time) ([]byte, error) {
+	if 0 == len(dm.metrics) {
+		return nil, nil
+	}
+	estimate := 128 * len(dm.metrics)
+	buf := bytes.NewBuffer(make([]byte, 0, estimate))
+
+	buf.WriteString(`[{"common":{`)
+	w := jsonFieldsWriter{buf: buf}
+	w.intField("timestamp", timeToIntMillis(dm.metricPeriodStart))
+	w.intField("interval.ms", harvestStart.Sub(dm.metricPeriodStart).Nanoseconds()/int64(time.Millisecond))
+	buf.WriteString(`},"metrics":[`)
+	first := true
+	for id, m := range dm.metrics {
+		if first {
+			first = false
+		} else {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('{')
+		w := jsonFieldsWriter{buf: buf}
+		w.stringField("name", id.name)
+		w.stringField("type", id.metricType.String())
+		switch id.metricType {
+		case MetricCount:
+			w.floatField("value", m.data.sum)
+		case MetricGauge:
+			w.floatField("value", m.data.last)
+		case MetricSummary:
+			w.addKey("value")
+			buf.WriteByte('{')
+			vw := jsonFieldsWriter{buf: buf}
+			vw.floatField("count", m.data.count)
+			vw.floatField("sum", m.data.sum)
+			vw.floatField("min", m.data.min)
+			vw.floatField("max", m.data.max)
+			buf.WriteByte('}')
+		}
+		if "" != id.attributes {
+			w.rawField("attributes", jsonString(id.attributes))
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteString(`]}]`)
+
+	return buf.Bytes(), nil
+}
+
+// EndpointMethod implements payloadCreator.
+func (dm *dimensionalMetrics) EndpointMethod() string {
+	return cmdDimensionalMetrics
+}
+
+// dimensionalMetricRecord is a harvestable containing a single recorded
+// value.
+type dimensionalMetricRecord struct {
+	name       string
+	metricType MetricType
+	value      float64
+	attributes map[string]interface{}
+}
+
+// MergeIntoHarvest implements harvestable.
+func (r dimensionalMetricRecord) MergeIntoHarvest(h *harvest) {
+	h.DimensionalMetrics.add(r.name, r.metricType, r.value, r.attributes)
+}
+
+// createDimensionalMetricRecord validates the value and attributes of a
+// dimensional metric.  The attributes are copied so that the caller may
+// reuse the map.
+func createDimensionalMetricRecord(metricType MetricType, name string, value float64, attributes map[string]interface{}) (dimensionalMetricRecord, error) {
+	r := dimensionalMetricRecord{
+		name:       name,
+		metricType: metricType,
+		value:      value,
+	}
+	if metricType < MetricCount || metricType > MetricSummary {
+		return r, errMetricType
+	}
+	if err := validateMetricValue(name, value); nil != err {
+		return r, err
+	}
+	if len(attributes) > attributeUserLimit {
+		return r, errMetricAttributeLimit
+	}
+	for key, val := range attributes {
+		val, err := validateUserAttribute(key, val)
+		if nil != err {
+			return r, err
+		}
+		if nil == r.attributes {
+			r.attributes = make(map[string]interface{}, len(attributes))
+		}
+		r.attributes[key] = val
+	}
+	return r, nil
+}
@@ -0,0 +1,241 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package newrelic
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/newrelic/go-agent/v3/internal"
+)
+
+func TestDimensionalMetricsAggregate(t *testing.T) {
+	dm := newDimensionalMetrics(now)
+	dm.add("orders", MetricCount, 1, map[string]interface{}{"region": "us", "tier": 1})
+	dm.add("orders", MetricCount, 2, map[string]interface{}{"tier": 1, "region": "us"})
+	dm.add("orders", MetricCount, 4, map[string]interface{}{"region": "eu", "tier": 1})
+	dm.add("orders", MetricGauge, 9, map[string]interface{}{"region": "us", "tier": 1})
+	dm.add("queue", MetricGauge, 3, nil)
+	dm.add("queue", MetricGauge, 1, nil)
+	dm.add("latency", MetricSummary, 2, nil)
+	dm.add("latency", MetricSummary, 5, nil)
+
+	if len(dm.metrics) != 5 {
+		t.Fatal(len(dm.metrics))
+	}
+	us := dm.metrics[dimensionalMetricID{
+		name:       "orders",
+		metricType: MetricCount,
+		attributes: `{"region":"us","tier":1}`,
+	}]
+	if nil == us || us.data.sum != 3 || us.data.count != 2 {
+		t.Error(us)
+	}
+	queue := dm.metrics[dimensionalMetricID{name: "queue", metricType: MetricGauge}]
+	if nil == queue || queue.data.last != 1 {
+		t.Error(queue)
+	}
+	latency := dm.metrics[dimensionalMetricID{name: "latency", metricType: MetricSummary}]
+	if nil == latency || latency.data != (dimensionalMetricData{count: 2, sum: 7, min: 2, max: 5, last: 5}) {
+		t.Error(latency)
+	}
+}
+
+func TestDimensionalMetricsLimits(t *testing.T) {
+	h := newHarvest(now, dfltHarvestCfgr)
+	h.DimensionalMetrics.maxSeries = 3
+	h.DimensionalMetrics.maxSeriesPerName = 2
+	for i := 0; i < 3; i++ {
+		attrs := map[string]interface{}{"id": strconv.Itoa(i)}
+		h.DimensionalMetrics.add("users", MetricCount, 1, attrs)
+	}
+	h.DimensionalMetrics.add("orders", MetricCount, 1, nil)
+	h.DimensionalMetrics.add("visits", MetricCount, 1, nil)
+	// Existing series are aggregated when the limits have been reached.
+	h.DimensionalMetrics.add("users", MetricCount, 1, map[string]interface{}{"id": "0"})
+
+	if len(h.DimensionalMetrics.metrics) != 3 || h.DimensionalMetrics.numDropped != 2 {
+		t.Fatal(len(h.DimensionalMetrics.metrics), h.DimensionalMetrics.numDropped)
+	}
+
+	ready := h.Ready(now.Add(61 * time.Second))
+	if nil == ready.DimensionalMetrics || len(ready.DimensionalMetrics.metrics) != 3 {
+		t.Fatal(ready.DimensionalMetrics)
+	}
+	if len(h.DimensionalMetrics.metrics) != 0 || h.DimensionalMetrics.numDropped != 0 {
+		t.Error(h.DimensionalMetrics)
+	}
+	expectMetricsPresent(t, ready.Metrics, []internal.WantMetric{
+		{Name: dimensionalMetricsDropped, Forced: true, Data: []float64{2, 0, 0, 0, 0, 0}},
+	})
+}
+
+func TestDimensionalMetricsPayload(t *testing.T) {
+	dm := newDimensionalMetrics(now)
+	if js, err := dm.Data("agentRunID", now); nil != js || nil != err {
+		t.Error(string(js), err)
+	}
+	dm.add("orders", MetricCount, 2, map[string]interface{}{"region": "us", "paid": true})
+	js, err := dm.Data("agentRunID", now.Add(time.Minute))
+	if nil != err {
+		t.Fatal(err)
+	}
+	expect := `[{"common":{"timestamp":1417136460000,"interval.ms":60000},"metrics":[` +
+		`{"name":"orders","type":"count","value":2,"attributes":{"paid":true,"region":"us"}}]}]`
+	if string(js) != expect {
+		t.Error(string(js))
+	}
+
+	dm = newDimensionalMetrics(now)
+	dm.add("queue", MetricGauge, 1.5, nil)
+	js, _ = dm.Data("agentRunID", now.Add(time.Minute))
+	expect = `[{"common":{"timestamp":1417136460000,"interval.ms":60000},"metrics":[` +
+		`{"name":"queue","type":"gauge","value":1.5}]}]`
+	if string(js) != expect {
+		t.Error(string(js))
+	}
+
+	dm = newDimensionalMetrics(now)
+	dm.add("latency", MetricSummary, 1, nil)
+	dm.add("latency", MetricSummary, 3, nil)
+	js, _ = dm.Data("agentRunID", now.Add(time.Minute))
+	expect = `[{"common":{"timestamp":1417136460000,"interval.ms":60000},"metrics":[` +
+		`{"name":"latency","type":"summary","value":{"count":2,"sum":4,"min":1,"max":3}}]}]`
+	if string(js) != expect {
+		t.Error(string(js))
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(js, &decoded); nil != err {
+		t.Error(err)
+	}
+	if m := dm.EndpointMethod(); m != "dimensional_metric_data" {
+		t.Error(m)
+	}
+}
+
+func TestDimensionalMetricsMergeFailed(t *testing.T) {
+	start1 := now
+	start2 := now.Add(time.Minute)
+	failed := newDimensionalMetrics(start1)
+	failed.add("queue", MetricGauge, 10, nil)
+	failed.add("orders", MetricCount, 1, nil)
+
+	h := newHarvest(start2, dfltHarvestCfgr)
+	h.DimensionalMetrics.add("queue", MetricGauge, 20, nil)
+	failed.MergeIntoHarvest(h)
+
+	dm := h.DimensionalMetrics
+	if !dm.metricPeriodStart.Equal(start1) || dm.failedHarvests != 1 {
+		t.Error(dm.metricPeriodStart, dm.failedHarvests)
+	}
+	// The current value of a gauge is kept.
+	queue := dm.metrics[dimensionalMetricID{name: "queue", metricType: MetricGauge}]
+	if nil == queue || queue.data.last != 20 || queue.data.count != 2 {
+		t.Error(queue)
+	}
+	if orders := dm.metrics[dimensionalMetricID{name: "orders"}]; nil == orders || orders.data.sum != 1 {
+		t.Error(orders)
+	}
+
+	failed.failedHarvests = failedMetricAttemptsLimit
+	failed.MergeIntoHarvest(h)
+	if queue.data.count != 2 {
+		t.Error(queue)
+	}
+}
+
+func TestRecordMetric(t *testing.T) {
+	tapp := testApp(nil, nil, t)
+	attrs := map[string]interface{}{"region": "us"}
+	tapp.RecordMetric(MetricCount, "orders", 1, attrs)
+	attrs["region"] = "eu"
+	tapp.RecordMetric(MetricCount, "orders", 2, attrs)
+	tapp.expectNoLoggedErrors(t)
+
+	metrics := newHarvestData(tapp.Private.(*app).testHarvest, now, nil).DimensionalMetrics()
+	if len(metrics) != 2 {
+		t.Fatal(metrics)
+	}
+	for _, m := range metrics {
+		if m.Name != "orders" || m.Type != MetricCount || m.Count != 1 {
+			t.Error(m)
+		}
+		if region := m.Attributes["region"]; (region == "us" && m.Sum != 1) || (region == "eu" && m.Sum != 2) {
+			t.Error(m)
+		}
+	}
+	if ms := newHarvestData(&harvest{}, now, nil).DimensionalMetrics(); nil != ms {
+		t.Error(ms)
+	}
+}
+
+func TestRecordMetricInvalid(t *testing.T) {
+	testcases := []struct {
+		metricType MetricType
+		name       string
+		value      float64
+		attributes map[string]interface{}
+		err        string
+	}{
+		{metricType: MetricType(7), name: "orders", err: errMetricType.Error()},
+		{metricType: MetricGauge, name: "", err: errMetricNameEmpty.Error()},
+		{metricType: MetricGauge, name: "orders", value: math.NaN(), err: errMetricNaN.Error()},
+		{metricType: MetricGauge, name: "orders", value: math.Inf(1), err: errMetricInf.Error()},
+		{
+			metricType: MetricGauge,
+			name:       "orders",
+			attributes: map[string]interface{}{"struct": struct{}{}},
+			err:        errInvalidAttributeType{key: "struct", val: struct{}{}}.Error(),
+		},
+	}
+	for _, tc := range testcases {
+		tapp := testApp(nil, nil, t)
+		tapp.RecordMetric(tc.metricType, tc.name, tc.value, tc.attributes)
+		tapp.expectSingleLoggedError(t, "unable to record metric", map[string]interface{}{
+			"metric-name": tc.name,
+			"reason":      tc.err,
+		})
+		if n := len(tapp.Private.(*app).testHarvest.DimensionalMetrics.metrics); n != 0 {
+			t.Error(tc.name, n)
+		}
+	}
+}
+
+func TestRecordMetricHighSecurity(t *testing.T) {
+	tapp := testApp(nil, func(cfg *Config) {
+		cfg.HighSecurity = true
+	}, t)
+	tapp.RecordMetric(MetricCount, "orders", 1, map[string]interface{}{"user": "jim"})
+	tapp.expectNoLoggedErrors(t)
+	dm := tapp.Private.(*app).testHarvest.DimensionalMetrics
+	if m := dm.metrics[dimensionalMetricID{name: "orders"}]; nil == m || nil != m.attributes {
+		t.Error(dm.metrics)
+	}
+}
+
+func TestServerlessRecordMetric(t *testing.T) {
+	tapp := testApp(nil, func(cfg *Config) { cfg.ServerlessMode.Enabled = true }, t)
+	tapp.RecordMetric(MetricCount, "orders", 1, nil)
+	tapp.expectSingleLoggedError(t, "unable to record metric", map[string]interface{}{
+		"metric-name": "orders",
+		"reason":      errMetricServerless.Error(),
+	})
+}
+
+func TestNilApplicationRecordMetric(t *testing.T) {
+	var nilApp *Application
+	nilApp.RecordMetric(MetricCount, "orders", 1, nil)
+}
+
+func TestMetricTypeString(t *testing.T) {
+	if s := MetricSummary.String(); s != "summary" {
+		t.Error(s)
+	}
+	if s := MetricType(7).String(); s != "MetricType(7)" {
+		t.Error(s)
+	}
+}
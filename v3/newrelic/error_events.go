@@ -31,6 +31,12 @@ func (e *errorEvent) WriteJSON(buf *bytes.Buffer) {
 	if e.SpanID != "" {
 		w.stringField("spanId", e.SpanID)
 	}
+	if e.Expect {
+		w.boolField("error.expected", true)
+	}
+	if "" != e.GroupName {
+		w.stringField("error.group.name", e.GroupName)
+	}
 
 	sharedTransactionIntrinsics(&e.txnEvent, &w)
 	sharedBetterCATIntrinsics(&e.txnEvent, &w)
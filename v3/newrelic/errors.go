@@ -21,6 +21,12 @@ type errorAttributer interface {
 	ErrorAttributes() map[string]interface{}
 }
 
+// errorExpecter can be implemented by errors to mark them as expected when
+// using Transaction.NoticeError.
+type errorExpecter interface {
+	ErrorExpected() bool
+}
+
 // Error is an error designed for use with Transaction.NoticeError.  It allows
 // direct control over the recorded error's message, class, stacktrace, and
 // attributes.
@@ -38,6 +44,10 @@ type Error struct {
 	// or leave it nil to indicate that Transaction.NoticeError should
 	// generate one.
 	Stack []uintptr
+	// Expected marks the error as expected.  Expected errors are recorded
+	// with the error.expected attribute, but they are not counted in the
+	// error metrics and do not affect apdex.
+	Expected bool
 }
 
 // NewStackTrace generates a stack trace for the newrelic.Error struct's Stack
@@ -55,5 +65,76 @@ func (e Error) ErrorClass() string { return e.Class }
 // ErrorAttributes returns the error's extra attributes.
 func (e Error) ErrorAttributes() map[string]interface{} { return e.Attributes }
 
+// ErrorExpected returns whether the error is expected.
+func (e Error) ErrorExpected() bool { return e.Expected }
+
 // StackTrace returns the error's stack.
 func (e Error) StackTrace() []uintptr { return e.Stack }
+
+// ErrorInfo describes a recorded error to the ErrorGroupCallback.
+type ErrorInfo struct {
+	// Error is the error passed to Transaction.NoticeError, or the value
+	// recovered from a panic if it is an error.  It is nil for errors
+	// created from response codes.
+	Error error
+	// Chain contains Error followed by the errors it wraps, found using
+	// their Unwrap methods.
+	Chain []error
+	// TransactionName is the final name of the transaction, for example
+	// "WebTransaction/Go/checkout".
+	TransactionName string
+	// Class and Message are the recorded class and message of the error.
+	Class   string
+	Message string
+	// Expected is true if the error is expected.
+	Expected bool
+	// RequestAttributes contains the request attributes of the
+	// transaction, such as AttributeRequestURI and AttributeRequestMethod,
+	// and its response code.
+	RequestAttributes map[string]interface{}
+	// Stack is the stack trace of the error.  It can be resolved using
+	// runtime.CallersFrames.
+	Stack []uintptr
+}
+
+// ErrorGroupCallback returns the fingerprint used to group an error.  The
+// fingerprint is recorded as the error.group.name attribute of error events
+// and traced errors.  When the callback returns an empty string or panics, the
+// fingerprint of DefaultErrorGroup is used.  See
+// Config.ErrorCollector.ErrorGroupCallback.
+type ErrorGroupCallback func(ErrorInfo) string
+
+// DefaultErrorGroup returns a fingerprint made of the error's class, its
+// message with its numbers, hexadecimal identifiers, and quoted strings
+// replaced, and the function at the top of its stack outside of the agent.
+// Errors which differ only by the values in their message and the line on
+// which they were recorded therefore share a fingerprint.
+func DefaultErrorGroup(info ErrorInfo) string {
+	group := info.Class
+	if msg := normalizeErrorMessage(info.Message); "" != msg {
+		group += ": " + msg
+	}
+	if fn := stackTrace(info.Stack).topFunction(); "" != fn {
+		group += " at " + fn
+	}
+	return truncateStringValueIfLong(group)
+}
+
+// PanicPolicy controls what happens to a panic recovered by a deferred
+// Transaction.End or Transaction.RecordPanic once it has been recorded as an
+// error.  It is used for the Config.ErrorCollector.PanicPolicy field.
+type PanicPolicy string
+
+// These constants are the supported values of
+// Config.ErrorCollector.PanicPolicy.
+const (
+	// PanicPolicyRepanic records the panic and then re-panics it.
+	PanicPolicyRepanic PanicPolicy = "repanic"
+	// PanicPolicySwallow records the panic and does not re-panic it.
+	// Handlers instrumented with WrapHandle and WrapHandleFunc respond
+	// with a 500 status code if they had not written their header.
+	PanicPolicySwallow PanicPolicy = "swallow"
+	// PanicPolicyGoroutineDump records the panic along with the stack
+	// traces of all goroutines, and then re-panics it.
+	PanicPolicyGoroutineDump PanicPolicy = "goroutine_dump"
+)
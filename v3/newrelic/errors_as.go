@@ -0,0 +1,14 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// +build go1.13
+
+package newrelic
+
+import "errors"
+
+// errorAs finds the first error in err's chain that matches target, using the
+// As methods of the errors in the chain like errors.As.
+func errorAs(err error, target interface{}) bool {
+	return errors.As(err, target)
+}
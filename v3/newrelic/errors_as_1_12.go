@@ -0,0 +1,19 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// +build !go1.13
+
+package newrelic
+
+import "reflect"
+
+// errors.As was added in Go 1.13.  The callers walk the chain themselves, so
+// only err is checked here.
+func errorAs(err error, target interface{}) bool {
+	val := reflect.ValueOf(target).Elem()
+	if reflect.TypeOf(err).AssignableTo(val.Type()) {
+		val.Set(reflect.ValueOf(err))
+		return true
+	}
+	return false
+}
@@ -7,7 +7,9 @@ import (
 	"bytes"
 	"fmt"
 	"net/http"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/newrelic/go-agent/v3/internal/jsonx"
@@ -30,10 +32,12 @@ func panicValueMsg(v interface{}) string {
 
 // txnErrorFromPanic creates a new TxnError from a panic.
 func txnErrorFromPanic(now time.Time, v interface{}) errorData {
+	err, _ := v.(error)
 	return errorData{
 		When:  now,
 		Msg:   panicValueMsg(v),
 		Klass: panicErrorKlass,
+		err:   err,
 	}
 }
 
@@ -53,6 +57,119 @@ func txnErrorFromResponseCode(now time.Time, code int) errorData {
 	}
 }
 
+// errorMatches returns whether the error's class is one of the classes, or
+// its message contains one of the messages listed for its class.
+func errorMatches(e errorData, classes []string, messages map[string][]string) bool {
+	for _, class := range classes {
+		if e.Klass == class {
+			return true
+		}
+	}
+	for _, msg := range messages[e.Klass] {
+		if strings.Contains(e.Msg, msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// errorIsIgnored returns whether the error must not be recorded according to
+// Config.ErrorCollector.
+func errorIsIgnored(c config, e errorData) bool {
+	ec := c.ErrorCollector
+	return errorMatches(e, ec.IgnoreClasses, ec.IgnoreMessages)
+}
+
+// errorIsExpected returns whether the error is expected according to
+// Config.ErrorCollector.
+func errorIsExpected(c config, e errorData) bool {
+	ec := c.ErrorCollector
+	return errorMatches(e, ec.ExpectedClasses, ec.ExpectedMessages)
+}
+
+var (
+	errorMessageQuoted = regexp.MustCompile(`"[^"]*"|'[^']*'`)
+	errorMessageHex    = regexp.MustCompile(`\b(0x)?[0-9a-fA-F]*[0-9][0-9a-fA-F]*\b`)
+	errorMessageNumber = regexp.MustCompile(`[0-9]+`)
+)
+
+// normalizeErrorMessage replaces the parts of an error message which usually
+// differ between occurrences of the same error:  Quoted strings become "?",
+// and numbers and hexadecimal identifiers such as UUIDs become "#".
+func normalizeErrorMessage(msg string) string {
+	msg = errorMessageQuoted.ReplaceAllString(msg, `"?"`)
+	msg = errorMessageHex.ReplaceAllString(msg, "#")
+	return errorMessageNumber.ReplaceAllString(msg, "#")
+}
+
+// errorInfo returns the description of the error given to the
+// ErrorGroupCallback.
+func (e *errorData) errorInfo(txnName string, attrs *attributes) ErrorInfo {
+	info := ErrorInfo{
+		Error:             e.err,
+		TransactionName:   txnName,
+		Class:             e.Klass,
+		Message:           e.Msg,
+		Expected:          e.Expect,
+		RequestAttributes: attrs.requestAttributes(),
+		Stack:             []uintptr(e.Stack),
+	}
+	if nil != e.err {
+		info.Chain = errorChain(e.err)
+	}
+	return info
+}
+
+// errorInfos returns the descriptions of the errors used to group them.  The
+// references to the noticed errors are released.
+func (errors txnErrors) errorInfos(txnName string, attrs *attributes) []ErrorInfo {
+	infos := make([]ErrorInfo, len(errors))
+	for i, e := range errors {
+		infos[i] = e.errorInfo(txnName, attrs)
+		e.err = nil
+	}
+	return infos
+}
+
+// setGroupNames sets the group names returned by errorGroups.
+func (errors txnErrors) setGroupNames(groups []string) {
+	for i, e := range errors {
+		e.GroupName = groups[i]
+	}
+}
+
+// errorGroups returns the group names of the errors.  It calls the callback,
+// which may use the transaction, so the txn must not be locked.
+func errorGroups(callback ErrorGroupCallback, infos []ErrorInfo, lg Logger) []string {
+	groups := make([]string, len(infos))
+	for i, info := range infos {
+		groups[i] = truncateStringValueIfLong(errorGroup(callback, info, lg))
+	}
+	return groups
+}
+
+// errorGroup returns the group name returned by the callback, or
+// DefaultErrorGroup when there is no callback, or it returns an empty string
+// or panics.
+func errorGroup(callback ErrorGroupCallback, info ErrorInfo, lg Logger) (group string) {
+	if nil != callback {
+		func() {
+			defer func() {
+				if r := recover(); nil != r {
+					lg.Error("error group callback panicked", map[string]interface{}{
+						"panic": fmt.Sprint(r),
+					})
+				}
+			}()
+			group = callback(info)
+		}()
+	}
+	if "" == group {
+		group = DefaultErrorGroup(info)
+	}
+	return group
+}
+
 // errorData contains the information about a recorded error.
 type errorData struct {
 	When            time.Time
@@ -61,6 +178,87 @@ type errorData struct {
 	Msg             string
 	Klass           string
 	SpanID          string
+	// Expect is true if the error is expected.
+	Expect bool
+	// Chain describes the errors wrapped by the error noticed.  It is only
+	// recorded in traced errors, as the AttributeErrorChain attribute.
+	Chain []errorLink
+	// GroupName is the fingerprint returned by the ErrorGroupCallback or
+	// DefaultErrorGroup.
+	GroupName string
+	// Goroutines contains the stack traces of all goroutines when the
+	// error is a panic recorded with PanicPolicyGoroutineDump.  It is only
+	// recorded in traced errors, as the AttributeErrorGoroutines attribute.
+	Goroutines string
+	// err is the error noticed, kept until the transaction ends for the
+	// ErrorGroupCallback.
+	err error
+}
+
+// errorLink describes an error wrapped by a noticed error.
+type errorLink struct {
+	Klass string
+	Msg   string
+	Stack stackTrace
+}
+
+func (l errorLink) WriteJSON(buf *bytes.Buffer) {
+	w := jsonFieldsWriter{buf: buf}
+	buf.WriteByte('{')
+	w.stringField("error.class", l.Klass)
+	w.stringField("error.message", l.Msg)
+	if nil != l.Stack {
+		w.addKey("stack_trace")
+		l.Stack.WriteJSON(buf)
+	}
+	buf.WriteByte('}')
+}
+
+// chainJSON returns the JSON array of the links of the chain.
+func (e *errorData) chainJSON() string {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('[')
+	for i, link := range e.Chain {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		link.WriteJSON(buf)
+	}
+	buf.WriteByte(']')
+	return buf.String()
+}
+
+// agentAttributes returns the agent attributes which describe the error in
+// traced errors.  The values are not added using agentAttributes.Add, which
+// would truncate them.
+func (e *errorData) agentAttributes() agentAttributes {
+	if 0 == len(e.Chain) && "" == e.Goroutines {
+		return nil
+	}
+	attrs := make(agentAttributes)
+	if len(e.Chain) > 0 {
+		attrs[AttributeErrorChain] = agentAttributeValue{stringVal: e.chainJSON()}
+	}
+	if "" != e.Goroutines {
+		attrs[AttributeErrorGoroutines] = agentAttributeValue{
+			stringVal: stringLengthByteLimit(e.Goroutines, maxGoroutineDumpBytes),
+		}
+	}
+	return attrs
+}
+
+// replaceChainMessages replaces the messages of the wrapped errors.  The
+// chain is copied since the noticed error's links may be shared.
+func (e *errorData) replaceChainMessages(msg string) {
+	if 0 == len(e.Chain) {
+		return
+	}
+	chain := make([]errorLink, len(e.Chain))
+	for i, link := range e.Chain {
+		link.Msg = msg
+		chain[i] = link
+	}
+	e.Chain = chain
 }
 
 // txnError combines error data with information about a transaction.  txnError is used for
@@ -84,10 +282,26 @@ func newTxnErrors(max int) txnErrors {
 	return make([]*errorData, 0, max)
 }
 
-// Add adds a TxnError.
+// Add adds a TxnError.  Once the set is full, the first unexpected error
+// replaces the last expected error so that the transaction is still known to
+// have failed.
 func (errors *txnErrors) Add(e errorData) {
 	if len(*errors) < cap(*errors) {
 		*errors = append(*errors, &e)
+		return
+	}
+	if e.Expect {
+		return
+	}
+	last := -1
+	for i, existing := range *errors {
+		if !existing.Expect {
+			return
+		}
+		last = i
+	}
+	if last >= 0 {
+		(*errors)[last] = &e
 	}
 }
 
@@ -105,7 +319,7 @@ func (h *tracedError) WriteJSON(buf *bytes.Buffer) {
 	buf.WriteByte('{')
 	buf.WriteString(`"agentAttributes"`)
 	buf.WriteByte(':')
-	agentAttributesJSON(h.Attrs, buf, destError)
+	agentAttributesWithExtraJSON(h.Attrs, buf, destError, h.agentAttributes())
 	buf.WriteByte(',')
 	buf.WriteString(`"userAttributes"`)
 	buf.WriteByte(':')
@@ -113,7 +327,7 @@ func (h *tracedError) WriteJSON(buf *bytes.Buffer) {
 	buf.WriteByte(',')
 	buf.WriteString(`"intrinsics"`)
 	buf.WriteByte(':')
-	intrinsicsJSON(&h.txnEvent, buf)
+	h.intrinsicsJSON(buf)
 	if nil != h.Stack {
 		buf.WriteByte(',')
 		buf.WriteString(`"stack_trace"`)
@@ -125,6 +339,21 @@ func (h *tracedError) WriteJSON(buf *bytes.Buffer) {
 	buf.WriteByte(']')
 }
 
+// intrinsicsJSON writes the intrinsics of the transaction followed by whether
+// the error is expected.
+func (h *tracedError) intrinsicsJSON(buf *bytes.Buffer) {
+	w := jsonFieldsWriter{buf: buf}
+	buf.WriteByte('{')
+	intrinsicsFields(&h.txnEvent, &w)
+	if h.Expect {
+		w.boolField("error.expected", true)
+	}
+	if "" != h.GroupName {
+		w.stringField("error.group.name", h.GroupName)
+	}
+	buf.WriteByte('}')
+}
+
 // MarshalJSON is used for testing.
 func (h *tracedError) MarshalJSON() ([]byte, error) {
 	buf := &bytes.Buffer{}
@@ -6,8 +6,11 @@ package newrelic
 import (
 	"encoding/json"
 	"errors"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/newrelic/go-agent/v3/internal"
 )
 
 var (
@@ -114,6 +117,119 @@ func TestErrorTraceMarshalOldCAT(t *testing.T) {
 	testExpectedJSON(t, expect, string(js))
 }
 
+func TestErrorTraceMarshalExpected(t *testing.T) {
+	he := &tracedError{
+		errorData: errorData{
+			When:   time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC),
+			Msg:    "my_msg",
+			Klass:  "my_class",
+			Expect: true,
+		},
+		txnEvent: txnEvent{
+			FinalName: "my_txn_name",
+			TotalTime: 2 * time.Second,
+		},
+	}
+	js, err := json.Marshal(he)
+	if nil != err {
+		t.Error(err)
+	}
+
+	expect := `
+	[
+		1.41713646e+12,
+		"my_txn_name",
+		"my_msg",
+		"my_class",
+		{
+			"agentAttributes":{},
+			"userAttributes":{},
+			"intrinsics":{
+				"totalTime":2,
+				"error.expected":true
+			}
+		}
+	]`
+	testExpectedJSON(t, expect, string(js))
+}
+
+func TestErrorTraceChainAttribute(t *testing.T) {
+	chainError := func(attrs *attributes) *tracedError {
+		return &tracedError{
+			errorData: errorData{
+				When:  time.Date(2014, time.November, 28, 1, 1, 0, 0, time.UTC),
+				Stack: emptyStackTrace,
+				Msg:   "my_msg",
+				Klass: "my_class",
+				Chain: []errorLink{
+					{Klass: "wrapped_class", Msg: "wrapped_msg"},
+					{Klass: "cause_class", Msg: "cause_msg", Stack: emptyStackTrace},
+				},
+			},
+			txnEvent: txnEvent{
+				FinalName: "my_txn_name",
+				Attrs:     attrs,
+			},
+		}
+	}
+
+	aci := config{Config: defaultConfig()}
+	he := chainError(newAttributes(createAttributeConfig(aci, true)))
+	expectError(t, he, internal.WantError{
+		TxnName: "my_txn_name",
+		Msg:     "my_msg",
+		Klass:   "my_class",
+		AgentAttributes: map[string]interface{}{
+			AttributeErrorChain: `[{"error.class":"wrapped_class","error.message":"wrapped_msg"},` +
+				`{"error.class":"cause_class","error.message":"cause_msg","stack_trace":[]}]`,
+		},
+	})
+
+	aci.ErrorCollector.Attributes.Exclude = []string{AttributeErrorChain}
+	he = chainError(newAttributes(createAttributeConfig(aci, true)))
+	expectError(t, he, internal.WantError{
+		TxnName:         "my_txn_name",
+		Msg:             "my_msg",
+		Klass:           "my_class",
+		AgentAttributes: map[string]interface{}{},
+	})
+}
+
+func TestErrorTraceGoroutinesAttributeTruncated(t *testing.T) {
+	he := &tracedError{
+		errorData: errorData{
+			Stack:      emptyStackTrace,
+			Msg:        "my_msg",
+			Klass:      "my_class",
+			Goroutines: strings.Repeat("g", maxGoroutineDumpBytes+10),
+		},
+		txnEvent: txnEvent{
+			FinalName: "my_txn_name",
+			Attrs:     newAttributes(createAttributeConfig(config{Config: defaultConfig()}, true)),
+		},
+	}
+	expectError(t, he, internal.WantError{
+		TxnName: "my_txn_name",
+		Msg:     "my_msg",
+		Klass:   "my_class",
+		AgentAttributes: map[string]interface{}{
+			AttributeErrorGoroutines: strings.Repeat("g", maxGoroutineDumpBytes),
+		},
+	})
+}
+
+func TestErrorsAddUnexpectedWhenFull(t *testing.T) {
+	ers := newTxnErrors(2)
+	ers.Add(errorData{Msg: "first", Expect: true})
+	ers.Add(errorData{Msg: "second", Expect: true})
+	ers.Add(errorData{Msg: "third", Expect: true})
+	ers.Add(errorData{Msg: "fourth"})
+	ers.Add(errorData{Msg: "fifth"})
+	if len(ers) != 2 || ers[0].Msg != "first" || ers[1].Msg != "fourth" {
+		t.Error(ers[0], ers[1])
+	}
+}
+
 func TestErrorTraceAttributes(t *testing.T) {
 	aci := config{Config: defaultConfig()}
 	aci.ErrorCollector.Attributes.Exclude = append(aci.ErrorCollector.Attributes.Exclude, "zap")
@@ -217,6 +333,44 @@ func TestErrorTraceAttributesOldCAT(t *testing.T) {
 	testExpectedJSON(t, expect, string(js))
 }
 
+func TestNormalizeErrorMessage(t *testing.T) {
+	testcases := []struct {
+		msg    string
+		expect string
+	}{
+		{msg: "", expect: ""},
+		{msg: "connection refused", expect: "connection refused"},
+		{msg: "user 1234 not found", expect: "user # not found"},
+		{msg: `open "/tmp/a.txt": no such file`, expect: `open "?": no such file`},
+		{msg: "order 123e4567-e89b-12d3-a456-426614174000 failed", expect: "order #-#-#-#-# failed"},
+		{msg: "bad pointer 0xc000123abc", expect: "bad pointer #"},
+		{msg: "retry2 failed", expect: "retry# failed"},
+	}
+	for _, tc := range testcases {
+		if out := normalizeErrorMessage(tc.msg); out != tc.expect {
+			t.Errorf("%q: got %q, want %q", tc.msg, out, tc.expect)
+		}
+	}
+}
+
+func TestDefaultErrorGroup(t *testing.T) {
+	group := DefaultErrorGroup(ErrorInfo{
+		Class:   "my_class",
+		Message: "timeout after 30s",
+	})
+	if group != "my_class: timeout after #s" {
+		t.Error(group)
+	}
+	// Frames of the agent, whose package includes the tests, are skipped.
+	group = DefaultErrorGroup(ErrorInfo{
+		Class: "my_class",
+		Stack: getStackTrace(),
+	})
+	if group != "my_class at testing.tRunner" {
+		t.Error(group)
+	}
+}
+
 func TestErrorsLifecycle(t *testing.T) {
 	ers := newTxnErrors(5)
 
@@ -229,9 +229,10 @@ func expectErrorEvents(v internal.Validator, events *errorEvents, expect []inter
 	expectEvents(v, events.analyticsEvents, expect, map[string]interface{}{
 		// The following intrinsics should always be present in
 		// error events:
-		"type":      "TransactionError",
-		"timestamp": internal.MatchAnything,
-		"duration":  internal.MatchAnything,
+		"type":             "TransactionError",
+		"timestamp":        internal.MatchAnything,
+		"duration":         internal.MatchAnything,
+		"error.group.name": internal.MatchAnything,
 	})
 }
 
@@ -254,6 +255,38 @@ func expectSpanEvents(v internal.Validator, events *spanEvents, expect []interna
 	expectObserverEvents(v, events.analyticsEvents, expect, extraAttrs)
 }
 
+// expectLogEvents allows testing of log events.  It passes if events exactly
+// matches expect.
+func expectLogEvents(v internal.Validator, events *logEvents, expect []internal.WantLog) {
+	if len(events.events) != len(expect) {
+		v.Error("number of log events does not match", len(events.events), len(expect))
+		return
+	}
+	for i, want := range expect {
+		e, ok := events.events[i].jsonWriter.(*logEvent)
+		if !ok {
+			v.Error("event is not a log event")
+			continue
+		}
+		validateStringField(v, "severity", want.Severity, e.severity)
+		validateStringField(v, "message", want.Message, e.message)
+		if want.SpanID != internal.MatchAnyString {
+			validateStringField(v, "span.id", want.SpanID, e.spanID)
+		}
+		if want.TraceID != internal.MatchAnyString {
+			validateStringField(v, "trace.id", want.TraceID, e.traceID)
+		}
+		if 0 != want.Timestamp {
+			if ms := timeToIntMillis(e.timestamp); ms != want.Timestamp {
+				v.Error("timestamp", want.Timestamp, ms)
+			}
+		}
+		if nil != want.Attributes {
+			expectAttributes(v, e.attributes, want.Attributes)
+		}
+	}
+}
+
 // expectTxnEvents allows testing of txn events.
 func expectTxnEvents(v internal.Validator, events *txnEvents, expect []internal.WantEvent) {
 	expectEvents(v, events.analyticsEvents, expect, map[string]interface{}{
@@ -0,0 +1,181 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package newrelic
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/newrelic/go-agent/v3/internal/jsonx"
+)
+
+// sqlExplainFunc captures the plan of a query: The column names and the rows
+// of the result of an EXPLAIN statement.
+type sqlExplainFunc func(ctx context.Context) (columns []string, rows [][]interface{}, err error)
+
+const (
+	// explainPlanTimeout limits the time taken to capture an explain plan.
+	explainPlanTimeout = 5 * time.Second
+	// maxExplainPlanRows limits the number of rows of an explain plan.
+	maxExplainPlanRows = 100
+)
+
+// explainPlan is the plan of a slow query.  It is captured asynchronously
+// once the slow query is kept by the harvest, and is only sent with the slow query if
+// it has been captured when the slow query is harvested.
+type explainPlan struct {
+	sync.Mutex
+	captured bool
+	columns  []string
+	rows     [][]interface{}
+	// done is closed once the capture has finished, whether or not it
+	// succeeded.
+	done chan struct{}
+}
+
+// pendingExplainPlan is the capture of the plan of a slow query, which is
+// started by start once the query is kept by the harvest: the plans of the
+// queries evicted by slower queries are not captured.
+type pendingExplainPlan struct {
+	explain      sqlExplainFunc
+	obfuscate    bool
+	dialect      sqlDialect
+	limiter      *explainPlanLimiter
+	maxPerMinute int
+	logger       Logger
+}
+
+// start starts capturing the plan unless the limit of plans per minute has
+// been reached.
+func (p *pendingExplainPlan) start(now time.Time) *explainPlan {
+	if nil != p.limiter && !p.limiter.allow(now, p.maxPerMinute) {
+		return nil
+	}
+	return startExplainPlan(p.explain, p.obfuscate, p.dialect, p.logger)
+}
+
+// explainPlanValue converts a value of a row of the result of an EXPLAIN
+// statement into a string, number, boolean, or nil.
+func explainPlanValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case nil, string, bool, int64, float64:
+		return val
+	case []byte:
+		return string(val)
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// startExplainPlan captures the plan using the function in a new goroutine.
+// If the query is obfuscated, the literals in the string values of the plan,
+// such as the conditions in the plans of Postgres, are obfuscated using the
+// dialect.
+func startExplainPlan(explain sqlExplainFunc, obfuscate bool, dialect sqlDialect, lg Logger) *explainPlan {
+	plan := &explainPlan{done: make(chan struct{})}
+	go func() {
+		defer close(plan.done)
+		ctx, cancel := context.WithTimeout(context.Background(), explainPlanTimeout)
+		defer cancel()
+		columns, rows, err := explain(ctx)
+		if nil != err {
+			lg.Debug("unable to capture explain plan", map[string]interface{}{
+				"reason": err.Error(),
+			})
+			return
+		}
+		if len(rows) > maxExplainPlanRows {
+			rows = rows[:maxExplainPlanRows]
+		}
+		for _, row := range rows {
+			for idx, v := range row {
+				v = explainPlanValue(v)
+				if s, ok := v.(string); ok && obfuscate {
+					v = obfuscateSQL(s, dialect)
+				}
+				row[idx] = v
+			}
+		}
+		plan.Lock()
+		defer plan.Unlock()
+		plan.captured = true
+		plan.columns = columns
+		plan.rows = rows
+	}()
+	return plan
+}
+
+func (plan *explainPlan) isCaptured() bool {
+	plan.Lock()
+	defer plan.Unlock()
+	return plan.captured
+}
+
+// WriteJSON writes the plan as an array containing the column names and the
+// rows.
+func (plan *explainPlan) WriteJSON(buf *bytes.Buffer) {
+	plan.Lock()
+	defer plan.Unlock()
+	buf.WriteByte('[')
+	jsonx.AppendStringArray(buf, plan.columns...)
+	buf.WriteString(",[")
+	for idx, row := range plan.rows {
+		if idx > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('[')
+		for i, v := range row {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			switch val := v.(type) {
+			case string:
+				jsonx.AppendString(buf, val)
+			case bool:
+				if val {
+					buf.WriteString("true")
+				} else {
+					buf.WriteString("false")
+				}
+			case int64:
+				jsonx.AppendInt(buf, val)
+			case float64:
+				if nil != jsonx.AppendFloat(buf, val) {
+					buf.WriteString("null")
+				}
+			default:
+				buf.WriteString("null")
+			}
+		}
+		buf.WriteByte(']')
+	}
+	buf.WriteString("]]")
+}
+
+// explainPlanLimiter limits the number of explain plans captured per minute,
+// since each runs an EXPLAIN statement against the database.
+type explainPlanLimiter struct {
+	sync.Mutex
+	windowStart time.Time
+	count       int
+}
+
+func (l *explainPlanLimiter) allow(now time.Time, maxPerMinute int) bool {
+	l.Lock()
+	defer l.Unlock()
+	if now.Sub(l.windowStart) >= time.Minute {
+		l.windowStart = now
+		l.count = 0
+	}
+	if l.count >= maxPerMinute {
+		return false
+	}
+	l.count++
+	return true
+}
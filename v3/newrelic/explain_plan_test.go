@@ -0,0 +1,107 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package newrelic
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/newrelic/go-agent/v3/internal/logger"
+)
+
+func TestExplainPlanJSON(t *testing.T) {
+	explain := func(ctx context.Context) ([]string, [][]interface{}, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("explain context has no deadline")
+		}
+		return []string{"id", "table", "cost", "key", "analyzed", "created"}, [][]interface{}{
+			{int64(1), []byte("users"), 1.5, nil, true, time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)},
+			{int64(2), "orders WHERE id = 5", math.NaN(), struct{}{}, false, uint8(3)},
+		}, nil
+	}
+	plan := startExplainPlan(explain, false, sqlDialectMySQL, logger.ShimLogger{})
+	<-plan.done
+	if !plan.isCaptured() {
+		t.Fatal("plan not captured")
+	}
+	buf := &bytes.Buffer{}
+	plan.WriteJSON(buf)
+	expect := `[["id","table","cost","key","analyzed","created"],[` +
+		`[1,"users",1.5,null,true,"2020-01-02T03:04:05Z"],` +
+		`[2,"orders WHERE id = 5",null,"{}",false,"3"]]]`
+	if buf.String() != expect {
+		t.Error(buf.String())
+	}
+}
+
+func TestExplainPlanObfuscated(t *testing.T) {
+	explain := func(ctx context.Context) ([]string, [][]interface{}, error) {
+		return []string{"QUERY PLAN"}, [][]interface{}{
+			{"Seq Scan on users  (cost=0.00..35.50 rows=10 width=36)"},
+			{"  Filter: (name = 'bob'::text)"},
+		}, nil
+	}
+	plan := startExplainPlan(explain, true, sqlDialectPostgres, logger.ShimLogger{})
+	<-plan.done
+	buf := &bytes.Buffer{}
+	plan.WriteJSON(buf)
+	expect := `[["QUERY PLAN"],[["Seq Scan on users  (cost=?..? rows=? width=?)"],["  Filter: (name = ?::text)"]]]`
+	if buf.String() != expect {
+		t.Error(buf.String())
+	}
+}
+
+func TestExplainPlanError(t *testing.T) {
+	explain := func(ctx context.Context) ([]string, [][]interface{}, error) {
+		return nil, nil, errors.New("unsupported")
+	}
+	plan := startExplainPlan(explain, false, sqlDialectMySQL, logger.ShimLogger{})
+	<-plan.done
+	if plan.isCaptured() {
+		t.Error("plan captured")
+	}
+	slow := slowQuery{slowQueryInstance: slowQueryInstance{ExplainPlan: plan}}
+	buf := &bytes.Buffer{}
+	slow.WriteJSON(buf)
+	if bytes.Contains(buf.Bytes(), []byte("explain_plan")) {
+		t.Error(buf.String())
+	}
+}
+
+func TestExplainPlanRowLimit(t *testing.T) {
+	explain := func(ctx context.Context) ([]string, [][]interface{}, error) {
+		rows := make([][]interface{}, maxExplainPlanRows+5)
+		for idx := range rows {
+			rows[idx] = []interface{}{int64(idx)}
+		}
+		return []string{"id"}, rows, nil
+	}
+	plan := startExplainPlan(explain, false, sqlDialectMySQL, logger.ShimLogger{})
+	<-plan.done
+	if len(plan.rows) != maxExplainPlanRows {
+		t.Error(len(plan.rows))
+	}
+}
+
+func TestExplainPlanLimiter(t *testing.T) {
+	var l explainPlanLimiter
+	for i := 0; i < 3; i++ {
+		if !l.allow(now, 3) {
+			t.Error(i)
+		}
+	}
+	if l.allow(now.Add(59*time.Second), 3) {
+		t.Error("limit exceeded")
+	}
+	if !l.allow(now.Add(60*time.Second), 3) {
+		t.Error("limit not reset")
+	}
+	if l.allow(now, 0) {
+		t.Error("zero limit allowed")
+	}
+}
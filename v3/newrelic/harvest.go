@@ -24,11 +24,12 @@ const (
 	harvestCustomEvents
 	harvestTxnEvents
 	harvestErrorEvents
+	harvestLogEvents
 )
 
 const (
 	// harvestTypesEvents includes all Event types
-	harvestTypesEvents = harvestSpanEvents | harvestCustomEvents | harvestTxnEvents | harvestErrorEvents
+	harvestTypesEvents = harvestSpanEvents | harvestCustomEvents | harvestTxnEvents | harvestErrorEvents | harvestLogEvents
 	// harvestTypesAll includes all harvest types
 	harvestTypesAll = harvestMetricsTraces | harvestTypesEvents
 )
@@ -68,6 +69,12 @@ type harvest struct {
 	CustomEvents *customEvents
 	TxnEvents    *txnEvents
 	ErrorEvents  *errorEvents
+	LogEvents    *logEvents
+	// DimensionalMetrics are harvested together with Metrics.
+	DimensionalMetrics *dimensionalMetrics
+	// Profiles are harvested together with Metrics.  They are only
+	// delivered to the harvest sinks of Config.HarvestSinks.
+	Profiles *harvestProfiles
 }
 
 const (
@@ -110,9 +117,25 @@ func (h *harvest) Ready(now time.Time) *harvest {
 		ready.SpanEvents = h.SpanEvents
 		h.SpanEvents = newSpanEvents(h.SpanEvents.capacity())
 	}
+	if 0 != types&harvestLogEvents {
+		h.Metrics.addCount(logEventsSeen, h.LogEvents.NumSeen(), forced)
+		h.Metrics.addCount(logEventsSent, h.LogEvents.NumSaved(), forced)
+		ready.LogEvents = h.LogEvents
+		h.LogEvents = newLogEvents(h.LogEvents.capacity(), h.LogEvents.commonAttributes)
+	}
 	// NOTE! Metrics must happen after the event harvest conditionals to
 	// ensure that the metrics contain the event supportability metrics.
 	if 0 != types&harvestMetricsTraces {
+		if n := h.DimensionalMetrics.numDropped; n > 0 {
+			h.Metrics.addCount(dimensionalMetricsDropped, float64(n), forced)
+		}
+		if n := h.Profiles.numDropped; n > 0 {
+			h.Metrics.addCount(profilesDropped, float64(n), forced)
+		}
+		ready.DimensionalMetrics = h.DimensionalMetrics
+		h.DimensionalMetrics = newDimensionalMetrics(now)
+		ready.Profiles = h.Profiles
+		h.Profiles = newHarvestProfiles(maxHarvestProfiles)
 		ready.Metrics = h.Metrics
 		ready.ErrorTraces = h.ErrorTraces
 		ready.SlowSQLs = h.SlowSQLs
@@ -139,9 +162,15 @@ func (h *harvest) Payloads(splitLargeTxnEvents bool) (ps []payloadCreator) {
 	if nil != h.SpanEvents {
 		ps = append(ps, h.SpanEvents)
 	}
+	if nil != h.LogEvents {
+		ps = append(ps, h.LogEvents)
+	}
 	if nil != h.Metrics {
 		ps = append(ps, h.Metrics)
 	}
+	if nil != h.DimensionalMetrics {
+		ps = append(ps, h.DimensionalMetrics)
+	}
 	if nil != h.ErrorTraces {
 		ps = append(ps, h.ErrorTraces)
 	}
@@ -167,6 +196,9 @@ type harvestConfig struct {
 	MaxCustomEvents int
 	MaxErrorEvents  int
 	MaxTxnEvents    int
+	MaxLogEvents    int
+	// LogCommonAttributes are sent with each log event payload.
+	LogCommonAttributes map[string]string
 }
 
 // newHarvest returns a new Harvest.
@@ -181,6 +213,10 @@ func newHarvest(now time.Time, configurer harvestConfig) *harvest {
 		CustomEvents: newCustomEvents(configurer.MaxCustomEvents),
 		TxnEvents:    newTxnEvents(configurer.MaxTxnEvents),
 		ErrorEvents:  newErrorEvents(configurer.MaxErrorEvents),
+		LogEvents:    newLogEvents(configurer.MaxLogEvents, configurer.LogCommonAttributes),
+
+		DimensionalMetrics: newDimensionalMetrics(now),
+		Profiles:           newHarvestProfiles(maxHarvestProfiles),
 	}
 }
 
@@ -220,6 +256,7 @@ func (h *harvest) CreateFinalMetrics(reply *internal.ConnectReply, hc harvestCon
 	h.Metrics.addValue(supportCustomEventLimit, "", float64(hc.MaxCustomEvents), forced)
 	h.Metrics.addValue(supportErrorEventLimit, "", float64(hc.MaxErrorEvents), forced)
 	h.Metrics.addValue(supportSpanEventLimit, "", float64(hc.MaxSpanEvents), forced)
+	h.Metrics.addValue(supportLogEventLimit, "", float64(hc.MaxLogEvents), forced)
 
 	createTraceObserverMetrics(to, h.Metrics)
 	createTrackUsageMetrics(h.Metrics)
@@ -310,6 +347,8 @@ func createTxnMetrics(args *txnData, metrics *metricTable) {
 		metrics.addSingleCount(errorsRollupMetric.all, forced)
 		metrics.addSingleCount(errorsRollupMetric.webOrOther(args.IsWeb), forced)
 		metrics.addSingleCount(errorsPrefix+args.FinalName, forced)
+	} else if args.hasExpectedErrorsOnly() {
+		metrics.addSingleCount(expectedErrorsMetric, forced)
 	}
 
 	// Queueing Metrics
@@ -327,5 +366,6 @@ var (
 		MaxSpanEvents:   maxSpanEvents,
 		MaxCustomEvents: internal.MaxCustomEvents,
 		MaxErrorEvents:  internal.MaxErrorEvents,
+		MaxLogEvents:    internal.MaxLogEvents,
 	}
 )
@@ -0,0 +1,479 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package newrelic
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// HarvestSink receives the data gathered by the agent each time it is ready
+// to be reported.  The agent's own writers (to the New Relic collector, to
+// stdout in ServerlessMode, and to an OTLP receiver) are built-in sinks.
+// Additional sinks registered using ConfigHarvestSink receive the same data,
+// which makes it possible to tee the data to a file, a message queue, or
+// another pipeline.
+//
+// Harvest is called from a background goroutine, and may be called
+// concurrently if a previous harvest is slow to complete.  In ServerlessMode,
+// Harvest is called from the goroutine which ends the Lambda invocation.  Data
+// that the built-in sink could not deliver may be merged into the next harvest,
+// and therefore be received again.
+type HarvestSink interface {
+	// Harvest receives the data.  The HarvestData must not be used after
+	// Harvest returns.  A returned error is logged by the agent.
+	Harvest(data *HarvestData) error
+}
+
+// HarvestData contains the data of a single harvest.  The accessor methods
+// return nil for data types that are not part of the harvest: Each type of
+// data is reported on its own schedule.
+type HarvestData struct {
+	start time.Time
+	data  *harvest
+	// run is nil in ServerlessMode.
+	run *appRun
+}
+
+// HarvestMetric is a metric.  Metric values are in seconds, except for Apdex
+// metrics, whose Count, Total, and Exclusive fields are the numbers of
+// satisfying, tolerating, and frustrating transactions, and whose Min and Max
+// fields are the Apdex threshold.
+type HarvestMetric struct {
+	Name string
+	// Scope is the name of the transaction for scoped metrics, and empty
+	// otherwise.
+	Scope      string
+	Count      float64
+	Total      float64
+	Exclusive  float64
+	Min        float64
+	Max        float64
+	SumSquares float64
+}
+
+// HarvestDimensionalMetric is a time series of a dimensional metric recorded
+// using Application.RecordMetric.  The value of a MetricCount is Sum, the
+// value of a MetricGauge is Last, and a MetricSummary uses Count, Sum, Min,
+// and Max.
+type HarvestDimensionalMetric struct {
+	Name       string
+	Type       MetricType
+	Attributes map[string]interface{}
+	Count      float64
+	Sum        float64
+	Min        float64
+	Max        float64
+	Last       float64
+}
+
+// HarvestEvent is a span, transaction, error, or custom event.  The attributes
+// are the ones that would be reported to New Relic: Attribute configuration
+// and high security mode have already been applied.  Numeric values are int64
+// or float64.
+type HarvestEvent struct {
+	// Type is "Span", "Transaction", "TransactionError", or the type of a
+	// custom event.
+	Type            string
+	Timestamp       time.Time
+	Intrinsics      map[string]interface{}
+	UserAttributes  map[string]interface{}
+	AgentAttributes map[string]interface{}
+}
+
+// HarvestLog is a log event.  TraceID and SpanID are empty for logs which
+// were not recorded by a transaction.
+type HarvestLog struct {
+	Timestamp  time.Time
+	Severity   string
+	Message    string
+	TraceID    string
+	SpanID     string
+	Attributes map[string]interface{}
+}
+
+// HarvestErrorTrace is an error recorded with its stack trace.
+type HarvestErrorTrace struct {
+	When            time.Time
+	TransactionName string
+	Message         string
+	Class           string
+	// Stack contains program counters which can be resolved using
+	// runtime.CallersFrames.
+	Stack []uintptr
+	// Chain describes the errors wrapped by the error, in the order in
+	// which they are found by errors.As.  It is empty when the
+	// AttributeErrorChain attribute is excluded.
+	Chain []HarvestErrorLink
+	// Goroutines contains the stack traces of all goroutines when the
+	// error is a panic recorded with PanicPolicyGoroutineDump.  It is
+	// empty when the AttributeErrorGoroutines attribute is excluded.
+	Goroutines      string
+	Intrinsics      map[string]interface{}
+	UserAttributes  map[string]interface{}
+	AgentAttributes map[string]interface{}
+}
+
+// HarvestErrorLink is an error wrapped by a recorded error.
+type HarvestErrorLink struct {
+	Class   string
+	Message string
+	// Stack is nil unless the wrapped error provides a stack trace.
+	Stack []uintptr
+}
+
+// HarvestSlowQuery is a slow datastore query.  Identical queries are
+// aggregated: Host, PortPathOrID, DatabaseName, QueryParameters, Stack, and
+// TransactionName come from the slowest observation.
+type HarvestSlowQuery struct {
+	TransactionName string
+	MetricName      string
+	Query           string
+	QueryParameters map[string]interface{}
+	Host            string
+	PortPathOrID    string
+	DatabaseName    string
+	Count           int
+	Total           time.Duration
+	Min             time.Duration
+	Max             time.Duration
+	Stack           []uintptr
+}
+
+// HarvestProfile is a runtime/pprof profile captured by the continuous
+// profiler configured in Config.Profiling.
+type HarvestProfile struct {
+	Type  ProfileType
+	Start time.Time
+	// Duration is the time a CPU profile was sampled.  It is zero for
+	// other types of profiles, which are snapshots.
+	Duration time.Duration
+	// Data is the profile in the gzip-compressed protocol buffer format
+	// read by "go tool pprof".
+	Data []byte
+	// TransactionName and TraceID identify the slow transaction which
+	// triggered the capture.  They are empty for scheduled captures.
+	TransactionName string
+	TraceID         string
+}
+
+func newHarvestData(h *harvest, start time.Time, run *appRun) *HarvestData {
+	return &HarvestData{start: start, data: h, run: run}
+}
+
+// Start returns the time the harvest began.
+func (hd *HarvestData) Start() time.Time {
+	return hd.start
+}
+
+// Metrics returns the metrics.
+func (hd *HarvestData) Metrics() []HarvestMetric {
+	mt := hd.data.Metrics
+	if nil == mt {
+		return nil
+	}
+	metrics := make([]HarvestMetric, 0, len(mt.metrics))
+	for id, m := range mt.metrics {
+		metrics = append(metrics, HarvestMetric{
+			Name:       id.Name,
+			Scope:      id.Scope,
+			Count:      m.data.countSatisfied,
+			Total:      m.data.totalTolerated,
+			Exclusive:  m.data.exclusiveFailed,
+			Min:        m.data.min,
+			Max:        m.data.max,
+			SumSquares: m.data.sumSquares,
+		})
+	}
+	return metrics
+}
+
+// DimensionalMetrics returns the dimensional metrics.
+func (hd *HarvestData) DimensionalMetrics() []HarvestDimensionalMetric {
+	dm := hd.data.DimensionalMetrics
+	if nil == dm {
+		return nil
+	}
+	metrics := make([]HarvestDimensionalMetric, 0, len(dm.metrics))
+	for id, m := range dm.metrics {
+		var attrs map[string]interface{}
+		if nil != m.attributes {
+			attrs = make(map[string]interface{}, len(m.attributes))
+			for key, val := range m.attributes {
+				attrs[key] = val
+			}
+		}
+		metrics = append(metrics, HarvestDimensionalMetric{
+			Name:       id.name,
+			Type:       id.metricType,
+			Attributes: attrs,
+			Count:      m.data.count,
+			Sum:        m.data.sum,
+			Min:        m.data.min,
+			Max:        m.data.max,
+			Last:       m.data.last,
+		})
+	}
+	return metrics
+}
+
+// SpanEvents returns the span events.
+func (hd *HarvestData) SpanEvents() []HarvestEvent {
+	if nil == hd.data.SpanEvents {
+		return nil
+	}
+	out := make([]HarvestEvent, 0, len(hd.data.SpanEvents.events))
+	for _, evt := range hd.data.SpanEvents.events {
+		if e, ok := harvestEvent(evt.jsonWriter); ok {
+			out = append(out, e)
+		}
+		if span, ok := evt.jsonWriter.(*spanEvent); ok {
+			for _, extra := range span.extras() {
+				if e, ok := harvestEvent(extra); ok {
+					out = append(out, e)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// TransactionEvents returns the transaction events.
+func (hd *HarvestData) TransactionEvents() []HarvestEvent {
+	if nil == hd.data.TxnEvents {
+		return nil
+	}
+	return harvestEvents(hd.data.TxnEvents.analyticsEvents)
+}
+
+// ErrorEvents returns the error events.
+func (hd *HarvestData) ErrorEvents() []HarvestEvent {
+	if nil == hd.data.ErrorEvents {
+		return nil
+	}
+	return harvestEvents(hd.data.ErrorEvents.analyticsEvents)
+}
+
+// CustomEvents returns the custom events.
+func (hd *HarvestData) CustomEvents() []HarvestEvent {
+	if nil == hd.data.CustomEvents {
+		return nil
+	}
+	return harvestEvents(hd.data.CustomEvents.analyticsEvents)
+}
+
+// LogEvents returns the log events.
+func (hd *HarvestData) LogEvents() []HarvestLog {
+	if nil == hd.data.LogEvents {
+		return nil
+	}
+	logs := make([]HarvestLog, 0, len(hd.data.LogEvents.events))
+	for _, evt := range hd.data.LogEvents.events {
+		e, ok := evt.jsonWriter.(*logEvent)
+		if !ok {
+			continue
+		}
+		var attrs map[string]interface{}
+		if nil != e.attributes {
+			attrs = make(map[string]interface{}, len(e.attributes))
+			for key, val := range e.attributes {
+				attrs[key] = val
+			}
+		}
+		logs = append(logs, HarvestLog{
+			Timestamp:  e.timestamp,
+			Severity:   e.severity,
+			Message:    e.message,
+			TraceID:    e.traceID,
+			SpanID:     e.spanID,
+			Attributes: attrs,
+		})
+	}
+	return logs
+}
+
+// ErrorTraces returns the error traces.
+func (hd *HarvestData) ErrorTraces() []HarvestErrorTrace {
+	if nil == hd.data.ErrorTraces {
+		return nil
+	}
+	traces := make([]HarvestErrorTrace, 0, len(hd.data.ErrorTraces))
+	for _, e := range hd.data.ErrorTraces {
+		if nil == e {
+			continue
+		}
+		buf := &bytes.Buffer{}
+		e.intrinsicsJSON(buf)
+		intrinsics := decodeHarvestJSON(buf)
+		agentAttributesWithExtraJSON(e.Attrs, buf, destError, e.agentAttributes())
+		agent := decodeHarvestJSON(buf)
+		userAttributesJSON(e.Attrs, buf, destError, e.errorData.ExtraAttributes)
+		user := decodeHarvestJSON(buf)
+
+		links := e.Chain
+		if _, ok := agent[AttributeErrorChain]; !ok {
+			// The chain is excluded by the attribute configuration.
+			links = nil
+		}
+		goroutines, _ := agent[AttributeErrorGoroutines].(string)
+		var chain []HarvestErrorLink
+		for _, link := range links {
+			chain = append(chain, HarvestErrorLink{
+				Class:   link.Klass,
+				Message: link.Msg,
+				Stack:   []uintptr(link.Stack),
+			})
+		}
+
+		traces = append(traces, HarvestErrorTrace{
+			When:            e.When,
+			TransactionName: e.FinalName,
+			Message:         e.Msg,
+			Class:           e.Klass,
+			Stack:           []uintptr(e.Stack),
+			Chain:           chain,
+			Goroutines:      goroutines,
+			Intrinsics:      intrinsics,
+			UserAttributes:  user,
+			AgentAttributes: agent,
+		})
+	}
+	return traces
+}
+
+// Profiles returns the profiles captured by the continuous profiler.
+func (hd *HarvestData) Profiles() []HarvestProfile {
+	if nil == hd.data.Profiles {
+		return nil
+	}
+	profiles := make([]HarvestProfile, len(hd.data.Profiles.profiles))
+	copy(profiles, hd.data.Profiles.profiles)
+	return profiles
+}
+
+// SlowQueries returns the slow datastore queries.
+func (hd *HarvestData) SlowQueries() []HarvestSlowQuery {
+	if nil == hd.data.SlowSQLs {
+		return nil
+	}
+	queries := make([]HarvestSlowQuery, 0, len(hd.data.SlowSQLs.priorityQueue))
+	for _, q := range hd.data.SlowSQLs.priorityQueue {
+		var params map[string]interface{}
+		if nil != q.QueryParameters {
+			params = make(map[string]interface{}, len(q.QueryParameters))
+			for key, val := range q.QueryParameters {
+				params[key] = val
+			}
+		}
+		queries = append(queries, HarvestSlowQuery{
+			TransactionName: q.FinalName,
+			MetricName:      q.DatastoreMetric,
+			Query:           q.ParameterizedQuery,
+			QueryParameters: params,
+			Host:            q.Host,
+			PortPathOrID:    q.PortPathOrID,
+			DatabaseName:    q.DatabaseName,
+			Count:           int(q.Count),
+			Total:           q.Total,
+			Min:             q.Min,
+			Max:             q.Duration,
+			Stack:           []uintptr(q.StackTrace),
+		})
+	}
+	return queries
+}
+
+func harvestEvents(events *analyticsEvents) []HarvestEvent {
+	out := make([]HarvestEvent, 0, len(events.events))
+	for _, evt := range events.events {
+		if e, ok := harvestEvent(evt.jsonWriter); ok {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func harvestEvent(w jsonWriter) (HarvestEvent, bool) {
+	fields, err := decodeEventJSON(w)
+	if nil != err {
+		return HarvestEvent{}, false
+	}
+	e := HarvestEvent{
+		Intrinsics:      fields[0],
+		UserAttributes:  fields[1],
+		AgentAttributes: fields[2],
+	}
+	if t, ok := e.Intrinsics["type"].(string); ok {
+		e.Type = t
+		delete(e.Intrinsics, "type")
+	}
+	if ms, ok := e.Intrinsics["timestamp"].(int64); ok {
+		e.Timestamp = time.Unix(0, ms*int64(time.Millisecond))
+		delete(e.Intrinsics, "timestamp")
+	}
+	return e, true
+}
+
+// decodeEventJSON decodes the collector JSON of an event, which is an array
+// of intrinsics, user attributes, and agent attributes.  Decoding the JSON
+// ensures that data sent to every sink is filtered in the same way.
+func decodeEventJSON(w jsonWriter) ([3]map[string]interface{}, error) {
+	var fields [3]map[string]interface{}
+	buf := &bytes.Buffer{}
+	w.WriteJSON(buf)
+
+	var raw []map[string]interface{}
+	dec := json.NewDecoder(buf)
+	dec.UseNumber()
+	if err := dec.Decode(&raw); nil != err {
+		return fields, err
+	}
+	if len(raw) != len(fields) {
+		return fields, fmt.Errorf("unexpected event length %d", len(raw))
+	}
+	for i, m := range raw {
+		fields[i] = convertJSONNumbers(m)
+	}
+	return fields, nil
+}
+
+// decodeHarvestJSON decodes a JSON object written to buf and resets buf.
+func decodeHarvestJSON(buf *bytes.Buffer) map[string]interface{} {
+	var m map[string]interface{}
+	dec := json.NewDecoder(buf)
+	dec.UseNumber()
+	dec.Decode(&m)
+	buf.Reset()
+	return convertJSONNumbers(m)
+}
+
+func convertJSONNumbers(m map[string]interface{}) map[string]interface{} {
+	if nil == m {
+		m = make(map[string]interface{})
+	}
+	for key, val := range m {
+		if n, ok := val.(json.Number); ok {
+			if i, err := n.Int64(); nil == err {
+				m[key] = i
+			} else if f, err := n.Float64(); nil == err {
+				m[key] = f
+			}
+		}
+	}
+	return m
+}
+
+// deliverHarvest gives the harvest to each sink in order.
+func deliverHarvest(lg Logger, data *HarvestData, sinks []HarvestSink) {
+	for _, s := range sinks {
+		if err := s.Harvest(data); nil != err {
+			lg.Warn("harvest sink failure", map[string]interface{}{
+				"sink":  fmt.Sprintf("%T", s),
+				"error": err.Error(),
+			})
+		}
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package newrelic
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/newrelic/go-agent/v3/internal"
+	"github.com/newrelic/go-agent/v3/internal/logger"
+)
+
+// sinkRecorder is a HarvestSink which records the custom events and metric
+// names it receives.
+type sinkRecorder struct {
+	sync.Mutex
+	harvests     int
+	customEvents []HarvestEvent
+	metrics      map[string]HarvestMetric
+	err          error
+}
+
+func (s *sinkRecorder) Harvest(data *HarvestData) error {
+	s.Lock()
+	defer s.Unlock()
+	s.harvests++
+	s.customEvents = append(s.customEvents, data.CustomEvents()...)
+	if nil == s.metrics {
+		s.metrics = make(map[string]HarvestMetric)
+	}
+	for _, m := range data.Metrics() {
+		s.metrics[m.Name] = m
+	}
+	return s.err
+}
+
+func TestHarvestDataAccessors(t *testing.T) {
+	replyfn := func(reply *internal.ConnectReply) {
+		reply.SetSampleEverything()
+	}
+	tapp := testApp(replyfn, func(cfg *Config) {
+		cfg.DistributedTracer.Enabled = true
+		cfg.DatastoreTracer.SlowQuery.Threshold = 0
+	}, t)
+	txn := tapp.StartTransaction("hello")
+	txn.NoticeError(errors.New("oops"))
+	txn.AddAttribute("zip", "zap")
+	ds := DatastoreSegment{
+		StartTime:          txn.StartSegmentNow(),
+		Product:            DatastorePostgres,
+		Collection:         "users",
+		Operation:          "INSERT",
+		ParameterizedQuery: "INSERT INTO users (name) VALUES ($1)",
+		QueryParameters:    map[string]interface{}{"name": "Dracula"},
+		Host:               "db-server-1",
+		PortPathOrID:       "5432",
+		DatabaseName:       "production",
+	}
+	ds.End()
+	txn.End()
+	tapp.RecordCustomEvent("MyEvent", map[string]interface{}{"count": 3, "ratio": 0.5})
+
+	start := time.Now()
+	data := newHarvestData(tapp.Private.(*app).testHarvest, start, nil)
+	if data.Start() != start {
+		t.Error(data.Start())
+	}
+
+	var found bool
+	for _, m := range data.Metrics() {
+		if m.Name == "OtherTransaction/Go/hello" && m.Scope == "" && m.Count == 1 {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("transaction metric missing", data.Metrics())
+	}
+
+	spans := data.SpanEvents()
+	if len(spans) != 2 {
+		t.Fatal(len(spans))
+	}
+	for _, s := range spans {
+		if s.Type != "Span" || s.Timestamp.IsZero() {
+			t.Error(s)
+		}
+	}
+
+	txnEvents := data.TransactionEvents()
+	if len(txnEvents) != 1 {
+		t.Fatal(len(txnEvents))
+	}
+	if e := txnEvents[0]; e.Type != "Transaction" || e.Intrinsics["name"] != "OtherTransaction/Go/hello" || e.UserAttributes["zip"] != "zap" {
+		t.Error(e)
+	}
+
+	errorEvents := data.ErrorEvents()
+	if len(errorEvents) != 1 || errorEvents[0].Intrinsics["error.message"] != "oops" {
+		t.Error(errorEvents)
+	}
+
+	custom := data.CustomEvents()
+	if len(custom) != 1 {
+		t.Fatal(len(custom))
+	}
+	if e := custom[0]; e.Type != "MyEvent" || e.UserAttributes["count"] != int64(3) || e.UserAttributes["ratio"] != 0.5 {
+		t.Error(e)
+	}
+
+	traces := data.ErrorTraces()
+	if len(traces) != 1 {
+		t.Fatal(len(traces))
+	}
+	if e := traces[0]; e.Message != "oops" || e.Class != "*errors.errorString" ||
+		e.TransactionName != "OtherTransaction/Go/hello" || len(e.Stack) == 0 ||
+		e.UserAttributes["zip"] != "zap" || e.Intrinsics["guid"] == nil {
+		t.Error(e)
+	}
+
+	queries := data.SlowQueries()
+	if len(queries) != 1 {
+		t.Fatal(len(queries))
+	}
+	if q := queries[0]; q.Query != "INSERT INTO users (name) VALUES ($1)" ||
+		q.MetricName != "Datastore/statement/Postgres/users/INSERT" ||
+		q.TransactionName != "OtherTransaction/Go/hello" || q.Count != 1 ||
+		q.Host != "db-server-1" || q.QueryParameters["name"] != "Dracula" {
+		t.Error(q)
+	}
+}
+
+func TestHarvestDataMissingTypes(t *testing.T) {
+	// A harvest returned by Ready may not contain every data type.
+	data := newHarvestData(&harvest{}, time.Now(), nil)
+	if nil != data.Metrics() || nil != data.SpanEvents() ||
+		nil != data.TransactionEvents() || nil != data.ErrorEvents() ||
+		nil != data.CustomEvents() || nil != data.ErrorTraces() ||
+		nil != data.SlowQueries() {
+		t.Error("data should be nil")
+	}
+}
+
+func TestDeliverHarvestLogsErrors(t *testing.T) {
+	buf := &bytes.Buffer{}
+	lg := logger.New(buf, false)
+	failing := &sinkRecorder{err: errors.New("sink broke")}
+	working := &sinkRecorder{}
+	deliverHarvest(lg, newHarvestData(newHarvest(time.Now(), dfltHarvestCfgr), time.Now(), nil), []HarvestSink{failing, working})
+	if failing.harvests != 1 || working.harvests != 1 {
+		t.Error(failing.harvests, working.harvests)
+	}
+	if log := buf.String(); !strings.Contains(log, `"msg":"harvest sink failure"`) ||
+		!strings.Contains(log, `"sink":"*newrelic.sinkRecorder"`) ||
+		!strings.Contains(log, `"error":"sink broke"`) {
+		t.Error(log)
+	}
+}
+
+func TestHarvestSinkOTLPMode(t *testing.T) {
+	_, srv := newOTLPReceiver()
+	defer srv.Close()
+
+	sink := &sinkRecorder{}
+	app, err := NewApplication(
+		ConfigAppName("my app"),
+		ConfigOTLPExporter(srv.URL),
+		ConfigHarvestSink(sink),
+		func(cfg *Config) { cfg.RuntimeSampler.Enabled = false },
+	)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err := app.WaitForConnection(5 * time.Second); nil != err {
+		t.Fatal(err)
+	}
+	app.StartTransaction("hello").End()
+	app.RecordCustomEvent("MyEvent", nil)
+	app.Shutdown(10 * time.Second)
+
+	sink.Lock()
+	defer sink.Unlock()
+	if len(sink.customEvents) != 1 || sink.customEvents[0].Type != "MyEvent" {
+		t.Error(sink.customEvents)
+	}
+	if _, ok := sink.metrics["OtherTransaction/Go/hello"]; !ok {
+		t.Error(sink.metrics)
+	}
+}
+
+func TestHarvestSinkServerless(t *testing.T) {
+	sink := &sinkRecorder{}
+	app := testApp(nil, func(cfg *Config) {
+		cfg.ServerlessMode.Enabled = true
+		cfg.HarvestSinks = []HarvestSink{sink}
+	}, t)
+	app.RecordCustomEvent("MyEvent", nil)
+
+	buf := &bytes.Buffer{}
+	internal.ServerlessWrite(app.Application.Private, "my-arn", buf)
+	if 0 == buf.Len() {
+		t.Error("serverless sink did not write")
+	}
+	if sink.harvests != 1 || len(sink.customEvents) != 1 {
+		t.Error(sink.harvests, sink.customEvents)
+	}
+}
+
+func TestServerlessHarvestSinks(t *testing.T) {
+	sh := newServerlessHarvest(logger.ShimLogger{}, serverlessGetenvShim)
+	sink := &sinkRecorder{}
+	sh.sinks = []HarvestSink{sink}
+	event, err := createCustomEvent("myEvent", nil, time.Now())
+	if nil != err {
+		t.Fatal(err)
+	}
+	sh.Consume(event)
+	sh.Write("arn", &bytes.Buffer{})
+	if len(sink.customEvents) != 1 || sink.customEvents[0].Type != "myEvent" {
+		t.Error(sink.customEvents)
+	}
+}
@@ -0,0 +1,459 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package newrelic
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/newrelic/go-agent/v3/internal/jsonx"
+)
+
+// SpoolSyncPolicy controls when the segment files of the harvest spool are
+// flushed to stable storage.  It is used for the Config.HarvestSpool.Sync
+// field.
+type SpoolSyncPolicy string
+
+// These constants are the supported values of Config.HarvestSpool.Sync.
+const (
+	// SpoolSyncSegment flushes a segment file when it is complete.
+	SpoolSyncSegment SpoolSyncPolicy = "segment"
+	// SpoolSyncWrite flushes the segment file after every write.  This is
+	// the safest and slowest policy.
+	SpoolSyncWrite SpoolSyncPolicy = "write"
+	// SpoolSyncNone leaves flushing to the operating system.
+	SpoolSyncNone SpoolSyncPolicy = "none"
+)
+
+const (
+	spoolSegmentPrefix = "spool-"
+	spoolSegmentSuffix = ".seg"
+	// spoolHeaderLen is the size of the header written before each
+	// record: The length of the record followed by its CRC-32 checksum.
+	spoolHeaderLen = 8
+
+	spoolSpooledBytes  = "Supportability/Go/HarvestSpool/SpooledBytes"
+	spoolReplayedBytes = "Supportability/Go/HarvestSpool/ReplayedBytes"
+	spoolDroppedBytes  = "Supportability/Go/HarvestSpool/DroppedBytes"
+)
+
+var errSpoolCorrupt = errors.New("corrupt spool record")
+
+// spoolRecord is a payload which could not be sent to the collector.
+type spoolRecord struct {
+	Method string `json:"method"`
+	RunID  string `json:"run_id"`
+	Data   []byte `json:"data"`
+	// size is the number of bytes used by the record on disk.
+	size int64
+}
+
+type spoolSegment struct {
+	path string
+	size int64
+}
+
+// harvestSpool stores payloads on disk while the collector is unreachable.
+// Payloads are appended to the active segment file.  Complete segments are
+// sent oldest first by replay.
+type harvestSpool struct {
+	sync.Mutex
+	lg           Logger
+	dir          string
+	maxBytes     int64
+	segmentBytes int64
+	syncPolicy   SpoolSyncPolicy
+
+	// segments are the complete segment files, oldest first.
+	segments   []spoolSegment
+	active     *os.File
+	activeSize int64
+	// size is the total size of the segment files.
+	size      int64
+	nextSeq   uint64
+	replaying bool
+
+	spooledBytes  float64
+	replayedBytes float64
+	droppedBytes  float64
+}
+
+// newHarvestSpool opens the spool directory.  Segment files left by a previous
+// process are kept so that they will be replayed.
+func newHarvestSpool(c config, lg Logger) (*harvestSpool, error) {
+	dir := c.HarvestSpool.Directory
+	if err := os.MkdirAll(dir, 0700); nil != err {
+		return nil, err
+	}
+	names, err := filepath.Glob(filepath.Join(dir, spoolSegmentPrefix+"*"+spoolSegmentSuffix))
+	if nil != err {
+		return nil, err
+	}
+	// Segment names contain a zero padded sequence number, therefore
+	// sorting the names sorts the segments from oldest to newest.
+	sort.Strings(names)
+
+	sp := &harvestSpool{
+		lg:           lg,
+		dir:          dir,
+		maxBytes:     c.HarvestSpool.MaxBytes,
+		segmentBytes: c.HarvestSpool.SegmentBytes,
+		syncPolicy:   c.HarvestSpool.Sync,
+	}
+	for _, name := range names {
+		seq, ok := spoolSegmentSeq(name)
+		if !ok {
+			continue
+		}
+		info, err := os.Stat(name)
+		if nil != err {
+			continue
+		}
+		sp.segments = append(sp.segments, spoolSegment{path: name, size: info.Size()})
+		sp.size += info.Size()
+		sp.nextSeq = seq + 1
+	}
+	return sp, nil
+}
+
+func spoolSegmentSeq(path string) (uint64, bool) {
+	name := filepath.Base(path)
+	name = strings.TrimPrefix(name, spoolSegmentPrefix)
+	name = strings.TrimSuffix(name, spoolSegmentSuffix)
+	seq, err := strconv.ParseUint(name, 10, 64)
+	return seq, nil == err
+}
+
+func (sp *harvestSpool) segmentPath(seq uint64) string {
+	return filepath.Join(sp.dir, fmt.Sprintf("%s%020d%s", spoolSegmentPrefix, seq, spoolSegmentSuffix))
+}
+
+func encodeSpoolRecord(rec spoolRecord) ([]byte, error) {
+	js, err := json.Marshal(rec)
+	if nil != err {
+		return nil, err
+	}
+	buf := make([]byte, spoolHeaderLen, spoolHeaderLen+len(js))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(js)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(js))
+	return append(buf, js...), nil
+}
+
+// write appends a payload to the spool.  The oldest segments are removed if
+// the payload would not otherwise fit.
+func (sp *harvestSpool) write(method, runID string, data []byte) {
+	buf, err := encodeSpoolRecord(spoolRecord{Method: method, RunID: runID, Data: data})
+	if nil != err {
+		sp.lg.Error("unable to encode spool record", map[string]interface{}{
+			"cmd":   method,
+			"error": err.Error(),
+		})
+		return
+	}
+	n := int64(len(buf))
+
+	sp.Lock()
+	defer sp.Unlock()
+
+	// A record must fit in a segment, so that readSpoolSegment can reject
+	// lengths larger than a segment as corrupt.
+	if n > sp.segmentBytes || n > sp.maxBytes {
+		sp.droppedBytes += float64(n)
+		return
+	}
+	for sp.size+n > sp.maxBytes {
+		if 0 == len(sp.segments) {
+			sp.closeActive()
+			if 0 == len(sp.segments) {
+				break
+			}
+		}
+		sp.removeOldest()
+	}
+	if nil == sp.active {
+		if err := sp.openActive(); nil != err {
+			sp.lg.Error("unable to create spool segment", map[string]interface{}{
+				"error": err.Error(),
+			})
+			sp.droppedBytes += float64(n)
+			return
+		}
+	}
+	if _, err := sp.active.Write(buf); nil != err {
+		sp.lg.Error("unable to write spool segment", map[string]interface{}{
+			"error": err.Error(),
+		})
+		sp.droppedBytes += float64(n)
+		// The segment may now end with a partial record, which will
+		// be discarded when it is replayed.
+		if info, err := sp.active.Stat(); nil == err {
+			sp.size += info.Size() - sp.activeSize
+			sp.activeSize = info.Size()
+		}
+		sp.closeActive()
+		return
+	}
+	sp.activeSize += n
+	sp.size += n
+	sp.spooledBytes += float64(n)
+	if SpoolSyncWrite == sp.syncPolicy {
+		sp.active.Sync()
+	}
+	if sp.activeSize >= sp.segmentBytes {
+		sp.closeActive()
+	}
+}
+
+// openActive must be called with the lock held.
+func (sp *harvestSpool) openActive() error {
+	f, err := os.OpenFile(sp.segmentPath(sp.nextSeq), os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0600)
+	if nil != err {
+		return err
+	}
+	sp.nextSeq++
+	sp.active = f
+	sp.activeSize = 0
+	return nil
+}
+
+// closeActive completes the active segment.  It must be called with the lock
+// held.
+func (sp *harvestSpool) closeActive() {
+	if nil == sp.active {
+		return
+	}
+	if SpoolSyncNone != sp.syncPolicy {
+		sp.active.Sync()
+	}
+	sp.active.Close()
+	sp.segments = append(sp.segments, spoolSegment{path: sp.active.Name(), size: sp.activeSize})
+	sp.active = nil
+	sp.activeSize = 0
+}
+
+// removeOldest drops the oldest complete segment.  It must be called with the
+// lock held.
+func (sp *harvestSpool) removeOldest() {
+	seg := sp.segments[0]
+	sp.segments = sp.segments[1:]
+	sp.size -= seg.size
+	sp.droppedBytes += float64(seg.size)
+	os.Remove(seg.path)
+}
+
+// segmentIndex returns the index of the segment with the given path, or -1 if
+// it has been removed.  It must be called with the lock held.
+func (sp *harvestSpool) segmentIndex(path string) int {
+	for i, seg := range sp.segments {
+		if seg.path == path {
+			return i
+		}
+	}
+	return -1
+}
+
+// createSpoolMetrics adds the supportability metrics of the spool and resets
+// them.
+func createSpoolMetrics(sp *harvestSpool, metrics *metricTable) {
+	if nil == sp {
+		return
+	}
+	sp.Lock()
+	defer sp.Unlock()
+
+	for name, val := range map[string]*float64{
+		spoolSpooledBytes:  &sp.spooledBytes,
+		spoolReplayedBytes: &sp.replayedBytes,
+		spoolDroppedBytes:  &sp.droppedBytes,
+	} {
+		if *val > 0 {
+			metrics.addCount(name, *val, forced)
+			*val = 0
+		}
+	}
+}
+
+// close completes the active segment.  It is called when the application shuts
+// down.
+func (sp *harvestSpool) close() {
+	if nil == sp {
+		return
+	}
+	sp.Lock()
+	defer sp.Unlock()
+	sp.closeActive()
+}
+
+// readSpoolSegment returns the records of a segment file.  Reading stops at
+// the first incomplete or corrupt record, which is the case if the process
+// exited while writing it.  A record whose length exceeds maxRecord or the
+// rest of the file is corrupt.
+func readSpoolSegment(path string, maxRecord int64) ([]spoolRecord, error) {
+	f, err := os.Open(path)
+	if nil != err {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if nil != err {
+		return nil, err
+	}
+	remaining := info.Size()
+
+	var records []spoolRecord
+	r := bufio.NewReader(f)
+	header := make([]byte, spoolHeaderLen)
+	for {
+		if _, err := io.ReadFull(r, header); nil != err {
+			if io.EOF == err {
+				return records, nil
+			}
+			return records, errSpoolCorrupt
+		}
+		remaining -= spoolHeaderLen
+		length := int64(binary.BigEndian.Uint32(header[0:4]))
+		if length > remaining || spoolHeaderLen+length > maxRecord {
+			return records, errSpoolCorrupt
+		}
+		remaining -= length
+		js := make([]byte, length)
+		if _, err := io.ReadFull(r, js); nil != err {
+			return records, errSpoolCorrupt
+		}
+		if crc32.ChecksumIEEE(js) != binary.BigEndian.Uint32(header[4:8]) {
+			return records, errSpoolCorrupt
+		}
+		var rec spoolRecord
+		if err := json.Unmarshal(js, &rec); nil != err {
+			return records, errSpoolCorrupt
+		}
+		rec.size = int64(spoolHeaderLen + len(js))
+		records = append(records, rec)
+	}
+}
+
+// rewriteRunID replaces the agent run id at the start of a payload.  Payloads
+// spooled during a previous run must be sent with the current one.
+func rewriteRunID(data []byte, oldID, newID string) []byte {
+	if oldID == newID {
+		return data
+	}
+	prefix := bytes.NewBufferString("[")
+	jsonx.AppendString(prefix, oldID)
+	if !bytes.HasPrefix(data, prefix.Bytes()) {
+		return data
+	}
+	buf := bytes.NewBufferString("[")
+	jsonx.AppendString(buf, newID)
+	buf.Write(data[prefix.Len():])
+	return buf.Bytes()
+}
+
+// replay sends the spooled payloads using send, oldest first.  Replay stops at
+// the first payload which should be retried, and that payload and those after
+// it stay in the spool.  Only one replay runs at a time.
+func (sp *harvestSpool) replay(runID string, send func(method string, data []byte) rpmResponse) {
+	sp.Lock()
+	if sp.replaying || (0 == len(sp.segments) && nil == sp.active) {
+		sp.Unlock()
+		return
+	}
+	sp.replaying = true
+	sp.closeActive()
+	segments := make([]spoolSegment, len(sp.segments))
+	copy(segments, sp.segments)
+	sp.Unlock()
+
+	defer func() {
+		sp.Lock()
+		sp.replaying = false
+		sp.Unlock()
+	}()
+
+	for _, seg := range segments {
+		records, err := readSpoolSegment(seg.path, sp.segmentBytes)
+		if nil != err && errSpoolCorrupt != err {
+			// The segment was removed to make room for new data.
+			continue
+		}
+		// Bytes following a corrupt record cannot be replayed.
+		tail := seg.size
+		for _, rec := range records {
+			tail -= rec.size
+		}
+		for i, rec := range records {
+			resp := send(rec.Method, rewriteRunID(rec.Data, rec.RunID, runID))
+			if resp.ShouldSaveHarvestData() || resp.IsDisconnect() || resp.IsRestartException() {
+				sp.keep(seg, records[i:], tail)
+				return
+			}
+			sp.Lock()
+			if nil == resp.Err {
+				sp.replayedBytes += float64(rec.size)
+			} else {
+				sp.droppedBytes += float64(rec.size)
+			}
+			sp.Unlock()
+		}
+		sp.Lock()
+		if idx := sp.segmentIndex(seg.path); idx >= 0 {
+			sp.droppedBytes += float64(tail)
+			sp.size -= seg.size
+			sp.segments = append(sp.segments[:idx], sp.segments[idx+1:]...)
+			os.Remove(seg.path)
+		}
+		sp.Unlock()
+	}
+}
+
+// keep replaces the contents of a segment with the records which have not been
+// sent.  tail is the number of unreadable bytes at the end of the segment.
+func (sp *harvestSpool) keep(seg spoolSegment, records []spoolRecord, tail int64) {
+	sp.Lock()
+	defer sp.Unlock()
+
+	idx := sp.segmentIndex(seg.path)
+	if idx < 0 {
+		return
+	}
+	buf := &bytes.Buffer{}
+	for _, rec := range records {
+		js, err := encodeSpoolRecord(rec)
+		if nil != err {
+			continue
+		}
+		buf.Write(js)
+	}
+	tmp := seg.path + ".tmp"
+	err := ioutil.WriteFile(tmp, buf.Bytes(), 0600)
+	if nil == err {
+		err = os.Rename(tmp, seg.path)
+	}
+	if nil != err {
+		sp.lg.Error("unable to rewrite spool segment", map[string]interface{}{
+			"error": err.Error(),
+		})
+		// Keep the whole segment: Payloads already sent may be sent
+		// again.
+		os.Remove(tmp)
+		return
+	}
+	size := int64(buf.Len())
+	sp.droppedBytes += float64(tail)
+	sp.size += size - seg.size
+	sp.segments[idx].size = size
+}
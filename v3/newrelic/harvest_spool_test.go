@@ -0,0 +1,361 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package newrelic
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/newrelic/go-agent/v3/internal"
+	"github.com/newrelic/go-agent/v3/internal/logger"
+)
+
+func testSpool(t *testing.T, cfgfn func(*Config)) (*harvestSpool, func()) {
+	dir, err := ioutil.TempDir("", "spool")
+	if nil != err {
+		t.Fatal(err)
+	}
+	c := config{Config: defaultConfig()}
+	c.HarvestSpool.Enabled = true
+	c.HarvestSpool.Directory = dir
+	if nil != cfgfn {
+		cfgfn(&c.Config)
+	}
+	sp, err := newHarvestSpool(c, logger.ShimLogger{})
+	if nil != err {
+		t.Fatal(err)
+	}
+	return sp, func() { os.RemoveAll(dir) }
+}
+
+type spoolSender struct {
+	methods []string
+	data    []string
+	// When code is non-zero, it is the status code returned for the
+	// payloads at index failAt and after.
+	failAt int
+	code   int
+}
+
+func (s *spoolSender) send(method string, data []byte) rpmResponse {
+	if s.code != 0 && len(s.methods) >= s.failAt {
+		return newRPMResponse(s.code)
+	}
+	s.methods = append(s.methods, method)
+	s.data = append(s.data, string(data))
+	return newRPMResponse(200)
+}
+
+func spoolMetrics(sp *harvestSpool) map[string]float64 {
+	mt := newMetricTable(100, time.Now())
+	createSpoolMetrics(sp, mt)
+	m := make(map[string]float64)
+	for id, val := range mt.metrics {
+		m[id.Name] = val.data.countSatisfied
+	}
+	return m
+}
+
+func TestSpoolWriteReplay(t *testing.T) {
+	sp, cleanup := testSpool(t, nil)
+	defer cleanup()
+
+	// Each record is placed in its own segment.
+	sp.write("metric_data", "old-run", []byte(`["old-run",1,2,[]]`))
+	sp.close()
+	sp.write("custom_event_data", "old-run", []byte(`["old-run",{},[]]`))
+	sp.close()
+	sp.write("sql_trace_data", "old-run", []byte(`[[]]`))
+	sp.close()
+	if len(sp.segments) != 3 || nil != sp.active {
+		t.Fatal(len(sp.segments), sp.active)
+	}
+	spooled := sp.size
+
+	s := &spoolSender{}
+	sp.replay("new-run", s.send)
+	if strings.Join(s.methods, ",") != "metric_data,custom_event_data,sql_trace_data" {
+		t.Error(s.methods)
+	}
+	if s.data[0] != `["new-run",1,2,[]]` || s.data[1] != `["new-run",{},[]]` || s.data[2] != `[[]]` {
+		t.Error(s.data)
+	}
+	if 0 != len(sp.segments) || 0 != sp.size {
+		t.Error(sp.segments, sp.size)
+	}
+	m := spoolMetrics(sp)
+	if m[spoolSpooledBytes] != float64(spooled) || m[spoolReplayedBytes] != float64(spooled) {
+		t.Error(m)
+	}
+	if _, ok := m[spoolDroppedBytes]; ok {
+		t.Error(m)
+	}
+	// The metrics are reset.
+	if m := spoolMetrics(sp); len(m) != 0 {
+		t.Error(m)
+	}
+}
+
+func TestSpoolReplayStopsOnRetry(t *testing.T) {
+	sp, cleanup := testSpool(t, nil)
+	defer cleanup()
+
+	sp.write("metric_data", "run", []byte(`["run",1]`))
+	sp.write("metric_data", "run", []byte(`["run",2]`))
+	sp.write("metric_data", "run", []byte(`["run",3]`))
+
+	s := &spoolSender{failAt: 1, code: 503}
+	sp.replay("run", s.send)
+	if len(s.data) != 1 || s.data[0] != `["run",1]` {
+		t.Fatal(s.data)
+	}
+	if len(sp.segments) != 1 {
+		t.Fatal(sp.segments)
+	}
+
+	s = &spoolSender{}
+	sp.replay("run", s.send)
+	if len(s.data) != 2 || s.data[0] != `["run",2]` || s.data[1] != `["run",3]` {
+		t.Error(s.data)
+	}
+	if 0 != len(sp.segments) || 0 != sp.size {
+		t.Error(sp.segments, sp.size)
+	}
+}
+
+func TestSpoolReplayDiscardsRejected(t *testing.T) {
+	sp, cleanup := testSpool(t, nil)
+	defer cleanup()
+
+	sp.write("metric_data", "run", []byte(`["run",1]`))
+	size := sp.size
+	s := &spoolSender{code: 400}
+	sp.replay("run", s.send)
+	if 0 != len(sp.segments) {
+		t.Error(sp.segments)
+	}
+	if m := spoolMetrics(sp); m[spoolDroppedBytes] != float64(size) {
+		t.Error(m)
+	}
+}
+
+func TestSpoolMaxBytes(t *testing.T) {
+	data := []byte(`["run",1]`)
+	rec, _ := encodeSpoolRecord(spoolRecord{Method: "metric_data", RunID: "run", Data: data})
+	n := int64(len(rec))
+
+	sp, cleanup := testSpool(t, func(cfg *Config) {
+		cfg.HarvestSpool.MaxBytes = 3 * n
+		cfg.HarvestSpool.SegmentBytes = 2 * n
+	})
+	defer cleanup()
+
+	for i := 0; i < 4; i++ {
+		sp.write("metric_data", "run", data)
+	}
+	// The first segment, containing two records, was removed.
+	if sp.size != 2*n || len(sp.segments) != 1 || sp.activeSize != 0 {
+		t.Error(sp.size, sp.segments, sp.activeSize)
+	}
+	// A record larger than the limit is dropped.
+	sp.write("metric_data", "run", make([]byte, 3*n))
+	if sp.size != 2*n {
+		t.Error(sp.size)
+	}
+	m := spoolMetrics(sp)
+	if m[spoolDroppedBytes] <= float64(5*n) || m[spoolSpooledBytes] != float64(4*n) {
+		t.Error(m)
+	}
+}
+
+func TestSpoolRestart(t *testing.T) {
+	sp, cleanup := testSpool(t, nil)
+	defer cleanup()
+
+	sp.write("metric_data", "run", []byte(`["run",1]`))
+	sp.close()
+
+	// A new process finds the segment left by the previous one.
+	c := config{Config: defaultConfig()}
+	c.HarvestSpool.Directory = sp.dir
+	restarted, err := newHarvestSpool(c, logger.ShimLogger{})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if len(restarted.segments) != 1 || restarted.size != sp.size {
+		t.Fatal(restarted.segments, restarted.size)
+	}
+	restarted.write("metric_data", "run", []byte(`["run",2]`))
+	s := &spoolSender{}
+	restarted.replay("new-run", s.send)
+	if len(s.data) != 2 || s.data[0] != `["new-run",1]` || s.data[1] != `["new-run",2]` {
+		t.Error(s.data)
+	}
+}
+
+func TestSpoolCorruptSegment(t *testing.T) {
+	sp, cleanup := testSpool(t, nil)
+	defer cleanup()
+
+	sp.write("metric_data", "run", []byte(`["run",1]`))
+	sp.close()
+	// Simulate a process which exited while writing a record.
+	path := sp.segments[0].path
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if nil != err {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 1})
+	f.Close()
+	sp.segments[0].size += 3
+	sp.size += 3
+
+	s := &spoolSender{}
+	sp.replay("run", s.send)
+	if len(s.data) != 1 || s.data[0] != `["run",1]` {
+		t.Error(s.data)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error(err)
+	}
+	if m := spoolMetrics(sp); m[spoolDroppedBytes] != 3 {
+		t.Error(m)
+	}
+}
+
+func TestSpoolCorruptLength(t *testing.T) {
+	sp, cleanup := testSpool(t, nil)
+	defer cleanup()
+
+	sp.write("metric_data", "run", []byte(`["run",1]`))
+	sp.close()
+	// A corrupt header claims a record of 4GB.
+	path := sp.segments[0].path
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if nil != err {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0, '{', '}'})
+	f.Close()
+
+	records, err := readSpoolSegment(path, sp.segmentBytes)
+	if err != errSpoolCorrupt || len(records) != 1 {
+		t.Error(records, err)
+	}
+	// A record longer than a segment is corrupt even if the file is long
+	// enough to contain it.
+	records, err = readSpoolSegment(path, records[0].size-1)
+	if err != errSpoolCorrupt || len(records) != 0 {
+		t.Error(records, err)
+	}
+}
+
+func TestSpoolRecordLargerThanSegment(t *testing.T) {
+	sp, cleanup := testSpool(t, func(cfg *Config) {
+		cfg.HarvestSpool.SegmentBytes = 64
+	})
+	defer cleanup()
+
+	sp.write("metric_data", "run", make([]byte, 64))
+	if sp.size != 0 || nil != sp.active {
+		t.Error(sp.size, sp.active)
+	}
+	if m := spoolMetrics(sp); m[spoolDroppedBytes] == 0 {
+		t.Error(m)
+	}
+}
+
+func TestRewriteRunID(t *testing.T) {
+	testcases := []struct {
+		data   string
+		expect string
+	}{
+		{data: `["old",1]`, expect: `["new",1]`},
+		{data: `[["old"]]`, expect: `[["old"]]`},
+		{data: `["older",1]`, expect: `["older",1]`},
+	}
+	for _, tc := range testcases {
+		if out := string(rewriteRunID([]byte(tc.data), "old", "new")); out != tc.expect {
+			t.Error(tc.data, out)
+		}
+	}
+}
+
+func TestCollectorSinkUsesSpool(t *testing.T) {
+	sp, cleanup := testSpool(t, nil)
+	defer cleanup()
+
+	cfg := config{Config: defaultConfig()}
+	cfg.Logger = logger.ShimLogger{}
+	var lock sync.Mutex
+	code := 503
+	var methods []string
+	a := &app{
+		Logger: logger.ShimLogger{},
+		config: cfg,
+		rpmControls: rpmControls{
+			Client: &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				lock.Lock()
+				defer lock.Unlock()
+				methods = append(methods, r.URL.Query().Get("method"))
+				return &http.Response{
+					StatusCode: code,
+					Body:       ioutil.NopCloser(strings.NewReader("{}")),
+				}, nil
+			})},
+			Logger: logger.ShimLogger{},
+		},
+		spool: sp,
+	}
+	reply := internal.ConnectReplyDefaults()
+	reply.RunID = "run"
+	run := newAppRun(a.config, reply)
+
+	h := newHarvest(time.Now(), run.harvestConfig)
+	h.Metrics.addCount("myMetric", 1, forced)
+	collectorSink{app: a}.Harvest(newHarvestData(h, time.Now(), run))
+
+	sp.Lock()
+	spooled := sp.size
+	sp.Unlock()
+	if 0 == spooled {
+		t.Fatal("data not spooled")
+	}
+
+	lock.Lock()
+	code = 200
+	methods = nil
+	lock.Unlock()
+
+	// A successful harvest replays the spool.
+	collectorSink{app: a}.Harvest(newHarvestData(&harvest{}, time.Now(), run))
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		sp.Lock()
+		done := 0 == sp.size && !sp.replaying
+		sp.Unlock()
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("spool not replayed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if len(methods) != 1 || methods[0] != "metric_data" {
+		t.Error(methods)
+	}
+	entries, _ := filepath.Glob(filepath.Join(sp.dir, "*"))
+	if len(entries) != 0 {
+		t.Error(entries)
+	}
+}
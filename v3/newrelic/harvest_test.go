@@ -101,6 +101,7 @@ func TestCreateFinalMetrics(t *testing.T) {
 		MaxCustomEvents: 33,
 		MaxErrorEvents:  44,
 		MaxSpanEvents:   55,
+		MaxLogEvents:    66,
 	}
 	h := newHarvest(now, cfgr)
 	h.Metrics.addCount("rename_me", 1.0, unforced)
@@ -113,6 +114,7 @@ func TestCreateFinalMetrics(t *testing.T) {
 		{Name: "Supportability/EventHarvest/CustomEventData/HarvestLimit", Scope: "", Forced: true, Data: []float64{1, 33, 33, 33, 33, 33 * 33}},
 		{Name: "Supportability/EventHarvest/ErrorEventData/HarvestLimit", Scope: "", Forced: true, Data: []float64{1, 44, 44, 44, 44, 44 * 44}},
 		{Name: "Supportability/EventHarvest/SpanEventData/HarvestLimit", Scope: "", Forced: true, Data: []float64{1, 55, 55, 55, 55, 55 * 55}},
+		{Name: "Supportability/EventHarvest/LogEventData/HarvestLimit", Scope: "", Forced: true, Data: []float64{1, 66, 66, 66, 66, 66 * 66}},
 		{Name: "Supportability/Go/Version/" + Version, Scope: "", Forced: true, Data: []float64{1, 0, 0, 0, 0, 0}},
 		{Name: "Supportability/Go/Runtime/Version/" + goVersionSimple, Scope: "", Forced: true, Data: []float64{1, 0, 0, 0, 0, 0}},
 		{Name: "Supportability/Go/gRPC/Version/" + grpcVersion, Scope: "", Forced: true, Data: []float64{1, 0, 0, 0, 0, 0}},
@@ -137,6 +139,7 @@ func TestCreateFinalMetrics(t *testing.T) {
 		{Name: "Supportability/EventHarvest/CustomEventData/HarvestLimit", Scope: "", Forced: true, Data: []float64{1, 10 * 1000, 10 * 1000, 10 * 1000, 10 * 1000, 10 * 1000 * 10 * 1000}},
 		{Name: "Supportability/EventHarvest/ErrorEventData/HarvestLimit", Scope: "", Forced: true, Data: []float64{1, 100, 100, 100, 100, 100 * 100}},
 		{Name: "Supportability/EventHarvest/SpanEventData/HarvestLimit", Scope: "", Forced: true, Data: []float64{1, 1000, 1000, 1000, 1000, 1000 * 1000}},
+		{Name: "Supportability/EventHarvest/LogEventData/HarvestLimit", Scope: "", Forced: true, Data: []float64{1, 10 * 1000, 10 * 1000, 10 * 1000, 10 * 1000, 10 * 1000 * 10 * 1000}},
 		{Name: "Supportability/Go/Version/" + Version, Scope: "", Forced: true, Data: []float64{1, 0, 0, 0, 0, 0}},
 		{Name: "Supportability/Go/Runtime/Version/" + goVersionSimple, Scope: "", Forced: true, Data: []float64{1, 0, 0, 0, 0, 0}},
 		{Name: "Supportability/Go/gRPC/Version/" + grpcVersion, Scope: "", Forced: true, Data: []float64{1, 0, 0, 0, 0, 0}},
@@ -170,6 +173,7 @@ func TestCreateFinalMetricsTraceObserver(t *testing.T) {
 		{Name: "Supportability/EventHarvest/CustomEventData/HarvestLimit", Scope: "", Forced: true, Data: nil},
 		{Name: "Supportability/EventHarvest/ErrorEventData/HarvestLimit", Scope: "", Forced: true, Data: nil},
 		{Name: "Supportability/EventHarvest/SpanEventData/HarvestLimit", Scope: "", Forced: true, Data: nil},
+		{Name: "Supportability/EventHarvest/LogEventData/HarvestLimit", Scope: "", Forced: true, Data: nil},
 		{Name: "Supportability/Go/Version/" + Version, Scope: "", Forced: true, Data: nil},
 		{Name: "Supportability/Go/Runtime/Version/" + goVersionSimple, Scope: "", Forced: true, Data: nil},
 		{Name: "Supportability/Go/gRPC/Version/" + grpcVersion, Scope: "", Forced: true, Data: []float64{1, 0, 0, 0, 0, 0}},
@@ -181,7 +185,7 @@ func TestCreateFinalMetricsTraceObserver(t *testing.T) {
 func TestEmptyPayloads(t *testing.T) {
 	h := newHarvest(time.Now(), dfltHarvestCfgr)
 	payloads := h.Payloads(true)
-	if len(payloads) != 8 {
+	if len(payloads) != 10 {
 		t.Error(len(payloads))
 	}
 	for _, p := range payloads {
@@ -315,7 +319,7 @@ func TestHarvestErrorEventsReady(t *testing.T) {
 		MaxErrorEvents: 3,
 	})
 	h.ErrorEvents.Add(&errorEvent{
-		errorData: errorData{Klass: "klass", Msg: "msg", When: time.Now()},
+		errorData: errorData{Klass: "klass", Msg: "msg", When: time.Now(), GroupName: "klass: msg"},
 		txnEvent:  txnEvent{FinalName: "finalName", Duration: 1 * time.Second},
 	}, 0)
 	ready := h.Ready(now.Add(10 * time.Second))
@@ -431,7 +435,7 @@ func TestHarvestMetricsTracesReady(t *testing.T) {
 
 	ready := h.Ready(now.Add(61 * time.Second))
 	payloads := ready.Payloads(true)
-	if len(payloads) != 4 {
+	if len(payloads) != 5 {
 		t.Fatal(payloads)
 	}
 
@@ -481,9 +485,10 @@ func TestMergeFailedHarvest(t *testing.T) {
 	h.CustomEvents.Add(ce)
 	h.ErrorEvents.Add(&errorEvent{
 		errorData: errorData{
-			Klass: "klass",
-			Msg:   "msg",
-			When:  time.Now(),
+			Klass:     "klass",
+			Msg:       "msg",
+			When:      time.Now(),
+			GroupName: "klass: msg",
 		},
 		txnEvent: txnEvent{
 			FinalName: "finalName",
@@ -730,10 +735,10 @@ func TestHarvestSplitTxnEvents(t *testing.T) {
 	payloadsWithSplit := h.Payloads(true)
 	payloadsWithoutSplit := h.Payloads(false)
 
-	if len(payloadsWithSplit) != 9 {
+	if len(payloadsWithSplit) != 11 {
 		t.Error(len(payloadsWithSplit))
 	}
-	if len(payloadsWithoutSplit) != 8 {
+	if len(payloadsWithoutSplit) != 10 {
 		t.Error(len(payloadsWithoutSplit))
 	}
 }
@@ -27,6 +27,10 @@ import (
 //		io.WriteString(w, "users page")
 //	}
 //
+// When Config.ErrorCollector.RecordPanics is true and
+// Config.ErrorCollector.PanicPolicy is PanicPolicySwallow, the panics of the
+// handler are recorded and the handler responds with a 500 status code.
+//
 // The WrapHandle function is safe to call if app is nil.
 func WrapHandle(app *Application, pattern string, handler http.Handler) (string, http.Handler) {
 	if app == nil {
@@ -41,6 +45,18 @@ func WrapHandle(app *Application, pattern string, handler http.Handler) (string,
 
 		r = RequestWithTransactionContext(r, txn)
 
+		if txn.swallowsPanics() {
+			defer func() {
+				if rec := recover(); nil != rec {
+					wroteHeader, err := txn.thread.RecordPanic(rec)
+					txn.thread.logAPIError(err, "record panic", nil)
+					if !wroteHeader {
+						w.WriteHeader(http.StatusInternalServerError)
+					}
+				}
+			}()
+		}
+
 		handler.ServeHTTP(w, r)
 	})
 }
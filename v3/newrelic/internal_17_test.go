@@ -115,6 +115,38 @@ func TestWrapHandleNilApp(t *testing.T) {
 	}
 }
 
+func TestWrapHandlePanicSwallowed(t *testing.T) {
+	app := testApp(nil, panicPolicy(PanicPolicySwallow), t)
+	mux := http.NewServeMux()
+	mux.Handle(WrapHandle(app.Application, helloPath, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		panic(myError{})
+	})))
+	w := newCompatibleResponseRecorder()
+	mux.ServeHTTP(w, helloRequest)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Error(w.Code)
+	}
+
+	// The 500 response is not recorded as an additional error.
+	app.ExpectErrors(t, []internal.WantError{{
+		TxnName: "WebTransaction/Go/GET /hello",
+		Msg:     "my msg",
+		Klass:   panicErrorKlass,
+	}})
+	app.ExpectErrorEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"error.class":     panicErrorKlass,
+			"error.message":   "my msg",
+			"transactionName": "WebTransaction/Go/GET /hello",
+		},
+		AgentAttributes: mergeAttributes(helloRequestAttributes, map[string]interface{}{
+			"httpResponseCode": "500",
+			"http.statusCode":  "500",
+		}),
+	}})
+}
+
 func TestRoundTripper(t *testing.T) {
 	app := testApp(distributedTracingReplyFields, enableBetterCAT, t)
 	txn := app.StartTransaction("hello")
@@ -63,15 +63,62 @@ type app struct {
 	err error
 
 	serverless *serverlessHarvest
+
+	// samplers are called by the runtime sampler.
+	samplers samplerRegistry
+	// explainPlans limits the rate at which the plans of slow queries are
+	// captured.
+	explainPlans explainPlanLimiter
+
+	// harvestSinks receive the data at each harvest: The built-in sink
+	// comes first, followed by the sinks from Config.HarvestSinks.
+	harvestSinks []HarvestSink
+
+	// spool is non-nil when Config.HarvestSpool is enabled and data is
+	// sent to New Relic.
+	spool *harvestSpool
+
+	// debugTraces is non-nil when Config.DebugTraces is enabled.
+	debugTraces *debugTraceWriter
+
+	// prometheus is non-nil when Config.Prometheus is enabled.
+	prometheus *prometheusRegistry
+
+	// profiler is non-nil when Config.Profiling is enabled and data is
+	// harvested.
+	profiler *profiler
+
+	// diagnosticsState is reported by the diagnostics handler.
+	diagnosticsState *appDiagnostics
+	// diagnosticsRequests is used by the diagnostics handler to ask the
+	// processing goroutine for the state of the harvest.
+	diagnosticsRequests chan chan<- map[string]diagnosticsReservoir
 }
 
 func (app *app) doHarvest(h *harvest, harvestStart time.Time, run *appRun) {
 	h.CreateFinalMetrics(run.Reply, run.harvestConfig, app.getObserver())
+	if nil != h.Metrics {
+		createSpoolMetrics(app.spool, h.Metrics)
+	}
+	app.diagnosticsState.recordHarvest(h)
+
+	deliverHarvest(app, newHarvestData(h, harvestStart, run), app.harvestSinks)
+}
 
-	payloads := h.Payloads(app.config.DistributedTracer.Enabled)
+// collectorSink is the built-in HarvestSink which sends data to the New Relic
+// collector.
+type collectorSink struct {
+	app *app
+}
+
+func (s collectorSink) Harvest(hd *HarvestData) error {
+	app := s.app
+	run := hd.run
+	payloads := hd.data.Payloads(app.config.DistributedTracer.Enabled)
+	saved := false
 	for _, p := range payloads {
 		cmd := p.EndpointMethod()
-		data, err := p.Data(run.Reply.RunID.String(), harvestStart)
+		data, err := p.Data(run.Reply.RunID.String(), hd.start)
 
 		if nil != err {
 			app.Warn("unable to create harvest data", map[string]interface{}{
@@ -93,14 +140,23 @@ func (app *app) doHarvest(h *harvest, harvestStart time.Time, run *appRun) {
 			MaxPayloadSize:    run.Reply.MaxPayloadSizeInBytes,
 		}
 
+		requestStart := time.Now()
 		resp := collectorRequest(call, app.rpmControls)
 
+		diag := newDiagnosticsRequest(requestStart, "collector", cmd, len(data))
+		diag.StatusCode = resp.statusCode
+		if nil != resp.Err {
+			diag.Error = resp.Err.Error()
+		}
+		diag.RetainData = resp.ShouldSaveHarvestData()
+		app.diagnosticsState.recordRequest(diag)
+
 		if resp.IsDisconnect() || resp.IsRestartException() {
 			select {
 			case app.collectorErrorChan <- resp:
 			case <-app.shutdownStarted:
 			}
-			return
+			return nil
 		}
 
 		if nil != resp.Err {
@@ -112,9 +168,37 @@ func (app *app) doHarvest(h *harvest, harvestStart time.Time, run *appRun) {
 		}
 
 		if resp.ShouldSaveHarvestData() {
-			app.Consume(run.Reply.RunID, p)
+			saved = true
+			if nil != app.spool {
+				app.spool.write(cmd, call.RunID, data)
+			} else {
+				app.Consume(run.Reply.RunID, p)
+			}
 		}
 	}
+	if !saved {
+		// The collector is reachable: Send any spooled data.
+		app.replaySpool(run)
+	}
+	return nil
+}
+
+// replaySpool sends the data in the spool using the given run in a new
+// goroutine.
+func (app *app) replaySpool(run *appRun) {
+	if nil == app.spool {
+		return
+	}
+	go app.spool.replay(run.Reply.RunID.String(), func(method string, data []byte) rpmResponse {
+		return collectorRequest(rpmCmd{
+			Collector:         run.Reply.Collector,
+			RunID:             run.Reply.RunID.String(),
+			Name:              method,
+			Data:              data,
+			RequestHeadersMap: run.Reply.RequestHeadersMap,
+			MaxPayloadSize:    run.Reply.MaxPayloadSizeInBytes,
+		}, app.rpmControls)
+	})
 }
 
 func (app *app) connectRoutine() {
@@ -232,6 +316,8 @@ func (app *app) process() {
 			if nil != run && run.Reply.RunID == d.id {
 				d.data.MergeIntoHarvest(h)
 			}
+		case reply := <-app.diagnosticsRequests:
+			reply <- reservoirDiagnostics(h)
 		case timeout := <-app.initiateShutdown:
 			close(app.shutdownStarted)
 
@@ -260,6 +346,7 @@ func (app *app) process() {
 				}
 				app.doHarvest(h, time.Now(), run)
 			}
+			app.spool.close()
 
 			close(app.shutdownComplete)
 			app.setObserver(nil)
@@ -299,6 +386,7 @@ func (app *app) process() {
 				"run": run.Reply.RunID.String(),
 			})
 			processConnectMessages(run, app)
+			app.replaySpool(run)
 		}
 	}
 }
@@ -345,6 +433,9 @@ func runSampler(app *app, period time.Duration) {
 				Current:  current,
 			}))
 			previous = current
+			for _, sample := range app.samplers.sample() {
+				app.Consume(run.Reply.RunID, sample)
+			}
 		case <-app.shutdownStarted:
 			t.Stop()
 			return
@@ -405,6 +496,9 @@ func newApp(c config) *app {
 		connectChan:        make(chan *appRun, 1),
 		collectorErrorChan: make(chan rpmResponse, 1),
 		dataChan:           make(chan appData, appDataChanSize),
+
+		diagnosticsState:    newAppDiagnostics(),
+		diagnosticsRequests: make(chan chan<- map[string]diagnosticsReservoir),
 		rpmControls: rpmControls{
 			License: c.License,
 			Client: &http.Client{
@@ -422,17 +516,62 @@ func newApp(c config) *app {
 		"grpc-version": grpcVersion,
 	})
 
+	if app.config.DebugTraces.Enabled {
+		w, err := newDebugTraceWriter(c.DebugTraces.Directory, c.Logger)
+		if nil != err {
+			app.Error("unable to create debug traces directory", map[string]interface{}{
+				"dir":   c.DebugTraces.Directory,
+				"error": err.Error(),
+			})
+		}
+		app.debugTraces = w
+	}
+
+	if app.config.Prometheus.Enabled {
+		app.prometheus = newPrometheusRegistry(c.Prometheus.Buckets)
+	}
+
 	if app.config.Enabled {
 		if app.config.ServerlessMode.Enabled {
 			reply := newServerlessConnectReply(c)
 			app.run = newAppRun(c, reply)
 			app.serverless = newServerlessHarvest(c.Logger, os.Getenv)
+			app.serverless.sinks = c.HarvestSinks
 		} else {
+			if app.config.OTLPExporter.Enabled {
+				app.harvestSinks = append(app.harvestSinks, otlpSink{
+					app: app,
+					exp: newOTLPExporter(c, app.rpmControls.Client),
+				})
+				// There is no connect: the run is available
+				// immediately.
+				app.connectChan <- newAppRun(c, newOTLPConnectReply())
+			} else {
+				app.harvestSinks = append(app.harvestSinks, collectorSink{app: app})
+				if app.config.HarvestSpool.Enabled {
+					sp, err := newHarvestSpool(c, c.Logger)
+					if nil != err {
+						app.Error("unable to open harvest spool", map[string]interface{}{
+							"dir":   c.HarvestSpool.Directory,
+							"error": err.Error(),
+						})
+					}
+					app.spool = sp
+				}
+			}
+			app.harvestSinks = append(app.harvestSinks, c.HarvestSinks...)
 			go app.process()
-			go app.connectRoutine()
+			if !app.config.OTLPExporter.Enabled {
+				go app.connectRoutine()
+			}
 			if app.config.RuntimeSampler.Enabled {
+				app.sampleRuntime()
 				go runSampler(app, runtimeSamplerPeriod)
 			}
+			if app.config.Profiling.Enabled {
+				app.profiler = newProfiler(app)
+				go app.profiler.run()
+			}
 		}
 	}
 
@@ -501,7 +640,11 @@ func (app *app) StartTransaction(name string) *Transaction {
 		return nil
 	}
 	run, _ := app.getState()
-	return newTransaction(newTxn(app, run, name))
+	thd := newTxn(app, run, name)
+	if app.config.profilerLabelsEnabled() {
+		thd.startTxnProfilerLabels()
+	}
+	return newTransaction(thd)
 }
 
 var (
@@ -542,6 +685,36 @@ func (app *app) RecordCustomEvent(eventType string, params map[string]interface{
 	return nil
 }
 
+// RecordLog implements newrelic.Application's RecordLog.
+func (app *app) RecordLog(data LogData) error {
+	if nil == app {
+		return nil
+	}
+	// Logging integrations call RecordLog for every record, so no error is
+	// returned when application logging is disabled.
+	if !app.config.ApplicationLogging.Enabled {
+		return nil
+	}
+	run, _ := app.getState()
+	r := logRecord{
+		severity: data.Severity,
+		metrics:  run.Config.logMetricsEnabled(),
+	}
+	if run.Config.logForwardingEnabled() {
+		e, err := run.createLogEvent(data, time.Now())
+		if nil != err {
+			return err
+		}
+		r.event = e
+		r.severity = e.severity
+	}
+	if "" == r.severity {
+		r.severity = logSeverityUnknown
+	}
+	app.Consume(run.Reply.RunID, r)
+	return nil
+}
+
 var (
 	errMetricInf        = errors.New("invalid metric value: inf")
 	errMetricNaN        = errors.New("invalid metric value: NaN")
@@ -549,14 +722,7 @@ var (
 	errMetricServerless = errors.New("custom metrics are not currently supported in serverless mode")
 )
 
-// RecordCustomMetric implements newrelic.Application's RecordCustomMetric.
-func (app *app) RecordCustomMetric(name string, value float64) error {
-	if nil == app {
-		return nil
-	}
-	if app.config.ServerlessMode.Enabled {
-		return errMetricServerless
-	}
+func validateMetricValue(name string, value float64) error {
 	if math.IsNaN(value) {
 		return errMetricNaN
 	}
@@ -566,6 +732,20 @@ func (app *app) RecordCustomMetric(name string, value float64) error {
 	if "" == name {
 		return errMetricNameEmpty
 	}
+	return nil
+}
+
+// RecordCustomMetric implements newrelic.Application's RecordCustomMetric.
+func (app *app) RecordCustomMetric(name string, value float64) error {
+	if nil == app {
+		return nil
+	}
+	if app.config.ServerlessMode.Enabled {
+		return errMetricServerless
+	}
+	if err := validateMetricValue(name, value); nil != err {
+		return err
+	}
 	run, _ := app.getState()
 	app.Consume(run.Reply.RunID, customMetric{
 		RawInputName: name,
@@ -574,6 +754,26 @@ func (app *app) RecordCustomMetric(name string, value float64) error {
 	return nil
 }
 
+// RecordMetric implements newrelic.Application's RecordMetric.
+func (app *app) RecordMetric(metricType MetricType, name string, value float64, attributes map[string]interface{}) error {
+	if nil == app {
+		return nil
+	}
+	if app.config.ServerlessMode.Enabled {
+		return errMetricServerless
+	}
+	run, _ := app.getState()
+	if app.config.HighSecurity || !run.Reply.SecurityPolicies.CustomParameters.Enabled() {
+		attributes = nil
+	}
+	r, err := createDimensionalMetricRecord(metricType, name, value, attributes)
+	if nil != err {
+		return err
+	}
+	app.Consume(run.Reply.RunID, r)
+	return nil
+}
+
 var (
 	_ internal.ServerlessWriter = &app{}
 )
@@ -585,6 +785,7 @@ func (app *app) ServerlessWrite(arn string, writer io.Writer) {
 func (app *app) Consume(id internal.AgentRunID, data harvestable) {
 
 	app.serverless.Consume(data)
+	app.prometheus.Consume(data)
 
 	if nil != app.testHarvest {
 		data.MergeIntoHarvest(app.testHarvest)
@@ -605,6 +806,10 @@ func (app *app) ExpectCustomEvents(t internal.Validator, want []internal.WantEve
 	expectCustomEvents(extendValidator(t, "custom events"), app.testHarvest.CustomEvents, want)
 }
 
+func (app *app) ExpectLogEvents(t internal.Validator, want []internal.WantLog) {
+	expectLogEvents(extendValidator(t, "log events"), app.testHarvest.LogEvents, want)
+}
+
 func (app *app) ExpectErrors(t internal.Validator, want []internal.WantError) {
 	t = extendValidator(t, "traced errors")
 	expectErrors(t, app.testHarvest.ErrorTraces, want)
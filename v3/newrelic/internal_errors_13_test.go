@@ -6,6 +6,7 @@
 package newrelic
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 
@@ -50,3 +51,213 @@ func TestNoticedWrappedError(t *testing.T) {
 	}})
 	app.ExpectMetrics(t, backgroundErrorMetrics)
 }
+
+func TestErrorGroupCallback(t *testing.T) {
+	var info ErrorInfo
+	cfgFn := func(cfg *Config) {
+		cfg.ErrorCollector.ErrorGroupCallback = func(i ErrorInfo) string {
+			info = i
+			return "group " + i.Class
+		}
+	}
+	socket := Error{Message: "socket error", Class: "socketError"}
+	wrapped := fmt.Errorf("problem in alpha: %w", socket)
+
+	app := testApp(nil, cfgFn, t)
+	txn := app.StartTransaction("hello")
+	txn.SetWebRequestHTTP(helloRequest)
+	txn.NoticeError(wrapped)
+	txn.End()
+	app.ExpectErrorEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"error.class":      "socketError",
+			"error.message":    "problem in alpha: socket error",
+			"error.group.name": "group socketError",
+			"transactionName":  "WebTransaction/Go/hello",
+		},
+		AgentAttributes: helloRequestAttributes,
+	}})
+
+	if info.Error != wrapped || len(info.Chain) != 2 || info.Chain[0] != wrapped || info.Chain[1].Error() != socket.Message {
+		t.Error(info.Error, info.Chain)
+	}
+	if info.TransactionName != "WebTransaction/Go/hello" || info.Class != "socketError" || info.Expected {
+		t.Error(info.TransactionName, info.Class, info.Expected)
+	}
+	if info.RequestAttributes[AttributeRequestURI] != "/hello" || info.RequestAttributes[AttributeRequestMethod] != "GET" {
+		t.Error(info.RequestAttributes)
+	}
+	if len(info.Stack) == 0 {
+		t.Error("missing stack")
+	}
+}
+
+func TestErrorGroupCallbackDefault(t *testing.T) {
+	cfgFn := func(cfg *Config) {
+		cfg.ErrorCollector.ErrorGroupCallback = func(ErrorInfo) string { return "" }
+	}
+	app := testApp(nil, cfgFn, t)
+	txn := app.StartTransaction("hello")
+	txn.NoticeError(Error{Message: "user 42 not found", Class: "notFound", Stack: []uintptr{}})
+	txn.End()
+	app.ExpectErrorEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"error.class":      "notFound",
+			"error.message":    "user 42 not found",
+			"error.group.name": "notFound: user # not found",
+			"transactionName":  "OtherTransaction/Go/hello",
+		},
+	}})
+}
+
+func TestErrorGroupWithoutCallback(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello")
+	txn.NoticeError(Error{Message: "user 42 not found", Class: "notFound", Stack: []uintptr{}})
+	txn.End()
+	app.ExpectErrorEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"error.class":      "notFound",
+			"error.message":    "user 42 not found",
+			"error.group.name": "notFound: user # not found",
+			"transactionName":  "OtherTransaction/Go/hello",
+		},
+	}})
+}
+
+func TestErrorGroupCallbackPanics(t *testing.T) {
+	cfgFn := func(cfg *Config) {
+		cfg.ErrorCollector.ErrorGroupCallback = func(ErrorInfo) string { panic("oops") }
+	}
+	app := testApp(nil, cfgFn, t)
+	txn := app.StartTransaction("hello")
+	txn.NoticeError(Error{Message: "user 42 not found", Class: "notFound", Stack: []uintptr{}})
+	txn.End()
+	app.expectSingleLoggedError(t, "error group callback panicked", map[string]interface{}{
+		"panic": "oops",
+	})
+	app.ExpectErrorEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"error.class":      "notFound",
+			"error.message":    "user 42 not found",
+			"error.group.name": "notFound: user # not found",
+			"transactionName":  "OtherTransaction/Go/hello",
+		},
+	}})
+}
+
+func TestErrorGroupCallbackUsesTransaction(t *testing.T) {
+	var txn *Transaction
+	cfgFn := func(cfg *Config) {
+		cfg.ErrorCollector.ErrorGroupCallback = func(ErrorInfo) string {
+			// The transaction is not locked while the callback runs.
+			return "group " + txn.GetLinkingMetadata().EntityName
+		}
+	}
+	app := testApp(nil, cfgFn, t)
+	txn = app.StartTransaction("hello")
+	txn.NoticeError(Error{Message: "socket error", Class: "socketError"})
+	txn.End()
+	app.ExpectErrorEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"error.class":      "socketError",
+			"error.message":    "socket error",
+			"error.group.name": "group my app",
+			"transactionName":  "OtherTransaction/Go/hello",
+		},
+	}})
+}
+
+type multiError []error
+
+func (m multiError) Error() string   { return "multiple errors" }
+func (m multiError) Unwrap() []error { return m }
+
+type cyclicError struct{ self *cyclicError }
+
+func (e *cyclicError) Error() string { return "cyclic" }
+func (e *cyclicError) Unwrap() error { return e.self }
+
+func TestErrorChain(t *testing.T) {
+	socket := Error{Message: "socket error", Class: "socketError", Stack: []uintptr{1}}
+	plain := errors.New("plain")
+	multi := multiError{plain, socket}
+	wrapped := fmt.Errorf("alpha: %w", multi)
+	chain := errorChain(wrapped)
+	if len(chain) != 4 || chain[0] != wrapped || chain[2] != plain || chain[3].Error() != "socket error" {
+		t.Error(chain)
+	}
+
+	cyclic := &cyclicError{}
+	cyclic.self = cyclic
+	if chain := errorChain(cyclic); len(chain) != maxErrorChainLinks {
+		t.Error(len(chain))
+	}
+}
+
+func TestNoticedErrorChain(t *testing.T) {
+	socket := Error{Message: "socket error", Class: "socketError", Stack: NewStackTrace()}
+	wrapped := fmt.Errorf("alpha: %w", multiError{errors.New("plain"), socket})
+
+	tapp := testApp(nil, nil, t)
+	txn := tapp.StartTransaction("hello")
+	txn.NoticeError(wrapped)
+	txn.End()
+	tapp.ExpectErrors(t, []internal.WantError{{
+		TxnName: "OtherTransaction/Go/hello",
+		Msg:     "alpha: multiple errors",
+		Klass:   "socketError",
+	}})
+
+	traces := newHarvestData(tapp.Private.(*app).testHarvest, now, nil).ErrorTraces()
+	if len(traces) != 1 {
+		t.Fatal(traces)
+	}
+	chain := traces[0].Chain
+	if len(chain) != 3 {
+		t.Fatal(chain)
+	}
+	if chain[0].Class != "newrelic.multiError" || chain[0].Message != "multiple errors" || nil != chain[0].Stack {
+		t.Error(chain[0])
+	}
+	if chain[1].Class != "*errors.errorString" || chain[1].Message != "plain" {
+		t.Error(chain[1])
+	}
+	if chain[2].Class != "socketError" || chain[2].Message != "socket error" || len(chain[2].Stack) == 0 {
+		t.Error(chain[2])
+	}
+	// The stack of the error found in the chain is used.
+	if len(traces[0].Stack) != len(socket.Stack) {
+		t.Error(len(traces[0].Stack), len(socket.Stack))
+	}
+}
+
+func TestNoticedErrorChainExcluded(t *testing.T) {
+	tapp := testApp(nil, func(cfg *Config) {
+		cfg.ErrorCollector.Attributes.Exclude = []string{AttributeErrorChain}
+	}, t)
+	txn := tapp.StartTransaction("hello")
+	txn.NoticeError(fmt.Errorf("alpha: %w", errors.New("plain")))
+	txn.End()
+	tapp.ExpectErrors(t, []internal.WantError{{
+		TxnName:         "OtherTransaction/Go/hello",
+		Msg:             "alpha: plain",
+		Klass:           "*errors.errorString",
+		AgentAttributes: map[string]interface{}{},
+	}})
+	traces := newHarvestData(tapp.Private.(*app).testHarvest, now, nil).ErrorTraces()
+	if len(traces) != 1 || nil != traces[0].Chain {
+		t.Fatal(traces)
+	}
+}
+
+func TestNoticedErrorChainHighSecurity(t *testing.T) {
+	tapp := testApp(nil, func(cfg *Config) { cfg.HighSecurity = true }, t)
+	txn := tapp.StartTransaction("hello")
+	txn.NoticeError(fmt.Errorf("alpha: %w", errors.New("secret")))
+	txn.End()
+	traces := newHarvestData(tapp.Private.(*app).testHarvest, now, nil).ErrorTraces()
+	if len(traces) != 1 || len(traces[0].Chain) != 1 || traces[0].Chain[0].Message != highSecurityErrorMsg {
+		t.Fatal(traces)
+	}
+}
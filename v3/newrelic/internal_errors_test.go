@@ -719,3 +719,124 @@ func TestNoticeErrorPanicRecoverySpanID(t *testing.T) {
 	}})
 	app.ExpectMetrics(t, backgroundErrorMetricsUnknownCaller)
 }
+
+func TestNoticeErrorExpected(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello")
+	txn.NoticeError(Error{Message: "my msg", Class: "my class", Expected: true})
+	app.expectNoLoggedErrors(t)
+	txn.End()
+	app.ExpectErrors(t, []internal.WantError{{
+		TxnName: "OtherTransaction/Go/hello",
+		Msg:     "my msg",
+		Klass:   "my class",
+	}})
+	app.ExpectErrorEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"error.class":     "my class",
+			"error.message":   "my msg",
+			"error.expected":  true,
+			"transactionName": "OtherTransaction/Go/hello",
+		},
+	}})
+	app.ExpectMetrics(t, append([]internal.WantMetric{
+		{Name: "ErrorsExpected/all", Scope: "", Forced: true, Data: singleCount},
+	}, backgroundMetrics...))
+	app.ExpectTxnEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"name":  "OtherTransaction/Go/hello",
+			"error": false,
+		},
+	}})
+}
+
+func TestNoticeErrorExpectedAndUnexpected(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello")
+	for i := 0; i < maxTxnErrors; i++ {
+		txn.NoticeError(Error{Message: "expected", Class: "my class", Expected: true})
+	}
+	txn.NoticeError(myError{})
+	txn.End()
+	app.ExpectMetrics(t, backgroundErrorMetrics)
+}
+
+func TestNoticeErrorExpectedByConfig(t *testing.T) {
+	cfgFn := func(cfg *Config) {
+		cfg.ErrorCollector.ExpectedClasses = []string{"newrelic.myError"}
+		cfg.ErrorCollector.ExpectedMessages = map[string][]string{"my class": {"not found"}}
+	}
+	app := testApp(nil, cfgFn, t)
+	txn := app.StartTransaction("hello")
+	txn.NoticeError(myError{})
+	txn.NoticeError(Error{Message: "user not found", Class: "my class"})
+	txn.End()
+	app.ExpectErrorEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"error.class":     "newrelic.myError",
+			"error.message":   "my msg",
+			"error.expected":  true,
+			"transactionName": "OtherTransaction/Go/hello",
+		},
+	}, {
+		Intrinsics: map[string]interface{}{
+			"error.class":     "my class",
+			"error.message":   "user not found",
+			"error.expected":  true,
+			"transactionName": "OtherTransaction/Go/hello",
+		},
+	}})
+	app.ExpectMetrics(t, append([]internal.WantMetric{
+		{Name: "ErrorsExpected/all", Scope: "", Forced: true, Data: singleCount},
+	}, backgroundMetrics...))
+}
+
+func TestNoticeErrorIgnoredByConfig(t *testing.T) {
+	cfgFn := func(cfg *Config) {
+		cfg.ErrorCollector.IgnoreClasses = []string{"newrelic.myError"}
+		cfg.ErrorCollector.IgnoreMessages = map[string][]string{"my class": {"canceled"}}
+	}
+	app := testApp(nil, cfgFn, t)
+	txn := app.StartTransaction("hello")
+	txn.NoticeError(myError{})
+	txn.NoticeError(Error{Message: "request canceled", Class: "my class"})
+	app.expectNoLoggedErrors(t)
+	txn.NoticeError(Error{Message: "failed", Class: "my class"})
+	txn.End()
+	app.ExpectErrors(t, []internal.WantError{{
+		TxnName: "OtherTransaction/Go/hello",
+		Msg:     "failed",
+		Klass:   "my class",
+	}})
+	app.ExpectMetrics(t, backgroundErrorMetrics)
+}
+
+func TestExpectedStatusCode(t *testing.T) {
+	cfgFn := func(cfg *Config) { cfg.ErrorCollector.ExpectedStatusCodes = []int{409} }
+	app := testApp(nil, cfgFn, t)
+	txn := app.StartTransaction("hello")
+	txn.SetWebResponse(nil).WriteHeader(409)
+	txn.End()
+	app.ExpectErrorEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"error.class":     "409",
+			"error.message":   "Conflict",
+			"error.expected":  true,
+			"transactionName": "OtherTransaction/Go/hello",
+		},
+	}})
+	app.ExpectMetrics(t, append([]internal.WantMetric{
+		{Name: "ErrorsExpected/all", Scope: "", Forced: true, Data: singleCount},
+	}, backgroundMetrics...))
+}
+
+func TestExpectedErrorApdex(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello")
+	txn.SetWebRequestHTTP(helloRequest)
+	txn.NoticeError(Error{Message: "my msg", Class: "my class", Expected: true})
+	txn.End()
+	app.ExpectMetricsPresent(t, []internal.WantMetric{
+		{Name: "Apdex", Scope: "", Forced: true, Data: []float64{1, 0, 0, 0.5, 0.5, 0}},
+	})
+}
@@ -867,3 +867,109 @@ func TestSlowQueryParamsInvalid(t *testing.T) {
 		Params:       map[string]interface{}{"number": 5},
 	}})
 }
+
+func recordSQLSlowQuery(t *testing.T, cfgfn func(*Config), replyfn func(*internal.ConnectReply), expect string) {
+	app := testApp(replyfn, func(cfg *Config) {
+		cfg.DatastoreTracer.SlowQuery.Threshold = 0
+		if nil != cfgfn {
+			cfgfn(cfg)
+		}
+	}, t)
+	txn := app.StartTransaction("hello")
+	s1 := DatastoreSegment{
+		StartTime:          txn.StartSegmentNow(),
+		Product:            DatastorePostgres,
+		Collection:         "users",
+		Operation:          "SELECT",
+		ParameterizedQuery: "SELECT * FROM users WHERE name = 'Dracula' AND age > 500 /* vampires */",
+	}
+	s1.End()
+	txn.End()
+
+	app.ExpectSlowQueries(t, []internal.WantSlowQuery{{
+		Count:      1,
+		MetricName: "Datastore/statement/Postgres/users/SELECT",
+		Query:      expect,
+		TxnName:    "OtherTransaction/Go/hello",
+		TxnURL:     "",
+	}})
+}
+
+func TestSlowQueryRecordSQLObfuscatedByDefault(t *testing.T) {
+	recordSQLSlowQuery(t, nil, nil, "SELECT * FROM users WHERE name = ? AND age > ? ?")
+}
+
+func TestSlowQueryRecordSQLRaw(t *testing.T) {
+	recordSQLSlowQuery(t, func(cfg *Config) {
+		cfg.DatastoreTracer.RecordSQL = RecordSQLRaw
+	}, nil, "SELECT * FROM users WHERE name = 'Dracula' AND age > 500 /* vampires */")
+}
+
+func TestSlowQueryRecordSQLOff(t *testing.T) {
+	recordSQLSlowQuery(t, func(cfg *Config) {
+		cfg.DatastoreTracer.RecordSQL = RecordSQLOff
+	}, nil, "'SELECT' on 'users' using 'Postgres'")
+}
+
+func TestSlowQueryRecordSQLRawHighSecurity(t *testing.T) {
+	recordSQLSlowQuery(t, func(cfg *Config) {
+		cfg.DatastoreTracer.RecordSQL = RecordSQLRaw
+		cfg.HighSecurity = true
+	}, nil, "SELECT * FROM users WHERE name = ? AND age > ? ?")
+}
+
+func TestSlowQueryRecordSQLRawSecurityPolicy(t *testing.T) {
+	recordSQLSlowQuery(t, func(cfg *Config) {
+		cfg.DatastoreTracer.RecordSQL = RecordSQLRaw
+	}, func(reply *internal.ConnectReply) {
+		reply.SecurityPolicies.RecordSQL.SetEnabled(true)
+	}, "SELECT * FROM users WHERE name = ? AND age > ? ?")
+}
+
+func TestDatastoreSpanStatementObfuscated(t *testing.T) {
+	app := testApp(distributedTracingReplyFields, enableBetterCAT, t)
+	txn := app.StartTransaction("hello")
+	s1 := DatastoreSegment{
+		StartTime:          txn.StartSegmentNow(),
+		Product:            DatastoreMySQL,
+		Collection:         "users",
+		Operation:          "SELECT",
+		ParameterizedQuery: `SELECT * FROM users WHERE name = "Dracula"`,
+	}
+	s1.End()
+	txn.End()
+
+	app.ExpectSpanEvents(t, []internal.WantEvent{
+		{
+			Intrinsics: map[string]interface{}{
+				"name":          "Datastore/statement/MySQL/users/SELECT",
+				"sampled":       true,
+				"category":      "datastore",
+				"priority":      internal.MatchAnything,
+				"guid":          internal.MatchAnything,
+				"transactionId": internal.MatchAnything,
+				"traceId":       internal.MatchAnything,
+				"parentId":      internal.MatchAnything,
+				"component":     "MySQL",
+				"span.kind":     "client",
+			},
+			AgentAttributes: map[string]interface{}{
+				"db.statement":  "SELECT * FROM users WHERE name = ?",
+				"db.collection": "users",
+			},
+		},
+		{
+			Intrinsics: map[string]interface{}{
+				"name":             "OtherTransaction/Go/hello",
+				"transaction.name": "OtherTransaction/Go/hello",
+				"sampled":          true,
+				"category":         "generic",
+				"priority":         internal.MatchAnything,
+				"guid":             internal.MatchAnything,
+				"transactionId":    internal.MatchAnything,
+				"nr.entryPoint":    true,
+				"traceId":          internal.MatchAnything,
+			},
+		},
+	})
+}
@@ -1160,3 +1160,151 @@ func TestAddSpanAttributeSecurityPolicyDisablesParameters(t *testing.T) {
 		},
 	})
 }
+
+func TestSegmentNoticeError(t *testing.T) {
+	replyfn := func(reply *internal.ConnectReply) {
+		reply.SetSampleEverything()
+	}
+	cfgfn := func(cfg *Config) {
+		cfg.DistributedTracer.Enabled = true
+	}
+	app := testApp(replyfn, cfgfn, t)
+	txn := app.StartTransaction("hello")
+	outer := txn.StartSegment("outer")
+	inner := txn.StartSegment("inner")
+	// The error is recorded on the outer segment although it is not the
+	// current segment.
+	outer.NoticeError(Error{Message: "outer failed", Class: "outerError"})
+	inner.End()
+	outer.End()
+	datastore := DatastoreSegment{
+		StartTime:  txn.StartSegmentNow(),
+		Product:    DatastoreMySQL,
+		Collection: "mycollection",
+		Operation:  "myoperation",
+	}
+	datastore.NoticeError(myError{})
+	datastore.End()
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	external := StartExternalSegment(txn, req)
+	external.NoticeError(Error{Message: "retrying", Class: "timeout", Expected: true})
+	external.End()
+	app.expectNoLoggedErrors(t)
+	external.NoticeError(myError{})
+	app.expectSingleLoggedError(t, "unable to notice segment error", map[string]interface{}{
+		"reason": errSegmentEnded.Error(),
+	})
+	txn.End()
+
+	app.ExpectErrors(t, []internal.WantError{})
+	app.ExpectErrorEvents(t, []internal.WantEvent{})
+	app.ExpectSpanEvents(t, []internal.WantEvent{
+		{
+			Intrinsics: map[string]interface{}{
+				"name":     "Custom/inner",
+				"category": "generic",
+				"parentId": internal.MatchAnything,
+			},
+			UserAttributes:  map[string]interface{}{},
+			AgentAttributes: map[string]interface{}{},
+		},
+		{
+			Intrinsics: map[string]interface{}{
+				"name":     "Custom/outer",
+				"category": "generic",
+				"parentId": internal.MatchAnything,
+			},
+			UserAttributes: map[string]interface{}{},
+			AgentAttributes: map[string]interface{}{
+				"error.class":   "outerError",
+				"error.message": "outer failed",
+			},
+		},
+		{
+			Intrinsics: map[string]interface{}{
+				"name":      "Datastore/statement/MySQL/mycollection/myoperation",
+				"category":  "datastore",
+				"component": "MySQL",
+				"span.kind": "client",
+				"parentId":  internal.MatchAnything,
+			},
+			UserAttributes: map[string]interface{}{},
+			AgentAttributes: map[string]interface{}{
+				"db.statement":  internal.MatchAnything,
+				"db.collection": "mycollection",
+				"error.class":   "newrelic.myError",
+				"error.message": "my msg",
+			},
+		},
+		{
+			Intrinsics: map[string]interface{}{
+				"name":      "External/example.com/http/GET",
+				"category":  "http",
+				"component": "http",
+				"span.kind": "client",
+				"parentId":  internal.MatchAnything,
+			},
+			UserAttributes: map[string]interface{}{},
+			AgentAttributes: map[string]interface{}{
+				"http.url":       "http://example.com",
+				"http.method":    "GET",
+				"error.class":    "timeout",
+				"error.message":  "retrying",
+				"error.expected": true,
+			},
+		},
+		{
+			Intrinsics: map[string]interface{}{
+				"name":             "OtherTransaction/Go/hello",
+				"transaction.name": "OtherTransaction/Go/hello",
+				"category":         "generic",
+				"nr.entryPoint":    true,
+			},
+			UserAttributes:  map[string]interface{}{},
+			AgentAttributes: map[string]interface{}{},
+		},
+	})
+	app.ExpectMetricsPresent(t, []internal.WantMetric{
+		{Name: "SegmentErrors/all", Scope: "", Forced: true, Data: []float64{2, 0, 0, 0, 0, 0}},
+		{Name: "SegmentErrors/Custom/outer", Scope: "", Forced: false, Data: singleCount},
+		{Name: "SegmentErrors/Datastore/statement/MySQL/mycollection/myoperation", Scope: "", Forced: false, Data: singleCount},
+	})
+}
+
+func TestSegmentNoticeErrorIgnored(t *testing.T) {
+	cfgfn := func(cfg *Config) {
+		cfg.DistributedTracer.Enabled = true
+		cfg.ErrorCollector.IgnoreClasses = []string{"newrelic.myError"}
+	}
+	app := testApp(func(reply *internal.ConnectReply) { reply.SetSampleEverything() }, cfgfn, t)
+	txn := app.StartTransaction("hello")
+	s := txn.StartSegment("segment")
+	s.NoticeError(myError{})
+	s.End()
+	var nilSegment *Segment
+	nilSegment.NoticeError(myError{})
+	(&Segment{}).NoticeError(myError{})
+	txn.End()
+	app.expectNoLoggedErrors(t)
+	app.ExpectSpanEvents(t, []internal.WantEvent{
+		{
+			Intrinsics: map[string]interface{}{
+				"name":     "Custom/segment",
+				"category": "generic",
+				"parentId": internal.MatchAnything,
+			},
+			UserAttributes:  map[string]interface{}{},
+			AgentAttributes: map[string]interface{}{},
+		},
+		{
+			Intrinsics: map[string]interface{}{
+				"name":             "OtherTransaction/Go/hello",
+				"transaction.name": "OtherTransaction/Go/hello",
+				"category":         "generic",
+				"nr.entryPoint":    true,
+			},
+			UserAttributes:  map[string]interface{}{},
+			AgentAttributes: map[string]interface{}{},
+		},
+	})
+}
@@ -8,6 +8,7 @@ import (
 	"math"
 	"net/http"
 	"net/http/httptest"
+	"runtime"
 	"strings"
 	"sync"
 	"testing"
@@ -256,6 +257,9 @@ func (ea expectApp) ExpectSlowQueries(t internal.Validator, want []internal.Want
 func (ea expectApp) ExpectSpanEvents(t internal.Validator, want []internal.WantEvent) {
 	ea.Application.Private.(internal.Expect).ExpectSpanEvents(t, want)
 }
+func (ea expectApp) ExpectLogEvents(t internal.Validator, want []internal.WantLog) {
+	ea.Application.Private.(internal.Expect).ExpectLogEvents(t, want)
+}
 
 func testApp(replyfn func(*internal.ConnectReply), cfgfn func(*Config), t testing.TB) expectApp {
 	lg := &errorSaverLogger{}
@@ -606,6 +610,146 @@ func TestPanicNil(t *testing.T) {
 	app.ExpectMetrics(t, backgroundMetrics)
 }
 
+func panicPolicy(policy PanicPolicy) ConfigOption {
+	return func(cfg *Config) {
+		cfg.ErrorCollector.RecordPanics = true
+		cfg.ErrorCollector.PanicPolicy = policy
+	}
+}
+
+func TestPanicStackTraceSite(t *testing.T) {
+	tapp := testApp(nil, enableRecordPanics, t)
+	txn := tapp.StartTransaction("hello")
+	deferEndPanic(txn, myError{})
+
+	traces := newHarvestData(tapp.Private.(*app).testHarvest, now, nil).ErrorTraces()
+	if len(traces) != 1 {
+		t.Fatal(traces)
+	}
+	frame, _ := runtime.CallersFrames(traces[0].Stack).Next()
+	if !strings.HasSuffix(frame.Function, ".deferEndPanic") {
+		t.Error(frame.Function)
+	}
+	if "" != traces[0].Goroutines {
+		t.Error(traces[0].Goroutines)
+	}
+}
+
+func TestPanicPolicySwallow(t *testing.T) {
+	app := testApp(nil, panicPolicy(PanicPolicySwallow), t)
+	txn := app.StartTransaction("hello")
+
+	if r := deferEndPanic(txn, myError{}); nil != r {
+		t.Error("panic propagated", r)
+	}
+
+	app.ExpectErrors(t, []internal.WantError{{
+		TxnName: "OtherTransaction/Go/hello",
+		Msg:     "my msg",
+		Klass:   panicErrorKlass,
+	}})
+	app.ExpectMetrics(t, backgroundErrorMetrics)
+}
+
+func TestPanicPolicyGoroutineDump(t *testing.T) {
+	tapp := testApp(nil, panicPolicy(PanicPolicyGoroutineDump), t)
+	txn := tapp.StartTransaction("hello")
+
+	e := myError{}
+	if r := deferEndPanic(txn, e); r != e {
+		t.Error("panic not propagated", r)
+	}
+
+	traces := newHarvestData(tapp.Private.(*app).testHarvest, now, nil).ErrorTraces()
+	if len(traces) != 1 {
+		t.Fatal(traces)
+	}
+	dump := traces[0].Goroutines
+	if !strings.HasPrefix(dump, "goroutine ") || !strings.Contains(dump, "TestPanicPolicyGoroutineDump") {
+		t.Error(dump)
+	}
+	if len(dump) > maxGoroutineDumpBytes {
+		t.Error(len(dump))
+	}
+	tapp.ExpectErrors(t, []internal.WantError{{
+		TxnName: "OtherTransaction/Go/hello",
+		Msg:     "my msg",
+		Klass:   panicErrorKlass,
+		AgentAttributes: map[string]interface{}{
+			AttributeErrorGoroutines: dump,
+		},
+	}})
+}
+
+func TestPanicPolicyGoroutineDumpExcluded(t *testing.T) {
+	tapp := testApp(nil, func(cfg *Config) {
+		panicPolicy(PanicPolicyGoroutineDump)(cfg)
+		cfg.ErrorCollector.Attributes.Exclude = []string{AttributeErrorGoroutines}
+	}, t)
+	txn := tapp.StartTransaction("hello")
+	deferEndPanic(txn, myError{})
+
+	tapp.ExpectErrors(t, []internal.WantError{{
+		TxnName:         "OtherTransaction/Go/hello",
+		Msg:             "my msg",
+		Klass:           panicErrorKlass,
+		AgentAttributes: map[string]interface{}{},
+	}})
+	traces := newHarvestData(tapp.Private.(*app).testHarvest, now, nil).ErrorTraces()
+	if len(traces) != 1 || "" != traces[0].Goroutines {
+		t.Fatal(traces)
+	}
+}
+
+func TestRecordPanicNewGoroutine(t *testing.T) {
+	app := testApp(nil, enableRecordPanics, t)
+	txn := app.StartTransaction("hello")
+
+	e := myError{}
+	done := make(chan interface{})
+	go func(txn *Transaction) {
+		defer func() { done <- recover() }()
+		defer txn.RecordPanic()
+		panic(e)
+	}(txn.NewGoroutine())
+	if r := <-done; r != e {
+		t.Error("panic not propagated", r)
+	}
+	txn.End()
+
+	app.expectNoLoggedErrors(t)
+	app.ExpectErrors(t, []internal.WantError{{
+		TxnName: "OtherTransaction/Go/hello",
+		Msg:     "my msg",
+		Klass:   panicErrorKlass,
+	}})
+	app.ExpectMetrics(t, backgroundErrorMetrics)
+}
+
+func TestRecordPanicNotEnabled(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello")
+
+	e := myError{}
+	r := func() (r interface{}) {
+		defer func() { r = recover() }()
+		defer txn.RecordPanic()
+		panic(e)
+	}()
+	if r != e {
+		t.Error("panic not propagated", r)
+	}
+	txn.End()
+
+	app.ExpectErrors(t, []internal.WantError{})
+	app.ExpectMetrics(t, backgroundMetrics)
+}
+
+func TestRecordPanicNilTransaction(t *testing.T) {
+	var txn *Transaction
+	defer txn.RecordPanic()
+}
+
 func TestResponseCodeError(t *testing.T) {
 	app := testApp(nil, nil, t)
 	w := newCompatibleResponseRecorder()
@@ -2134,3 +2278,226 @@ func TestMessageProducerSegmentNilSegment(t *testing.T) {
 	var s *MessageProducerSegment
 	s.End()
 }
+
+func TestMessageConsumerSegmentBasic(t *testing.T) {
+	replyfn := func(reply *internal.ConnectReply) {
+		reply.SetSampleEverything()
+	}
+	cfgfn := func(cfg *Config) {
+		cfg.DistributedTracer.Enabled = true
+	}
+	app := testApp(replyfn, cfgfn, t)
+	txn := app.StartTransaction("hello")
+	s := MessageConsumerSegment{
+		StartTime:       txn.StartSegmentNow(),
+		Library:         "RabbitMQ",
+		DestinationType: MessageQueue,
+		DestinationName: "myQueue",
+	}
+	s.End()
+	app.expectNoLoggedErrors(t)
+	txn.End()
+	app.ExpectMetrics(t, []internal.WantMetric{
+		{Name: "OtherTransaction/Go/hello", Scope: "", Forced: true, Data: nil},
+		{Name: "OtherTransaction/all", Scope: "", Forced: true, Data: nil},
+		{Name: "OtherTransactionTotalTime", Scope: "", Forced: true, Data: nil},
+		{Name: "OtherTransactionTotalTime/Go/hello", Scope: "", Forced: false, Data: nil},
+		{Name: "DurationByCaller/Unknown/Unknown/Unknown/Unknown/all", Scope: "", Forced: false, Data: nil},
+		{Name: "DurationByCaller/Unknown/Unknown/Unknown/Unknown/allOther", Scope: "", Forced: false, Data: nil},
+		{Name: "MessageBroker/RabbitMQ/Queue/Consume/Named/myQueue", Scope: "", Forced: false, Data: nil},
+		{Name: "MessageBroker/RabbitMQ/Queue/Consume/Named/myQueue", Scope: "OtherTransaction/Go/hello", Forced: false, Data: nil},
+	})
+	app.ExpectSpanEvents(t, []internal.WantEvent{
+		{
+			Intrinsics: map[string]interface{}{
+				"parentId": internal.MatchAnything,
+				"name":     "MessageBroker/RabbitMQ/Queue/Consume/Named/myQueue",
+				"category": "generic",
+			},
+			UserAttributes:  map[string]interface{}{},
+			AgentAttributes: map[string]interface{}{},
+		},
+		{
+			Intrinsics: map[string]interface{}{
+				"name":             "OtherTransaction/Go/hello",
+				"transaction.name": "OtherTransaction/Go/hello",
+				"sampled":          true,
+				"category":         "generic",
+				"nr.entryPoint":    true,
+			},
+			UserAttributes:  map[string]interface{}{},
+			AgentAttributes: map[string]interface{}{},
+		},
+	})
+}
+
+func TestMessageConsumerSegmentTemp(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello")
+	s := MessageConsumerSegment{
+		StartTime:            txn.StartSegmentNow(),
+		Library:              "RabbitMQ",
+		DestinationTemporary: true,
+		DestinationName:      "myQueue0123456789",
+	}
+	s.End()
+	app.expectNoLoggedErrors(t)
+	txn.End()
+	app.ExpectMetrics(t, []internal.WantMetric{
+		{Name: "OtherTransaction/Go/hello", Scope: "", Forced: true, Data: nil},
+		{Name: "OtherTransaction/all", Scope: "", Forced: true, Data: nil},
+		{Name: "OtherTransactionTotalTime", Scope: "", Forced: true, Data: nil},
+		{Name: "OtherTransactionTotalTime/Go/hello", Scope: "", Forced: false, Data: nil},
+		{Name: "MessageBroker/RabbitMQ/Queue/Consume/Temp", Scope: "", Forced: false, Data: nil},
+		{Name: "MessageBroker/RabbitMQ/Queue/Consume/Temp", Scope: "OtherTransaction/Go/hello", Forced: false, Data: nil},
+	})
+}
+
+func TestMessageConsumerSegmentTxnEnded(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello")
+	s := MessageConsumerSegment{
+		StartTime:       txn.StartSegmentNow(),
+		Library:         "RabbitMQ",
+		DestinationName: "myQueue",
+	}
+	txn.End()
+	s.End()
+	app.expectSingleLoggedError(t, "unable to end message consumer segment", map[string]interface{}{
+		"reason": errAlreadyEnded.Error(),
+	})
+}
+
+func TestMessageConsumerSegmentNilSegment(t *testing.T) {
+	var s *MessageConsumerSegment
+	s.End()
+	s.AddAttribute("key", "val")
+}
+
+func TestSetMessageRequest(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello")
+	txn.SetMessageRequest(MessageRequest{
+		Library:         "RabbitMQ",
+		DestinationType: MessageExchange,
+		DestinationName: "myExchange",
+		RoutingKey:      "myRoutingKey",
+		QueueName:       "myQueueName",
+		ExchangeType:    "myExchangeType",
+	})
+	txn.End()
+	app.expectNoLoggedErrors(t)
+	app.ExpectMetrics(t, []internal.WantMetric{
+		{Name: "OtherTransaction/Message/RabbitMQ/Exchange/Named/myExchange", Scope: "", Forced: true, Data: nil},
+		{Name: "OtherTransaction/all", Scope: "", Forced: true, Data: nil},
+		{Name: "OtherTransactionTotalTime", Scope: "", Forced: true, Data: nil},
+		{Name: "OtherTransactionTotalTime/Message/RabbitMQ/Exchange/Named/myExchange", Scope: "", Forced: false, Data: nil},
+	})
+	app.ExpectTxnEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"name": "OtherTransaction/Message/RabbitMQ/Exchange/Named/myExchange",
+		},
+		UserAttributes: map[string]interface{}{},
+		// The exchange type attribute is disabled by default.
+		AgentAttributes: map[string]interface{}{
+			"message.routingKey": "myRoutingKey",
+			"message.queueName":  "myQueueName",
+		},
+	}})
+}
+
+func TestSetMessageRequestTemp(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello")
+	txn.SetWebRequest(WebRequest{})
+	txn.SetMessageRequest(MessageRequest{
+		Library:              "RabbitMQ",
+		DestinationName:      "myQueue0123456789",
+		DestinationTemporary: true,
+	})
+	txn.End()
+	app.expectNoLoggedErrors(t)
+	// The transaction is not a web transaction and does not get apdex.
+	app.ExpectMetrics(t, []internal.WantMetric{
+		{Name: "OtherTransaction/Message/RabbitMQ/Queue/Temp", Scope: "", Forced: true, Data: nil},
+		{Name: "OtherTransaction/all", Scope: "", Forced: true, Data: nil},
+		{Name: "OtherTransactionTotalTime", Scope: "", Forced: true, Data: nil},
+		{Name: "OtherTransactionTotalTime/Message/RabbitMQ/Queue/Temp", Scope: "", Forced: false, Data: nil},
+	})
+}
+
+func TestSetMessageRequestThenSetWebRequest(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello")
+	txn.SetMessageRequest(MessageRequest{
+		Library:         "RabbitMQ",
+		DestinationName: "myQueue",
+	})
+	txn.SetWebRequest(WebRequest{})
+	txn.End()
+	app.expectNoLoggedErrors(t)
+	app.ExpectMetrics(t, []internal.WantMetric{
+		{Name: "WebTransaction/Go/Message/RabbitMQ/Queue/Named/myQueue", Scope: "", Forced: true, Data: nil},
+		{Name: "WebTransaction", Scope: "", Forced: true, Data: nil},
+		{Name: "WebTransactionTotalTime/Go/Message/RabbitMQ/Queue/Named/myQueue", Scope: "", Forced: false, Data: nil},
+		{Name: "WebTransactionTotalTime", Scope: "", Forced: true, Data: nil},
+		{Name: "HttpDispatcher", Scope: "", Forced: true, Data: nil},
+		{Name: "Apdex", Scope: "", Forced: true, Data: nil},
+		{Name: "Apdex/Go/Message/RabbitMQ/Queue/Named/myQueue", Scope: "", Forced: false, Data: nil},
+	})
+}
+
+func TestSetMessageRequestThenSetName(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello")
+	txn.SetMessageRequest(MessageRequest{
+		Library:         "RabbitMQ",
+		DestinationName: "myQueue",
+	})
+	txn.SetName("hello")
+	txn.End()
+	app.expectNoLoggedErrors(t)
+	app.ExpectMetrics(t, backgroundMetrics)
+}
+
+func TestSetMessageRequestDistributedTraceHeaders(t *testing.T) {
+	app := testApp(distributedTracingReplyFields, enableBetterCAT, t)
+	hdrs := http.Header{}
+	hdrs.Set(DistributedTraceW3CTraceParentHeader, "00-050c91b77efca9b0ef38b30c182355ce-560ccffb087d1906-01")
+	txn := app.StartTransaction("hello")
+	txn.SetMessageRequest(MessageRequest{
+		Library:         "Kafka",
+		DestinationType: MessageTopic,
+		DestinationName: "myTopic",
+		Header:          hdrs,
+		Transport:       TransportKafka,
+	})
+	txn.End()
+	app.expectNoLoggedErrors(t)
+	app.ExpectTxnEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"name":                 "OtherTransaction/Message/Kafka/Topic/Named/myTopic",
+			"traceId":              "050c91b77efca9b0ef38b30c182355ce",
+			"parentSpanId":         "560ccffb087d1906",
+			"guid":                 internal.MatchAnything,
+			"sampled":              internal.MatchAnything,
+			"priority":             internal.MatchAnything,
+			"parent.transportType": "Kafka",
+		},
+	}})
+}
+
+func TestSetMessageRequestTxnEnded(t *testing.T) {
+	app := testApp(nil, nil, t)
+	txn := app.StartTransaction("hello")
+	txn.End()
+	txn.SetMessageRequest(MessageRequest{Library: "RabbitMQ"})
+	app.expectSingleLoggedError(t, "unable to set message request", map[string]interface{}{
+		"reason": errAlreadyEnded.Error(),
+	})
+}
+
+func TestSetMessageRequestNilTxn(t *testing.T) {
+	var txn *Transaction
+	txn.SetMessageRequest(MessageRequest{Library: "RabbitMQ"})
+}
@@ -4,6 +4,7 @@
 package newrelic
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -27,12 +28,27 @@ type txn struct {
 	finished           bool
 	numPayloadsCreated uint32
 	sampledCalculated  bool
+	// samplerCalled and samplerResult record the call of the Sampler by
+	// decideSampling.
+	samplerCalled bool
+	samplerResult *SamplingResult
+	// sampledBeforeError is set if the sampling decision was computed
+	// before an error was noticed.  See applyErrorSamplingRule.
+	sampledBeforeError bool
+	// tailSamplingDecided and tailSamplingKept record the decision of
+	// decideTailSampling.
+	tailSamplingDecided bool
+	tailSamplingKept    bool
 
 	ignore bool
 
 	// wroteHeader prevents capturing multiple response code errors if the
 	// user erroneously calls WriteHeader multiple times.
 	wroteHeader bool
+	// panicked prevents capturing a response code error for the response
+	// written after a panic has been recorded, since the panic is its
+	// cause.
+	panicked bool
 
 	txnData
 
@@ -137,6 +153,10 @@ func (txn *txn) shouldCollectSpanEvents() bool {
 	if !txn.Config.SpanEvents.Enabled {
 		return false
 	}
+	if txn.Config.SpanEvents.TailSampling.Enabled {
+		// Span events are buffered until the transaction ends.
+		return !txn.tailSamplingDecided || txn.tailSamplingKept
+	}
 	if shouldUseTraceObserver(txn.Config) {
 		return true
 	}
@@ -164,10 +184,7 @@ func (txn *txn) lazilyCalculateSampled() bool {
 	if txn.sampledCalculated {
 		return txn.BetterCAT.Sampled
 	}
-	txn.BetterCAT.Sampled = txn.appRun.adaptiveSampler.computeSampled(txn.BetterCAT.Priority.Float32(), time.Now())
-	if txn.BetterCAT.Sampled {
-		txn.BetterCAT.Priority += 1.0
-	}
+	txn.computeSampled(time.Now())
 	txn.sampledCalculated = true
 	return txn.BetterCAT.Sampled
 }
@@ -180,8 +197,10 @@ func (txn *txn) SetWebRequest(r WebRequest) error {
 		return errAlreadyEnded
 	}
 
-	// Any call to SetWebRequest should indicate a web transaction.
+	// Any call to SetWebRequest should indicate a web transaction, which
+	// is not a message consumer transaction.
 	txn.IsWeb = true
+	txn.IsMessage = false
 
 	h := r.Header
 	if nil != h {
@@ -195,6 +214,39 @@ func (txn *txn) SetWebRequest(r WebRequest) error {
 	return nil
 }
 
+func (txn *txn) SetMessageRequest(r MessageRequest) error {
+	txn.Lock()
+	defer txn.Unlock()
+
+	if txn.finished {
+		return errAlreadyEnded
+	}
+
+	// Any call to SetMessageRequest should indicate a message consumer
+	// transaction, which is a background transaction.
+	txn.IsWeb = false
+	txn.IsMessage = true
+
+	if "" == r.DestinationType {
+		r.DestinationType = MessageQueue
+	}
+	txn.Name = internal.MessageMetricKey{
+		Library:         r.Library,
+		DestinationType: string(r.DestinationType),
+		DestinationName: r.DestinationName,
+		DestinationTemp: r.DestinationTemporary,
+		Consumer:        true,
+	}.Name()
+
+	if nil != r.Header {
+		txn.acceptDistributedTraceHeadersLocked(r.Transport, r.Header)
+	}
+
+	messageAgentAttributes(txn.Attrs, r)
+
+	return nil
+}
+
 type dummyResponseWriter struct{}
 
 func (rw dummyResponseWriter) Header() http.Header { return nil }
@@ -228,7 +280,11 @@ func (txn *txn) freezeName() {
 	if txn.ignore || ("" != txn.FinalName) {
 		return
 	}
-	txn.FinalName = txn.appRun.createTransactionName(txn.Name, txn.IsWeb)
+	if txn.IsMessage {
+		txn.FinalName = txn.appRun.createMessageTransactionName(txn.Name)
+	} else {
+		txn.FinalName = txn.appRun.createTransactionName(txn.Name, txn.IsWeb)
+	}
 	if "" == txn.FinalName {
 		txn.ignore = true
 	}
@@ -277,9 +333,10 @@ func (txn *txn) MergeIntoHarvest(h *harvest) {
 				errorData: *e,
 				txnEvent:  txn.txnEvent,
 			}
-			// Since the stack trace is not used in error events, remove the reference
-			// to minimize memory.
+			// Since the stack trace and the chain are not used in error
+			// events, remove the references to minimize memory.
 			errEvent.Stack = nil
+			errEvent.Chain = nil
 			h.ErrorEvents.Add(errEvent, priority)
 		}
 	}
@@ -293,11 +350,14 @@ func (txn *txn) MergeIntoHarvest(h *harvest) {
 
 	if nil != txn.SlowQueries {
 		h.SlowSQLs.Merge(txn.SlowQueries, txn.txnEvent)
+		h.SlowSQLs.startExplainPlans(time.Now())
 	}
 
 	if txn.shouldCollectSpanEvents() && !shouldUseTraceObserver(txn.Config) {
 		h.SpanEvents.MergeSpanEvents(txn.txnData.SpanEvents)
 	}
+
+	h.LogEvents.mergeTxnLogs(txn.Logs, priority)
 }
 
 func headersJustWritten(thd *thread, code int, hdr http.Header) {
@@ -316,9 +376,10 @@ func headersJustWritten(thd *thread, code int, hdr http.Header) {
 	responseHeaderAttributes(txn.Attrs, hdr)
 	responseCodeAttribute(txn.Attrs, code)
 
-	if txn.appRun.responseCodeIsError(code) {
+	if txn.appRun.responseCodeIsError(code) && !txn.panicked {
 		e := txnErrorFromResponseCode(time.Now(), code)
 		e.Stack = getStackTrace()
+		e.Expect = txn.appRun.responseCodeIsExpected(code)
 		thd.noticeErrorInternal(e)
 	}
 }
@@ -366,6 +427,7 @@ func addCrossProcessHeaders(txn *txn, hdr http.Header) {
 
 func (thd *thread) End(recovered interface{}) error {
 	txn := thd.txn
+	txn.decideSampling()
 	txn.Lock()
 	defer txn.Unlock()
 
@@ -376,16 +438,24 @@ func (thd *thread) End(recovered interface{}) error {
 	txn.finished = true
 
 	if nil != recovered {
-		e := txnErrorFromPanic(time.Now(), recovered)
-		e.Stack = getStackTrace()
-		thd.noticeErrorInternal(e)
+		thd.noticePanic(recovered)
 	}
 
 	txn.markEnd(time.Now(), thd.thread)
 	txn.freezeName()
+	if len(txn.Errors) > 0 {
+		// The ErrorGroupCallback is called without the lock.  Since the
+		// txn is finished, the errors cannot change meanwhile.
+		infos := txn.Errors.errorInfos(txn.FinalName, txn.Attrs)
+		txn.Unlock()
+		groups := errorGroups(txn.Config.ErrorCollector.ErrorGroupCallback, infos, txn.Config.Logger)
+		txn.Lock()
+		txn.Errors.setGroupNames(groups)
+	}
 	// Make a sampling decision if there have been no segments or outbound
 	// payloads.
 	txn.lazilyCalculateSampled()
+	txn.applyErrorSamplingRule()
 
 	// Finalise the CAT state.
 	if err := txn.CrossProcess.Finalise(txn.Name, txn.Config.AppName); err != nil {
@@ -408,6 +478,10 @@ func (thd *thread) End(recovered interface{}) error {
 		txn.Zone = apdexNone
 	}
 
+	if txn.BetterCAT.Enabled && txn.Config.SpanEvents.Enabled && txn.Config.SpanEvents.TailSampling.Enabled {
+		txn.decideTailSampling()
+	}
+
 	if txn.Config.Logger.DebugEnabled() {
 		txn.Config.Logger.Debug("transaction ended", map[string]interface{}{
 			"name":          txn.FinalName,
@@ -433,6 +507,9 @@ func (thd *thread) End(recovered interface{}) error {
 		if txn.rootSpanErrData != nil {
 			root.AgentAttributes.addString(SpanAttributeErrorClass, txn.rootSpanErrData.Klass)
 			root.AgentAttributes.addString(SpanAttributeErrorMessage, txn.rootSpanErrData.Msg)
+			if txn.rootSpanErrData.Expect {
+				root.AgentAttributes.addBool(SpanAttributeErrorExpected, true)
+			}
 		}
 		if p := txn.BetterCAT.Inbound; nil != p {
 			root.ParentID = txn.BetterCAT.Inbound.ID
@@ -460,8 +537,13 @@ func (thd *thread) End(recovered interface{}) error {
 		}
 	}
 
+	if !txn.ignore && nil != txn.app.debugTraces {
+		txn.app.debugTraces.write(txn)
+	}
+
 	if !txn.ignore {
 		txn.app.Consume(txn.Reply.RunID, txn)
+		txn.app.profiler.transactionEnded(txn.FinalName, txn.BetterCAT.TraceID, txn.Duration, txn.Stop)
 		if observer := txn.app.getObserver(); nil != observer {
 			for _, evt := range txn.SpanEvents {
 				observer.consumeSpan(evt)
@@ -471,13 +553,42 @@ func (thd *thread) End(recovered interface{}) error {
 
 	// Note that if a consumer uses `panic(nil)`, the panic will not
 	// propagate.
-	if nil != recovered {
+	if nil != recovered && txn.Config.ErrorCollector.PanicPolicy != PanicPolicySwallow {
 		panic(recovered)
 	}
 
 	return nil
 }
 
+// noticePanic records a recovered panic.  It must be called by the deferred
+// function recovering the panic so that the stack trace starts at the panic
+// site.  The txn must be locked.
+func (thd *thread) noticePanic(recovered interface{}) {
+	txn := thd.txn
+	e := txnErrorFromPanic(time.Now(), recovered)
+	e.Stack = getPanicStackTrace()
+	if PanicPolicyGoroutineDump == txn.Config.ErrorCollector.PanicPolicy {
+		e.Goroutines = goroutineDump()
+	}
+	txn.panicked = true
+	thd.noticeErrorInternal(e)
+}
+
+// RecordPanic records a panic recovered without ending the transaction.  It
+// returns whether the response header had been written, so that WrapHandle
+// knows whether it can respond with a 500 status code.
+func (thd *thread) RecordPanic(recovered interface{}) (bool, error) {
+	txn := thd.txn
+	txn.Lock()
+	defer txn.Unlock()
+
+	if txn.finished {
+		return false, errAlreadyEnded
+	}
+	thd.noticePanic(recovered)
+	return txn.wroteHeader, nil
+}
+
 func (txn *txn) AddAttribute(name string, value interface{}) error {
 	txn.Lock()
 	defer txn.Unlock()
@@ -511,36 +622,59 @@ const (
 	securityPolicyErrorMsg = "message removed by security policy"
 )
 
-func (thd *thread) noticeErrorInternal(err errorData) error {
-	txn := thd.txn
-	if !txn.Config.ErrorCollector.Enabled {
-		return errorsDisabled
+// prepareError applies the ErrorCollector rules and the security settings to
+// the error.  It returns false if the error must not be recorded.
+func (txn *txn) prepareError(err *errorData) bool {
+	if errorIsIgnored(txn.Config, *err) {
+		return false
 	}
-
-	if nil == txn.Errors {
-		txn.Errors = newTxnErrors(maxTxnErrors)
+	if errorIsExpected(txn.Config, *err) {
+		err.Expect = true
 	}
 
 	if txn.Config.HighSecurity {
 		err.Msg = highSecurityErrorMsg
+		err.replaceChainMessages(highSecurityErrorMsg)
 	}
 
 	if !txn.Reply.SecurityPolicies.AllowRawExceptionMessages.Enabled() {
 		err.Msg = securityPolicyErrorMsg
+		err.replaceChainMessages(securityPolicyErrorMsg)
 	}
+	return true
+}
 
-	if txn.shouldCollectSpanEvents() {
+func (thd *thread) noticeErrorInternal(err errorData) error {
+	txn := thd.txn
+	if !txn.Config.ErrorCollector.Enabled {
+		return errorsDisabled
+	}
+
+	if !txn.prepareError(&err) {
+		return nil
+	}
+
+	if nil == txn.Errors {
+		txn.Errors = newTxnErrors(maxTxnErrors)
+	}
+
+	if !err.Expect {
+		txn.txnData.txnEvent.HasError = true //mark transaction as having an error
+	}
+	// The sampling decision is not forced here so that the Sampler, which
+	// cannot be called under the lock, sees the error.
+	if (txn.BetterCAT.Enabled && !txn.sampledCalculated) || txn.shouldCollectSpanEvents() {
 		err.SpanID = txn.CurrentSpanIdentifier(thd.thread)
 		addErrorAttrs(thd, err)
 	}
 	txn.Errors.Add(err)
-	txn.txnData.txnEvent.HasError = true //mark transaction as having an error
 	return nil
 }
 
 var errorAttrs = []string{
 	SpanAttributeErrorClass,
 	SpanAttributeErrorMessage,
+	SpanAttributeErrorExpected,
 }
 
 func addErrorAttrs(t *thread, err errorData) {
@@ -554,13 +688,43 @@ func addErrorAttrs(t *thread, err errorData) {
 	}
 	t.thread.AddAgentSpanAttribute(SpanAttributeErrorClass, err.Klass)
 	t.thread.AddAgentSpanAttribute(SpanAttributeErrorMessage, err.Msg)
+	if err.Expect {
+		t.thread.stack[len(t.thread.stack)-1].agentAttributes.addBool(SpanAttributeErrorExpected, true)
+	}
 }
 
 var (
 	errTooManyErrorAttributes = fmt.Errorf("too many extra attributes: limit is %d",
 		attributeErrorLimit)
+	errTooManySpanAnnotationAttributes = fmt.Errorf("too many event attributes: limit is %d",
+		attributeUserLimit)
 )
 
+// errorChain returns the error followed by the errors it wraps, in the
+// depth-first order used by errors.As.  Both Unwrap() error and
+// Unwrap() []error are followed.  At most maxErrorChainLinks errors are
+// returned, which also protects against cycles.
+func errorChain(err error) []error {
+	var chain []error
+	var walk func(error)
+	walk = func(err error) {
+		if nil == err || len(chain) >= maxErrorChainLinks {
+			return
+		}
+		chain = append(chain, err)
+		switch e := err.(type) {
+		case interface{ Unwrap() error }:
+			walk(e.Unwrap())
+		case interface{ Unwrap() []error }:
+			for _, next := range e.Unwrap() {
+				walk(next)
+			}
+		}
+	}
+	walk(err)
+	return chain
+}
+
 // errorCause returns the error's deepest wrapped ancestor.
 func errorCause(err error) error {
 	for {
@@ -574,65 +738,106 @@ func errorCause(err error) error {
 	}
 }
 
-func errorClassMethod(err error) string {
-	if ec, ok := err.(errorClasser); ok {
-		return ec.ErrorClass()
+// The following methods return the first non-empty value provided by the
+// errors of the chain, which are matched using errorAs.
+
+func errorClassMethod(chain []error) string {
+	for _, err := range chain {
+		var ec errorClasser
+		if errorAs(err, &ec) {
+			if c := ec.ErrorClass(); "" != c {
+				return c
+			}
+		}
 	}
 	return ""
 }
 
-func errorStackTraceMethod(err error) stackTrace {
-	if st, ok := err.(stackTracer); ok {
-		return st.StackTrace()
+func errorStackTraceMethod(chain []error) stackTrace {
+	for _, err := range chain {
+		var st stackTracer
+		if errorAs(err, &st) {
+			if s := st.StackTrace(); nil != s {
+				return s
+			}
+		}
 	}
 	return nil
 }
 
-func errorAttributesMethod(err error) map[string]interface{} {
-	if st, ok := err.(errorAttributer); ok {
-		return st.ErrorAttributes()
+func errorExpectedMethod(chain []error) bool {
+	for _, err := range chain {
+		var ee errorExpecter
+		if errorAs(err, &ee) && ee.ErrorExpected() {
+			return true
+		}
+	}
+	return false
+}
+
+func errorAttributesMethod(chain []error) map[string]interface{} {
+	for _, err := range chain {
+		var ea errorAttributer
+		if errorAs(err, &ea) {
+			if ats := ea.ErrorAttributes(); nil != ats {
+				return ats
+			}
+		}
 	}
 	return nil
 }
 
+// errorLinks describes the errors wrapped by the error noticed, which are all
+// but the first error of the chain.
+func errorLinks(chain []error) []errorLink {
+	if len(chain) < 2 {
+		return nil
+	}
+	links := make([]errorLink, 0, len(chain)-1)
+	for _, err := range chain[1:] {
+		link := errorLink{Msg: err.Error()}
+		if ec, ok := err.(errorClasser); ok && "" != ec.ErrorClass() {
+			link.Klass = ec.ErrorClass()
+		} else {
+			link.Klass = reflect.TypeOf(err).String()
+		}
+		if st, ok := err.(stackTracer); ok {
+			link.Stack = st.StackTrace()
+		}
+		links = append(links, link)
+	}
+	return links
+}
+
 func errDataFromError(input error) (data errorData, err error) {
-	cause := errorCause(input)
+	chain := errorChain(input)
 
 	data = errorData{
-		When: time.Now(),
-		Msg:  input.Error(),
+		When:  time.Now(),
+		Msg:   input.Error(),
+		Chain: errorLinks(chain),
+		err:   input,
 	}
 
-	if c := errorClassMethod(input); "" != c {
-		// If the error implements ErrorClasser, use that.
-		data.Klass = c
-	} else if c := errorClassMethod(cause); "" != c {
-		// Otherwise, if the error's cause implements ErrorClasser, use that.
+	if c := errorClassMethod(chain); "" != c {
+		// If an error of the chain implements ErrorClasser, use that.
 		data.Klass = c
 	} else {
-		// As a final fallback, use the type of the error's cause.
-		data.Klass = reflect.TypeOf(cause).String()
+		// As a fallback, use the type of the error's cause.
+		data.Klass = reflect.TypeOf(errorCause(input)).String()
 	}
 
-	if st := errorStackTraceMethod(input); nil != st {
-		// If the error implements StackTracer, use that.
-		data.Stack = st
-	} else if st := errorStackTraceMethod(cause); nil != st {
-		// Otherwise, if the error's cause implements StackTracer, use that.
+	data.Expect = errorExpectedMethod(chain)
+
+	if st := errorStackTraceMethod(chain); nil != st {
+		// If an error of the chain implements StackTracer, use that.
 		data.Stack = st
 	} else {
-		// As a final fallback, generate a StackTrace here.
+		// As a fallback, generate a StackTrace here.
 		data.Stack = getStackTrace()
 	}
 
-	var unvetted map[string]interface{}
-	if ats := errorAttributesMethod(input); nil != ats {
-		// If the error implements ErrorAttributer, use that.
-		unvetted = ats
-	} else {
-		// Otherwise, if the error's cause implements ErrorAttributer, use that.
-		unvetted = errorAttributesMethod(cause)
-	}
+	unvetted := errorAttributesMethod(chain)
 	if unvetted != nil {
 		if len(unvetted) > attributeErrorLimit {
 			err = errTooManyErrorAttributes
@@ -677,6 +882,37 @@ func (thd *thread) NoticeError(input error) error {
 	return thd.noticeErrorInternal(data)
 }
 
+// NoticeSegmentError marks the span of the segment with the error.  The error
+// is not recorded as an error of the transaction.
+func (thd *thread) NoticeSegmentError(start segmentStartTime, input error) error {
+	txn := thd.txn
+	txn.Lock()
+	defer txn.Unlock()
+
+	if txn.finished {
+		return errAlreadyEnded
+	}
+
+	if nil == input {
+		return errNilError
+	}
+
+	if !txn.Config.ErrorCollector.Enabled {
+		return errorsDisabled
+	}
+
+	data, err := errDataFromError(input)
+	if nil != err {
+		return err
+	}
+
+	if !txn.prepareError(&data) {
+		return nil
+	}
+
+	return thd.thread.noticeSegmentError(start, data)
+}
+
 func (txn *txn) SetName(name string) error {
 	txn.Lock()
 	defer txn.Unlock()
@@ -686,6 +922,9 @@ func (txn *txn) SetName(name string) error {
 	}
 
 	txn.Name = name
+	// An explicitly provided name replaces the name created by
+	// SetMessageRequest.
+	txn.IsMessage = false
 	return nil
 }
 
@@ -809,6 +1048,7 @@ func endBasic(s *Segment) error {
 		return nil
 	}
 	txn := thd.txn
+	txn.decideSampling()
 	var err error
 	txn.Lock()
 	if txn.finished {
@@ -826,6 +1066,7 @@ func endDatastore(s *DatastoreSegment) error {
 		return nil
 	}
 	txn := thd.txn
+	txn.decideSampling()
 	txn.Lock()
 	defer txn.Unlock()
 
@@ -838,10 +1079,16 @@ func endDatastore(s *DatastoreSegment) error {
 	if !txn.Config.DatastoreTracer.QueryParameters.Enabled {
 		s.QueryParameters = nil
 	}
+	recordSQL := txn.Config.DatastoreTracer.RecordSQL
+	if txn.Config.HighSecurity && recordSQL == RecordSQLRaw {
+		recordSQL = RecordSQLObfuscated
+	}
 	if txn.Reply.SecurityPolicies.RecordSQL.IsSet() {
 		s.QueryParameters = nil
 		if !txn.Reply.SecurityPolicies.RecordSQL.Enabled() {
-			s.ParameterizedQuery = ""
+			recordSQL = RecordSQLOff
+		} else if recordSQL == RecordSQLRaw {
+			recordSQL = RecordSQLObfuscated
 		}
 	}
 	if !txn.Config.DatastoreTracer.DatabaseNameReporting.Enabled {
@@ -851,6 +1098,28 @@ func endDatastore(s *DatastoreSegment) error {
 		s.Host = ""
 		s.PortPathOrID = ""
 	}
+	var explain func() *pendingExplainPlan
+	explainPlans := txn.Config.DatastoreTracer.SlowQuery.ExplainPlans
+	if nil != s.explain && explainPlans.Enabled && !txn.Config.HighSecurity && recordSQL != RecordSQLOff {
+		prepare := s.explain
+		explain = func() *pendingExplainPlan {
+			fn := prepare()
+			if nil == fn {
+				return nil
+			}
+			p := &pendingExplainPlan{
+				explain:      fn,
+				obfuscate:    recordSQL != RecordSQLRaw,
+				dialect:      sqlDialectForProduct(string(s.Product)),
+				maxPerMinute: explainPlans.MaxPerMinute,
+				logger:       txn.Config.Logger,
+			}
+			if nil != txn.app {
+				p.limiter = &txn.app.explainPlans
+			}
+			return p
+		}
+	}
 	return endDatastoreSegment(endDatastoreParams{
 		TxnData:            &txn.txnData,
 		Thread:             thd.thread,
@@ -860,11 +1129,13 @@ func endDatastore(s *DatastoreSegment) error {
 		Collection:         s.Collection,
 		Operation:          s.Operation,
 		ParameterizedQuery: s.ParameterizedQuery,
+		RecordSQL:          recordSQL,
 		QueryParameters:    s.QueryParameters,
 		Host:               s.Host,
 		PortPathOrID:       s.PortPathOrID,
 		Database:           s.DatabaseName,
 		ThisHost:           txn.appRun.Config.hostname,
+		Explain:            explain,
 	})
 }
 
@@ -909,6 +1180,7 @@ func endExternal(s *ExternalSegment) error {
 		return nil
 	}
 	txn := thd.txn
+	txn.decideSampling()
 	txn.Lock()
 	defer txn.Unlock()
 
@@ -940,6 +1212,7 @@ func endMessage(s *MessageProducerSegment) error {
 		return nil
 	}
 	txn := thd.txn
+	txn.decideSampling()
 	txn.Lock()
 	defer txn.Unlock()
 
@@ -964,6 +1237,38 @@ func endMessage(s *MessageProducerSegment) error {
 	})
 }
 
+func endMessageConsumer(s *MessageConsumerSegment) error {
+	thd := s.StartTime.thread
+	if nil == thd {
+		return nil
+	}
+	txn := thd.txn
+	txn.decideSampling()
+	txn.Lock()
+	defer txn.Unlock()
+
+	if txn.finished {
+		return errAlreadyEnded
+	}
+
+	if "" == s.DestinationType {
+		s.DestinationType = MessageQueue
+	}
+
+	return endMessageSegment(endMessageParams{
+		TxnData:         &txn.txnData,
+		Thread:          thd.thread,
+		Start:           s.StartTime.start,
+		Now:             time.Now(),
+		Library:         s.Library,
+		Logger:          txn.Config.Logger,
+		DestinationName: s.DestinationName,
+		DestinationType: string(s.DestinationType),
+		DestinationTemp: s.DestinationTemporary,
+		Consumer:        true,
+	})
+}
+
 // oldCATOutboundHeaders generates the Old CAT and Synthetics headers, depending
 // on whether Old CAT is enabled or any Synthetics functionality has been
 // triggered in the agent.
@@ -1011,6 +1316,7 @@ const (
 
 func (thd *thread) CreateDistributedTracePayload(hdrs http.Header) {
 	txn := thd.txn
+	txn.decideSampling()
 	txn.Lock()
 	defer txn.Unlock()
 
@@ -1220,6 +1526,113 @@ func (thd *thread) AddUserSpanAttribute(key string, val interface{}) error {
 	return nil
 }
 
+var errSpanLinkMissingIDs = errors.New("link must contain a trace id and a span id")
+
+func (thd *thread) AddSpanAnnotation(start segmentStartTime, name string, attrs map[string]interface{}, now time.Time) error {
+	txn := thd.txn
+	txn.Lock()
+	defer txn.Unlock()
+
+	if txn.finished {
+		return errAlreadyEnded
+	}
+	if len(attrs) > attributeUserLimit {
+		return errTooManySpanAnnotationAttributes
+	}
+	a := spanAnnotation{
+		Name:      truncateStringValueIfLong(name),
+		Timestamp: now,
+	}
+	// Attributes are dropped in high security mode and when excluded by the
+	// configuration, but an invalid attribute discards the whole event.
+	if !txn.Config.HighSecurity && txn.Reply.SecurityPolicies.CustomParameters.Enabled() {
+		for key, val := range attrs {
+			if outputDests := applyAttributeConfig(thd.Attrs.config, key, destSpan); 0 == outputDests {
+				continue
+			}
+			validatedVal, err := validateUserAttribute(key, val)
+			if nil != err {
+				return err
+			}
+			addAttr(&a.Attributes, key, validatedVal)
+		}
+	}
+	return thd.thread.AddSpanAnnotation(start, a)
+}
+
+func (thd *thread) AddSpanLink(start segmentStartTime, link TraceMetadata, now time.Time) error {
+	txn := thd.txn
+	txn.Lock()
+	defer txn.Unlock()
+
+	if txn.finished {
+		return errAlreadyEnded
+	}
+	if "" == link.TraceID || "" == link.SpanID {
+		return errSpanLinkMissingIDs
+	}
+	return thd.thread.AddSpanLink(start, spanLink{
+		Timestamp:     now,
+		LinkedTraceID: link.TraceID,
+		LinkedSpanID:  link.SpanID,
+	})
+}
+
+// RecordLog counts the log record immediately and, if log forwarding is
+// enabled, keeps the log event until the transaction ends.
+func (thd *thread) RecordLog(data LogData, now time.Time) error {
+	txn := thd.txn
+	if !txn.Config.ApplicationLogging.Enabled {
+		return nil
+	}
+	r, err := thd.recordLog(data, now)
+	if nil != err {
+		return err
+	}
+	if r.metrics {
+		txn.app.Consume(txn.Reply.RunID, r)
+	}
+	return nil
+}
+
+// recordLog adds the log event to the transaction and returns the record
+// containing the metrics which are not deferred until the transaction ends.
+func (thd *thread) recordLog(data LogData, now time.Time) (logRecord, error) {
+	txn := thd.txn
+	txn.decideSampling()
+	txn.Lock()
+	defer txn.Unlock()
+
+	r := logRecord{
+		severity: data.Severity,
+		metrics:  txn.Config.logMetricsEnabled(),
+	}
+	if "" == r.severity {
+		r.severity = logSeverityUnknown
+	}
+	if txn.finished {
+		return r, errAlreadyEnded
+	}
+	if !txn.Config.logForwardingEnabled() {
+		return r, nil
+	}
+	e, err := txn.createLogEvent(data, now)
+	if nil != err {
+		return r, err
+	}
+	if txn.BetterCAT.Enabled {
+		e.traceID = txn.BetterCAT.TraceID
+		if txn.shouldCollectSpanEvents() {
+			e.spanID = txn.CurrentSpanIdentifier(thd.thread)
+		}
+	}
+	if nil == txn.Logs {
+		txn.Logs = newLogEvents(txn.harvestConfig.MaxLogEvents, nil)
+	}
+	txn.Logs.addEvent(analyticsEvent{e.priority, e})
+	return r, nil
+}
+
 var (
 	// Ensure that txn implements AddAgentAttributer to avoid breaking
 	// integration package type assertions.
@@ -1238,6 +1651,7 @@ func (txn *txn) AddAgentAttribute(name string, stringVal string, otherVal interf
 
 func (thd *thread) GetTraceMetadata() (metadata TraceMetadata) {
 	txn := thd.txn
+	txn.decideSampling()
 	txn.Lock()
 	defer txn.Unlock()
 
@@ -1255,6 +1669,120 @@ func (thd *thread) GetTraceMetadata() (metadata TraceMetadata) {
 	return
 }
 
+// txnProfilerLabels returns the pprof labels of the transaction.  The txn must
+// be locked.
+func (txn *txn) txnProfilerLabels() []string {
+	labels := []string{profilerLabelTransaction, txn.Name}
+	if txn.BetterCAT.Enabled && "" != txn.BetterCAT.TraceID {
+		labels = append(labels, profilerLabelTraceID, txn.BetterCAT.TraceID)
+	}
+	return labels
+}
+
+// profilerLabelsContext returns the context whose pprof labels the labels of
+// the thread are added to.  The txn must be locked.
+func (thd *thread) profilerLabelsContext() context.Context {
+	if ctx := thd.thread.profilerLabelsContext; nil != ctx {
+		return ctx
+	}
+	return context.Background()
+}
+
+// startTxnProfilerLabels sets the pprof labels of the transaction on the
+// calling goroutine.
+func (thd *thread) startTxnProfilerLabels() {
+	txn := thd.txn
+	txn.Lock()
+	labels := txn.txnProfilerLabels()
+	thd.thread.profilerLabels = labels
+	ctx := thd.profilerLabelsContext()
+	txn.Unlock()
+	setGoroutineProfilerLabels(ctx, labels)
+}
+
+// setProfilerLabelsContext adds the pprof labels of the thread to those of
+// the context, and restores the labels of the context when the transaction
+// ends.
+func (thd *thread) setProfilerLabelsContext(ctx context.Context) {
+	txn := thd.txn
+	txn.Lock()
+	thd.thread.profilerLabelsContext = ctx
+	labels := thd.thread.profilerLabels
+	finished := txn.finished
+	txn.Unlock()
+	if finished || nil == labels {
+		restoreGoroutineProfilerLabels(ctx)
+	} else {
+		setGoroutineProfilerLabels(ctx, labels)
+	}
+}
+
+// startSegmentProfilerLabels adds the name of the segment to the pprof labels
+// of the calling goroutine until the segment ends.  The name and trace ID of
+// the transaction are read again since they may have changed.
+func (thd *thread) startSegmentProfilerLabels(start segmentStartTime, name string) {
+	txn := thd.txn
+	txn.Lock()
+	if txn.finished {
+		txn.Unlock()
+		return
+	}
+	// previous is nil for the first segment of a goroutine created using
+	// NewGoroutine: the labels of the profiler labels context are restored
+	// when it ends.
+	previous := thd.thread.profilerLabels
+	labels := append(txn.txnProfilerLabels(), profilerLabelSegment, name)
+	thd.thread.profilerLabelFrames = append(thd.thread.profilerLabelFrames, profilerLabelFrame{
+		stamp:    start.Stamp,
+		previous: previous,
+	})
+	thd.thread.profilerLabels = labels
+	ctx := thd.profilerLabelsContext()
+	txn.Unlock()
+	setGoroutineProfilerLabels(ctx, labels)
+}
+
+// endSegmentProfilerLabels restores the pprof labels the calling goroutine had
+// when the segment started.  The labels of segments started after it, which
+// have not ended, are discarded.  Once the transaction has finished, or when
+// the goroutine had no labels of the transaction, the labels of the profiler
+// labels context are restored instead.
+func (thd *thread) endSegmentProfilerLabels(start segmentStartTime) {
+	txn := thd.txn
+	txn.Lock()
+	frames := thd.thread.profilerLabelFrames
+	for i := len(frames) - 1; i >= 0; i-- {
+		if frames[i].stamp != start.Stamp {
+			continue
+		}
+		labels := frames[i].previous
+		thd.thread.profilerLabelFrames = frames[:i]
+		thd.thread.profilerLabels = labels
+		finished := txn.finished
+		ctx := thd.profilerLabelsContext()
+		txn.Unlock()
+		if finished || nil == labels {
+			restoreGoroutineProfilerLabels(ctx)
+		} else {
+			setGoroutineProfilerLabels(ctx, labels)
+		}
+		return
+	}
+	txn.Unlock()
+}
+
+// endTxnProfilerLabels restores the pprof labels of the profiler labels
+// context on the calling goroutine when the transaction ends.
+func (thd *thread) endTxnProfilerLabels() {
+	txn := thd.txn
+	txn.Lock()
+	thd.thread.profilerLabels = nil
+	thd.thread.profilerLabelFrames = nil
+	ctx := thd.profilerLabelsContext()
+	txn.Unlock()
+	restoreGoroutineProfilerLabels(ctx)
+}
+
 func (thd *thread) GetLinkingMetadata() (metadata LinkingMetadata) {
 	txn := thd.txn
 	metadata.EntityName = txn.appRun.firstAppName
@@ -1270,6 +1798,7 @@ func (thd *thread) GetLinkingMetadata() (metadata LinkingMetadata) {
 }
 
 func (txn *txn) IsSampled() bool {
+	txn.decideSampling()
 	txn.Lock()
 	defer txn.Unlock()
 
@@ -17,7 +17,11 @@ func intrinsicsJSON(e *txnEvent, buf *bytes.Buffer) {
 	w := jsonFieldsWriter{buf: buf}
 
 	buf.WriteByte('{')
+	intrinsicsFields(e, &w)
+	buf.WriteByte('}')
+}
 
+func intrinsicsFields(e *txnEvent, w *jsonFieldsWriter) {
 	w.floatField("totalTime", e.TotalTime.Seconds())
 
 	if e.BetterCAT.Enabled {
@@ -28,17 +32,15 @@ func intrinsicsJSON(e *txnEvent, buf *bytes.Buffer) {
 	}
 
 	if e.CrossProcess.Used() {
-		addOptionalStringField(&w, "client_cross_process_id", e.CrossProcess.ClientID)
-		addOptionalStringField(&w, "trip_id", e.CrossProcess.TripID)
-		addOptionalStringField(&w, "path_hash", e.CrossProcess.PathHash)
-		addOptionalStringField(&w, "referring_transaction_guid", e.CrossProcess.ReferringTxnGUID)
+		addOptionalStringField(w, "client_cross_process_id", e.CrossProcess.ClientID)
+		addOptionalStringField(w, "trip_id", e.CrossProcess.TripID)
+		addOptionalStringField(w, "path_hash", e.CrossProcess.PathHash)
+		addOptionalStringField(w, "referring_transaction_guid", e.CrossProcess.ReferringTxnGUID)
 	}
 
 	if e.CrossProcess.IsSynthetics() {
-		addOptionalStringField(&w, "synthetics_resource_id", e.CrossProcess.Synthetics.ResourceID)
-		addOptionalStringField(&w, "synthetics_job_id", e.CrossProcess.Synthetics.JobID)
-		addOptionalStringField(&w, "synthetics_monitor_id", e.CrossProcess.Synthetics.MonitorID)
+		addOptionalStringField(w, "synthetics_resource_id", e.CrossProcess.Synthetics.ResourceID)
+		addOptionalStringField(w, "synthetics_job_id", e.CrossProcess.Synthetics.JobID)
+		addOptionalStringField(w, "synthetics_monitor_id", e.CrossProcess.Synthetics.MonitorID)
 	}
-
-	buf.WriteByte('}')
 }
@@ -26,6 +26,12 @@ const (
 	// transaction.
 	maxTxnErrors      = 5
 	maxTxnSlowQueries = 10
+	// maxErrorChainLinks is the maximum number of errors of the chain of
+	// a noticed error, including itself, which are examined and recorded.
+	maxErrorChainLinks = 10
+	// maxGoroutineDumpBytes is the maximum size of the stack traces of
+	// all goroutines recorded with a panic by PanicPolicyGoroutineDump.
+	maxGoroutineDumpBytes = 64 * 1024
 
 	startingTxnTraceNodes = 16
 	maxTxnTraceNodes      = 256
@@ -39,6 +45,22 @@ const (
 	// maxSpanEvents is the maximum number of Span Events that can be captured
 	// per 60-second harvest cycle
 	maxSpanEvents = 1000
+	// maxSpanAnnotations and maxSpanLinks are the maximum number of events
+	// and links that can be added to a single segment.
+	maxSpanAnnotations = 100
+	maxSpanLinks       = 100
+	// maxDimensionalMetricSeries and maxDimensionalMetricSeriesPerName limit
+	// the number of distinct dimensional metric time series, in total and
+	// per metric name, that are aggregated per harvest.
+	maxDimensionalMetricSeries        = 10 * 1000
+	maxDimensionalMetricSeriesPerName = 1000
+	// maxPrometheusSeries limits the number of time series aggregated for
+	// the Prometheus handler.  Unlike the metrics sent to New Relic, these
+	// are kept for the lifetime of the application.
+	maxPrometheusSeries = 10 * 1000
+	// maxHarvestProfiles limits the number of profiles delivered with each
+	// harvest of metrics and traces.
+	maxHarvestProfiles = 20
 
 	// attributes
 	attributeKeyLengthLimit   = 255
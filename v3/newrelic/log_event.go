@@ -0,0 +1,150 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package newrelic
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// LogData contains a log record, which may be recorded using
+// Application.RecordLog or Transaction.RecordLog.
+type LogData struct {
+	// Timestamp is the time the record was logged.  If it is zero, the
+	// time RecordLog is called is used.
+	Timestamp time.Time
+	// Severity is the level of the record, such as "INFO" or "ERROR".  If
+	// it is empty, "UNKNOWN" is used.
+	Severity string
+	// Message is the text of the record.  Messages longer than 32768
+	// bytes are truncated.
+	Message string
+	// Attributes are added to the log event.  Each value must be a
+	// number, string, or boolean.  Attributes are subject to the
+	// Attributes and ApplicationLogging.Forwarding.Attributes
+	// configuration, and are not recorded in high security mode.
+	Attributes map[string]interface{}
+}
+
+const (
+	logSeverityUnknown = "UNKNOWN"
+	// maxLogMessageLength is the maximum length of a log event message in
+	// bytes.
+	maxLogMessageLength = 32 * 1024
+)
+
+var (
+	errLogAttributeLimit = fmt.Errorf("log attribute limit of %d exceeded",
+		attributeUserLimit)
+)
+
+// logEvent is a log record sent to New Relic as part of the log_event_data
+// payload.
+type logEvent struct {
+	priority   priority
+	timestamp  time.Time
+	severity   string
+	message    string
+	traceID    string
+	spanID     string
+	attributes map[string]interface{}
+}
+
+// WriteJSON prepares the JSON object of a single log in the format expected
+// by the log_event_data endpoint.
+func (e *logEvent) WriteJSON(buf *bytes.Buffer) {
+	w := jsonFieldsWriter{buf: buf}
+	buf.WriteByte('{')
+	w.intField("timestamp", timeToIntMillis(e.timestamp))
+	w.stringField("level", e.severity)
+	w.stringField("message", e.message)
+	if "" != e.traceID {
+		w.stringField("trace.id", e.traceID)
+	}
+	if "" != e.spanID {
+		w.stringField("span.id", e.spanID)
+	}
+	if len(e.attributes) > 0 {
+		w.addKey("attributes")
+		buf.WriteByte('{')
+		aw := jsonFieldsWriter{buf: buf}
+		for key, val := range e.attributes {
+			writeAttributeValueJSON(&aw, key, val)
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteByte('}')
+}
+
+// MarshalJSON is used for testing.
+func (e *logEvent) MarshalJSON() ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, 256))
+
+	e.WriteJSON(buf)
+
+	return buf.Bytes(), nil
+}
+
+// createLogEvent validates the log record and applies the attribute
+// configuration to its attributes.  Attributes are dropped if high security
+// mode is enabled or if the custom parameters security policy is disabled.
+func (run *appRun) createLogEvent(data LogData, now time.Time) (*logEvent, error) {
+	if len(data.Attributes) > attributeUserLimit {
+		return nil, errLogAttributeLimit
+	}
+	e := &logEvent{
+		timestamp: data.Timestamp,
+		severity:  data.Severity,
+		message:   stringLengthByteLimit(data.Message, maxLogMessageLength),
+	}
+	if e.timestamp.IsZero() {
+		e.timestamp = now
+	}
+	if "" == e.severity {
+		e.severity = logSeverityUnknown
+	}
+	if run.Config.HighSecurity || !run.Reply.SecurityPolicies.CustomParameters.Enabled() {
+		return e, nil
+	}
+	for key, val := range data.Attributes {
+		val, err := validateUserAttribute(key, val)
+		if nil != err {
+			return nil, err
+		}
+		if destNone == applyAttributeConfig(run.AttributeConfig, key, destLog) {
+			continue
+		}
+		if nil == e.attributes {
+			e.attributes = make(map[string]interface{})
+		}
+		e.attributes[key] = val
+	}
+	return e, nil
+}
+
+// logRecord is a harvestable containing a single log record.  The metrics
+// counting log lines are created if metrics is true, and the event is added
+// to the harvest if it is not nil.
+type logRecord struct {
+	severity string
+	metrics  bool
+	event    *logEvent
+}
+
+// MergeIntoHarvest implements Harvestable.
+func (r logRecord) MergeIntoHarvest(h *harvest) {
+	if r.metrics {
+		createLogMetrics(r.severity, h.Metrics)
+	}
+	if nil != r.event {
+		h.LogEvents.Add(r.event)
+	}
+}
+
+// createLogMetrics counts a log line both in total and by severity.
+func createLogMetrics(severity string, metrics *metricTable) {
+	metrics.addSingleCount(logLinesMetric, forced)
+	metrics.addSingleCount(logLinesMetric+"/"+severity, forced)
+}
@@ -0,0 +1,237 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package newrelic
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/newrelic/go-agent/v3/internal"
+)
+
+func enableLogForwarding(cfg *Config) {
+	cfg.ApplicationLogging.Forwarding.Enabled = true
+}
+
+func TestLogEventJSON(t *testing.T) {
+	e := &logEvent{
+		timestamp:  now,
+		severity:   "INFO",
+		message:    "hello",
+		traceID:    "trace",
+		spanID:     "span",
+		attributes: map[string]interface{}{"zip": 1},
+	}
+	js, err := json.Marshal(e)
+	if nil != err {
+		t.Fatal(err)
+	}
+	expect := `{"timestamp":1417136460000,"level":"INFO","message":"hello",` +
+		`"trace.id":"trace","span.id":"span","attributes":{"zip":1}}`
+	if string(js) != expect {
+		t.Error(string(js))
+	}
+
+	js, _ = json.Marshal(&logEvent{timestamp: now, severity: "WARN"})
+	if string(js) != `{"timestamp":1417136460000,"level":"WARN","message":""}` {
+		t.Error(string(js))
+	}
+}
+
+func TestCreateLogEvent(t *testing.T) {
+	cfg := config{Config: defaultConfig()}
+	cfg.ApplicationLogging.Forwarding.Attributes.Exclude = []string{"password"}
+	run := newAppRun(cfg, internal.ConnectReplyDefaults())
+
+	e, err := run.createLogEvent(LogData{
+		Message:    strings.Repeat("a", maxLogMessageLength+1),
+		Attributes: map[string]interface{}{"user": "jim", "password": "hunter2"},
+	}, now)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if e.severity != logSeverityUnknown || !e.timestamp.Equal(now) {
+		t.Error(e.severity, e.timestamp)
+	}
+	if len(e.message) != maxLogMessageLength {
+		t.Error(len(e.message))
+	}
+	if len(e.attributes) != 1 || e.attributes["user"] != "jim" {
+		t.Error(e.attributes)
+	}
+
+	_, err = run.createLogEvent(LogData{
+		Attributes: map[string]interface{}{"struct": struct{}{}},
+	}, now)
+	if _, ok := err.(errInvalidAttributeType); !ok {
+		t.Error(err)
+	}
+}
+
+func TestCreateLogEventHighSecurity(t *testing.T) {
+	cfg := config{Config: defaultConfig()}
+	cfg.HighSecurity = true
+	run := newAppRun(cfg, internal.ConnectReplyDefaults())
+	e, err := run.createLogEvent(LogData{
+		Severity:   "ERROR",
+		Message:    "oops",
+		Attributes: map[string]interface{}{"user": "jim"},
+	}, now)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if e.message != "oops" || nil != e.attributes {
+		t.Error(e.message, e.attributes)
+	}
+}
+
+func TestApplicationRecordLog(t *testing.T) {
+	tapp := testApp(nil, enableLogForwarding, t)
+	tapp.RecordLog(LogData{
+		Timestamp:  now,
+		Severity:   "INFO",
+		Message:    "hello",
+		Attributes: map[string]interface{}{"zip": "zap"},
+	})
+	tapp.RecordLog(LogData{Message: "no severity"})
+	tapp.expectNoLoggedErrors(t)
+	tapp.ExpectLogEvents(t, []internal.WantLog{
+		{
+			Severity:   "INFO",
+			Message:    "hello",
+			Timestamp:  timeToIntMillis(now),
+			Attributes: map[string]interface{}{"zip": "zap"},
+		},
+		{
+			Severity: logSeverityUnknown,
+			Message:  "no severity",
+		},
+	})
+	tapp.ExpectMetrics(t, []internal.WantMetric{
+		{Name: "Logging/lines", Forced: true, Data: []float64{2, 0, 0, 0, 0, 0}},
+		{Name: "Logging/lines/INFO", Forced: true, Data: []float64{1, 0, 0, 0, 0, 0}},
+		{Name: "Logging/lines/UNKNOWN", Forced: true, Data: []float64{1, 0, 0, 0, 0, 0}},
+	})
+}
+
+func TestApplicationRecordLogForwardingDisabled(t *testing.T) {
+	tapp := testApp(nil, nil, t)
+	tapp.RecordLog(LogData{Severity: "DEBUG", Message: "hello"})
+	tapp.ExpectLogEvents(t, []internal.WantLog{})
+	tapp.ExpectMetrics(t, []internal.WantMetric{
+		{Name: "Logging/lines", Forced: true, Data: []float64{1, 0, 0, 0, 0, 0}},
+		{Name: "Logging/lines/DEBUG", Forced: true, Data: []float64{1, 0, 0, 0, 0, 0}},
+	})
+}
+
+func TestApplicationRecordLogDisabled(t *testing.T) {
+	tapp := testApp(nil, func(cfg *Config) {
+		cfg.ApplicationLogging.Enabled = false
+		enableLogForwarding(cfg)
+	}, t)
+	tapp.RecordLog(LogData{Severity: "DEBUG", Message: "hello"})
+	tapp.expectNoLoggedErrors(t)
+	tapp.ExpectLogEvents(t, []internal.WantLog{})
+	tapp.ExpectMetrics(t, []internal.WantMetric{})
+}
+
+func TestTransactionRecordLog(t *testing.T) {
+	tapp := testApp(distributedTracingReplyFields, func(cfg *Config) {
+		enableBetterCAT(cfg)
+		enableLogForwarding(cfg)
+	}, t)
+	txn := tapp.StartTransaction("hello")
+	seg := txn.StartSegment("mySegment")
+	md := txn.GetTraceMetadata()
+	txn.RecordLog(LogData{Severity: "WARN", Message: "careful"})
+	seg.End()
+
+	// Log events are not added to the harvest until the transaction ends,
+	// but the metrics are.
+	tapp.ExpectLogEvents(t, []internal.WantLog{})
+	tapp.ExpectMetrics(t, []internal.WantMetric{
+		{Name: "Logging/lines", Forced: true, Data: []float64{1, 0, 0, 0, 0, 0}},
+		{Name: "Logging/lines/WARN", Forced: true, Data: []float64{1, 0, 0, 0, 0, 0}},
+	})
+	txn.End()
+
+	tapp.ExpectLogEvents(t, []internal.WantLog{{
+		Severity: "WARN",
+		Message:  "careful",
+		TraceID:  md.TraceID,
+		SpanID:   md.SpanID,
+	}})
+	events := tapp.Private.(*app).testHarvest.LogEvents.events
+	if p := events[0].priority; p != txn.thread.BetterCAT.Priority {
+		t.Error(p, txn.thread.BetterCAT.Priority)
+	}
+
+	// Logs recorded after the transaction has ended are neither counted
+	// nor forwarded.
+	if err := txn.RecordLog(LogData{Severity: "WARN", Message: "late"}); err != errAlreadyEnded {
+		t.Error(err)
+	}
+	tapp.ExpectLogEvents(t, []internal.WantLog{{
+		Severity: "WARN",
+		Message:  "careful",
+		TraceID:  internal.MatchAnyString,
+		SpanID:   internal.MatchAnyString,
+	}})
+	tapp.ExpectMetricsPresent(t, []internal.WantMetric{
+		{Name: "Logging/lines/WARN", Forced: true, Data: []float64{1, 0, 0, 0, 0, 0}},
+	})
+}
+
+func TestRecordLogErrorNotLogged(t *testing.T) {
+	tapp := testApp(nil, enableLogForwarding, t)
+	attrs := make(map[string]interface{})
+	for i := 0; i <= attributeUserLimit; i++ {
+		attrs[strconv.Itoa(i)] = i
+	}
+	if err := tapp.RecordLog(LogData{Message: "hello", Attributes: attrs}); err != errLogAttributeLimit {
+		t.Error(err)
+	}
+	txn := tapp.StartTransaction("hello")
+	if err := txn.RecordLog(LogData{Message: "hello", Attributes: attrs}); err != errLogAttributeLimit {
+		t.Error(err)
+	}
+	txn.End()
+	// The errors are returned rather than logged, since the agent's logger
+	// may be the logger calling RecordLog.
+	tapp.expectNoLoggedErrors(t)
+	tapp.ExpectLogEvents(t, []internal.WantLog{})
+}
+
+func TestTransactionRecordLogMetricsDisabled(t *testing.T) {
+	tapp := testApp(nil, func(cfg *Config) {
+		cfg.ApplicationLogging.Metrics.Enabled = false
+		enableLogForwarding(cfg)
+	}, t)
+	txn := tapp.StartTransaction("hello")
+	txn.RecordLog(LogData{Severity: "INFO", Message: "hello"})
+	txn.End()
+	tapp.ExpectLogEvents(t, []internal.WantLog{{
+		Severity: "INFO",
+		Message:  "hello",
+	}})
+	tapp.ExpectMetricsPresent(t, []internal.WantMetric{
+		{Name: "OtherTransaction/Go/hello", Forced: true},
+	})
+	if m := tapp.Private.(*app).testHarvest.Metrics.metrics[metricID{Name: "Logging/lines"}]; nil != m {
+		t.Error("log metrics created", m)
+	}
+}
+
+func TestNilTransactionRecordLog(t *testing.T) {
+	var txn *Transaction
+	if err := txn.RecordLog(LogData{Message: "hello"}); nil != err {
+		t.Error(err)
+	}
+	var nilApp *Application
+	if err := nilApp.RecordLog(LogData{Message: "hello"}); nil != err {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package newrelic
+
+import (
+	"bytes"
+	"sort"
+	"time"
+)
+
+type logEvents struct {
+	*analyticsEvents
+	// commonAttributes identify the entity which logged the events.  They
+	// are sent once per payload rather than with every log.
+	commonAttributes map[string]string
+}
+
+func newLogEvents(max int, commonAttributes map[string]string) *logEvents {
+	return &logEvents{
+		analyticsEvents:  newAnalyticsEvents(max),
+		commonAttributes: commonAttributes,
+	}
+}
+
+// Add adds a log event which was not recorded by a transaction.  Like custom
+// events, these logs are sampled using a random priority.
+func (events *logEvents) Add(e *logEvent) {
+	e.priority = newPriority()
+	events.addEvent(analyticsEvent{e.priority, e})
+}
+
+// mergeTxnLogs adds the log events of a transaction using the transaction's
+// priority, so that logs are kept together with the transaction's other
+// events.
+func (events *logEvents) mergeTxnLogs(txnLogs *logEvents, p priority) {
+	if nil == txnLogs {
+		return
+	}
+	allSeen := events.numSeen + txnLogs.numSeen
+	for _, e := range txnLogs.events {
+		le := e.jsonWriter.(*logEvent)
+		le.priority = p
+		events.addEvent(analyticsEvent{p, le})
+	}
+	events.numSeen = allSeen
+}
+
+func (events *logEvents) MergeIntoHarvest(h *harvest) {
+	h.LogEvents.mergeFailed(events.analyticsEvents)
+}
+
+func (events *logEvents) Data(agentRunID string, harvestStart time.Time) ([]byte, error) {
+	if 0 == len(events.events) {
+		return nil, nil
+	}
+
+	estimate := 256 * len(events.events)
+	buf := bytes.NewBuffer(make([]byte, 0, estimate))
+
+	buf.WriteString(`[{"common":{"attributes":{`)
+	keys := make([]string, 0, len(events.commonAttributes))
+	for key := range events.commonAttributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	w := jsonFieldsWriter{buf: buf}
+	for _, key := range keys {
+		w.stringField(key, events.commonAttributes[key])
+	}
+	buf.WriteString(`}},"logs":[`)
+	for i, e := range events.events {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		e.WriteJSON(buf)
+	}
+	buf.WriteString(`]}]`)
+
+	return buf.Bytes(), nil
+}
+
+func (events *logEvents) EndpointMethod() string {
+	return cmdLogEvents
+}
+
+// logCommonAttributes returns the attributes which identify the application
+// in the log event payload.
+func logCommonAttributes(run *appRun) map[string]string {
+	attrs := map[string]string{
+		"entity.name": run.firstAppName,
+		"entity.type": "SERVICE",
+		"hostname":    run.Config.hostname,
+	}
+	if "" != run.Reply.EntityGUID {
+		attrs["entity.guid"] = run.Reply.EntityGUID
+	}
+	return attrs
+}
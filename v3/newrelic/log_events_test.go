@@ -0,0 +1,138 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package newrelic
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/newrelic/go-agent/v3/internal"
+)
+
+func TestLogEventsPayload(t *testing.T) {
+	events := newLogEvents(10, map[string]string{
+		"entity.name": "my app",
+		"hostname":    "my-host",
+	})
+	if js, err := events.Data("agentRunID", time.Now()); nil != js || nil != err {
+		t.Error(string(js), err)
+	}
+	events.Add(&logEvent{timestamp: now, severity: "INFO", message: "hello"})
+	js, err := events.Data("agentRunID", time.Now())
+	if nil != err {
+		t.Fatal(err)
+	}
+	expect := `[{"common":{"attributes":{"entity.name":"my app","hostname":"my-host"}},` +
+		`"logs":[{"timestamp":1417136460000,"level":"INFO","message":"hello"}]}]`
+	if string(js) != expect {
+		t.Error(string(js))
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(js, &decoded); nil != err {
+		t.Error(err)
+	}
+	if m := events.EndpointMethod(); m != "log_event_data" {
+		t.Error(m)
+	}
+}
+
+func TestLogEventsMergeTxnLogs(t *testing.T) {
+	events := newLogEvents(2, nil)
+	events.Add(&logEvent{message: "app"})
+
+	txnLogs := newLogEvents(2, nil)
+	txnLogs.addEvent(analyticsEvent{0, &logEvent{message: "first"}})
+	txnLogs.addEvent(analyticsEvent{0, &logEvent{message: "second"}})
+	txnLogs.addEvent(analyticsEvent{0, &logEvent{message: "third"}})
+	events.mergeTxnLogs(txnLogs, 2.0)
+	events.mergeTxnLogs(nil, 2.0)
+
+	if events.NumSeen() != 4 || events.NumSaved() != 2 {
+		t.Error(events.NumSeen(), events.NumSaved())
+	}
+	for _, e := range events.events {
+		if e.priority != 2.0 {
+			t.Error(e.priority)
+		}
+		if le := e.jsonWriter.(*logEvent); le.priority != 2.0 || le.message == "app" {
+			t.Error(le.priority, le.message)
+		}
+	}
+}
+
+func TestLogEventsHarvest(t *testing.T) {
+	h := newHarvest(now, harvestConfig{
+		ReportPeriods: map[harvestTypes]time.Duration{
+			harvestTypesAll &^ harvestLogEvents: fixedHarvestPeriod,
+			harvestLogEvents:                    5 * time.Second,
+		},
+		MaxLogEvents: 1,
+	})
+	logRecord{severity: "INFO", metrics: true, event: &logEvent{message: "hello"}}.MergeIntoHarvest(h)
+	logRecord{severity: "INFO", metrics: true, event: &logEvent{message: "hello"}}.MergeIntoHarvest(h)
+
+	ready := h.Ready(now.Add(10 * time.Second))
+	if nil == ready.LogEvents || nil != ready.Metrics {
+		t.Fatal(ready)
+	}
+	if ready.LogEvents.NumSaved() != 1 {
+		t.Error(ready.LogEvents.NumSaved())
+	}
+	if h.LogEvents.capacity() != 1 || h.LogEvents.NumSeen() != 0 {
+		t.Error(h.LogEvents.capacity(), h.LogEvents.NumSeen())
+	}
+	expectMetrics(t, h.Metrics, []internal.WantMetric{
+		{Name: "Logging/lines", Forced: true, Data: []float64{2, 0, 0, 0, 0, 0}},
+		{Name: "Logging/lines/INFO", Forced: true, Data: []float64{2, 0, 0, 0, 0, 0}},
+		{Name: logEventsSeen, Forced: true, Data: []float64{2, 0, 0, 0, 0, 0}},
+		{Name: logEventsSent, Forced: true, Data: []float64{1, 0, 0, 0, 0, 0}},
+	})
+
+	// Failed payloads are merged into the next harvest.
+	ready.LogEvents.MergeIntoHarvest(h)
+	if h.LogEvents.NumSaved() != 1 {
+		t.Error(h.LogEvents.NumSaved())
+	}
+}
+
+func TestConnectRequestLogEventLimit(t *testing.T) {
+	cfg := defaultConfig()
+	if limit := cfg.eventHarvestConfig().Limits.LogEvents; nil != limit {
+		t.Error(*limit)
+	}
+	cfg.ApplicationLogging.Forwarding.Enabled = true
+	cfg.ApplicationLogging.Forwarding.MaxSamplesStored = 50
+	if limit := cfg.eventHarvestConfig().Limits.LogEvents; nil == limit || *limit != 50 {
+		t.Error(limit)
+	}
+	cfg.ApplicationLogging.Forwarding.MaxSamplesStored = internal.MaxLogEvents + 1
+	if limit := cfg.eventHarvestConfig().Limits.LogEvents; nil == limit || *limit != internal.MaxLogEvents {
+		t.Error(limit)
+	}
+}
+
+func TestHarvestDataLogEvents(t *testing.T) {
+	h := newHarvest(now, dfltHarvestCfgr)
+	if logs := newHarvestData(&harvest{}, now, nil).LogEvents(); nil != logs {
+		t.Error(logs)
+	}
+	h.LogEvents.Add(&logEvent{
+		timestamp:  now,
+		severity:   "ERROR",
+		message:    "oops",
+		traceID:    "trace",
+		spanID:     "span",
+		attributes: map[string]interface{}{"zip": "zap"},
+	})
+	logs := newHarvestData(h, now, nil).LogEvents()
+	if len(logs) != 1 {
+		t.Fatal(len(logs))
+	}
+	l := logs[0]
+	if !l.Timestamp.Equal(now) || l.Severity != "ERROR" || l.Message != "oops" ||
+		l.TraceID != "trace" || l.SpanID != "span" || l.Attributes["zip"] != "zap" {
+		t.Error(l)
+	}
+}
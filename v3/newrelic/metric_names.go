@@ -16,6 +16,15 @@ const (
 
 	errorsPrefix = "Errors/"
 
+	// expectedErrorsMetric counts the transactions whose errors were all
+	// expected.
+	expectedErrorsMetric = "ErrorsExpected/all"
+
+	// Errors noticed on segments are counted using the segment metric
+	// name, e.g. "SegmentErrors/External/example.com/http/GET".
+	segmentErrorsPrefix = "SegmentErrors/"
+	segmentErrorsRollup = "SegmentErrors/all"
+
 	// "HttpDispatcher" metric is used for the overview graph, and
 	// therefore should only be made for web transactions.
 	dispatcherMetric = "HttpDispatcher"
@@ -42,8 +51,23 @@ const (
 	spanEventsSeen = "Supportability/SpanEvent/TotalEventsSeen"
 	spanEventsSent = "Supportability/SpanEvent/TotalEventsSent"
 
+	logEventsSeen = "Supportability/Logging/Forwarding/Seen"
+	logEventsSent = "Supportability/Logging/Forwarding/Sent"
+
+	// logLinesMetric counts log records.  It is suffixed with the severity
+	// to count records by level.
+	logLinesMetric = "Logging/lines"
+
 	supportabilityDropped = "Supportability/MetricsDropped"
 
+	// dimensionalMetricsDropped counts dimensional metric values dropped
+	// because of the time series limits.
+	dimensionalMetricsDropped = "Supportability/DimensionalMetrics/Dropped"
+
+	// profilesDropped counts profiles dropped because of the limit of
+	// profiles per harvest.
+	profilesDropped = "Supportability/Profiles/Dropped"
+
 	// Runtime/System Metrics
 	memoryPhysical       = "Memory/Physical"
 	heapObjectsAllocated = "Memory/Heap/AllocatedObjects"
@@ -55,12 +79,40 @@ const (
 	gcPauseFraction      = "GC/System/Pause Fraction"
 	gcPauses             = "GC/System/Pauses"
 
+	// Extended runtime metrics, reported by category as configured in
+	// Config.RuntimeSampler.
+	runtimeSchedulerLatency    = "Go/Runtime/Scheduler/Latency"
+	runtimeSchedulerGOMAXPROCS = "Go/Runtime/Scheduler/GOMAXPROCS"
+	runtimeGCHeapGoal          = "Go/Runtime/GC/HeapGoal"
+	runtimeGCCycles            = "Go/Runtime/GC/Cycles"
+	runtimeGCHeapAllocated     = "Go/Runtime/GC/HeapAllocated"
+	runtimeHeapFragmentation   = "Go/Runtime/Heap/Fragmentation"
+	runtimeHeapFree            = "Go/Runtime/Heap/Free"
+	runtimeHeapReleased        = "Go/Runtime/Heap/Released"
+	runtimeSyncMutexWait       = "Go/Runtime/Sync/MutexWait"
+	runtimeCgoCalls            = "Go/Runtime/Cgo/Calls"
+	runtimeProcessThreads      = "Go/Runtime/Process/Threads"
+	runtimeProcessFDs          = "Go/Runtime/Process/FileDescriptors"
+
+	// Database connection pool metrics are prefixed by the name given to
+	// Application.SampleDBStats.
+	dbStatsPrefix            = "Go/SQL/"
+	dbStatsMaxOpen           = "/MaxOpenConnections"
+	dbStatsOpen              = "/OpenConnections"
+	dbStatsInUse             = "/InUse"
+	dbStatsIdle              = "/Idle"
+	dbStatsWaitCount         = "/WaitCount"
+	dbStatsWaitDuration      = "/WaitDuration"
+	dbStatsMaxIdleClosed     = "/MaxIdleClosed"
+	dbStatsMaxLifetimeClosed = "/MaxLifetimeClosed"
+
 	// Configurable event harvest supportability metrics
 	supportReportPeriod     = "Supportability/EventHarvest/ReportPeriod"
 	supportTxnEventLimit    = "Supportability/EventHarvest/AnalyticEventData/HarvestLimit"
 	supportCustomEventLimit = "Supportability/EventHarvest/CustomEventData/HarvestLimit"
 	supportErrorEventLimit  = "Supportability/EventHarvest/ErrorEventData/HarvestLimit"
 	supportSpanEventLimit   = "Supportability/EventHarvest/SpanEventData/HarvestLimit"
+	supportLogEventLimit    = "Supportability/EventHarvest/LogEventData/HarvestLimit"
 )
 
 // distributedTracingSupport is used to track distributed tracing activity for
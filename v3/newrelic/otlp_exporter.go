@@ -0,0 +1,823 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package newrelic
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The OTLP exporter translates harvest data into the OTLP protobuf or JSON
+// protobuf encoding and posts it to an OTLP/HTTP receiver:
+// https://github.com/open-telemetry/opentelemetry-specification/blob/main/specification/protocol/otlp.md
+
+// OTLPEncoding is the encoding of the requests of the OTLP exporter.  It is
+// used for the Config.OTLPExporter.Encoding field.
+type OTLPEncoding string
+
+// These constants are the supported values of Config.OTLPExporter.Encoding.
+const (
+	// OTLPEncodingProtobuf is the binary protobuf encoding, which is the
+	// default encoding of OTLP/HTTP.
+	OTLPEncodingProtobuf OTLPEncoding = "protobuf"
+	// OTLPEncodingJSON is the JSON protobuf encoding.
+	OTLPEncodingJSON OTLPEncoding = "json"
+)
+
+const (
+	otlpTracesPath  = "/v1/traces"
+	otlpMetricsPath = "/v1/metrics"
+	otlpLogsPath    = "/v1/logs"
+
+	// otlpAgentRunID is used in place of the run ID assigned by the
+	// collector since no connect occurs when the OTLP exporter is enabled.
+	otlpAgentRunID = "otlp"
+
+	otlpScopeName = "github.com/newrelic/go-agent/v3/newrelic"
+
+	// Span kinds as defined by opentelemetry.proto.trace.v1.Span.SpanKind.
+	otlpSpanKindInternal = 1
+	otlpSpanKindServer   = 2
+	otlpSpanKindClient   = 3
+	otlpSpanKindProducer = 4
+	otlpSpanKindConsumer = 5
+)
+
+// otlpAnyValue is a single-entry map such as {"stringValue":"hello"}.
+type otlpAnyValue map[string]interface{}
+
+func otlpString(s string) otlpAnyValue               { return otlpAnyValue{"stringValue": s} }
+func otlpBool(b bool) otlpAnyValue                   { return otlpAnyValue{"boolValue": b} }
+func otlpInt(x int64) otlpAnyValue                   { return otlpAnyValue{"intValue": strconv.FormatInt(x, 10)} }
+func otlpDouble(x float64) otlpAnyValue              { return otlpAnyValue{"doubleValue": x} }
+func otlpUnixNano(t time.Time) string                { return strconv.FormatInt(t.UnixNano(), 10) }
+func otlpMillisToNano(ms int64) string               { return strconv.FormatInt(ms*int64(time.Millisecond), 10) }
+func otlpCount(count float64) string                 { return strconv.FormatUint(uint64(count), 10) }
+func otlpKV(key string, v otlpAnyValue) otlpKeyValue { return otlpKeyValue{Key: key, Value: v} }
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Links             []otlpLink     `json:"links,omitempty"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpLink struct {
+	TraceID string `json:"traceId"`
+	SpanID  string `json:"spanId"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpTracesData struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpQuantileValue struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+type otlpSummaryDataPoint struct {
+	Attributes        []otlpKeyValue      `json:"attributes,omitempty"`
+	StartTimeUnixNano string              `json:"startTimeUnixNano"`
+	TimeUnixNano      string              `json:"timeUnixNano"`
+	Count             string              `json:"count"`
+	Sum               float64             `json:"sum"`
+	QuantileValues    []otlpQuantileValue `json:"quantileValues"`
+}
+
+type otlpNumberDataPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	TimeUnixNano      string         `json:"timeUnixNano"`
+	AsDouble          float64        `json:"asDouble"`
+}
+
+type otlpSummary struct {
+	DataPoints []otlpSummaryDataPoint `json:"dataPoints"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpNumberDataPoint `json:"dataPoints"`
+}
+
+// otlpSum is a sum with delta aggregation temporality.  Counters are
+// monotonic sums.
+type otlpSum struct {
+	DataPoints             []otlpNumberDataPoint `json:"dataPoints"`
+	AggregationTemporality int                   `json:"aggregationTemporality"`
+	IsMonotonic            bool                  `json:"isMonotonic"`
+}
+
+// otlpAggregationTemporalityDelta is AGGREGATION_TEMPORALITY_DELTA.
+const otlpAggregationTemporalityDelta = 1
+
+type otlpMetric struct {
+	Name    string       `json:"name"`
+	Summary *otlpSummary `json:"summary,omitempty"`
+	Gauge   *otlpGauge   `json:"gauge,omitempty"`
+	Sum     *otlpSum     `json:"sum,omitempty"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpMetricsData struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	SeverityText string         `json:"severityText,omitempty"`
+	Body         otlpAnyValue   `json:"body"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+	TraceID      string         `json:"traceId,omitempty"`
+	SpanID       string         `json:"spanId,omitempty"`
+}
+
+type otlpScopeLogs struct {
+	Scope      otlpScope       `json:"scope"`
+	LogRecords []otlpLogRecord `json:"logRecords"`
+}
+
+type otlpResourceLogs struct {
+	Resource  otlpResource    `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpLogsData struct {
+	ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+}
+
+// otlpExporter posts harvest data to an OTLP/HTTP receiver in place of the
+// New Relic collector.
+type otlpExporter struct {
+	endpoint string
+	headers  map[string]string
+	encoding OTLPEncoding
+	client   *http.Client
+	resource otlpResource
+	scope    otlpScope
+}
+
+func newOTLPExporter(c config, client *http.Client) *otlpExporter {
+	return &otlpExporter{
+		endpoint: strings.TrimSuffix(c.OTLPExporter.Endpoint, "/"),
+		headers:  c.OTLPExporter.Headers,
+		encoding: c.OTLPExporter.Encoding,
+		client:   client,
+		resource: otlpResourceFromConfig(c),
+		scope:    otlpScope{Name: otlpScopeName, Version: Version},
+	}
+}
+
+// otlpResourceFromConfig creates the resource which identifies the
+// application.  Only the first application name is used as service.name since
+// rollup names have no OTLP equivalent.
+func otlpResourceFromConfig(c config) otlpResource {
+	appName := strings.SplitN(c.AppName, ";", 2)[0]
+	attrs := []otlpKeyValue{
+		otlpKV("service.name", otlpString(appName)),
+		otlpKV("host.name", otlpString(c.hostname)),
+		otlpKV("telemetry.sdk.name", otlpString("newrelic")),
+		otlpKV("telemetry.sdk.language", otlpString(agentLanguage)),
+		otlpKV("telemetry.sdk.version", otlpString(Version)),
+	}
+	keys := make([]string, 0, len(c.Labels))
+	for key := range c.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		attrs = append(attrs, otlpKV(key, otlpString(c.Labels[key])))
+	}
+	return otlpResource{Attributes: attrs}
+}
+
+// otlpSink is the built-in HarvestSink used in place of the collector when
+// the OTLP exporter is enabled.  Unlike the collector, the receiver cannot
+// request a disconnect or a restart.
+type otlpSink struct {
+	app *app
+	exp *otlpExporter
+}
+
+func (s otlpSink) Harvest(hd *HarvestData) error {
+	for _, p := range hd.data.Payloads(false) {
+		path, data, err := s.exp.Data(p, hd.start)
+
+		if nil != err {
+			s.app.Warn("unable to create otlp data", map[string]interface{}{
+				"path":  path,
+				"error": err.Error(),
+			})
+			continue
+		}
+		if nil == data {
+			continue
+		}
+
+		requestStart := time.Now()
+		resp := s.exp.export(path, data)
+
+		diag := newDiagnosticsRequest(requestStart, "otlp", path, len(data))
+		diag.StatusCode = resp.statusCode
+		if nil != resp.Err {
+			diag.Error = resp.Err.Error()
+		}
+		diag.RetainData = resp.retry
+		s.app.diagnosticsState.recordRequest(diag)
+
+		if nil != resp.Err {
+			s.app.Warn("otlp export failure", map[string]interface{}{
+				"path":        path,
+				"error":       resp.Err.Error(),
+				"retain_data": resp.retry,
+			})
+		}
+
+		if resp.retry {
+			s.app.Consume(hd.run.Reply.RunID, p)
+		}
+	}
+	return nil
+}
+
+// otlpResponse contains the result of an export request.
+type otlpResponse struct {
+	statusCode int
+	Err        error
+	// retry is set if the data should be merged into the next harvest.
+	retry bool
+}
+
+func newOTLPResponse(statusCode int) otlpResponse {
+	resp := otlpResponse{statusCode: statusCode}
+	if statusCode < 200 || statusCode > 299 {
+		resp.Err = fmt.Errorf("response code: %d", statusCode)
+	}
+	// https://github.com/open-telemetry/opentelemetry-specification/blob/main/specification/protocol/otlp.md#retryable-response-codes
+	switch statusCode {
+	case 429, 502, 503, 504:
+		resp.retry = true
+	}
+	return resp
+}
+
+// Data returns the OTLP path and the encoded body for the payload.  A nil
+// body is returned if the payload is empty or if its data type is not
+// exported.
+func (exp *otlpExporter) Data(p payloadCreator, harvestStart time.Time) (string, []byte, error) {
+	var path string
+	var data protoMarshaler
+	var err error
+
+	switch v := p.(type) {
+	case *spanEvents:
+		path = otlpTracesPath
+		data = exp.tracesData(v)
+	case *metricTable:
+		path = otlpMetricsPath
+		data = exp.metricsData(v, harvestStart)
+	case *dimensionalMetrics:
+		path = otlpMetricsPath
+		data = exp.dimensionalMetricsData(v, harvestStart)
+	case *customEvents:
+		path = otlpLogsPath
+		data, err = exp.logsData(v.analyticsEvents)
+	case *txnEvents:
+		path = otlpLogsPath
+		data, err = exp.logsData(v.analyticsEvents)
+	case *errorEvents:
+		path = otlpLogsPath
+		data, err = exp.logsData(v.analyticsEvents)
+	case *logEvents:
+		path = otlpLogsPath
+		data = exp.logEventsData(v)
+	}
+	if nil != err || nil == data {
+		return path, nil, err
+	}
+	if OTLPEncodingJSON == exp.encoding {
+		js, err := json.Marshal(data)
+		return path, js, err
+	}
+	return path, marshalOTLPProto(data), nil
+}
+
+func (exp *otlpExporter) contentType() string {
+	if OTLPEncodingJSON == exp.encoding {
+		return "application/json"
+	}
+	return "application/x-protobuf"
+}
+
+func (exp *otlpExporter) export(path string, data []byte) otlpResponse {
+	req, err := http.NewRequest("POST", exp.endpoint+path, bytes.NewReader(data))
+	if nil != err {
+		return otlpResponse{Err: err}
+	}
+	req.Header.Add("Content-Type", exp.contentType())
+	req.Header.Add("User-Agent", userAgentPrefix+Version)
+	for key, val := range exp.headers {
+		req.Header.Set(key, val)
+	}
+
+	resp, err := exp.client.Do(req)
+	if nil != err {
+		// The receiver may be temporarily unreachable: keep the data.
+		return otlpResponse{Err: err, retry: true}
+	}
+	defer resp.Body.Close()
+	// Drain the body so that the connection can be reused.
+	io.Copy(ioutil.Discard, resp.Body)
+
+	return newOTLPResponse(resp.StatusCode)
+}
+
+func (exp *otlpExporter) tracesData(events *spanEvents) protoMarshaler {
+	if 0 == len(events.events) {
+		return nil
+	}
+	spans := make([]otlpSpan, 0, len(events.events))
+	for _, evt := range events.events {
+		if e, ok := evt.jsonWriter.(*spanEvent); ok {
+			spans = append(spans, otlpSpanFromEvent(e))
+		}
+	}
+	return otlpTracesData{ResourceSpans: []otlpResourceSpans{{
+		Resource:   exp.resource,
+		ScopeSpans: []otlpScopeSpans{{Scope: exp.scope, Spans: spans}},
+	}}}
+}
+
+// otlpID converts a New Relic trace or span ID into the lower case hex
+// representation of the given length required by OTLP.  Trace IDs received
+// from older agents may be shorter than 32 characters.
+func otlpID(id string, length int) string {
+	id = strings.ToLower(id)
+	if len(id) < length {
+		id = strings.Repeat("0", length-len(id)) + id
+	}
+	return id
+}
+
+func otlpSpanKind(e *spanEvent) int {
+	switch e.Kind {
+	case "client":
+		return otlpSpanKindClient
+	case "server":
+		return otlpSpanKindServer
+	case "producer":
+		return otlpSpanKindProducer
+	case "consumer":
+		return otlpSpanKindConsumer
+	}
+	if e.IsEntrypoint {
+		return otlpSpanKindServer
+	}
+	return otlpSpanKindInternal
+}
+
+func otlpSpanFromEvent(e *spanEvent) otlpSpan {
+	span := otlpSpan{
+		TraceID:           otlpID(e.TraceID, 32),
+		SpanID:            otlpID(e.GUID, 16),
+		Name:              e.Name,
+		Kind:              otlpSpanKind(e),
+		StartTimeUnixNano: otlpUnixNano(e.Timestamp),
+		EndTimeUnixNano:   otlpUnixNano(e.Timestamp.Add(e.Duration)),
+	}
+	if "" != e.ParentID {
+		span.ParentSpanID = otlpID(e.ParentID, 16)
+	}
+
+	attrs := []otlpKeyValue{
+		otlpKV("category", otlpString(string(e.Category))),
+		otlpKV("transactionId", otlpString(e.TransactionID)),
+		otlpKV("sampled", otlpBool(e.Sampled)),
+		otlpKV("priority", otlpDouble(float64(e.Priority.Float32()))),
+	}
+	if e.IsEntrypoint {
+		attrs = append(attrs, otlpKV("nr.entryPoint", otlpBool(true)))
+	}
+	if "" != e.Component {
+		attrs = append(attrs, otlpKV("component", otlpString(e.Component)))
+	}
+	if "" != e.TrustedParentID {
+		attrs = append(attrs, otlpKV("trustedParentId", otlpString(e.TrustedParentID)))
+	}
+	if "" != e.TracingVendors {
+		attrs = append(attrs, otlpKV("tracingVendors", otlpString(e.TracingVendors)))
+	}
+	if "" != e.TxnName {
+		attrs = append(attrs, otlpKV("transaction.name", otlpString(e.TxnName)))
+	}
+	attrs = appendOTLPSpanAttributes(attrs, e.AgentAttributes)
+	attrs = appendOTLPSpanAttributes(attrs, e.UserAttributes)
+	span.Attributes = attrs
+
+	for _, a := range e.Annotations {
+		span.Events = append(span.Events, otlpEvent{
+			TimeUnixNano: otlpUnixNano(a.Timestamp),
+			Name:         a.Name,
+			Attributes:   appendOTLPSpanAttributes(nil, a.Attributes),
+		})
+	}
+	for _, l := range e.Links {
+		span.Links = append(span.Links, otlpLink{
+			TraceID: otlpID(l.LinkedTraceID, 32),
+			SpanID:  otlpID(l.LinkedSpanID, 16),
+		})
+	}
+
+	return span
+}
+
+func appendOTLPSpanAttributes(attrs []otlpKeyValue, source spanAttributeMap) []otlpKeyValue {
+	keys := make([]string, 0, len(source))
+	for key := range source {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		var v otlpAnyValue
+		switch val := source[key].(type) {
+		case stringJSONWriter:
+			v = otlpString(string(val))
+		case intJSONWriter:
+			v = otlpInt(int64(val))
+		case boolJSONWriter:
+			v = otlpBool(bool(val))
+		case floatJSONWriter:
+			v = otlpDouble(float64(val))
+		default:
+			b := bytes.Buffer{}
+			val.WriteJSON(&b)
+			v = otlpString(strings.Trim(b.String(), `"`))
+		}
+		attrs = append(attrs, otlpKV(key, v))
+	}
+	return attrs
+}
+
+func isApdexMetric(name string) bool {
+	return name == apdexRollup || strings.HasPrefix(name, apdexPrefix)
+}
+
+// metricsData converts the metric table.  Apdex metrics become gauges with a
+// data point per zone, all other metrics become summaries whose sum is the
+// total time in seconds (or the total value for custom metrics) and whose
+// quantiles 0 and 1 are the min and max.
+func (exp *otlpExporter) metricsData(mt *metricTable, harvestStart time.Time) protoMarshaler {
+	if 0 == len(mt.metrics) {
+		return nil
+	}
+	start := otlpUnixNano(mt.metricPeriodStart)
+	end := otlpUnixNano(harvestStart)
+
+	ids := make([]metricID, 0, len(mt.metrics))
+	for id := range mt.metrics {
+		ids = append(ids, id)
+	}
+	sort.Sort(metricIDs(ids))
+
+	metrics := make([]otlpMetric, 0, len(ids))
+	for _, id := range ids {
+		data := mt.metrics[id].data
+		var attrs []otlpKeyValue
+		if "" != id.Scope {
+			attrs = append(attrs, otlpKV("scope", otlpString(id.Scope)))
+		}
+		if isApdexMetric(id.Name) {
+			points := make([]otlpNumberDataPoint, 0, 3)
+			for _, zone := range []struct {
+				name  string
+				count float64
+			}{
+				{"satisfying", data.countSatisfied},
+				{"tolerating", data.totalTolerated},
+				{"frustrating", data.exclusiveFailed},
+			} {
+				points = append(points, otlpNumberDataPoint{
+					Attributes:        append([]otlpKeyValue{otlpKV("apdex.zone", otlpString(zone.name))}, attrs...),
+					StartTimeUnixNano: start,
+					TimeUnixNano:      end,
+					AsDouble:          zone.count,
+				})
+			}
+			metrics = append(metrics, otlpMetric{Name: id.Name, Gauge: &otlpGauge{DataPoints: points}})
+			continue
+		}
+		metrics = append(metrics, otlpMetric{Name: id.Name, Summary: &otlpSummary{
+			DataPoints: []otlpSummaryDataPoint{{
+				Attributes:        attrs,
+				StartTimeUnixNano: start,
+				TimeUnixNano:      end,
+				Count:             otlpCount(data.countSatisfied),
+				Sum:               data.totalTolerated,
+				QuantileValues: []otlpQuantileValue{
+					{Quantile: 0, Value: data.min},
+					{Quantile: 1, Value: data.max},
+				},
+			}},
+		}})
+	}
+	return otlpMetricsData{ResourceMetrics: []otlpResourceMetrics{{
+		Resource:     exp.resource,
+		ScopeMetrics: []otlpScopeMetrics{{Scope: exp.scope, Metrics: metrics}},
+	}}}
+}
+
+// dimensionalMetricsData converts dimensional metrics.  Counters become
+// delta sums, gauges become gauges, and summaries become summaries whose
+// quantiles 0 and 1 are the min and max.
+func (exp *otlpExporter) dimensionalMetricsData(dm *dimensionalMetrics, harvestStart time.Time) protoMarshaler {
+	if 0 == len(dm.metrics) {
+		return nil
+	}
+	start := otlpUnixNano(dm.metricPeriodStart)
+	end := otlpUnixNano(harvestStart)
+
+	ids := make([]dimensionalMetricID, 0, len(dm.metrics))
+	for id := range dm.metrics {
+		ids = append(ids, id)
+	}
+	sort.Sort(dimensionalMetricIDs(ids))
+
+	metrics := make([]otlpMetric, 0, len(ids))
+	for _, id := range ids {
+		m := dm.metrics[id]
+		keys := make([]string, 0, len(m.attributes))
+		for key := range m.attributes {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		var attrs []otlpKeyValue
+		for _, key := range keys {
+			if v := otlpValueFromAttribute(m.attributes[key]); nil != v {
+				attrs = append(attrs, otlpKV(key, v))
+			}
+		}
+		point := otlpNumberDataPoint{
+			Attributes:        attrs,
+			StartTimeUnixNano: start,
+			TimeUnixNano:      end,
+		}
+		metric := otlpMetric{Name: id.name}
+		switch id.metricType {
+		case MetricCount:
+			point.AsDouble = m.data.sum
+			metric.Sum = &otlpSum{
+				DataPoints:             []otlpNumberDataPoint{point},
+				AggregationTemporality: otlpAggregationTemporalityDelta,
+				IsMonotonic:            true,
+			}
+		case MetricGauge:
+			point.AsDouble = m.data.last
+			metric.Gauge = &otlpGauge{DataPoints: []otlpNumberDataPoint{point}}
+		case MetricSummary:
+			metric.Summary = &otlpSummary{DataPoints: []otlpSummaryDataPoint{{
+				Attributes:        attrs,
+				StartTimeUnixNano: start,
+				TimeUnixNano:      end,
+				Count:             otlpCount(m.data.count),
+				Sum:               m.data.sum,
+				QuantileValues: []otlpQuantileValue{
+					{Quantile: 0, Value: m.data.min},
+					{Quantile: 1, Value: m.data.max},
+				},
+			}}}
+		}
+		metrics = append(metrics, metric)
+	}
+	return otlpMetricsData{ResourceMetrics: []otlpResourceMetrics{{
+		Resource:     exp.resource,
+		ScopeMetrics: []otlpScopeMetrics{{Scope: exp.scope, Metrics: metrics}},
+	}}}
+}
+
+type metricIDs []metricID
+
+func (ids metricIDs) Len() int      { return len(ids) }
+func (ids metricIDs) Swap(i, j int) { ids[i], ids[j] = ids[j], ids[i] }
+func (ids metricIDs) Less(i, j int) bool {
+	if ids[i].Name != ids[j].Name {
+		return ids[i].Name < ids[j].Name
+	}
+	return ids[i].Scope < ids[j].Scope
+}
+
+type dimensionalMetricIDs []dimensionalMetricID
+
+func (ids dimensionalMetricIDs) Len() int      { return len(ids) }
+func (ids dimensionalMetricIDs) Swap(i, j int) { ids[i], ids[j] = ids[j], ids[i] }
+func (ids dimensionalMetricIDs) Less(i, j int) bool {
+	if ids[i].name != ids[j].name {
+		return ids[i].name < ids[j].name
+	}
+	if ids[i].metricType != ids[j].metricType {
+		return ids[i].metricType < ids[j].metricType
+	}
+	return ids[i].attributes < ids[j].attributes
+}
+
+// logsData converts analytics events into log records, following the OTLP
+// convention of representing events as logs carrying an event.name
+// attribute.
+func (exp *otlpExporter) logsData(events *analyticsEvents) (protoMarshaler, error) {
+	if 0 == len(events.events) {
+		return nil, nil
+	}
+	records := make([]otlpLogRecord, 0, len(events.events))
+	for _, evt := range events.events {
+		record, err := otlpLogRecordFromEvent(evt.jsonWriter)
+		if nil != err {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return otlpLogsData{ResourceLogs: []otlpResourceLogs{{
+		Resource:  exp.resource,
+		ScopeLogs: []otlpScopeLogs{{Scope: exp.scope, LogRecords: records}},
+	}}}, nil
+}
+
+// logEventsData converts log events into log records.  Unlike analytics
+// events, the log's message is the body of the record.
+func (exp *otlpExporter) logEventsData(events *logEvents) protoMarshaler {
+	if 0 == len(events.events) {
+		return nil
+	}
+	records := make([]otlpLogRecord, 0, len(events.events))
+	for _, evt := range events.events {
+		e, ok := evt.jsonWriter.(*logEvent)
+		if !ok {
+			continue
+		}
+		record := otlpLogRecord{
+			TimeUnixNano: otlpUnixNano(e.timestamp),
+			SeverityText: e.severity,
+			Body:         otlpString(e.message),
+		}
+		if "" != e.traceID {
+			record.TraceID = otlpID(e.traceID, 32)
+		}
+		if "" != e.spanID {
+			record.SpanID = otlpID(e.spanID, 16)
+		}
+		keys := make([]string, 0, len(e.attributes))
+		for key := range e.attributes {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if v := otlpValueFromAttribute(e.attributes[key]); nil != v {
+				record.Attributes = append(record.Attributes, otlpKV(key, v))
+			}
+		}
+		records = append(records, record)
+	}
+	return otlpLogsData{ResourceLogs: []otlpResourceLogs{{
+		Resource:  exp.resource,
+		ScopeLogs: []otlpScopeLogs{{Scope: exp.scope, LogRecords: records}},
+	}}}
+}
+
+// otlpLogRecordFromEvent creates a log record whose attributes are the
+// event's intrinsics, user attributes, and agent attributes.
+func otlpLogRecordFromEvent(w jsonWriter) (otlpLogRecord, error) {
+	var record otlpLogRecord
+	fields, err := decodeEventJSON(w)
+	if nil != err {
+		return record, err
+	}
+
+	seen := make(map[string]struct{})
+	for i, m := range fields {
+		keys := make([]string, 0, len(m))
+		for key := range m {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			val := m[key]
+			if 0 == i {
+				switch key {
+				case "type":
+					s, _ := val.(string)
+					record.Body = otlpString(s)
+					record.Attributes = append(record.Attributes, otlpKV("event.name", otlpString(s)))
+					continue
+				case "timestamp":
+					ms, _ := val.(int64)
+					record.TimeUnixNano = otlpMillisToNano(ms)
+					continue
+				}
+			}
+			// Intrinsics take precedence over attributes with the
+			// same key since OTLP requires unique keys.
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			if v := otlpValueFromJSON(val); nil != v {
+				record.Attributes = append(record.Attributes, otlpKV(key, v))
+			}
+		}
+	}
+	return record, nil
+}
+
+// otlpValueFromAttribute converts a validated user attribute value, which is a
+// string, boolean, or number.
+func otlpValueFromAttribute(val interface{}) otlpAnyValue {
+	switch v := val.(type) {
+	case string:
+		return otlpString(v)
+	case bool:
+		return otlpBool(v)
+	case float32:
+		return otlpDouble(float64(v))
+	case float64:
+		return otlpDouble(v)
+	}
+	rv := reflect.ValueOf(val)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return otlpInt(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return otlpInt(int64(rv.Uint()))
+	}
+	return nil
+}
+
+func otlpValueFromJSON(val interface{}) otlpAnyValue {
+	switch v := val.(type) {
+	case string:
+		return otlpString(v)
+	case bool:
+		return otlpBool(v)
+	case int64:
+		return otlpInt(v)
+	case float64:
+		return otlpDouble(v)
+	case nil:
+		return nil
+	default:
+		js, _ := json.Marshal(v)
+		return otlpString(string(js))
+	}
+}
@@ -0,0 +1,544 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package newrelic
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// otlpReceiver is a local OTLP/HTTP receiver which records the payloads
+// posted to each path.
+type otlpReceiver struct {
+	sync.Mutex
+	payloads map[string][][]byte
+	headers  http.Header
+	code     int
+}
+
+func newOTLPReceiver() (*otlpReceiver, *httptest.Server) {
+	rcv := &otlpReceiver{payloads: make(map[string][][]byte), code: 200}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		rcv.Lock()
+		defer rcv.Unlock()
+		rcv.payloads[r.URL.Path] = append(rcv.payloads[r.URL.Path], body)
+		rcv.headers = r.Header
+		w.WriteHeader(rcv.code)
+	}))
+	return rcv, srv
+}
+
+func (rcv *otlpReceiver) get(path string) [][]byte {
+	rcv.Lock()
+	defer rcv.Unlock()
+	return rcv.payloads[path]
+}
+
+func TestOTLPExporterEndToEnd(t *testing.T) {
+	rcv, srv := newOTLPReceiver()
+	defer srv.Close()
+
+	app, err := NewApplication(
+		ConfigAppName("my app"),
+		ConfigOTLPExporter(srv.URL),
+		ConfigDistributedTracerEnabled(true),
+		func(cfg *Config) {
+			cfg.RuntimeSampler.Enabled = false
+			cfg.OTLPExporter.Headers = map[string]string{"api-key": "secret"}
+			cfg.OTLPExporter.Encoding = OTLPEncodingJSON
+		},
+	)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err := app.WaitForConnection(5 * time.Second); nil != err {
+		t.Fatal(err)
+	}
+	txn := app.StartTransaction("hello")
+	seg := txn.StartSegment("mySegment")
+	seg.AddAttribute("zip", "zap")
+	seg.End()
+	txn.End()
+	app.RecordCustomEvent("MyEvent", map[string]interface{}{"count": 3})
+	app.Shutdown(10 * time.Second)
+
+	if h := rcv.headers.Get("api-key"); h != "secret" {
+		t.Error(h)
+	}
+	if ct := rcv.headers.Get("Content-Type"); ct != "application/json" {
+		t.Error(ct)
+	}
+
+	traces := rcv.get(otlpTracesPath)
+	if len(traces) != 1 {
+		t.Fatal(len(traces))
+	}
+	var td otlpTracesData
+	if err := json.Unmarshal(traces[0], &td); nil != err {
+		t.Fatal(err)
+	}
+	rs := td.ResourceSpans[0]
+	if v := rs.Resource.Attributes[0]; v.Key != "service.name" || v.Value["stringValue"] != "my app" {
+		t.Error(v)
+	}
+	spans := rs.ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatal(len(spans))
+	}
+	byName := make(map[string]otlpSpan)
+	for _, s := range spans {
+		byName[s.Name] = s
+	}
+	root := byName["OtherTransaction/Go/hello"]
+	child := byName["Custom/mySegment"]
+	if root.Kind != otlpSpanKindServer || child.Kind != otlpSpanKindInternal {
+		t.Error(root.Kind, child.Kind)
+	}
+	if len(root.TraceID) != 32 || root.TraceID != child.TraceID {
+		t.Error(root.TraceID, child.TraceID)
+	}
+	if child.ParentSpanID != root.SpanID || "" != root.ParentSpanID {
+		t.Error(child.ParentSpanID, root.SpanID, root.ParentSpanID)
+	}
+	var foundAttr bool
+	for _, kv := range child.Attributes {
+		if kv.Key == "zip" && kv.Value["stringValue"] == "zap" {
+			foundAttr = true
+		}
+	}
+	if !foundAttr {
+		t.Error(child.Attributes)
+	}
+
+	metrics := rcv.get(otlpMetricsPath)
+	if len(metrics) != 1 {
+		t.Fatal(len(metrics))
+	}
+	var md otlpMetricsData
+	if err := json.Unmarshal(metrics[0], &md); nil != err {
+		t.Fatal(err)
+	}
+	var txnMetric *otlpMetric
+	for _, m := range md.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		if m.Name == "OtherTransaction/Go/hello" {
+			m := m
+			txnMetric = &m
+		}
+	}
+	if nil == txnMetric || nil == txnMetric.Summary || txnMetric.Summary.DataPoints[0].Count != "1" {
+		t.Error(txnMetric)
+	}
+
+	logs := rcv.get(otlpLogsPath)
+	if len(logs) != 2 {
+		t.Fatal(len(logs))
+	}
+	names := make(map[string]bool)
+	for _, js := range logs {
+		var ld otlpLogsData
+		if err := json.Unmarshal(js, &ld); nil != err {
+			t.Fatal(err)
+		}
+		for _, r := range ld.ResourceLogs[0].ScopeLogs[0].LogRecords {
+			names[r.Body["stringValue"].(string)] = true
+		}
+	}
+	if !names["Transaction"] || !names["MyEvent"] {
+		t.Error(names)
+	}
+}
+
+// protoFields contains the decoded fields of a protobuf message by field
+// number.  Varint and fixed64 values are uint64, and length delimited values
+// are []byte.
+type protoFields map[int][]interface{}
+
+func decodeProto(t *testing.T, b []byte) protoFields {
+	fields := make(protoFields)
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatal("bad tag")
+		}
+		b = b[n:]
+		field := int(key >> 3)
+		switch key & 7 {
+		case protoWireVarint:
+			x, n := binary.Uvarint(b)
+			if n <= 0 {
+				t.Fatal("bad varint")
+			}
+			fields[field] = append(fields[field], x)
+			b = b[n:]
+		case protoWireFixed64:
+			if len(b) < 8 {
+				t.Fatal("bad fixed64")
+			}
+			fields[field] = append(fields[field], binary.LittleEndian.Uint64(b))
+			b = b[8:]
+		case protoWireBytes:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < length {
+				t.Fatal("bad length")
+			}
+			fields[field] = append(fields[field], b[n:n+int(length)])
+			b = b[n+int(length):]
+		default:
+			t.Fatal("unexpected wire type", key&7)
+		}
+	}
+	return fields
+}
+
+func (f protoFields) message(t *testing.T, field int, idx int) protoFields {
+	if len(f[field]) <= idx {
+		t.Fatalf("field %d has %d values", field, len(f[field]))
+	}
+	return decodeProto(t, f[field][idx].([]byte))
+}
+
+func (f protoFields) str(field int) string {
+	if 0 == len(f[field]) {
+		return ""
+	}
+	return string(f[field][0].([]byte))
+}
+
+func TestOTLPExporterProtobuf(t *testing.T) {
+	rcv, srv := newOTLPReceiver()
+	defer srv.Close()
+
+	app, err := NewApplication(
+		ConfigAppName("my app"),
+		ConfigOTLPExporter(srv.URL),
+		ConfigDistributedTracerEnabled(true),
+		func(cfg *Config) { cfg.RuntimeSampler.Enabled = false },
+	)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err := app.WaitForConnection(5 * time.Second); nil != err {
+		t.Fatal(err)
+	}
+	txn := app.StartTransaction("hello")
+	txn.StartSegment("mySegment").End()
+	txn.End()
+	app.Shutdown(10 * time.Second)
+
+	if ct := rcv.headers.Get("Content-Type"); ct != "application/x-protobuf" {
+		t.Error(ct)
+	}
+	traces := rcv.get(otlpTracesPath)
+	if len(traces) != 1 {
+		t.Fatal(len(traces))
+	}
+	rs := decodeProto(t, traces[0]).message(t, 1, 0)
+	serviceName := rs.message(t, 1, 0).message(t, 1, 0)
+	if serviceName.str(1) != "service.name" || serviceName.message(t, 2, 0).str(1) != "my app" {
+		t.Error(serviceName)
+	}
+	ss := rs.message(t, 2, 0)
+	if ss.message(t, 1, 0).str(1) != otlpScopeName {
+		t.Error(ss)
+	}
+	byName := make(map[string]protoFields)
+	for i := range ss[2] {
+		span := ss.message(t, 2, i)
+		byName[span.str(5)] = span
+	}
+	root := byName["OtherTransaction/Go/hello"]
+	child := byName["Custom/mySegment"]
+	if nil == root || nil == child {
+		t.Fatal(byName)
+	}
+	if len(root.str(1)) != 16 || root.str(1) != child.str(1) {
+		t.Error(root[1], child[1])
+	}
+	if len(root.str(2)) != 8 || child.str(4) != root.str(2) || nil != root[4] {
+		t.Error(root[2], child[4], root[4])
+	}
+	if root[6][0].(uint64) != otlpSpanKindServer || child[6][0].(uint64) != otlpSpanKindInternal {
+		t.Error(root[6], child[6])
+	}
+	if start, end := root[7][0].(uint64), root[8][0].(uint64); 0 == start || end < start {
+		t.Error(start, end)
+	}
+}
+
+func TestOTLPProtobufValues(t *testing.T) {
+	b := protoBuffer{}
+	b.messageField(1, otlpKV("negative", otlpInt(-1)))
+	b.messageField(1, otlpKV("empty", otlpString("")))
+	b.messageField(1, otlpKV("false", otlpBool(false)))
+	b.messageField(1, otlpKV("double", otlpDouble(1.5)))
+	b.messageField(2, otlpNumberDataPoint{StartTimeUnixNano: "1", TimeUnixNano: "2"})
+	b.messageField(3, otlpSum{AggregationTemporality: otlpAggregationTemporalityDelta, IsMonotonic: true})
+	fields := decodeProto(t, b.buf)
+
+	negative := fields.message(t, 1, 0).message(t, 2, 0)
+	if int64(negative[3][0].(uint64)) != -1 {
+		t.Error(negative)
+	}
+	// Values of a oneof are present even when they are the zero value.
+	if empty := fields.message(t, 1, 1).message(t, 2, 0); 1 != len(empty[1]) || "" != empty.str(1) {
+		t.Error(empty)
+	}
+	if f := fields.message(t, 1, 2).message(t, 2, 0); 1 != len(f[2]) || 0 != f[2][0].(uint64) {
+		t.Error(f)
+	}
+	if d := fields.message(t, 1, 3).message(t, 2, 0); math.Float64frombits(d[4][0].(uint64)) != 1.5 {
+		t.Error(d)
+	}
+	point := fields.message(t, 2, 0)
+	if 1 != point[2][0].(uint64) || 2 != point[3][0].(uint64) || 1 != len(point[4]) || 0 != point[4][0].(uint64) {
+		t.Error(point)
+	}
+	sum := fields.message(t, 3, 0)
+	if otlpAggregationTemporalityDelta != sum[2][0].(uint64) || 1 != len(sum[3]) || 1 != sum[3][0].(uint64) {
+		t.Error(sum)
+	}
+}
+
+func TestOTLPExporterRetry(t *testing.T) {
+	rcv, srv := newOTLPReceiver()
+	defer srv.Close()
+	rcv.code = 503
+
+	cfg := config{Config: defaultConfig()}
+	cfg.OTLPExporter.Endpoint = srv.URL + "/"
+	exp := newOTLPExporter(cfg, &http.Client{})
+
+	resp := exp.export(otlpLogsPath, []byte(`{}`))
+	if nil == resp.Err || !resp.retry {
+		t.Error(resp)
+	}
+	if len(rcv.get(otlpLogsPath)) != 1 {
+		t.Error("trailing slash of endpoint not removed")
+	}
+}
+
+func TestNewOTLPResponse(t *testing.T) {
+	testcases := []struct {
+		code  int
+		isErr bool
+		retry bool
+	}{
+		{code: 200, isErr: false, retry: false},
+		{code: 202, isErr: false, retry: false},
+		{code: 400, isErr: true, retry: false},
+		{code: 429, isErr: true, retry: true},
+		{code: 500, isErr: true, retry: false},
+		{code: 502, isErr: true, retry: true},
+		{code: 503, isErr: true, retry: true},
+		{code: 504, isErr: true, retry: true},
+	}
+	for _, tc := range testcases {
+		resp := newOTLPResponse(tc.code)
+		if (nil != resp.Err) != tc.isErr || resp.retry != tc.retry {
+			t.Error(tc.code, resp)
+		}
+	}
+}
+
+func TestOTLPSpanFromEvent(t *testing.T) {
+	start := time.Unix(1577836800, 0)
+	e := &spanEvent{
+		TraceID:   "ABCDEF0123456789",
+		GUID:      "1234",
+		ParentID:  "5678",
+		Timestamp: start,
+		Duration:  2 * time.Second,
+		Name:      "External/example.com/http/GET",
+		Category:  spanCategoryHTTP,
+		Kind:      "client",
+	}
+	span := otlpSpanFromEvent(e)
+	if span.TraceID != "0000000000000000abcdef0123456789" {
+		t.Error(span.TraceID)
+	}
+	if span.SpanID != "0000000000001234" || span.ParentSpanID != "0000000000005678" {
+		t.Error(span.SpanID, span.ParentSpanID)
+	}
+	if span.Kind != otlpSpanKindClient {
+		t.Error(span.Kind)
+	}
+	if span.StartTimeUnixNano != "1577836800000000000" || span.EndTimeUnixNano != "1577836802000000000" {
+		t.Error(span.StartTimeUnixNano, span.EndTimeUnixNano)
+	}
+}
+
+func TestOTLPLogRecordFromEvent(t *testing.T) {
+	e, err := createCustomEvent("MyEvent", map[string]interface{}{
+		"str":   "hello",
+		"int":   5,
+		"float": 1.5,
+		"bool":  true,
+	}, time.Unix(1577836800, 0))
+	if nil != err {
+		t.Fatal(err)
+	}
+	record, err := otlpLogRecordFromEvent(e)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if record.TimeUnixNano != "1577836800000000000" {
+		t.Error(record.TimeUnixNano)
+	}
+	if record.Body["stringValue"] != "MyEvent" {
+		t.Error(record.Body)
+	}
+	js, _ := json.Marshal(record.Attributes)
+	expect := `[{"key":"event.name","value":{"stringValue":"MyEvent"}},` +
+		`{"key":"bool","value":{"boolValue":true}},` +
+		`{"key":"float","value":{"doubleValue":1.5}},` +
+		`{"key":"int","value":{"intValue":"5"}},` +
+		`{"key":"str","value":{"stringValue":"hello"}}]`
+	if string(js) != expect {
+		t.Error(string(js))
+	}
+}
+
+func TestOTLPMetricsData(t *testing.T) {
+	now := time.Now()
+	mt := newMetricTable(100, now)
+	mt.addDuration("WebTransaction/Go/hello", "", 2*time.Second, time.Second, forced)
+	mt.addDuration("Custom/seg", "WebTransaction/Go/hello", time.Second, time.Second, forced)
+	mt.addApdex(apdexRollup, "", 500*time.Millisecond, apdexTolerating, forced)
+
+	exp := newOTLPExporter(config{Config: defaultConfig()}, &http.Client{})
+	md := exp.metricsData(mt, now.Add(time.Minute)).(otlpMetricsData)
+	metrics := md.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	if len(metrics) != 3 {
+		t.Fatal(len(metrics))
+	}
+	// Metrics are sorted by name.
+	apdex := metrics[0]
+	if apdex.Name != apdexRollup || nil == apdex.Gauge || len(apdex.Gauge.DataPoints) != 3 {
+		t.Fatal(apdex)
+	}
+	if tolerating := apdex.Gauge.DataPoints[1]; tolerating.AsDouble != 1 || tolerating.Attributes[0].Value["stringValue"] != "tolerating" {
+		t.Error(tolerating)
+	}
+	scoped := metrics[1]
+	if scoped.Name != "Custom/seg" || scoped.Summary.DataPoints[0].Attributes[0].Value["stringValue"] != "WebTransaction/Go/hello" {
+		t.Error(scoped)
+	}
+	txn := metrics[2].Summary.DataPoints[0]
+	if txn.Count != "1" || txn.Sum != 2 || txn.QuantileValues[0].Value != 2 || txn.QuantileValues[1].Value != 2 {
+		t.Error(txn)
+	}
+}
+
+func TestOTLPSpanEventsAndLinks(t *testing.T) {
+	e := &spanEvent{
+		TraceID:   "abcdef0123456789",
+		GUID:      "1234",
+		Timestamp: time.Unix(1577836800, 0),
+		Annotations: []spanAnnotation{{
+			Name:      "retry",
+			Timestamp: time.Unix(1577836801, 0),
+		}},
+		Links: []spanLink{{
+			LinkedTraceID: "FEDCBA",
+			LinkedSpanID:  "5678",
+		}},
+	}
+	e.Annotations[0].Attributes.addInt("attempt", 2)
+	span := otlpSpanFromEvent(e)
+	if len(span.Events) != 1 || span.Events[0].Name != "retry" ||
+		span.Events[0].TimeUnixNano != "1577836801000000000" || len(span.Events[0].Attributes) != 1 {
+		t.Error(span.Events)
+	}
+	if len(span.Links) != 1 || span.Links[0].TraceID != "00000000000000000000000000fedcba" ||
+		span.Links[0].SpanID != "0000000000005678" {
+		t.Error(span.Links)
+	}
+}
+
+func TestOTLPLogEventsData(t *testing.T) {
+	events := newLogEvents(10, nil)
+	events.Add(&logEvent{
+		timestamp:  time.Unix(1577836800, 0),
+		severity:   "WARN",
+		message:    "careful",
+		traceID:    "abcdef",
+		spanID:     "1234",
+		attributes: map[string]interface{}{"count": uint8(3), "user": "jim"},
+	})
+	exp := newOTLPExporter(config{Config: defaultConfig()}, &http.Client{})
+	exp.encoding = OTLPEncodingJSON
+	path, js, err := exp.Data(events, time.Now())
+	if nil != err || path != otlpLogsPath {
+		t.Fatal(path, err)
+	}
+	var data otlpLogsData
+	if err := json.Unmarshal(js, &data); nil != err {
+		t.Fatal(err)
+	}
+	record := data.ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+	if record.TimeUnixNano != "1577836800000000000" || record.SeverityText != "WARN" ||
+		record.Body["stringValue"] != "careful" {
+		t.Error(record)
+	}
+	if record.TraceID != "00000000000000000000000000abcdef" || record.SpanID != "0000000000001234" {
+		t.Error(record.TraceID, record.SpanID)
+	}
+	attrs, _ := json.Marshal(record.Attributes)
+	if string(attrs) != `[{"key":"count","value":{"intValue":"3"}},{"key":"user","value":{"stringValue":"jim"}}]` {
+		t.Error(string(attrs))
+	}
+}
+
+func TestOTLPDimensionalMetricsData(t *testing.T) {
+	now := time.Now()
+	dm := newDimensionalMetrics(now)
+	dm.add("orders", MetricCount, 2, map[string]interface{}{"region": "us"})
+	dm.add("orders", MetricCount, 3, map[string]interface{}{"region": "us"})
+	dm.add("queue", MetricGauge, 7, nil)
+	dm.add("latency", MetricSummary, 1, nil)
+	dm.add("latency", MetricSummary, 3, nil)
+
+	exp := newOTLPExporter(config{Config: defaultConfig()}, &http.Client{})
+	exp.encoding = OTLPEncodingJSON
+	path, js, err := exp.Data(dm, now.Add(time.Minute))
+	if nil != err || path != otlpMetricsPath {
+		t.Fatal(path, err)
+	}
+	var md otlpMetricsData
+	if err := json.Unmarshal(js, &md); nil != err {
+		t.Fatal(err)
+	}
+	metrics := md.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	if len(metrics) != 3 {
+		t.Fatal(len(metrics))
+	}
+	// Series are sorted by name.
+	summary := metrics[0]
+	if summary.Name != "latency" || nil == summary.Summary {
+		t.Fatal(summary)
+	}
+	if p := summary.Summary.DataPoints[0]; p.Count != "2" || p.Sum != 4 ||
+		p.QuantileValues[0].Value != 1 || p.QuantileValues[1].Value != 3 {
+		t.Error(p)
+	}
+	sum := metrics[1]
+	if sum.Name != "orders" || nil == sum.Sum || sum.Sum.AggregationTemporality != otlpAggregationTemporalityDelta || !sum.Sum.IsMonotonic {
+		t.Fatal(sum)
+	}
+	if p := sum.Sum.DataPoints[0]; p.AsDouble != 5 || p.Attributes[0].Key != "region" {
+		t.Error(p)
+	}
+	gauge := metrics[2]
+	if gauge.Name != "queue" || nil == gauge.Gauge || gauge.Gauge.DataPoints[0].AsDouble != 7 {
+		t.Error(gauge)
+	}
+}
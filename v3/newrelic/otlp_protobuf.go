@@ -0,0 +1,325 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package newrelic
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"strconv"
+)
+
+// This file contains the OTLP protobuf encoding of the types used for the
+// JSON encoding.  The field numbers are those of the opentelemetry.proto
+// messages:
+// https://github.com/open-telemetry/opentelemetry-proto/tree/main/opentelemetry/proto
+
+const (
+	protoWireVarint  = 0
+	protoWireFixed64 = 1
+	protoWireBytes   = 2
+)
+
+// protoBuffer appends protobuf encoded fields.  Fields with a zero value are
+// omitted, as proto3 does.
+type protoBuffer struct {
+	buf []byte
+}
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.buf = append(b.buf, byte(x)|0x80)
+		x >>= 7
+	}
+	b.buf = append(b.buf, byte(x))
+}
+
+func (b *protoBuffer) tag(field int, wireType int) {
+	b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (b *protoBuffer) uintField(field int, x uint64) {
+	if 0 == x {
+		return
+	}
+	b.tag(field, protoWireVarint)
+	b.varint(x)
+}
+
+func (b *protoBuffer) boolField(field int, x bool) {
+	if x {
+		b.uintField(field, 1)
+	}
+}
+
+func (b *protoBuffer) fixed64(x uint64) {
+	var tmp [8]byte
+	binary.LittleEndian.PutUint64(tmp[:], x)
+	b.buf = append(b.buf, tmp[:]...)
+}
+
+func (b *protoBuffer) fixed64Field(field int, x uint64) {
+	if 0 == x {
+		return
+	}
+	b.tag(field, protoWireFixed64)
+	b.fixed64(x)
+}
+
+func (b *protoBuffer) doubleField(field int, x float64) {
+	b.fixed64Field(field, math.Float64bits(x))
+}
+
+func (b *protoBuffer) bytesField(field int, x []byte) {
+	if 0 == len(x) {
+		return
+	}
+	b.tag(field, protoWireBytes)
+	b.varint(uint64(len(x)))
+	b.buf = append(b.buf, x...)
+}
+
+func (b *protoBuffer) stringField(field int, x string) {
+	b.bytesField(field, []byte(x))
+}
+
+// messageField appends an embedded message, even if it is empty.
+func (b *protoBuffer) messageField(field int, m protoMarshaler) {
+	inner := protoBuffer{}
+	m.marshalProto(&inner)
+	b.tag(field, protoWireBytes)
+	b.varint(uint64(len(inner.buf)))
+	b.buf = append(b.buf, inner.buf...)
+}
+
+// hexField appends a trace or span ID, which OTLP encodes as bytes.
+func (b *protoBuffer) hexField(field int, id string) {
+	decoded, _ := hex.DecodeString(id)
+	b.bytesField(field, decoded)
+}
+
+// decimalField appends a fixed64 field, such as a time in nanoseconds or a
+// count, which the JSON types hold as a decimal string.
+func (b *protoBuffer) decimalField(field int, nanos string) {
+	x, _ := strconv.ParseUint(nanos, 10, 64)
+	b.fixed64Field(field, x)
+}
+
+type protoMarshaler interface {
+	marshalProto(b *protoBuffer)
+}
+
+// marshalOTLPProto returns the protobuf encoding of the data.
+func marshalOTLPProto(m protoMarshaler) []byte {
+	b := protoBuffer{}
+	m.marshalProto(&b)
+	return b.buf
+}
+
+func (v otlpAnyValue) marshalProto(b *protoBuffer) {
+	for key, val := range v {
+		switch key {
+		case "stringValue":
+			s, _ := val.(string)
+			// An empty string must still be set in the oneof.
+			b.tag(1, protoWireBytes)
+			b.varint(uint64(len(s)))
+			b.buf = append(b.buf, s...)
+		case "boolValue":
+			x, _ := val.(bool)
+			b.tag(2, protoWireVarint)
+			if x {
+				b.varint(1)
+			} else {
+				b.varint(0)
+			}
+		case "intValue":
+			s, _ := val.(string)
+			x, _ := strconv.ParseInt(s, 10, 64)
+			b.tag(3, protoWireVarint)
+			b.varint(uint64(x))
+		case "doubleValue":
+			x, _ := val.(float64)
+			b.tag(4, protoWireFixed64)
+			b.fixed64(math.Float64bits(x))
+		}
+	}
+}
+
+func (kv otlpKeyValue) marshalProto(b *protoBuffer) {
+	b.stringField(1, kv.Key)
+	b.messageField(2, kv.Value)
+}
+
+func marshalProtoAttributes(b *protoBuffer, field int, attrs []otlpKeyValue) {
+	for _, kv := range attrs {
+		b.messageField(field, kv)
+	}
+}
+
+func (r otlpResource) marshalProto(b *protoBuffer) {
+	marshalProtoAttributes(b, 1, r.Attributes)
+}
+
+func (s otlpScope) marshalProto(b *protoBuffer) {
+	b.stringField(1, s.Name)
+	b.stringField(2, s.Version)
+}
+
+func (td otlpTracesData) marshalProto(b *protoBuffer) {
+	for _, rs := range td.ResourceSpans {
+		b.messageField(1, rs)
+	}
+}
+
+func (rs otlpResourceSpans) marshalProto(b *protoBuffer) {
+	b.messageField(1, rs.Resource)
+	for _, ss := range rs.ScopeSpans {
+		b.messageField(2, ss)
+	}
+}
+
+func (ss otlpScopeSpans) marshalProto(b *protoBuffer) {
+	b.messageField(1, ss.Scope)
+	for _, s := range ss.Spans {
+		b.messageField(2, s)
+	}
+}
+
+func (s otlpSpan) marshalProto(b *protoBuffer) {
+	b.hexField(1, s.TraceID)
+	b.hexField(2, s.SpanID)
+	b.hexField(4, s.ParentSpanID)
+	b.stringField(5, s.Name)
+	b.uintField(6, uint64(s.Kind))
+	b.decimalField(7, s.StartTimeUnixNano)
+	b.decimalField(8, s.EndTimeUnixNano)
+	marshalProtoAttributes(b, 9, s.Attributes)
+	for _, e := range s.Events {
+		b.messageField(11, e)
+	}
+	for _, l := range s.Links {
+		b.messageField(13, l)
+	}
+}
+
+func (e otlpEvent) marshalProto(b *protoBuffer) {
+	b.decimalField(1, e.TimeUnixNano)
+	b.stringField(2, e.Name)
+	marshalProtoAttributes(b, 3, e.Attributes)
+}
+
+func (l otlpLink) marshalProto(b *protoBuffer) {
+	b.hexField(1, l.TraceID)
+	b.hexField(2, l.SpanID)
+}
+
+func (md otlpMetricsData) marshalProto(b *protoBuffer) {
+	for _, rm := range md.ResourceMetrics {
+		b.messageField(1, rm)
+	}
+}
+
+func (rm otlpResourceMetrics) marshalProto(b *protoBuffer) {
+	b.messageField(1, rm.Resource)
+	for _, sm := range rm.ScopeMetrics {
+		b.messageField(2, sm)
+	}
+}
+
+func (sm otlpScopeMetrics) marshalProto(b *protoBuffer) {
+	b.messageField(1, sm.Scope)
+	for _, m := range sm.Metrics {
+		b.messageField(2, m)
+	}
+}
+
+func (m otlpMetric) marshalProto(b *protoBuffer) {
+	b.stringField(1, m.Name)
+	if nil != m.Gauge {
+		b.messageField(5, *m.Gauge)
+	}
+	if nil != m.Sum {
+		b.messageField(7, *m.Sum)
+	}
+	if nil != m.Summary {
+		b.messageField(11, *m.Summary)
+	}
+}
+
+func (g otlpGauge) marshalProto(b *protoBuffer) {
+	for _, p := range g.DataPoints {
+		b.messageField(1, p)
+	}
+}
+
+func (s otlpSum) marshalProto(b *protoBuffer) {
+	for _, p := range s.DataPoints {
+		b.messageField(1, p)
+	}
+	b.uintField(2, uint64(s.AggregationTemporality))
+	b.boolField(3, s.IsMonotonic)
+}
+
+func (s otlpSummary) marshalProto(b *protoBuffer) {
+	for _, p := range s.DataPoints {
+		b.messageField(1, p)
+	}
+}
+
+func (p otlpNumberDataPoint) marshalProto(b *protoBuffer) {
+	b.decimalField(2, p.StartTimeUnixNano)
+	b.decimalField(3, p.TimeUnixNano)
+	// as_double is a member of a oneof, so it is set even when zero.
+	b.tag(4, protoWireFixed64)
+	b.fixed64(math.Float64bits(p.AsDouble))
+	marshalProtoAttributes(b, 7, p.Attributes)
+}
+
+func (p otlpSummaryDataPoint) marshalProto(b *protoBuffer) {
+	b.decimalField(2, p.StartTimeUnixNano)
+	b.decimalField(3, p.TimeUnixNano)
+	b.decimalField(4, p.Count)
+	b.doubleField(5, p.Sum)
+	for _, q := range p.QuantileValues {
+		b.messageField(6, q)
+	}
+	marshalProtoAttributes(b, 7, p.Attributes)
+}
+
+func (q otlpQuantileValue) marshalProto(b *protoBuffer) {
+	b.doubleField(1, q.Quantile)
+	b.doubleField(2, q.Value)
+}
+
+func (ld otlpLogsData) marshalProto(b *protoBuffer) {
+	for _, rl := range ld.ResourceLogs {
+		b.messageField(1, rl)
+	}
+}
+
+func (rl otlpResourceLogs) marshalProto(b *protoBuffer) {
+	b.messageField(1, rl.Resource)
+	for _, sl := range rl.ScopeLogs {
+		b.messageField(2, sl)
+	}
+}
+
+func (sl otlpScopeLogs) marshalProto(b *protoBuffer) {
+	b.messageField(1, sl.Scope)
+	for _, r := range sl.LogRecords {
+		b.messageField(2, r)
+	}
+}
+
+func (r otlpLogRecord) marshalProto(b *protoBuffer) {
+	b.decimalField(1, r.TimeUnixNano)
+	b.stringField(3, r.SeverityText)
+	if nil != r.Body {
+		b.messageField(5, r.Body)
+	}
+	marshalProtoAttributes(b, 6, r.Attributes)
+	b.hexField(9, r.TraceID)
+	b.hexField(10, r.SpanID)
+}
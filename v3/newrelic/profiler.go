@@ -0,0 +1,210 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package newrelic
+
+import (
+	"bytes"
+	"runtime"
+	"runtime/pprof"
+	"sync/atomic"
+	"time"
+)
+
+// ProfileType is a type of runtime/pprof profile captured by the continuous
+// profiler configured in Config.Profiling.
+type ProfileType string
+
+const (
+	// ProfileCPU is a CPU profile sampled for Config.Profiling.CPUDuration.
+	ProfileCPU ProfileType = "cpu"
+	// ProfileHeap is a sampling of the memory allocations of live objects.
+	ProfileHeap ProfileType = "heap"
+	// ProfileMutex contains the stack traces of holders of contended
+	// mutexes.  It is empty unless Config.Profiling.MutexProfileFraction
+	// or runtime.SetMutexProfileFraction enables it.
+	ProfileMutex ProfileType = "mutex"
+	// ProfileBlock contains the stack traces that led to blocking on
+	// synchronization primitives.  It is empty unless
+	// Config.Profiling.BlockProfileRate or runtime.SetBlockProfileRate
+	// enables it.
+	ProfileBlock ProfileType = "block"
+	// ProfileGoroutine contains the stack traces of all current goroutines.
+	ProfileGoroutine ProfileType = "goroutine"
+)
+
+// These are the keys of the pprof labels set on goroutines when
+// Config.ProfilerLabels is enabled.
+const (
+	profilerLabelTransaction = "transaction"
+	profilerLabelSegment     = "segment"
+	profilerLabelTraceID     = "trace.id"
+)
+
+// profileRecord is a harvestable containing a captured profile.
+type profileRecord struct {
+	profile HarvestProfile
+}
+
+// MergeIntoHarvest implements harvestable.
+func (r profileRecord) MergeIntoHarvest(h *harvest) {
+	h.Profiles.add(r.profile)
+}
+
+// harvestProfiles contains the profiles captured during a harvest period.
+// Profiles beyond the limit are dropped and counted.
+type harvestProfiles struct {
+	max        int
+	profiles   []HarvestProfile
+	numDropped int
+}
+
+func newHarvestProfiles(max int) *harvestProfiles {
+	return &harvestProfiles{max: max}
+}
+
+func (hp *harvestProfiles) add(p HarvestProfile) {
+	if len(hp.profiles) >= hp.max {
+		hp.numDropped++
+		return
+	}
+	hp.profiles = append(hp.profiles, p)
+}
+
+// profileTrigger identifies the slow transaction which triggered a capture.
+type profileTrigger struct {
+	name    string
+	traceID string
+}
+
+// profiler captures the profiles of Config.Profiling every period, and when a
+// transaction exceeds the slow transaction threshold.
+type profiler struct {
+	// capturing and lastTriggered are first to ensure 64 bit alignment for
+	// atomic operations.  capturing is 1 while profiles are captured:  Only
+	// one CPU profile can be active in a process.  lastTriggered is the
+	// UnixNano time of the last capture triggered by a transaction.
+	capturing     int32
+	lastTriggered int64
+
+	app           *app
+	types         []ProfileType
+	period        time.Duration
+	cpuDuration   time.Duration
+	slowThreshold time.Duration
+}
+
+func newProfiler(app *app) *profiler {
+	cfg := app.config.Profiling
+	if cfg.MutexProfileFraction > 0 {
+		runtime.SetMutexProfileFraction(cfg.MutexProfileFraction)
+	}
+	if cfg.BlockProfileRate > 0 {
+		runtime.SetBlockProfileRate(cfg.BlockProfileRate)
+	}
+	return &profiler{
+		app:           app,
+		types:         cfg.Types,
+		period:        cfg.Period,
+		cpuDuration:   cfg.CPUDuration,
+		slowThreshold: cfg.SlowTransactionThreshold,
+	}
+}
+
+// run captures profiles every period until shutdown.
+func (p *profiler) run() {
+	t := time.NewTicker(p.period)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if atomic.CompareAndSwapInt32(&p.capturing, 0, 1) {
+				p.capture(nil)
+			}
+		case <-p.app.shutdownStarted:
+			return
+		}
+	}
+}
+
+// transactionEnded triggers a capture if the transaction is slow, unless a
+// capture is in progress or a capture was triggered less than a period ago.
+// It is nil-safe.
+func (p *profiler) transactionEnded(name, traceID string, duration time.Duration, now time.Time) {
+	if nil == p || p.slowThreshold <= 0 || duration < p.slowThreshold {
+		return
+	}
+	last := atomic.LoadInt64(&p.lastTriggered)
+	if now.UnixNano()-last < int64(p.period) {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&p.capturing, 0, 1) {
+		return
+	}
+	atomic.StoreInt64(&p.lastTriggered, now.UnixNano())
+	go p.capture(&profileTrigger{name: name, traceID: traceID})
+}
+
+// capture captures each type of profile and consumes the profiles.  The
+// capturing flag must be set by the caller, and is cleared on return.
+func (p *profiler) capture(trigger *profileTrigger) {
+	defer atomic.StoreInt32(&p.capturing, 0)
+
+	for _, tp := range p.types {
+		start := time.Now()
+		data, duration, err := p.captureProfile(tp)
+		if nil != err {
+			p.app.Debug("unable to capture profile", map[string]interface{}{
+				"type":  string(tp),
+				"error": err.Error(),
+			})
+			continue
+		}
+		if nil == data {
+			// Shutdown started during the CPU profile.
+			return
+		}
+		profile := HarvestProfile{
+			Type:     tp,
+			Start:    start,
+			Duration: duration,
+			Data:     data,
+		}
+		if nil != trigger {
+			profile.TransactionName = trigger.name
+			profile.TraceID = trigger.traceID
+		}
+		run, _ := p.app.getState()
+		p.app.Consume(run.Reply.RunID, profileRecord{profile: profile})
+	}
+}
+
+// captureProfile returns the profile in the gzip-compressed protocol buffer
+// format, or nil data if shutdown started while the CPU profile was sampled.
+func (p *profiler) captureProfile(tp ProfileType) ([]byte, time.Duration, error) {
+	buf := &bytes.Buffer{}
+	if ProfileCPU == tp {
+		if err := pprof.StartCPUProfile(buf); nil != err {
+			return nil, 0, err
+		}
+		start := time.Now()
+		timer := time.NewTimer(p.cpuDuration)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-p.app.shutdownStarted:
+			pprof.StopCPUProfile()
+			return nil, 0, nil
+		}
+		pprof.StopCPUProfile()
+		return buf.Bytes(), time.Since(start), nil
+	}
+	prof := pprof.Lookup(string(tp))
+	if nil == prof {
+		return nil, 0, errUnknownProfileType
+	}
+	if err := prof.WriteTo(buf, 0); nil != err {
+		return nil, 0, err
+	}
+	return buf.Bytes(), 0, nil
+}
@@ -0,0 +1,23 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// +build go1.9
+
+package newrelic
+
+import (
+	"context"
+	"runtime/pprof"
+)
+
+// setGoroutineProfilerLabels sets the labels, added to those of the context,
+// on the calling goroutine.
+func setGoroutineProfilerLabels(ctx context.Context, labels []string) {
+	pprof.SetGoroutineLabels(pprof.WithLabels(ctx, pprof.Labels(labels...)))
+}
+
+// restoreGoroutineProfilerLabels sets the labels of the context on the
+// calling goroutine.
+func restoreGoroutineProfilerLabels(ctx context.Context) {
+	pprof.SetGoroutineLabels(ctx)
+}
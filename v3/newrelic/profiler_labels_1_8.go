@@ -0,0 +1,14 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// +build !go1.9
+
+package newrelic
+
+import "context"
+
+// Goroutine labels were added to runtime/pprof in Go 1.9.
+
+func setGoroutineProfilerLabels(ctx context.Context, labels []string) {}
+
+func restoreGoroutineProfilerLabels(ctx context.Context) {}
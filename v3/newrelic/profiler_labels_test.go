@@ -0,0 +1,214 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// +build go1.9
+
+package newrelic
+
+import (
+	"bytes"
+	"context"
+	"runtime/pprof"
+	"strings"
+	"testing"
+)
+
+// goroutineLabels returns the goroutine profile, in which the labels of each
+// goroutine are listed.
+func goroutineLabels(t *testing.T) string {
+	buf := &bytes.Buffer{}
+	if err := pprof.Lookup("goroutine").WriteTo(buf, 1); nil != err {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func expectLabels(t *testing.T, present []string, absent []string) {
+	labels := goroutineLabels(t)
+	for _, l := range present {
+		if !strings.Contains(labels, l) {
+			t.Errorf("label %s missing: %s", l, labels)
+		}
+	}
+	for _, l := range absent {
+		if strings.Contains(labels, l) {
+			t.Errorf("label %s present: %s", l, labels)
+		}
+	}
+}
+
+func TestProfilerLabels(t *testing.T) {
+	tapp := testApp(distributedTracingReplyFields, func(cfg *Config) {
+		enableBetterCAT(cfg)
+		ConfigProfilerLabels(true)(cfg)
+	}, t)
+	txn := tapp.StartTransaction("hello")
+	traceID := `"trace.id":"` + txn.GetTraceMetadata().TraceID + `"`
+	expectLabels(t, []string{`"transaction":"hello"`, traceID}, []string{`"segment"`})
+
+	outer := txn.StartSegment("outer")
+	inner := txn.StartSegment("inner")
+	expectLabels(t, []string{`"segment":"inner"`, traceID}, []string{`"segment":"outer"`})
+	inner.End()
+	expectLabels(t, []string{`"segment":"outer"`}, []string{`"segment":"inner"`})
+	outer.End()
+	expectLabels(t, []string{`"transaction":"hello"`}, []string{`"segment"`})
+
+	txn.End()
+	expectLabels(t, nil, []string{`"transaction":"hello"`})
+}
+
+func TestProfilerLabelsOutOfOrder(t *testing.T) {
+	tapp := testApp(nil, ConfigProfilerLabels(true), t)
+	txn := tapp.StartTransaction("hello")
+	outer := txn.StartSegment("outer")
+	inner := txn.StartSegment("inner")
+	outer.End()
+	expectLabels(t, []string{`"transaction":"hello"`}, []string{`"segment"`})
+	inner.End()
+	expectLabels(t, []string{`"transaction":"hello"`}, []string{`"segment"`})
+	txn.End()
+}
+
+func TestProfilerLabelsNewGoroutine(t *testing.T) {
+	tapp := testApp(nil, ConfigProfilerLabels(true), t)
+	txn := tapp.StartTransaction("hello")
+	done := make(chan struct{})
+	go func(txn *Transaction) {
+		defer close(done)
+		s := txn.StartSegment("async")
+		expectLabels(t, []string{`"segment":"async"`}, nil)
+		s.End()
+		expectLabels(t, []string{`"transaction":"hello"`}, []string{`"segment":"async"`})
+	}(txn.NewGoroutine())
+	<-done
+	txn.End()
+}
+
+// labelsOf returns the labels of the goroutine whose stack contains the
+// function, as listed in the goroutine profile.
+func labelsOf(t *testing.T, function string) string {
+	for _, record := range strings.Split(goroutineLabels(t), "\n\n") {
+		if !strings.Contains(record, function) {
+			continue
+		}
+		for _, line := range strings.Split(record, "\n") {
+			if strings.HasPrefix(line, "# labels: ") {
+				return strings.TrimPrefix(line, "# labels: ")
+			}
+		}
+		return ""
+	}
+	t.Fatal("goroutine not found", function)
+	return ""
+}
+
+//go:noinline
+func parkProfilerLabelsWorker(parked chan<- struct{}, release <-chan struct{}) {
+	parked <- struct{}{}
+	<-release
+}
+
+func TestProfilerLabelsNewGoroutineRestored(t *testing.T) {
+	tapp := testApp(nil, ConfigProfilerLabels(true), t)
+	txn := tapp.StartTransaction("checkout")
+	parked := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	// The worker inherits the labels of the transaction when it is
+	// created, as a pooled worker would keep them from an earlier task.
+	go func(g *Transaction) {
+		defer close(done)
+		g.StartSegment("work").End()
+		parkProfilerLabelsWorker(parked, release)
+	}(txn.NewGoroutine())
+	<-parked
+	if labels := labelsOf(t, "parkProfilerLabelsWorker"); "" != labels {
+		t.Error(labels)
+	}
+	close(release)
+	<-done
+	txn.End()
+}
+
+func TestProfilerLabelsRestoredOnRepanic(t *testing.T) {
+	tapp := testApp(nil, func(cfg *Config) {
+		ConfigProfilerLabels(true)(cfg)
+		cfg.ErrorCollector.RecordPanics = true
+	}, t)
+	pprof.Do(context.Background(), pprof.Labels("user", "mine"), func(ctx context.Context) {
+		func() {
+			defer func() { recover() }()
+			txn := tapp.StartTransaction("hello")
+			txn.SetProfilerLabelsContext(ctx)
+			defer txn.End()
+			panic("oops")
+		}()
+		expectLabels(t, []string{`"user":"mine"`}, []string{`"transaction":"hello"`})
+	})
+}
+
+func TestProfilerLabelsSegmentEndedAfterTransaction(t *testing.T) {
+	tapp := testApp(nil, ConfigProfilerLabels(true), t)
+	txn := tapp.StartTransaction("hello")
+	started := make(chan struct{})
+	ended := make(chan struct{})
+	done := make(chan struct{})
+	go func(txn *Transaction) {
+		defer close(done)
+		s := txn.StartSegment("async")
+		close(started)
+		<-ended
+		s.End()
+		expectLabels(t, nil, []string{`"transaction":"hello"`})
+	}(txn.NewGoroutine())
+	<-started
+	txn.End()
+	close(ended)
+	<-done
+}
+
+func TestProfilerLabelsContext(t *testing.T) {
+	tapp := testApp(nil, ConfigProfilerLabels(true), t)
+	pprof.Do(context.Background(), pprof.Labels("user", "mine"), func(ctx context.Context) {
+		txn := tapp.StartTransaction("hello")
+		txn.SetProfilerLabelsContext(ctx)
+		expectLabels(t, []string{`"user":"mine"`, `"transaction":"hello"`}, nil)
+
+		s := txn.StartSegment("segment")
+		expectLabels(t, []string{`"user":"mine"`, `"segment":"segment"`}, nil)
+		s.End()
+		expectLabels(t, []string{`"user":"mine"`, `"transaction":"hello"`}, []string{`"segment"`})
+
+		txn.End()
+		expectLabels(t, []string{`"user":"mine"`}, []string{`"transaction":"hello"`})
+	})
+	expectLabels(t, nil, []string{`"user":"mine"`})
+}
+
+func TestProfilerLabelsContextSegmentEndedAfterTransaction(t *testing.T) {
+	tapp := testApp(nil, ConfigProfilerLabels(true), t)
+	pprof.Do(context.Background(), pprof.Labels("user", "mine"), func(ctx context.Context) {
+		txn := tapp.StartTransaction("hello")
+		txn.SetProfilerLabelsContext(ctx)
+		s := txn.StartSegment("segment")
+		txn.End()
+		s.End()
+		expectLabels(t, []string{`"user":"mine"`}, []string{`"transaction":"hello"`, `"segment"`})
+	})
+}
+
+func TestProfilerLabelsDisabled(t *testing.T) {
+	tapp := testApp(nil, nil, t)
+	txn := tapp.StartTransaction("disabled")
+	txn.StartSegment("segment")
+	expectLabels(t, nil, []string{`"transaction":"disabled"`})
+	txn.End()
+}
+
+func TestProfilingEnablesProfilerLabels(t *testing.T) {
+	tapp := testApp(nil, ConfigProfiling(), t)
+	txn := tapp.StartTransaction("profiled")
+	expectLabels(t, []string{`"transaction":"profiled"`}, nil)
+	txn.End()
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package newrelic
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/newrelic/go-agent/v3/internal"
+)
+
+func profilerTestApp(t *testing.T, cfgfn func(*Config)) (*app, *profiler) {
+	tapp := testApp(nil, func(cfg *Config) {
+		ConfigProfiling(ProfileCPU, ProfileHeap, ProfileGoroutine)(cfg)
+		cfg.Profiling.CPUDuration = 10 * time.Millisecond
+		if nil != cfgfn {
+			cfgfn(cfg)
+		}
+	}, t)
+	a := tapp.Private.(*app)
+	return a, newProfiler(a)
+}
+
+func isGzip(data []byte) bool {
+	return len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b
+}
+
+func TestProfilerCapture(t *testing.T) {
+	a, p := profilerTestApp(t, nil)
+	p.capturing = 1
+	p.capture(nil)
+	if p.capturing != 0 {
+		t.Error(p.capturing)
+	}
+
+	profiles := newHarvestData(a.testHarvest, now, nil).Profiles()
+	if len(profiles) != 3 {
+		t.Fatal(profiles)
+	}
+	for i, tp := range []ProfileType{ProfileCPU, ProfileHeap, ProfileGoroutine} {
+		pr := profiles[i]
+		if pr.Type != tp || !isGzip(pr.Data) || pr.TransactionName != "" || pr.Start.IsZero() {
+			t.Error(pr.Type, pr.TransactionName, pr.Start)
+		}
+	}
+	if profiles[0].Duration < 10*time.Millisecond || profiles[1].Duration != 0 {
+		t.Error(profiles[0].Duration, profiles[1].Duration)
+	}
+}
+
+func TestProfilerTriggered(t *testing.T) {
+	a, p := profilerTestApp(t, func(cfg *Config) {
+		cfg.Profiling.Types = []ProfileType{ProfileGoroutine}
+		cfg.Profiling.SlowTransactionThreshold = time.Second
+	})
+	p.transactionEnded("fast", "trace-id", time.Millisecond, now)
+	if atomic.LoadInt32(&p.capturing) != 0 {
+		t.Fatal("fast transaction triggered a capture")
+	}
+	p.transactionEnded("slow", "trace-id", 2*time.Second, now)
+	for atomic.LoadInt32(&p.capturing) != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// Captures are triggered at most once per period.
+	p.transactionEnded("slow", "trace-id", 2*time.Second, now.Add(time.Second))
+	if atomic.LoadInt32(&p.capturing) != 0 {
+		t.Fatal("capture triggered within the period")
+	}
+
+	profiles := newHarvestData(a.testHarvest, now, nil).Profiles()
+	if len(profiles) != 1 {
+		t.Fatal(profiles)
+	}
+	if pr := profiles[0]; pr.Type != ProfileGoroutine || pr.TransactionName != "slow" || pr.TraceID != "trace-id" {
+		t.Error(pr.Type, pr.TransactionName, pr.TraceID)
+	}
+
+	var nilProfiler *profiler
+	nilProfiler.transactionEnded("slow", "", time.Hour, now)
+}
+
+func TestProfilerTransactionEnd(t *testing.T) {
+	a, _ := profilerTestApp(t, func(cfg *Config) {
+		cfg.Profiling.Types = []ProfileType{ProfileHeap}
+		cfg.Profiling.SlowTransactionThreshold = time.Nanosecond
+	})
+	// The profiler is not started when the application is disabled.
+	a.profiler = newProfiler(a)
+	txn := a.StartTransaction("hello")
+	time.Sleep(time.Millisecond)
+	txn.End()
+	for atomic.LoadInt32(&a.profiler.capturing) != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	profiles := newHarvestData(a.testHarvest, now, nil).Profiles()
+	if len(profiles) != 1 || profiles[0].TransactionName != "OtherTransaction/Go/hello" {
+		t.Fatal(profiles)
+	}
+}
+
+func TestHarvestProfilesDropped(t *testing.T) {
+	h := newHarvest(now, dfltHarvestCfgr)
+	for i := 0; i < maxHarvestProfiles+2; i++ {
+		profileRecord{profile: HarvestProfile{Type: ProfileHeap}}.MergeIntoHarvest(h)
+	}
+	ready := h.Ready(now.Add(61 * time.Second))
+	if nil == ready.Profiles || len(ready.Profiles.profiles) != maxHarvestProfiles {
+		t.Fatal(ready.Profiles)
+	}
+	if len(h.Profiles.profiles) != 0 || h.Profiles.numDropped != 0 {
+		t.Error(h.Profiles)
+	}
+	expectMetricsPresent(t, ready.Metrics, []internal.WantMetric{
+		{Name: profilesDropped, Forced: true, Data: []float64{2, 0, 0, 0, 0, 0}},
+	})
+}
@@ -0,0 +1,407 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package newrelic
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// DefaultPrometheusBuckets are the upper bounds, in seconds, of the buckets of
+// the transaction duration histograms when Config.Prometheus.Buckets is empty.
+var DefaultPrometheusBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+const (
+	prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+	prometheusCounter   = "counter"
+	prometheusGauge     = "gauge"
+	prometheusSummary   = "summary"
+	prometheusHistogram = "histogram"
+
+	prometheusDurationFamily = "newrelic_transaction_duration_seconds"
+	prometheusDroppedFamily  = "newrelic_prometheus_series_dropped_total"
+)
+
+// PrometheusHandler returns an http.Handler which writes the metrics of the
+// application in the Prometheus text exposition format.  It exposes the
+// statistics of the runtime sampler, the apdex and the duration histogram of
+// each transaction name, calls to datastores and external services, metrics
+// recorded with RecordCustomMetric, and dimensional metrics recorded with
+// RecordMetric.  The values are aggregated since the application was created,
+// from the same data that is sent to New Relic.  The handler returns 404 unless
+// Config.Prometheus.Enabled is set.
+//
+//	mux := http.NewServeMux()
+//	mux.Handle("/metrics", app.PrometheusHandler())
+func (app *Application) PrometheusHandler() http.Handler {
+	if nil == app || nil == app.app || nil == app.app.prometheus {
+		return http.NotFoundHandler()
+	}
+	reg := app.app.prometheus
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := &bytes.Buffer{}
+		reg.write(buf)
+		w.Header().Set("Content-Type", prometheusContentType)
+		w.Write(buf.Bytes())
+	})
+}
+
+// prometheusSeries is one time series.  Counters report sum, gauges report
+// last, and summaries report sum and count.
+type prometheusSeries struct {
+	count float64
+	sum   float64
+	last  float64
+}
+
+type prometheusFamily struct {
+	help       string
+	metricType string
+	// series is keyed by the formatted labels of the series.
+	series map[string]*prometheusSeries
+}
+
+type prometheusHistogramSeries struct {
+	// counts contains the number of observations of each bucket, not
+	// including those of smaller buckets.  The last element is the +Inf
+	// bucket.
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// prometheusRegistry aggregates the harvestables consumed by the application
+// for the lifetime of the application.  Only the data types that are never
+// consumed twice are aggregated, so that retried harvests are not counted
+// again.
+type prometheusRegistry struct {
+	sync.Mutex
+	buckets    []float64
+	families   map[string]*prometheusFamily
+	durations  map[string]*prometheusHistogramSeries
+	numSeries  int
+	numDropped int
+}
+
+func newPrometheusRegistry(buckets []float64) *prometheusRegistry {
+	if 0 == len(buckets) {
+		buckets = DefaultPrometheusBuckets
+	}
+	return &prometheusRegistry{
+		buckets:   buckets,
+		families:  make(map[string]*prometheusFamily),
+		durations: make(map[string]*prometheusHistogramSeries),
+	}
+}
+
+// prometheusLabels formats label pairs, given as alternating names and values,
+// in the order given.
+func prometheusLabels(pairs ...string) string {
+	buf := &bytes.Buffer{}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(pairs[i])
+		buf.WriteString(`="`)
+		writePrometheusLabelValue(buf, pairs[i+1])
+		buf.WriteByte('"')
+	}
+	return buf.String()
+}
+
+func writePrometheusLabelValue(buf *bytes.Buffer, value string) {
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '\\':
+			buf.WriteString(`\\`)
+		case '"':
+			buf.WriteString(`\"`)
+		case '\n':
+			buf.WriteString(`\n`)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+}
+
+// prometheusName replaces the characters which are not allowed in Prometheus
+// metric names, or in label names if label is true, with underscores.
+func prometheusName(name string, label bool) string {
+	b := []byte(name)
+	for i, c := range b {
+		valid := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_' ||
+			(c >= '0' && c <= '9' && i > 0) || (c == ':' && !label)
+		if !valid {
+			b[i] = '_'
+		}
+	}
+	if 0 == len(b) {
+		return "_"
+	}
+	return string(b)
+}
+
+// series returns the series of the family, creating both if necessary.  It
+// returns nil if the series limit is reached or if the family exists with a
+// different type.
+func (r *prometheusRegistry) series(family, metricType, help, labels string) *prometheusSeries {
+	f, ok := r.families[family]
+	if !ok {
+		f = &prometheusFamily{
+			help:       help,
+			metricType: metricType,
+			series:     make(map[string]*prometheusSeries),
+		}
+		r.families[family] = f
+	}
+	if f.metricType != metricType {
+		r.numDropped++
+		return nil
+	}
+	s, ok := f.series[labels]
+	if !ok {
+		if r.numSeries >= maxPrometheusSeries {
+			r.numDropped++
+			return nil
+		}
+		r.numSeries++
+		s = &prometheusSeries{}
+		f.series[labels] = s
+	}
+	return s
+}
+
+func (r *prometheusRegistry) add(family, metricType, help, labels string, count, value float64) {
+	if s := r.series(family, metricType, help, labels); nil != s {
+		s.count += count
+		s.sum += value
+		s.last = value
+	}
+}
+
+func (r *prometheusRegistry) gauge(family, help string, value float64) {
+	r.add(family, prometheusGauge, help, "", 1, value)
+}
+
+func (r *prometheusRegistry) counter(family, help, labels string, value float64) {
+	r.add(family, prometheusCounter, help, labels, 1, value)
+}
+
+func (r *prometheusRegistry) observeDuration(name string, seconds float64) {
+	h, ok := r.durations[name]
+	if !ok {
+		if r.numSeries >= maxPrometheusSeries {
+			r.numDropped++
+			return
+		}
+		r.numSeries++
+		h = &prometheusHistogramSeries{counts: make([]uint64, len(r.buckets)+1)}
+		r.durations[name] = h
+	}
+	idx := sort.SearchFloat64s(r.buckets, seconds)
+	h.counts[idx]++
+	h.count++
+	h.sum += seconds
+}
+
+// Consume aggregates the data.  It is called for everything the application
+// consumes, and is a no-op for nil registries.
+func (r *prometheusRegistry) Consume(data harvestable) {
+	if nil == r {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+
+	switch d := data.(type) {
+	case *txn:
+		r.consumeTxn(&d.txnData)
+	case systemStats:
+		r.consumeSystemStats(d)
+	case customMetric:
+		r.add("newrelic_custom_metric", prometheusSummary,
+			"Values recorded with RecordCustomMetric.",
+			prometheusLabels("name", d.RawInputName), 1, d.Value)
+	case dimensionalMetricRecord:
+		r.consumeDimensionalMetric(d)
+	}
+}
+
+func (r *prometheusRegistry) consumeTxn(t *txnData) {
+	labels := prometheusLabels("transaction", t.FinalName)
+	r.observeDuration(t.FinalName, t.Duration.Seconds())
+
+	var errors float64
+	if t.HasErrors() {
+		errors = 1
+	}
+	r.counter("newrelic_transaction_errors_total",
+		"Transactions which had errors.", labels, errors)
+
+	var zone string
+	switch t.Zone {
+	case apdexSatisfying:
+		zone = "satisfying"
+	case apdexTolerating:
+		zone = "tolerating"
+	case apdexFailing:
+		zone = "frustrating"
+	}
+	if "" != zone {
+		r.counter("newrelic_apdex_total",
+			"Transactions by apdex zone.",
+			prometheusLabels("transaction", t.FinalName, "zone", zone), 1)
+		r.add("newrelic_apdex_threshold_seconds", prometheusGauge,
+			"The apdex threshold of the transaction.",
+			labels, 1, t.ApdexThreshold.Seconds())
+	}
+
+	for key, data := range t.datastoreSegments {
+		dl := prometheusLabels("product", key.Product, "operation", key.Operation)
+		r.counter("newrelic_datastore_calls_total",
+			"Calls to datastores made within transactions.", dl, data.countSatisfied)
+		r.counter("newrelic_datastore_call_seconds_total",
+			"Time spent in calls to datastores made within transactions.", dl, data.totalTolerated)
+	}
+	for key, data := range t.externalSegments {
+		el := prometheusLabels("host", key.Host)
+		r.counter("newrelic_external_calls_total",
+			"Calls to external services made within transactions.", el, data.countSatisfied)
+		r.counter("newrelic_external_call_seconds_total",
+			"Time spent in calls to external services made within transactions.", el, data.totalTolerated)
+	}
+}
+
+func (r *prometheusRegistry) consumeSystemStats(s systemStats) {
+	r.gauge("newrelic_runtime_goroutines", "Number of goroutines.", float64(s.numGoroutine))
+	r.gauge("newrelic_runtime_heap_objects", "Number of allocated heap objects.", float64(s.heapObjects))
+	r.gauge("newrelic_runtime_heap_alloc_bytes", "Bytes of allocated heap objects.", float64(s.allocBytes))
+	r.gauge("newrelic_runtime_cpu_user_utilization", "Fraction of the CPU capacity used in user mode.", s.user.fraction)
+	r.gauge("newrelic_runtime_cpu_system_utilization", "Fraction of the CPU capacity used in system mode.", s.system.fraction)
+	r.gauge("newrelic_runtime_gc_pause_fraction", "Fraction of time spent in garbage collection pauses.", s.gcPauseFraction)
+	r.counter("newrelic_runtime_cpu_user_seconds_total", "CPU time used in user mode.", "", s.user.used.Seconds())
+	r.counter("newrelic_runtime_cpu_system_seconds_total", "CPU time used in system mode.", "", s.system.used.Seconds())
+	r.counter("newrelic_runtime_gc_pauses_total", "Number of garbage collection pauses.", "", float64(s.deltaNumGC))
+	r.counter("newrelic_runtime_gc_pause_seconds_total", "Time spent in garbage collection pauses.", "", s.deltaPauseTotal.Seconds())
+}
+
+func (r *prometheusRegistry) consumeDimensionalMetric(m dimensionalMetricRecord) {
+	keys := make([]string, 0, len(m.attributes))
+	for key := range m.attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, 2*len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, prometheusName(key, true), fmt.Sprint(m.attributes[key]))
+	}
+	var metricType string
+	switch m.metricType {
+	case MetricCount:
+		metricType = prometheusCounter
+	case MetricGauge:
+		metricType = prometheusGauge
+	default:
+		metricType = prometheusSummary
+	}
+	r.add(prometheusName(m.name, false), metricType,
+		"Dimensional metric recorded with RecordMetric.",
+		prometheusLabels(pairs...), 1, m.value)
+}
+
+func formatPrometheusValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func writePrometheusSample(buf *bytes.Buffer, name, labels string, value float64) {
+	buf.WriteString(name)
+	if "" != labels {
+		buf.WriteByte('{')
+		buf.WriteString(labels)
+		buf.WriteByte('}')
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(formatPrometheusValue(value))
+	buf.WriteByte('\n')
+}
+
+func writePrometheusHeader(buf *bytes.Buffer, name, help, metricType string) {
+	buf.WriteString("# HELP " + name + " " + help + "\n")
+	buf.WriteString("# TYPE " + name + " " + metricType + "\n")
+}
+
+func sortedPrometheusSeries(m map[string]*prometheusSeries) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// write writes the aggregated metrics in the text exposition format, with the
+// families and series sorted by name.
+func (r *prometheusRegistry) write(buf *bytes.Buffer) {
+	r.Lock()
+	defer r.Unlock()
+
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := r.families[name]
+		writePrometheusHeader(buf, name, f.help, f.metricType)
+		for _, labels := range sortedPrometheusSeries(f.series) {
+			s := f.series[labels]
+			switch f.metricType {
+			case prometheusCounter:
+				writePrometheusSample(buf, name, labels, s.sum)
+			case prometheusGauge:
+				writePrometheusSample(buf, name, labels, s.last)
+			case prometheusSummary:
+				writePrometheusSample(buf, name+"_sum", labels, s.sum)
+				writePrometheusSample(buf, name+"_count", labels, s.count)
+			}
+		}
+	}
+
+	if len(r.durations) > 0 {
+		writePrometheusHeader(buf, prometheusDurationFamily, "Duration of transactions.", prometheusHistogram)
+		txnNames := make([]string, 0, len(r.durations))
+		for name := range r.durations {
+			txnNames = append(txnNames, name)
+		}
+		sort.Strings(txnNames)
+		for _, name := range txnNames {
+			h := r.durations[name]
+			var cumulative uint64
+			for i, count := range h.counts {
+				cumulative += count
+				le := "+Inf"
+				if i < len(r.buckets) {
+					le = formatPrometheusValue(r.buckets[i])
+				}
+				writePrometheusSample(buf, prometheusDurationFamily+"_bucket",
+					prometheusLabels("transaction", name, "le", le), float64(cumulative))
+			}
+			labels := prometheusLabels("transaction", name)
+			writePrometheusSample(buf, prometheusDurationFamily+"_sum", labels, h.sum)
+			writePrometheusSample(buf, prometheusDurationFamily+"_count", labels, float64(h.count))
+		}
+	}
+
+	if r.numDropped > 0 {
+		writePrometheusHeader(buf, prometheusDroppedFamily,
+			"Values dropped because of the series limit or conflicting metric types.", prometheusCounter)
+		writePrometheusSample(buf, prometheusDroppedFamily, "", float64(r.numDropped))
+	}
+}
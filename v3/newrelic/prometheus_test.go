@@ -0,0 +1,169 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package newrelic
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func getPrometheus(t *testing.T, h http.Handler) string {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatal(w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != prometheusContentType {
+		t.Error(ct)
+	}
+	return w.Body.String()
+}
+
+func expectPrometheusLines(t *testing.T, out string, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		if !strings.Contains(out, "\n"+line+"\n") {
+			t.Errorf("missing line %q in:\n%s", line, out)
+		}
+	}
+}
+
+func TestPrometheusHandlerNotEnabled(t *testing.T) {
+	var app *Application
+	w := httptest.NewRecorder()
+	app.PrometheusHandler().ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusNotFound {
+		t.Error(w.Code)
+	}
+
+	tapp := testApp(nil, nil, t)
+	w = httptest.NewRecorder()
+	tapp.PrometheusHandler().ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusNotFound {
+		t.Error(w.Code)
+	}
+}
+
+func TestPrometheusTransactions(t *testing.T) {
+	tapp := testApp(nil, ConfigPrometheusEnabled(true), t)
+
+	txn := tapp.StartTransaction("hello")
+	txn.SetWebRequestHTTP(nil)
+	ds := &DatastoreSegment{
+		StartTime: txn.StartSegmentNow(),
+		Product:   DatastoreMySQL,
+		Operation: "SELECT",
+	}
+	ds.End()
+	ext := ExternalSegment{
+		StartTime: txn.StartSegmentNow(),
+		URL:       "http://example.com/",
+	}
+	ext.End()
+	txn.End()
+
+	txn = tapp.StartTransaction("hello")
+	txn.SetWebRequestHTTP(nil)
+	txn.NoticeError(myError{})
+	txn.End()
+
+	tapp.StartTransaction("ignored").Ignore()
+
+	out := getPrometheus(t, tapp.PrometheusHandler())
+	expectPrometheusLines(t, out,
+		"# TYPE newrelic_transaction_duration_seconds histogram",
+		`newrelic_transaction_duration_seconds_bucket{transaction="WebTransaction/Go/hello",le="0.005"} 2`,
+		`newrelic_transaction_duration_seconds_bucket{transaction="WebTransaction/Go/hello",le="+Inf"} 2`,
+		`newrelic_transaction_duration_seconds_count{transaction="WebTransaction/Go/hello"} 2`,
+		`newrelic_transaction_errors_total{transaction="WebTransaction/Go/hello"} 1`,
+		`newrelic_apdex_total{transaction="WebTransaction/Go/hello",zone="satisfying"} 1`,
+		`newrelic_apdex_total{transaction="WebTransaction/Go/hello",zone="frustrating"} 1`,
+		`newrelic_apdex_threshold_seconds{transaction="WebTransaction/Go/hello"} 0.5`,
+		`newrelic_datastore_calls_total{product="MySQL",operation="SELECT"} 1`,
+		`newrelic_external_calls_total{host="example.com"} 1`,
+	)
+	if strings.Contains(out, "ignored") {
+		t.Error(out)
+	}
+}
+
+func TestPrometheusCustomMetrics(t *testing.T) {
+	tapp := testApp(nil, ConfigPrometheusEnabled(true), t)
+	tapp.RecordCustomMetric("my metric", 2)
+	tapp.RecordCustomMetric("my metric", 3)
+	tapp.RecordMetric(MetricCount, "orders.count", 1, map[string]interface{}{"region": "us"})
+	tapp.RecordMetric(MetricCount, "orders.count", 2, map[string]interface{}{"region": "us"})
+	tapp.RecordMetric(MetricGauge, "queue", 7, nil)
+	tapp.RecordMetric(MetricGauge, "queue", 5, nil)
+	// A series with a conflicting type is dropped.
+	tapp.RecordMetric(MetricSummary, "queue", 1, nil)
+
+	out := getPrometheus(t, tapp.PrometheusHandler())
+	expectPrometheusLines(t, out,
+		"# TYPE newrelic_custom_metric summary",
+		`newrelic_custom_metric_sum{name="my metric"} 5`,
+		`newrelic_custom_metric_count{name="my metric"} 2`,
+		"# TYPE orders_count counter",
+		`orders_count{region="us"} 3`,
+		"# TYPE queue gauge",
+		"queue 5",
+		"newrelic_prometheus_series_dropped_total 1",
+	)
+}
+
+func TestPrometheusRuntime(t *testing.T) {
+	r := newPrometheusRegistry(nil)
+	stats := systemStats{
+		numGoroutine:    12,
+		user:            cpuStats{used: 2 * time.Second, fraction: 0.25},
+		deltaNumGC:      3,
+		deltaPauseTotal: 30 * time.Millisecond,
+	}
+	r.Consume(stats)
+	r.Consume(stats)
+	buf := &bytes.Buffer{}
+	r.write(buf)
+	expectPrometheusLines(t, buf.String(),
+		"# TYPE newrelic_runtime_goroutines gauge",
+		"newrelic_runtime_goroutines 12",
+		"newrelic_runtime_cpu_user_utilization 0.25",
+		"newrelic_runtime_cpu_user_seconds_total 4",
+		"newrelic_runtime_gc_pauses_total 6",
+		"newrelic_runtime_gc_pause_seconds_total 0.06",
+	)
+
+	var nilRegistry *prometheusRegistry
+	nilRegistry.Consume(stats)
+}
+
+func TestPrometheusBuckets(t *testing.T) {
+	r := newPrometheusRegistry([]float64{1, 2})
+	for _, d := range []float64{0.5, 1, 1.5, 3} {
+		r.observeDuration("txn", d)
+	}
+	buf := &bytes.Buffer{}
+	r.write(buf)
+	expectPrometheusLines(t, buf.String(),
+		`newrelic_transaction_duration_seconds_bucket{transaction="txn",le="1"} 2`,
+		`newrelic_transaction_duration_seconds_bucket{transaction="txn",le="2"} 3`,
+		`newrelic_transaction_duration_seconds_bucket{transaction="txn",le="+Inf"} 4`,
+		`newrelic_transaction_duration_seconds_sum{transaction="txn"} 6`,
+	)
+}
+
+func TestPrometheusNames(t *testing.T) {
+	if n := prometheusName("9lives.per-sec:total", false); n != "_lives_per_sec:total" {
+		t.Error(n)
+	}
+	if n := prometheusName("a:b", true); n != "a_b" {
+		t.Error(n)
+	}
+	if l := prometheusLabels("name", "a\"b\\c\nd"); l != `name="a\"b\\c\nd"` {
+		t.Error(l)
+	}
+}
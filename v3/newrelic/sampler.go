@@ -5,6 +5,7 @@ package newrelic
 
 import (
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/newrelic/go-agent/v3/internal/sysinfo"
@@ -145,3 +146,28 @@ func (s systemStats) MergeIntoHarvest(h *harvest) {
 		}, forced)
 	}
 }
+
+// samplerRegistry holds functions called by the runtime sampler to gather
+// data in addition to the system sample, such as database connection pool
+// statistics.
+type samplerRegistry struct {
+	sync.Mutex
+	samplers []func() harvestable
+}
+
+func (r *samplerRegistry) add(sampler func() harvestable) {
+	r.Lock()
+	defer r.Unlock()
+	r.samplers = append(r.samplers, sampler)
+}
+
+// sample calls each of the registered functions.
+func (r *samplerRegistry) sample() []harvestable {
+	r.Lock()
+	defer r.Unlock()
+	samples := make([]harvestable, 0, len(r.samplers))
+	for _, sampler := range r.samplers {
+		samples = append(samples, sampler())
+	}
+	return samples
+}
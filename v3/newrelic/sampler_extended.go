@@ -0,0 +1,309 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package newrelic
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// These are the names of the runtime/metrics statistics read by the extended
+// runtime sampler.
+const (
+	rmSchedLatencies   = "/sched/latencies:seconds"
+	rmGOMAXPROCS       = "/sched/gomaxprocs:threads"
+	rmGCHeapGoal       = "/gc/heap/goal:bytes"
+	rmGCCycles         = "/gc/cycles/total:gc-cycles"
+	rmGCHeapAllocs     = "/gc/heap/allocs:bytes"
+	rmHeapObjects      = "/memory/classes/heap/objects:bytes"
+	rmHeapUnused       = "/memory/classes/heap/unused:bytes"
+	rmHeapFree         = "/memory/classes/heap/free:bytes"
+	rmHeapReleased     = "/memory/classes/heap/released:bytes"
+	rmSyncMutexWait    = "/sync/mutex/wait/total:seconds"
+	rmCgoGoToCCalls    = "/cgo/go-to-c-calls:calls"
+	procSelfStatusPath = "/proc/self/status"
+	procSelfFDPath     = "/proc/self/fd"
+)
+
+// runtimeHistogram is a histogram read from runtime/metrics.  buckets has one
+// more element than counts:  counts[i] is the number of values between
+// buckets[i] and buckets[i+1].
+type runtimeHistogram struct {
+	counts  []uint64
+	buckets []float64
+}
+
+// runtimeReading contains the statistics read at one point in time.  Missing
+// statistics are absent from the maps, and threads and fds are negative when
+// they cannot be read.
+type runtimeReading struct {
+	values     map[string]float64
+	histograms map[string]runtimeHistogram
+	threads    int
+	fds        int
+}
+
+type runtimeCategories struct {
+	scheduler bool
+	gc        bool
+	heap      bool
+	sync      bool
+	cgo       bool
+	process   bool
+}
+
+func newRuntimeCategories(c config) runtimeCategories {
+	rs := c.RuntimeSampler
+	return runtimeCategories{
+		scheduler: rs.Scheduler.Enabled,
+		gc:        rs.GC.Enabled,
+		heap:      rs.Heap.Enabled,
+		sync:      rs.Sync.Enabled,
+		cgo:       rs.Cgo.Enabled,
+		process:   rs.Process.Enabled,
+	}
+}
+
+// runtimeMetricNames returns the runtime/metrics statistics needed by the
+// categories.
+func (cats runtimeCategories) runtimeMetricNames() []string {
+	var names []string
+	if cats.scheduler {
+		names = append(names, rmSchedLatencies, rmGOMAXPROCS)
+	}
+	if cats.gc {
+		names = append(names, rmGCHeapGoal, rmGCCycles, rmGCHeapAllocs)
+	}
+	if cats.heap {
+		names = append(names, rmHeapObjects, rmHeapUnused, rmHeapFree, rmHeapReleased)
+	}
+	if cats.sync {
+		names = append(names, rmSyncMutexWait)
+	}
+	if cats.cgo {
+		names = append(names, rmCgoGoToCCalls)
+	}
+	return names
+}
+
+// readRuntime reads the statistics of the categories.
+func readRuntime(cats runtimeCategories, names []string) *runtimeReading {
+	r := readRuntimeMetrics(names)
+	r.threads = -1
+	r.fds = -1
+	if cats.process {
+		r.threads = readProcThreads(procSelfStatusPath)
+		r.fds = countProcFDs(procSelfFDPath)
+	}
+	return r
+}
+
+// readProcThreads returns the number of threads from the Threads line of a
+// /proc status file, or -1.
+func readProcThreads(path string) int {
+	f, err := os.Open(path)
+	if nil != err {
+		return -1
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "Threads:") {
+			n, err := strconv.Atoi(strings.TrimSpace(line[len("Threads:"):]))
+			if nil != err {
+				return -1
+			}
+			return n
+		}
+	}
+	return -1
+}
+
+// countProcFDs returns the number of entries of a /proc fd directory, or -1.
+func countProcFDs(path string) int {
+	dir, err := os.Open(path)
+	if nil != err {
+		return -1
+	}
+	defer dir.Close()
+	names, err := dir.Readdirnames(-1)
+	if nil != err {
+		return -1
+	}
+	// The directory itself was opened to read the entries.
+	return len(names) - 1
+}
+
+// sampleRuntime registers the extended runtime sampler for the categories
+// enabled in Config.RuntimeSampler.
+func (app *app) sampleRuntime() {
+	cats := newRuntimeCategories(app.config)
+	names := cats.runtimeMetricNames()
+	if 0 == len(names) && !cats.process {
+		return
+	}
+	previous := readRuntime(cats, names)
+	app.samplers.add(func() harvestable {
+		current := readRuntime(cats, names)
+		sample := runtimeSample{
+			previous: previous,
+			current:  current,
+		}
+		previous = current
+		return sample
+	})
+}
+
+// runtimeSample contains two consecutive readings of the extended runtime
+// statistics.  Cumulative statistics are recorded as the difference between
+// the two.
+type runtimeSample struct {
+	previous *runtimeReading
+	current  *runtimeReading
+}
+
+// delta returns the difference of a cumulative statistic between the readings.
+func (s runtimeSample) delta(name string) (float64, bool) {
+	cur, ok := s.current.values[name]
+	if !ok {
+		return 0, false
+	}
+	prev := s.previous.values[name]
+	if cur < prev {
+		return 0, true
+	}
+	return cur - prev, true
+}
+
+// MergeIntoHarvest implements harvestable.
+func (s runtimeSample) MergeIntoHarvest(h *harvest) {
+	gauge := func(metric, name string) {
+		if v, ok := s.current.values[name]; ok {
+			h.Metrics.addValue(metric, "", v, forced)
+		}
+	}
+	// Sizes are recorded in mebibytes like Memory/Physical.
+	mebibytes := func(metric, name string) {
+		if v, ok := s.current.values[name]; ok {
+			h.Metrics.addValue(metric, "", v/(1024*1024), forced)
+		}
+	}
+
+	if hist, ok := s.current.histograms[rmSchedLatencies]; ok {
+		recordHistogramDelta(h, runtimeSchedulerLatency, s.previous.histograms[rmSchedLatencies], hist)
+	}
+	gauge(runtimeSchedulerGOMAXPROCS, rmGOMAXPROCS)
+
+	mebibytes(runtimeGCHeapGoal, rmGCHeapGoal)
+	if d, ok := s.delta(rmGCCycles); ok {
+		h.Metrics.addCount(runtimeGCCycles, d, forced)
+	}
+	if d, ok := s.delta(rmGCHeapAllocs); ok {
+		h.Metrics.addValue(runtimeGCHeapAllocated, "", d/(1024*1024), forced)
+	}
+
+	objects, ok1 := s.current.values[rmHeapObjects]
+	unused, ok2 := s.current.values[rmHeapUnused]
+	if ok1 && ok2 && objects+unused > 0 {
+		h.Metrics.addValue(runtimeHeapFragmentation, "", unused/(objects+unused), forced)
+	}
+	mebibytes(runtimeHeapFree, rmHeapFree)
+	mebibytes(runtimeHeapReleased, rmHeapReleased)
+
+	if d, ok := s.delta(rmSyncMutexWait); ok {
+		h.Metrics.addValue(runtimeSyncMutexWait, "", d, forced)
+	}
+	if d, ok := s.delta(rmCgoGoToCCalls); ok {
+		h.Metrics.addCount(runtimeCgoCalls, d, forced)
+	}
+
+	if s.current.threads >= 0 {
+		h.Metrics.addValue(runtimeProcessThreads, "", float64(s.current.threads), forced)
+	}
+	if s.current.fds >= 0 {
+		h.Metrics.addValue(runtimeProcessFDs, "", float64(s.current.fds), forced)
+	}
+}
+
+// histogramPercentiles are recorded as metrics named after the histogram
+// followed by the suffix.
+var histogramPercentiles = []struct {
+	suffix   string
+	fraction float64
+}{
+	{suffix: "/50th", fraction: 0.50},
+	{suffix: "/95th", fraction: 0.95},
+	{suffix: "/99th", fraction: 0.99},
+}
+
+// histogramBucketValue returns the value representing a bucket:  Its middle,
+// or its finite bound if it is unbounded.
+func histogramBucketValue(lower, upper float64) float64 {
+	switch {
+	case math.IsInf(lower, -1):
+		return upper
+	case math.IsInf(upper, 1):
+		return lower
+	}
+	return (lower + upper) / 2
+}
+
+// recordHistogramDelta records the values added to a histogram since the
+// previous reading as a metric, with the total and the sum of squares
+// approximated from the buckets, and its percentiles as separate metrics.
+func recordHistogramDelta(h *harvest, name string, previous, current runtimeHistogram) {
+	counts := make([]float64, len(current.counts))
+	var total float64
+	for i, c := range current.counts {
+		counts[i] = float64(c)
+		if len(previous.counts) == len(current.counts) && previous.counts[i] <= c {
+			counts[i] -= float64(previous.counts[i])
+		}
+		total += counts[i]
+	}
+	if 0 == total {
+		return
+	}
+	data := metricData{
+		countSatisfied: total,
+		min:            math.Inf(1),
+		max:            math.Inf(-1),
+	}
+	for i, c := range counts {
+		if 0 == c {
+			continue
+		}
+		lower, upper := current.buckets[i], current.buckets[i+1]
+		v := histogramBucketValue(lower, upper)
+		data.totalTolerated += c * v
+		data.sumSquares += c * v * v
+		data.min = math.Min(data.min, math.Max(lower, 0))
+		if math.IsInf(upper, 1) {
+			upper = lower
+		}
+		data.max = math.Max(data.max, upper)
+	}
+	data.exclusiveFailed = data.totalTolerated
+	h.Metrics.add(name, "", data, forced)
+
+	for _, p := range histogramPercentiles {
+		target := math.Ceil(p.fraction * total)
+		var seen float64
+		for i, c := range counts {
+			seen += c
+			if seen >= target {
+				upper := current.buckets[i+1]
+				if math.IsInf(upper, 1) {
+					upper = current.buckets[i]
+				}
+				h.Metrics.addValue(name+p.suffix, "", upper, forced)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package newrelic
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/newrelic/go-agent/v3/internal"
+)
+
+func TestRuntimeSampleMetrics(t *testing.T) {
+	const mib = 1024 * 1024
+	sample := runtimeSample{
+		previous: &runtimeReading{
+			values: map[string]float64{
+				rmGCCycles:      10,
+				rmGCHeapAllocs:  1 * mib,
+				rmSyncMutexWait: 0.5,
+				rmCgoGoToCCalls: 100,
+			},
+			histograms: map[string]runtimeHistogram{
+				rmSchedLatencies: {counts: []uint64{1, 0, 0, 0}, buckets: []float64{0, 1, 2, 4, math.Inf(1)}},
+			},
+		},
+		current: &runtimeReading{
+			values: map[string]float64{
+				rmGOMAXPROCS:    4,
+				rmGCHeapGoal:    8 * mib,
+				rmGCCycles:      13,
+				rmGCHeapAllocs:  3 * mib,
+				rmHeapObjects:   3 * mib,
+				rmHeapUnused:    1 * mib,
+				rmHeapFree:      2 * mib,
+				rmHeapReleased:  1 * mib,
+				rmSyncMutexWait: 0.75,
+				rmCgoGoToCCalls: 150,
+			},
+			histograms: map[string]runtimeHistogram{
+				rmSchedLatencies: {counts: []uint64{5, 2, 1, 1}, buckets: []float64{0, 1, 2, 4, math.Inf(1)}},
+			},
+			threads: 7,
+			fds:     -1,
+		},
+	}
+	h := newHarvest(time.Now(), dfltHarvestCfgr)
+	sample.MergeIntoHarvest(h)
+	expectMetrics(t, h.Metrics, []internal.WantMetric{
+		{Name: "Go/Runtime/Scheduler/Latency", Scope: "", Forced: true, Data: []float64{8, 12, 12, 0, 4, 30.5}},
+		{Name: "Go/Runtime/Scheduler/Latency/50th", Scope: "", Forced: true, Data: []float64{1, 1, 1, 1, 1, 1}},
+		{Name: "Go/Runtime/Scheduler/Latency/95th", Scope: "", Forced: true, Data: []float64{1, 4, 4, 4, 4, 16}},
+		{Name: "Go/Runtime/Scheduler/Latency/99th", Scope: "", Forced: true, Data: []float64{1, 4, 4, 4, 4, 16}},
+		{Name: "Go/Runtime/Scheduler/GOMAXPROCS", Scope: "", Forced: true, Data: []float64{1, 4, 4, 4, 4, 16}},
+		{Name: "Go/Runtime/GC/HeapGoal", Scope: "", Forced: true, Data: []float64{1, 8, 8, 8, 8, 64}},
+		{Name: "Go/Runtime/GC/Cycles", Scope: "", Forced: true, Data: []float64{3, 0, 0, 0, 0, 0}},
+		{Name: "Go/Runtime/GC/HeapAllocated", Scope: "", Forced: true, Data: []float64{1, 2, 2, 2, 2, 4}},
+		{Name: "Go/Runtime/Heap/Fragmentation", Scope: "", Forced: true, Data: []float64{1, 0.25, 0.25, 0.25, 0.25, 0.0625}},
+		{Name: "Go/Runtime/Heap/Free", Scope: "", Forced: true, Data: []float64{1, 2, 2, 2, 2, 4}},
+		{Name: "Go/Runtime/Heap/Released", Scope: "", Forced: true, Data: []float64{1, 1, 1, 1, 1, 1}},
+		{Name: "Go/Runtime/Sync/MutexWait", Scope: "", Forced: true, Data: []float64{1, 0.25, 0.25, 0.25, 0.25, 0.0625}},
+		{Name: "Go/Runtime/Cgo/Calls", Scope: "", Forced: true, Data: []float64{50, 0, 0, 0, 0, 0}},
+		{Name: "Go/Runtime/Process/Threads", Scope: "", Forced: true, Data: []float64{1, 7, 7, 7, 7, 49}},
+	})
+}
+
+func TestRuntimeSampleEmpty(t *testing.T) {
+	empty := &runtimeReading{threads: -1, fds: -1}
+	h := newHarvest(time.Now(), dfltHarvestCfgr)
+	runtimeSample{previous: empty, current: empty}.MergeIntoHarvest(h)
+	expectMetrics(t, h.Metrics, []internal.WantMetric{})
+}
+
+func TestRuntimeCategories(t *testing.T) {
+	cfg := defaultConfig()
+	if names := newRuntimeCategories(config{Config: cfg}).runtimeMetricNames(); len(names) != 11 {
+		t.Error(names)
+	}
+	cfg.RuntimeSampler.Scheduler.Enabled = false
+	cfg.RuntimeSampler.GC.Enabled = false
+	cfg.RuntimeSampler.Heap.Enabled = false
+	cfg.RuntimeSampler.Sync.Enabled = false
+	cfg.RuntimeSampler.Cgo.Enabled = true
+	names := newRuntimeCategories(config{Config: cfg}).runtimeMetricNames()
+	if len(names) != 1 || names[0] != rmCgoGoToCCalls {
+		t.Error(names)
+	}
+}
+
+func TestReadRuntime(t *testing.T) {
+	cats := newRuntimeCategories(config{Config: defaultConfig()})
+	r := readRuntime(cats, cats.runtimeMetricNames())
+	// The statistics are missing before Go 1.17.
+	if _, ok := r.values[rmGCHeapGoal]; ok {
+		if r.values[rmGCHeapGoal] <= 0 {
+			t.Error(r.values)
+		}
+		if hist := r.histograms[rmSchedLatencies]; len(hist.buckets) != len(hist.counts)+1 {
+			t.Error(len(hist.buckets), len(hist.counts))
+		}
+	}
+	if _, err := os.Stat(procSelfStatusPath); nil == err {
+		if r.threads <= 0 || r.fds <= 0 {
+			t.Error(r.threads, r.fds)
+		}
+	}
+}
+
+func TestReadProcThreads(t *testing.T) {
+	dir, err := ioutil.TempDir("", "proc")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "status")
+	ioutil.WriteFile(path, []byte("Name:\tapp\nThreads:\t12\nVmRSS:\t1 kB\n"), 0644)
+	if n := readProcThreads(path); n != 12 {
+		t.Error(n)
+	}
+	if n := readProcThreads(filepath.Join(dir, "missing")); n != -1 {
+		t.Error(n)
+	}
+	if n := countProcFDs(filepath.Join(dir, "missing")); n != -1 {
+		t.Error(n)
+	}
+}
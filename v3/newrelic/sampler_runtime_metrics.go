@@ -0,0 +1,54 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// +build go1.17
+
+package newrelic
+
+import (
+	"runtime/metrics"
+)
+
+// supportedRuntimeMetrics contains the statistics known to the running Go
+// version.
+var supportedRuntimeMetrics = func() map[string]bool {
+	supported := make(map[string]bool)
+	for _, d := range metrics.All() {
+		supported[d.Name] = true
+	}
+	return supported
+}()
+
+// readRuntimeMetrics reads the statistics known to the running Go version.
+func readRuntimeMetrics(names []string) *runtimeReading {
+	r := &runtimeReading{
+		values:     make(map[string]float64),
+		histograms: make(map[string]runtimeHistogram),
+	}
+	samples := make([]metrics.Sample, 0, len(names))
+	for _, name := range names {
+		if supportedRuntimeMetrics[name] {
+			samples = append(samples, metrics.Sample{Name: name})
+		}
+	}
+	if 0 == len(samples) {
+		return r
+	}
+	metrics.Read(samples)
+	for _, s := range samples {
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			r.values[s.Name] = float64(s.Value.Uint64())
+		case metrics.KindFloat64:
+			r.values[s.Name] = s.Value.Float64()
+		case metrics.KindFloat64Histogram:
+			// The histogram may be reused by the next read.
+			hist := s.Value.Float64Histogram()
+			r.histograms[s.Name] = runtimeHistogram{
+				counts:  append([]uint64(nil), hist.Counts...),
+				buckets: append([]float64(nil), hist.Buckets...),
+			}
+		}
+	}
+	return r
+}
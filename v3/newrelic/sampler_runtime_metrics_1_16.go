@@ -0,0 +1,15 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// +build !go1.17
+
+package newrelic
+
+// readRuntimeMetrics returns no statistics since the runtime/metrics package
+// does not provide them before Go 1.17.
+func readRuntimeMetrics(names []string) *runtimeReading {
+	return &runtimeReading{
+		values:     make(map[string]float64),
+		histograms: make(map[string]runtimeHistogram),
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package newrelic
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SamplingDecision overrides the sampling decision of a transaction.  It is
+// used for the SamplingResult.Decision and SamplingRule.Decision fields.
+type SamplingDecision string
+
+// These constants are the supported values of SamplingDecision.
+const (
+	// SamplingDefer leaves the decision to the agent's adaptive sampler.
+	SamplingDefer SamplingDecision = ""
+	// SamplingKeep samples the transaction.
+	SamplingKeep SamplingDecision = "keep"
+	// SamplingDrop does not sample the transaction.
+	SamplingDrop SamplingDecision = "drop"
+)
+
+// SamplingParameters describes a transaction at the time the sampling decision
+// is made.  The decision is made when the first segment of the transaction
+// ends, when distributed tracing headers are created, or when the transaction
+// ends, whichever happens first.
+type SamplingParameters struct {
+	// TransactionName is the name provided to StartTransaction or
+	// Transaction.SetName, without the "WebTransaction/Go/" or
+	// "OtherTransaction/Go/" prefix.
+	TransactionName string
+	// IsWeb is true for web transactions.
+	IsWeb bool
+	// HasError is true if an error has been noticed.
+	HasError bool
+	// Priority is the priority of the transaction before the decision.
+	Priority float32
+	// AgentAttributes contains the agent attributes of the transaction,
+	// such as AttributeRequestURI.  UserAttributes contains the
+	// attributes added using Transaction.AddAttribute.
+	AgentAttributes map[string]interface{}
+	UserAttributes  map[string]interface{}
+}
+
+// SamplingResult is returned by a Sampler.
+type SamplingResult struct {
+	Decision SamplingDecision
+	// Priority, when non-zero, replaces the priority of the transaction.
+	// Events with the highest priority are kept when there are more
+	// events than can be reported.  The agent gives sampled transactions a
+	// priority between 1 and 2.
+	Priority float32
+}
+
+// Sampler can override the sampling decision of transactions when
+// distributed tracing is enabled.  A sampled transaction reports its span
+// events and is more likely to have its transaction and error events kept.
+// Transactions which accept a distributed tracing payload containing a
+// sampling decision use that decision, and the Sampler is not called.
+//
+// ShouldSample is called concurrently by different transactions, and at most
+// once per transaction.  It is not called while the transaction is locked,
+// therefore it may use the Transaction.
+type Sampler interface {
+	ShouldSample(params SamplingParameters) SamplingResult
+}
+
+// SamplingRule is a declarative sampling rule.  A rule matches a transaction
+// when all of its non-empty conditions match.  See Config.Sampling.
+type SamplingRule struct {
+	// TransactionName is a pattern matched against the
+	// SamplingParameters.TransactionName.  The '*' character matches any
+	// sequence of characters.  For example, "/checkout*" matches
+	// "/checkout/confirm".
+	TransactionName string
+	// Attribute and AttributeValue match transactions having the agent
+	// or user attribute named Attribute with a value matching the pattern
+	// AttributeValue.  Non-string values are formatted using fmt.Sprint.
+	// For example, Attribute AttributeRequestURI and AttributeValue
+	// "*/health*" match health checks.
+	Attribute      string
+	AttributeValue string
+	// HasError restricts the rule to transactions with an error noticed.
+	// Rules are evaluated again when the transaction ends if an error was
+	// noticed after the sampling decision.  The span events of the
+	// segments which ended before the error was noticed are only kept if
+	// they were sampled, unless SpanEvents.TailSampling is enabled.
+	HasError bool
+
+	Decision SamplingDecision
+	// Priority, when non-zero, replaces the priority of the transaction.
+	// See SamplingResult.Priority.
+	Priority float32
+}
+
+func (r SamplingRule) matches(p *SamplingParameters) bool {
+	if "" != r.TransactionName && !globMatch(r.TransactionName, p.TransactionName) {
+		return false
+	}
+	if "" != r.Attribute {
+		val, ok := p.AgentAttributes[r.Attribute]
+		if !ok {
+			val, ok = p.UserAttributes[r.Attribute]
+		}
+		if !ok || !globMatch(r.AttributeValue, fmt.Sprint(val)) {
+			return false
+		}
+	}
+	if r.HasError && !p.HasError {
+		return false
+	}
+	return true
+}
+
+// globMatch reports whether s matches the pattern, in which the '*' character
+// matches any sequence of characters, including '/'.
+func globMatch(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if 1 == len(parts) {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		idx := strings.Index(s, part)
+		if idx < 0 {
+			return false
+		}
+		s = s[idx+len(part):]
+	}
+	return len(s) >= len(last) && strings.HasSuffix(s, last)
+}
+
+func (txn *txn) samplingParameters() SamplingParameters {
+	p := SamplingParameters{
+		TransactionName: txn.Name,
+		IsWeb:           txn.IsWeb,
+		HasError:        txn.txnEvent.HasError,
+		Priority:        txn.BetterCAT.Priority.Float32(),
+		AgentAttributes: make(map[string]interface{}, len(txn.Attrs.Agent)),
+		UserAttributes:  make(map[string]interface{}, len(txn.Attrs.user)),
+	}
+	for key, val := range txn.Attrs.Agent {
+		if nil != val.otherVal {
+			p.AgentAttributes[key] = val.otherVal
+		} else {
+			p.AgentAttributes[key] = val.stringVal
+		}
+	}
+	for key, val := range txn.Attrs.user {
+		p.UserAttributes[key] = val.value
+	}
+	return p
+}
+
+// matchSamplingRule returns the first rule which matches.
+func matchSamplingRule(rules []SamplingRule, p *SamplingParameters) (SamplingRule, bool) {
+	for _, r := range rules {
+		if r.matches(p) {
+			return r, true
+		}
+	}
+	return SamplingRule{}, false
+}
+
+// decideSampling calls the Sampler of the configuration if the sampling
+// decision has yet to be made and no sampling rule matches.  The Sampler is
+// given a snapshot of the transaction and is called without holding the txn
+// lock, so that it may use the Transaction.  It is called at most once per
+// transaction, and its result is used by computeSampled.
+func (txn *txn) decideSampling() {
+	sampler := txn.Config.Sampling.Sampler
+	if nil == sampler {
+		return
+	}
+	txn.Lock()
+	if txn.finished || !txn.BetterCAT.Enabled || txn.sampledCalculated || txn.samplerCalled {
+		txn.Unlock()
+		return
+	}
+	p := txn.samplingParameters()
+	if _, ok := matchSamplingRule(txn.Config.Sampling.Rules, &p); ok {
+		txn.Unlock()
+		return
+	}
+	txn.samplerCalled = true
+	txn.Unlock()
+
+	result := sampler.ShouldSample(p)
+
+	txn.Lock()
+	txn.samplerResult = &result
+	txn.Unlock()
+}
+
+// samplingOverride applies the sampling rules and then the result of the
+// Sampler of the configuration.  The first rule which matches is used.  The
+// Sampler is not called here since the txn is locked: If decideSampling has
+// not been called, the decision is left to the adaptive sampler.
+func (txn *txn) samplingOverride() SamplingResult {
+	if rules := txn.Config.Sampling.Rules; len(rules) > 0 {
+		p := txn.samplingParameters()
+		if r, ok := matchSamplingRule(rules, &p); ok {
+			return SamplingResult{Decision: r.Decision, Priority: r.Priority}
+		}
+	}
+	if nil != txn.samplerResult {
+		return *txn.samplerResult
+	}
+	return SamplingResult{}
+}
+
+// computeSampled makes the sampling decision of the transaction.
+func (txn *txn) computeSampled(now time.Time) {
+	txn.sampledBeforeError = !txn.txnEvent.HasError
+	result := txn.samplingOverride()
+	switch result.Decision {
+	case SamplingKeep:
+		txn.BetterCAT.Sampled = true
+	case SamplingDrop:
+		txn.BetterCAT.Sampled = false
+	default:
+		txn.BetterCAT.Sampled = txn.appRun.adaptiveSampler.computeSampled(txn.BetterCAT.Priority.Float32(), now)
+	}
+	if txn.BetterCAT.Sampled {
+		txn.BetterCAT.Priority += 1.0
+	}
+	if 0 != result.Priority {
+		txn.BetterCAT.Priority = priority(result.Priority)
+	}
+}
+
+// applyErrorSamplingRule is called when the transaction ends.  If an error
+// was noticed after the sampling decision and the first sampling rule which
+// now matches is an error rule, its decision replaces the previous one.
+func (txn *txn) applyErrorSamplingRule() {
+	if !txn.sampledBeforeError || !txn.txnEvent.HasError || 0 == len(txn.Config.Sampling.Rules) {
+		return
+	}
+	p := txn.samplingParameters()
+	r, ok := matchSamplingRule(txn.Config.Sampling.Rules, &p)
+	if !ok || !r.HasError {
+		return
+	}
+	switch r.Decision {
+	case SamplingKeep:
+		if !txn.BetterCAT.Sampled {
+			txn.BetterCAT.Sampled = true
+			txn.BetterCAT.Priority += 1.0
+		}
+	case SamplingDrop:
+		if txn.BetterCAT.Sampled {
+			txn.BetterCAT.Sampled = false
+			txn.BetterCAT.Priority -= 1.0
+		}
+	}
+	if 0 != r.Priority {
+		txn.BetterCAT.Priority = priority(r.Priority)
+	}
+}
+
+// tailSamplingKeep decides whether the buffered span events of the ended
+// transaction are kept.  See Config.SpanEvents.TailSampling.
+func (txn *txn) tailSamplingKeep() (bool, float32) {
+	ts := txn.Config.SpanEvents.TailSampling
+	if len(ts.Rules) > 0 {
+		p := txn.samplingParameters()
+		for _, r := range ts.Rules {
+			if !r.matches(&p) {
+				continue
+			}
+			switch r.Decision {
+			case SamplingKeep:
+				return true, r.Priority
+			case SamplingDrop:
+				return false, r.Priority
+			}
+		}
+	}
+	if txn.BetterCAT.Sampled {
+		return true, 0
+	}
+	if ts.KeepErrors && txn.txnEvent.HasError {
+		return true, 0
+	}
+	if ts.MinDuration > 0 && txn.Duration >= ts.MinDuration {
+		return true, 0
+	}
+	return false, 0
+}
+
+// decideTailSampling keeps or drops the buffered span events of the ended
+// transaction.  Dropped span events are neither harvested nor sent to the
+// trace observer.
+func (txn *txn) decideTailSampling() {
+	keep, p := txn.tailSamplingKeep()
+	txn.tailSamplingDecided = true
+	txn.tailSamplingKept = keep
+	if keep {
+		if !txn.BetterCAT.Sampled {
+			txn.BetterCAT.Sampled = true
+			txn.BetterCAT.Priority += 1.0
+		}
+	} else {
+		txn.SpanEvents = nil
+	}
+	if 0 != p {
+		txn.BetterCAT.Priority = priority(p)
+	}
+}
@@ -0,0 +1,384 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package newrelic
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/newrelic/go-agent/v3/internal"
+)
+
+type samplerFunc func(SamplingParameters) SamplingResult
+
+func (f samplerFunc) ShouldSample(p SamplingParameters) SamplingResult { return f(p) }
+
+func TestGlobMatch(t *testing.T) {
+	testcases := []struct {
+		pattern string
+		s       string
+		match   bool
+	}{
+		{pattern: "", s: "", match: true},
+		{pattern: "", s: "a", match: false},
+		{pattern: "*", s: "", match: true},
+		{pattern: "*", s: "WebTransaction/Go/hello", match: true},
+		{pattern: "/checkout", s: "/checkout", match: true},
+		{pattern: "/checkout", s: "/checkout/confirm", match: false},
+		{pattern: "/checkout*", s: "/checkout/confirm", match: true},
+		{pattern: "*/confirm", s: "/checkout/confirm", match: true},
+		{pattern: "/c*t/*m", s: "/checkout/confirm", match: true},
+		{pattern: "/c*t/*m", s: "/checkout/confirmed", match: false},
+		{pattern: "*aa", s: "a", match: false},
+		{pattern: "a*a", s: "a", match: false},
+		{pattern: "*b*bc", s: "bc", match: false},
+	}
+	for _, tc := range testcases {
+		if globMatch(tc.pattern, tc.s) != tc.match {
+			t.Error(tc.pattern, tc.s, tc.match)
+		}
+	}
+}
+
+func sampleNothing(reply *internal.ConnectReply) {
+	distributedTracingReplyFields(reply)
+	reply.SetSampleNothing()
+}
+
+func TestSamplingRuleKeepsTransaction(t *testing.T) {
+	app := testApp(sampleNothing, func(cfg *Config) {
+		enableBetterCAT(cfg)
+		cfg.Sampling.Rules = []SamplingRule{
+			{TransactionName: "/checkout*", Decision: SamplingKeep},
+		}
+	}, t)
+	txn := app.StartTransaction("/checkout/confirm")
+	if !txn.IsSampled() {
+		t.Error("checkout transaction not sampled")
+	}
+	if p := txn.thread.BetterCAT.Priority; p < 1 {
+		t.Error(p)
+	}
+	txn.End()
+
+	txn = app.StartTransaction("/cart")
+	if txn.IsSampled() {
+		t.Error("cart transaction sampled")
+	}
+	txn.End()
+}
+
+func TestSamplingRuleAttribute(t *testing.T) {
+	app := testApp(distributedTracingReplyFields, func(cfg *Config) {
+		enableBetterCAT(cfg)
+		cfg.Sampling.Rules = []SamplingRule{
+			{Attribute: AttributeRequestURI, AttributeValue: "*/health*", Decision: SamplingDrop, Priority: 0.1},
+			{Attribute: "customer", AttributeValue: "gold", Decision: SamplingKeep},
+		}
+	}, t)
+	req, _ := http.NewRequest("GET", "http://example.com/health/live", nil)
+	txn := app.StartTransaction("health")
+	txn.SetWebRequestHTTP(req)
+	if txn.IsSampled() {
+		t.Error("health check sampled")
+	}
+	if p := txn.thread.BetterCAT.Priority; p != 0.1 {
+		t.Error(p)
+	}
+	txn.End()
+
+	txn = app.StartTransaction("order")
+	txn.AddAttribute("customer", "gold")
+	if !txn.IsSampled() {
+		t.Error("gold customer not sampled")
+	}
+	txn.End()
+}
+
+func TestSamplingRuleHasError(t *testing.T) {
+	app := testApp(sampleNothing, func(cfg *Config) {
+		enableBetterCAT(cfg)
+		cfg.Sampling.Rules = []SamplingRule{
+			{HasError: true, Decision: SamplingKeep},
+		}
+	}, t)
+	txn := app.StartTransaction("hello")
+	txn.NoticeError(errors.New("oops"))
+	if !txn.IsSampled() {
+		t.Error("transaction with error not sampled")
+	}
+	txn.End()
+
+	txn = app.StartTransaction("hello")
+	if txn.IsSampled() {
+		t.Error("transaction without error sampled")
+	}
+	txn.End()
+}
+
+func TestSamplerHook(t *testing.T) {
+	var lock sync.Mutex
+	var params []SamplingParameters
+	app := testApp(distributedTracingReplyFields, func(cfg *Config) {
+		enableBetterCAT(cfg)
+		cfg.Sampling.Rules = []SamplingRule{
+			{TransactionName: "ruled", Decision: SamplingDefer},
+		}
+		cfg.Sampling.Sampler = samplerFunc(func(p SamplingParameters) SamplingResult {
+			lock.Lock()
+			defer lock.Unlock()
+			params = append(params, p)
+			return SamplingResult{Decision: SamplingDrop}
+		})
+	}, t)
+
+	txn := app.StartTransaction("hooked")
+	txn.AddAttribute("zip", "zap")
+	if txn.IsSampled() {
+		t.Error("sampler decision not used")
+	}
+	txn.End()
+
+	// A matching rule prevents the Sampler from being called.
+	txn = app.StartTransaction("ruled")
+	if !txn.IsSampled() {
+		t.Error("adaptive sampler decision not used")
+	}
+	txn.End()
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(params) != 1 {
+		t.Fatal(len(params))
+	}
+	p := params[0]
+	if p.TransactionName != "hooked" || p.IsWeb || p.HasError ||
+		p.UserAttributes["zip"] != "zap" || p.Priority <= 0 {
+		t.Error(p)
+	}
+}
+
+func TestSamplerUsesTransaction(t *testing.T) {
+	var txn *Transaction
+	app := testApp(distributedTracingReplyFields, func(cfg *Config) {
+		enableBetterCAT(cfg)
+		cfg.Sampling.Sampler = samplerFunc(func(p SamplingParameters) SamplingResult {
+			// The txn is not locked while the Sampler is called.
+			txn.AddAttribute("sampler", "called")
+			txn.IsSampled()
+			return SamplingResult{Decision: SamplingKeep}
+		})
+	}, t)
+	txn = app.StartTransaction("hello")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		txn.StartSegment("segment").End()
+		txn.End()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Sampler using the Transaction deadlocked")
+	}
+	if !txn.thread.BetterCAT.Sampled {
+		t.Error("sampler decision not used")
+	}
+	app.ExpectTxnEvents(t, []internal.WantEvent{{
+		Intrinsics: map[string]interface{}{
+			"name":     "OtherTransaction/Go/hello",
+			"sampled":  true,
+			"priority": internal.MatchAnything,
+			"guid":     internal.MatchAnything,
+			"traceId":  internal.MatchAnything,
+		},
+		UserAttributes: map[string]interface{}{"sampler": "called"},
+	}})
+}
+
+func TestSamplingRuleHasErrorAfterDecision(t *testing.T) {
+	app := testApp(sampleNothing, func(cfg *Config) {
+		enableBetterCAT(cfg)
+		cfg.Sampling.Rules = []SamplingRule{
+			{HasError: true, Decision: SamplingKeep},
+			{TransactionName: "*", Decision: SamplingDrop},
+		}
+	}, t)
+	txn := app.StartTransaction("hello")
+	// The decision is made when the first segment ends, before the error.
+	txn.StartSegment("segment").End()
+	if txn.IsSampled() {
+		t.Error("transaction without error sampled")
+	}
+	txn.NoticeError(errors.New("oops"))
+	txn.End()
+	if !txn.thread.BetterCAT.Sampled {
+		t.Error("error rule not applied when the transaction ended")
+	}
+	if txn.thread.BetterCAT.Priority < 1 {
+		t.Error(txn.thread.BetterCAT.Priority)
+	}
+}
+
+func TestSamplingInboundPayloadDecision(t *testing.T) {
+	// The decision of an inbound payload is not overridden.
+	app := testApp(distributedTracingReplyFields, func(cfg *Config) {
+		enableBetterCAT(cfg)
+		cfg.Sampling.Rules = []SamplingRule{{Decision: SamplingDrop}}
+	}, t)
+	hdrs := http.Header{}
+	txn := app.StartTransaction("outbound")
+	txn.thread.BetterCAT.Sampled = true
+	txn.thread.sampledCalculated = true
+	txn.InsertDistributedTraceHeaders(hdrs)
+	txn.End()
+
+	txn = app.StartTransaction("inbound")
+	txn.AcceptDistributedTraceHeaders(TransportHTTP, hdrs)
+	if !txn.IsSampled() {
+		t.Error("inbound decision overridden")
+	}
+	txn.End()
+}
+
+func harvestedSpans(tapp expectApp) []HarvestEvent {
+	return newHarvestData(tapp.Private.(*app).testHarvest, time.Now(), nil).SpanEvents()
+}
+
+func TestTailSamplingKeepsErrors(t *testing.T) {
+	app := testApp(sampleNothing, func(cfg *Config) {
+		enableBetterCAT(cfg)
+		cfg.SpanEvents.TailSampling.Enabled = true
+	}, t)
+	txn := app.StartTransaction("hello")
+	seg := txn.StartSegment("mySegment")
+	txn.NoticeError(errors.New("oops"))
+	seg.End()
+	txn.End()
+
+	spans := harvestedSpans(app)
+	if len(spans) != 2 {
+		t.Fatal(len(spans))
+	}
+	for _, s := range spans {
+		if s.Intrinsics["sampled"] != true || s.Intrinsics["priority"].(float64) < 1 {
+			t.Error(s.Intrinsics)
+		}
+		if s.Intrinsics["name"] == "Custom/mySegment" && nil == s.Intrinsics["parentId"] {
+			t.Error("child span has no parent", s.Intrinsics)
+		}
+	}
+	if !txn.thread.BetterCAT.Sampled {
+		t.Error("transaction not marked as sampled")
+	}
+}
+
+func TestTailSamplingDropsUnsampled(t *testing.T) {
+	app := testApp(sampleNothing, func(cfg *Config) {
+		enableBetterCAT(cfg)
+		cfg.SpanEvents.TailSampling.Enabled = true
+		cfg.SpanEvents.TailSampling.MinDuration = time.Hour
+	}, t)
+	txn := app.StartTransaction("hello")
+	txn.StartSegment("mySegment").End()
+	txn.End()
+	if spans := harvestedSpans(app); len(spans) != 0 {
+		t.Error(len(spans))
+	}
+	if txn.thread.BetterCAT.Sampled {
+		t.Error("transaction marked as sampled")
+	}
+}
+
+func TestTailSamplingMinDuration(t *testing.T) {
+	app := testApp(sampleNothing, func(cfg *Config) {
+		enableBetterCAT(cfg)
+		cfg.SpanEvents.TailSampling.Enabled = true
+		cfg.SpanEvents.TailSampling.MinDuration = time.Nanosecond
+	}, t)
+	txn := app.StartTransaction("hello")
+	txn.StartSegment("mySegment").End()
+	time.Sleep(time.Millisecond)
+	txn.End()
+	if spans := harvestedSpans(app); len(spans) != 2 {
+		t.Error(len(spans))
+	}
+}
+
+func TestTailSamplingRules(t *testing.T) {
+	app := testApp(distributedTracingReplyFields, func(cfg *Config) {
+		enableBetterCAT(cfg)
+		cfg.SpanEvents.TailSampling.Enabled = true
+		cfg.SpanEvents.TailSampling.Rules = []SamplingRule{
+			{TransactionName: "/health", Decision: SamplingDrop},
+			{TransactionName: "/checkout", Decision: SamplingKeep, Priority: 1.5},
+		}
+	}, t)
+	txn := app.StartTransaction("/health")
+	txn.StartSegment("mySegment").End()
+	txn.End()
+	if spans := harvestedSpans(app); len(spans) != 0 {
+		t.Error(len(spans))
+	}
+
+	txn = app.StartTransaction("/checkout")
+	txn.End()
+	spans := harvestedSpans(app)
+	if len(spans) != 1 {
+		t.Fatal(len(spans))
+	}
+	if p := spans[0].Intrinsics["priority"]; p != 1.5 {
+		t.Error(p)
+	}
+}
+
+// spanRecorder is a traceObserver which records the spans it consumes.
+type spanRecorder struct {
+	sync.Mutex
+	spans []*spanEvent
+}
+
+func (r *spanRecorder) restart(internal.AgentRunID, map[string]string) {}
+func (r *spanRecorder) shutdown(time.Duration) error                   { return nil }
+func (r *spanRecorder) dumpSupportabilityMetrics() map[string]float64  { return nil }
+func (r *spanRecorder) initialConnCompleted() bool                     { return true }
+func (r *spanRecorder) consumeSpan(s *spanEvent) {
+	r.Lock()
+	defer r.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+func TestTailSamplingTraceObserver(t *testing.T) {
+	tapp := testApp(sampleNothing, func(cfg *Config) {
+		enableBetterCAT(cfg)
+		cfg.SpanEvents.TailSampling.Enabled = true
+		cfg.SpanEvents.TailSampling.KeepErrors = true
+	}, t)
+	obs := &spanRecorder{}
+	tapp.Private.(*app).setObserver(obs)
+
+	txn := tapp.StartTransaction("dropped")
+	txn.StartSegment("mySegment").End()
+	txn.End()
+
+	txn = tapp.StartTransaction("kept")
+	traceID := txn.GetTraceMetadata().TraceID
+	txn.StartSegment("mySegment").End()
+	txn.NoticeError(errors.New("oops"))
+	txn.End()
+
+	obs.Lock()
+	defer obs.Unlock()
+	if len(obs.spans) != 2 {
+		t.Fatal(len(obs.spans))
+	}
+	for _, s := range obs.spans {
+		if !s.Sampled || s.TraceID != traceID {
+			t.Error(s)
+		}
+	}
+}
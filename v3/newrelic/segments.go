@@ -5,6 +5,7 @@ package newrelic
 
 import (
 	"net/http"
+	"time"
 )
 
 // SegmentStartTime is created by Transaction.StartSegmentNow and marks the
@@ -67,6 +68,11 @@ type DatastoreSegment struct {
 	// being executed.  This becomes the db.instance attribute on Span events
 	// and Transaction Trace segments.
 	DatabaseName string
+
+	// explain is set by SQL driver instrumentation which can capture the
+	// plans of slow queries.  It is called when a slow query ends, and
+	// returns the function which captures the plan, or nil.
+	explain func() sqlExplainFunc
 }
 
 // ExternalSegment instruments external calls.  StartExternalSegment is the
@@ -122,6 +128,28 @@ type MessageProducerSegment struct {
 	DestinationTemporary bool
 }
 
+// MessageConsumerSegment instruments calls to receive messages from a queueing
+// system.  Use it when messages are consumed inside an existing Transaction,
+// for example when polling a queue.  To create a Transaction for each consumed
+// message, use Transaction.SetMessageRequest instead.
+type MessageConsumerSegment struct {
+	StartTime SegmentStartTime
+
+	// Library is the name of the library instrumented.  eg. "RabbitMQ",
+	// "JMS"
+	Library string
+
+	// DestinationType is the destination type.
+	DestinationType MessageDestinationType
+
+	// DestinationName is the name of your queue or topic.  eg. "UsersQueue".
+	DestinationName string
+
+	// DestinationTemporary must be set to true if destination is temporary
+	// to improve metric grouping.
+	DestinationTemporary bool
+}
+
 // MessageDestinationType is used for the MessageSegment.DestinationType field.
 type MessageDestinationType string
 
@@ -144,6 +172,69 @@ func (s *Segment) AddAttribute(key string, val interface{}) {
 	addSpanAttr(s.StartTime, key, val)
 }
 
+// AddEvent records a timestamped event within the segment, such as a retry or
+// a cache miss.  Events are sent along with the segment's span event and
+// require distributed tracing and span events to be enabled.  The segment
+// must not have ended.
+//
+// At most 100 events may be added to a segment.  The attributes follow the
+// same rules as AddAttribute: there may be at most 64 of them and they are
+// subject to the span attribute configuration.  They are removed in high
+// security mode.  If there are too many attributes or one of them is invalid,
+// the event is not recorded and the error is logged.
+//
+// An event is kept or discarded along with the span event of its segment, and
+// does not count against the span event limit.
+func (s *Segment) AddEvent(name string, attributes map[string]interface{}) {
+	if nil == s || nil == s.StartTime.thread {
+		return
+	}
+	if err := s.StartTime.thread.AddSpanAnnotation(s.StartTime.start, name, attributes, time.Now()); err != nil {
+		s.StartTime.thread.logAPIError(err, "add segment event", map[string]interface{}{
+			"name": name,
+		})
+	}
+}
+
+// AddLink links the segment to a span of another trace.  This is
+// useful when a segment processes work started elsewhere, such as a consumer
+// handling a batch of messages which were produced in many traces.  The
+// TraceMetadata of the other span may be obtained using
+// Transaction.GetTraceMetadata in the process that created it.
+//
+// At most 100 links may be added to a segment, which must not have ended.
+// Links require distributed tracing and span events to be enabled.  Like events, links are kept or
+// discarded along with the span event of their segment.
+func (s *Segment) AddLink(link TraceMetadata) {
+	if nil == s || nil == s.StartTime.thread {
+		return
+	}
+	if err := s.StartTime.thread.AddSpanLink(s.StartTime.start, link, time.Now()); err != nil {
+		s.StartTime.thread.logAPIError(err, "add segment link", map[string]interface{}{
+			"traceID": link.TraceID,
+			"spanID":  link.SpanID,
+		})
+	}
+}
+
+// NoticeError records an error on the segment.  The error class, message, and
+// whether the error is expected are added to the segment's span and
+// transaction trace node, and unexpected errors are counted in the
+// SegmentErrors metrics of the segment.  Unlike Transaction.NoticeError, the
+// transaction is not marked as failed, which suits failures of calls which
+// are retried.  Call Transaction.NoticeError as well when the error makes the
+// transaction fail.
+//
+// The error is examined like in Transaction.NoticeError, and the rules of
+// Config.ErrorCollector apply.  Only the last error noticed on a segment is
+// kept.
+func (s *Segment) NoticeError(err error) {
+	if nil == s {
+		return
+	}
+	noticeSegmentError(s.StartTime, err)
+}
+
 // End finishes the segment.
 func (s *Segment) End() {
 	if s == nil {
@@ -154,6 +245,9 @@ func (s *Segment) End() {
 			"name": s.Name,
 		})
 	}
+	if thd := s.StartTime.thread; nil != thd && thd.Config.profilerLabelsEnabled() {
+		thd.endSegmentProfilerLabels(s.StartTime.start)
+	}
 }
 
 // AddAttribute adds a key value pair to the current DatastoreSegment.
@@ -167,6 +261,15 @@ func (s *DatastoreSegment) AddAttribute(key string, val interface{}) {
 	addSpanAttr(s.StartTime, key, val)
 }
 
+// NoticeError records an error on the datastore segment.  See
+// Segment.NoticeError.
+func (s *DatastoreSegment) NoticeError(err error) {
+	if nil == s {
+		return
+	}
+	noticeSegmentError(s.StartTime, err)
+}
+
 // End finishes the datastore segment.
 func (s *DatastoreSegment) End() {
 	if nil == s {
@@ -192,6 +295,15 @@ func (s *ExternalSegment) AddAttribute(key string, val interface{}) {
 	addSpanAttr(s.StartTime, key, val)
 }
 
+// NoticeError records an error on the external segment, such as a failed
+// attempt of a call which is retried.  See Segment.NoticeError.
+func (s *ExternalSegment) NoticeError(err error) {
+	if nil == s {
+		return
+	}
+	noticeSegmentError(s.StartTime, err)
+}
+
 // End finishes the external segment.
 func (s *ExternalSegment) End() {
 	if nil == s {
@@ -234,6 +346,30 @@ func (s *MessageProducerSegment) End() {
 	}
 }
 
+// AddAttribute adds a key value pair to the current MessageConsumerSegment.
+//
+// The key must contain fewer than than 255 bytes.  The value must be a
+// number, string, or boolean.
+func (s *MessageConsumerSegment) AddAttribute(key string, val interface{}) {
+	if nil == s {
+		return
+	}
+	addSpanAttr(s.StartTime, key, val)
+}
+
+// End finishes the message consumer segment.
+func (s *MessageConsumerSegment) End() {
+	if nil == s {
+		return
+	}
+	if err := endMessageConsumer(s); err != nil {
+		s.StartTime.thread.logAPIError(err, "end message consumer segment", map[string]interface{}{
+			"library":          s.Library,
+			"destination-name": s.DestinationName,
+		})
+	}
+}
+
 // SetStatusCode sets the status code for the response of this ExternalSegment.
 // This status code will be included as an attribute on Span Events.  If status
 // code is not set using this method, then the status code found on the
@@ -299,6 +435,15 @@ func StartExternalSegment(txn *Transaction, request *http.Request) *ExternalSegm
 	return s
 }
 
+func noticeSegmentError(start SegmentStartTime, err error) {
+	if nil == start.thread {
+		return
+	}
+	if e := start.thread.NoticeSegmentError(start.start, err); nil != e {
+		start.thread.logAPIError(e, "notice segment error", nil)
+	}
+}
+
 func addSpanAttr(start SegmentStartTime, key string, val interface{}) {
 	if nil == start.thread {
 		return
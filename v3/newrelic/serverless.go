@@ -31,6 +31,9 @@ type serverlessHarvest struct {
 	// mutex to prevent race conditions.
 	sync.Mutex
 	harvest *harvest
+
+	// sinks are the sinks from Config.HarvestSinks.
+	sinks []HarvestSink
 }
 
 // newServerlessHarvest creates a new serverlessHarvest.
@@ -66,23 +69,45 @@ func (sh *serverlessHarvest) swapHarvest() *harvest {
 	return h
 }
 
-// Write logs the data in the format described by:
-// https://source.datanerd.us/agents/agent-specs/blob/master/Lambda.md
+// Write gives the data to the serverlessSink, which writes it to writer, and
+// then to the configured sinks.
 func (sh *serverlessHarvest) Write(arn string, writer io.Writer) {
 	if nil == sh {
 		return
 	}
 	harvest := sh.swapHarvest()
-	payloads := harvest.Payloads(false)
+	sinks := make([]HarvestSink, 0, 1+len(sh.sinks))
+	sinks = append(sinks, serverlessSink{
+		logger:          sh.logger,
+		awsExecutionEnv: sh.awsExecutionEnv,
+		arn:             arn,
+		writer:          writer,
+	})
+	sinks = append(sinks, sh.sinks...)
+	deliverHarvest(sh.logger, newHarvestData(harvest, time.Now(), nil), sinks)
+}
+
+// serverlessSink is the built-in HarvestSink used in ServerlessMode.
+type serverlessSink struct {
+	logger          Logger
+	awsExecutionEnv string
+	arn             string
+	writer          io.Writer
+}
+
+// Harvest logs the data in the format described by:
+// https://source.datanerd.us/agents/agent-specs/blob/master/Lambda.md
+func (s serverlessSink) Harvest(hd *HarvestData) error {
+	payloads := hd.data.Payloads(false)
 	// Note that *json.RawMessage (instead of json.RawMessage) is used to
 	// support older Go versions: https://go-review.googlesource.com/c/go/+/21811/
 	harvestPayloads := make(map[string]*json.RawMessage, len(payloads))
 	for _, p := range payloads {
 		agentRunID := ""
 		cmd := p.EndpointMethod()
-		data, err := p.Data(agentRunID, time.Now())
+		data, err := p.Data(agentRunID, hd.start)
 		if err != nil {
-			sh.logger.Error("error creating payload json", map[string]interface{}{
+			s.logger.Error("error creating payload json", map[string]interface{}{
 				"command": cmd,
 				"error":   err.Error(),
 			})
@@ -100,7 +125,7 @@ func (sh *serverlessHarvest) Write(arn string, writer io.Writer) {
 		// normal or synthetic, so that won't be an issue.  Log an error
 		// if this happens for future defensiveness.
 		if _, ok := harvestPayloads[cmd]; ok {
-			sh.logger.Error("data with duplicate command name lost", map[string]interface{}{
+			s.logger.Error("data with duplicate command name lost", map[string]interface{}{
 				"command": cmd,
 			})
 		}
@@ -111,15 +136,15 @@ func (sh *serverlessHarvest) Write(arn string, writer io.Writer) {
 	if len(harvestPayloads) == 0 {
 		// The harvest may not contain any data if the serverless
 		// transaction was ignored.
-		return
+		return nil
 	}
 
 	data, err := json.Marshal(harvestPayloads)
 	if nil != err {
-		sh.logger.Error("error creating serverless data json", map[string]interface{}{
+		s.logger.Error("error creating serverless data json", map[string]interface{}{
 			"error": err.Error(),
 		})
-		return
+		return nil
 	}
 
 	var dataBuf bytes.Buffer
@@ -142,19 +167,20 @@ func (sh *serverlessHarvest) Write(arn string, writer io.Writer) {
 			MetadataVersion:      lambdaMetadataVersion,
 			ProtocolVersion:      procotolVersion,
 			AgentVersion:         Version,
-			ExecutionEnvironment: sh.awsExecutionEnv,
-			ARN:                  arn,
+			ExecutionEnvironment: s.awsExecutionEnv,
+			ARN:                  s.arn,
 			AgentLanguage:        agentLanguage,
 		},
 		base64.StdEncoding.EncodeToString(dataBuf.Bytes()),
 	})
 
 	if err != nil {
-		sh.logger.Error("error creating serverless json", map[string]interface{}{
+		s.logger.Error("error creating serverless json", map[string]interface{}{
 			"error": err.Error(),
 		})
-		return
+		return nil
 	}
 
-	fmt.Fprintln(writer, string(js))
+	fmt.Fprintln(s.writer, string(js))
+	return nil
 }
@@ -56,6 +56,11 @@ type slowQueryInstance struct {
 	PortPathOrID       string
 	DatabaseName       string
 	StackTrace         stackTrace
+	// pendingExplain, if not nil, is started by startExplainPlans.
+	pendingExplain *pendingExplainPlan
+	// ExplainPlan is captured asynchronously, and is nil unless capture
+	// was started.
+	ExplainPlan *explainPlan
 
 	txnEvent
 }
@@ -116,6 +121,18 @@ func (slows *slowQueries) Merge(other *slowQueries, txnEvent txnEvent) {
 	}
 }
 
+// startExplainPlans starts capturing the plans of the slow queries which are
+// pending.  It is called on the slow queries of the harvest, so that the
+// plans of the queries which are not kept are not captured.
+func (slows *slowQueries) startExplainPlans(now time.Time) {
+	for _, slow := range slows.priorityQueue {
+		if nil != slow.pendingExplain {
+			slow.ExplainPlan = slow.pendingExplain.start(now)
+			slow.pendingExplain = nil
+		}
+	}
+}
+
 // merge aggregates the observations from two slow queries with the same Query.
 func (slow *slowQuery) merge(other slowQuery) {
 	slow.Count += other.Count
@@ -220,6 +237,9 @@ func (slow *slowQuery) WriteJSON(buf *bytes.Buffer) {
 	if nil != slow.QueryParameters {
 		w.writerField("query_parameters", slow.QueryParameters)
 	}
+	if nil != slow.ExplainPlan && slow.ExplainPlan.isCaptured() {
+		w.writerField("explain_plan", slow.ExplainPlan)
+	}
 
 	sharedBetterCATIntrinsics(&slow.txnEvent, &w)
 
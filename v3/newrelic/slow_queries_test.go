@@ -4,11 +4,14 @@
 package newrelic
 
 import (
+	"context"
 	"math/rand"
 	"strconv"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/newrelic/go-agent/v3/internal/logger"
 )
 
 func TestEmptySlowQueriesData(t *testing.T) {
@@ -288,3 +291,36 @@ func TestSlowQueriesBetterCAT(t *testing.T) {
 		t.Error(string(js), expect)
 	}
 }
+
+func TestSlowQueriesExplainOnlyKept(t *testing.T) {
+	explained := make(chan string, maxHarvestSlowSQLs+1)
+	slows := newSlowQueries(maxHarvestSlowSQLs)
+	for i := 0; i < maxHarvestSlowSQLs+1; i++ {
+		query := "query " + strconv.Itoa(i)
+		slows.observeInstance(slowQueryInstance{
+			// The first query is the fastest and is evicted.
+			Duration:           time.Duration(i+1) * time.Second,
+			ParameterizedQuery: query,
+			pendingExplain: &pendingExplainPlan{
+				explain: func(ctx context.Context) ([]string, [][]interface{}, error) {
+					explained <- query
+					return []string{"id"}, nil, nil
+				},
+				logger: logger.ShimLogger{},
+			},
+		})
+	}
+	slows.startExplainPlans(time.Now())
+	for _, slow := range slows.priorityQueue {
+		if nil != slow.pendingExplain || nil == slow.ExplainPlan {
+			t.Fatal(slow.ParameterizedQuery)
+		}
+		<-slow.ExplainPlan.done
+	}
+	close(explained)
+	for query := range explained {
+		if query == "query 0" {
+			t.Error("evicted query explained")
+		}
+	}
+}
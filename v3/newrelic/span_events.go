@@ -39,6 +39,24 @@ type spanEvent struct {
 	TracingVendors  string
 	AgentAttributes spanAttributeMap
 	UserAttributes  spanAttributeMap
+	Annotations     []spanAnnotation
+	Links           []spanLink
+}
+
+// spanAnnotation is a timestamped event recorded within a span using
+// Segment.AddEvent.
+type spanAnnotation struct {
+	Name       string
+	Timestamp  time.Time
+	Attributes spanAttributeMap
+}
+
+// spanLink links a span to a span of another trace.  It is recorded using
+// Segment.AddLink, and is identified by the GUID of the span which owns it.
+type spanLink struct {
+	Timestamp     time.Time
+	LinkedTraceID string
+	LinkedSpanID  string
 }
 
 // WriteJSON prepares JSON in the format expected by the collector.
@@ -100,6 +118,61 @@ func writeAttrs(buf *bytes.Buffer, attrs spanAttributeMap) {
 	}
 }
 
+// spanAnnotationEvent is the record of a spanAnnotation sent with the span
+// events.
+type spanAnnotationEvent struct {
+	span       *spanEvent
+	annotation *spanAnnotation
+}
+
+// WriteJSON prepares JSON in the format expected by the collector.
+func (e spanAnnotationEvent) WriteJSON(buf *bytes.Buffer) {
+	w := jsonFieldsWriter{buf: buf}
+	buf.WriteByte('[')
+	buf.WriteByte('{')
+	w.stringField("type", "SpanEvent")
+	w.stringField("span.id", e.span.GUID)
+	w.stringField("trace.id", e.span.TraceID)
+	w.intField("timestamp", timeToIntMillis(e.annotation.Timestamp))
+	w.stringField("name", e.annotation.Name)
+	buf.WriteByte('}')
+	buf.WriteByte(',')
+	buf.WriteByte('{')
+	writeAttrs(buf, e.annotation.Attributes)
+	buf.WriteByte('}')
+	buf.WriteByte(',')
+	buf.WriteByte('{')
+	buf.WriteByte('}')
+	buf.WriteByte(']')
+}
+
+// spanLinkEvent is the record of a spanLink sent with the span events.
+type spanLinkEvent struct {
+	span *spanEvent
+	link *spanLink
+}
+
+// WriteJSON prepares JSON in the format expected by the collector.
+func (e spanLinkEvent) WriteJSON(buf *bytes.Buffer) {
+	w := jsonFieldsWriter{buf: buf}
+	buf.WriteByte('[')
+	buf.WriteByte('{')
+	w.stringField("type", "SpanLink")
+	w.stringField("id", e.span.GUID)
+	w.stringField("trace.id", e.span.TraceID)
+	w.intField("timestamp", timeToIntMillis(e.link.Timestamp))
+	w.stringField("linkedSpanId", e.link.LinkedSpanID)
+	w.stringField("linkedTraceId", e.link.LinkedTraceID)
+	buf.WriteByte('}')
+	buf.WriteByte(',')
+	buf.WriteByte('{')
+	buf.WriteByte('}')
+	buf.WriteByte(',')
+	buf.WriteByte('{')
+	buf.WriteByte('}')
+	buf.WriteByte(']')
+}
+
 // MarshalJSON is used for testing.
 func (e *spanEvent) MarshalJSON() ([]byte, error) {
 	buf := bytes.NewBuffer(make([]byte, 0, 256))
@@ -119,6 +192,25 @@ func newSpanEvents(max int) *spanEvents {
 	}
 }
 
+// extras returns the events and links of the span, which are sent following
+// the span itself.
+func (e *spanEvent) extras() []jsonWriter {
+	if 0 == len(e.Annotations) && 0 == len(e.Links) {
+		return nil
+	}
+	extras := make([]jsonWriter, 0, len(e.Annotations)+len(e.Links))
+	for i := range e.Annotations {
+		extras = append(extras, spanAnnotationEvent{span: e, annotation: &e.Annotations[i]})
+	}
+	for i := range e.Links {
+		extras = append(extras, spanLinkEvent{span: e, link: &e.Links[i]})
+	}
+	return extras
+}
+
+// addEventPopulated adds the span to the reservoir.  The events and links of
+// the span do not take a place in the reservoir: they are written along with
+// the span, so that they are kept or discarded together.
 func (events *spanEvents) addEventPopulated(e *spanEvent) {
 	events.analyticsEvents.addEvent(analyticsEvent{priority: e.Priority, jsonWriter: e})
 }
@@ -137,7 +229,15 @@ func (events *spanEvents) MergeIntoHarvest(h *harvest) {
 }
 
 func (events *spanEvents) Data(agentRunID string, harvestStart time.Time) ([]byte, error) {
-	return events.CollectorJSON(agentRunID)
+	return events.collectorJSON(agentRunID, func(buf *bytes.Buffer, evt analyticsEvent) {
+		evt.WriteJSON(buf)
+		if e, ok := evt.jsonWriter.(*spanEvent); ok {
+			for _, extra := range e.extras() {
+				buf.WriteByte(',')
+				extra.WriteJSON(buf)
+			}
+		}
+	})
 }
 
 func (events *spanEvents) EndpointMethod() string {
@@ -4,7 +4,9 @@
 package newrelic
 
 import (
+	"bytes"
 	"encoding/json"
+	"strings"
 	"testing"
 	"time"
 
@@ -244,3 +246,199 @@ func TestSpanEventsMerge(t *testing.T) {
 		},
 	})
 }
+
+func TestSpanAnnotationAndLinkMarshal(t *testing.T) {
+	e := sampleSpanEvent
+	annotation := &spanAnnotation{
+		Name:      "retry",
+		Timestamp: timeFromUnixMilliseconds(1488393111500),
+	}
+	annotation.Attributes.addInt("attempt", 2)
+	buf := &bytes.Buffer{}
+	spanAnnotationEvent{span: &e, annotation: annotation}.WriteJSON(buf)
+	expect := compactJSONString(`[
+	{
+		"type":"SpanEvent",
+		"span.id":"guid",
+		"trace.id":"trace-id",
+		"timestamp":1488393111500,
+		"name":"retry"
+	},
+	{"attempt":2},
+	{}]`)
+	if buf.String() != expect {
+		t.Errorf("\nexpect=%s\nactual=%s\n", expect, buf.String())
+	}
+
+	link := &spanLink{
+		Timestamp:     timeFromUnixMilliseconds(1488393111500),
+		LinkedTraceID: "other-trace-id",
+		LinkedSpanID:  "other-span-id",
+	}
+	buf = &bytes.Buffer{}
+	spanLinkEvent{span: &e, link: link}.WriteJSON(buf)
+	expect = compactJSONString(`[
+	{
+		"type":"SpanLink",
+		"id":"guid",
+		"trace.id":"trace-id",
+		"timestamp":1488393111500,
+		"linkedSpanId":"other-span-id",
+		"linkedTraceId":"other-trace-id"
+	},
+	{},
+	{}]`)
+	if buf.String() != expect {
+		t.Errorf("\nexpect=%s\nactual=%s\n", expect, buf.String())
+	}
+}
+
+func TestSegmentAddEventAndLink(t *testing.T) {
+	tapp := testApp(distributedTracingReplyFields, func(cfg *Config) {
+		enableBetterCAT(cfg)
+		cfg.SpanEvents.Attributes.Exclude = []string{"secret"}
+	}, t)
+	txn := tapp.StartTransaction("consumer")
+	seg := txn.StartSegment("batch")
+	seg.AddEvent("retry", map[string]interface{}{
+		"attempt": 2,
+		"secret":  "password",
+	})
+	seg.AddLink(TraceMetadata{TraceID: "other-trace-id", SpanID: "other-span-id"})
+	// Links without identifiers are ignored.
+	seg.AddLink(TraceMetadata{})
+	seg.End()
+	traceID := txn.GetTraceMetadata().TraceID
+	txn.End()
+
+	byType := make(map[string][]HarvestEvent)
+	for _, e := range harvestedSpans(tapp) {
+		byType[e.Type] = append(byType[e.Type], e)
+	}
+	if len(byType["Span"]) != 2 || len(byType["SpanEvent"]) != 1 || len(byType["SpanLink"]) != 1 {
+		t.Fatal(byType)
+	}
+	var segmentSpan HarvestEvent
+	for _, s := range byType["Span"] {
+		if s.Intrinsics["name"] == "Custom/batch" {
+			segmentSpan = s
+		}
+	}
+	evt := byType["SpanEvent"][0]
+	if evt.Intrinsics["name"] != "retry" || evt.Intrinsics["span.id"] != segmentSpan.Intrinsics["guid"] ||
+		evt.Intrinsics["trace.id"] != traceID {
+		t.Error(evt.Intrinsics)
+	}
+	if len(evt.UserAttributes) != 1 || evt.UserAttributes["attempt"] != int64(2) {
+		t.Error(evt.UserAttributes)
+	}
+	link := byType["SpanLink"][0]
+	if link.Intrinsics["linkedTraceId"] != "other-trace-id" || link.Intrinsics["linkedSpanId"] != "other-span-id" ||
+		link.Intrinsics["trace.id"] != traceID || link.Intrinsics["id"] != segmentSpan.Intrinsics["guid"] {
+		t.Error(link.Intrinsics)
+	}
+}
+
+func TestSegmentAddEventLimit(t *testing.T) {
+	tapp := testApp(distributedTracingReplyFields, enableBetterCAT, t)
+	txn := tapp.StartTransaction("hello")
+	seg := txn.StartSegment("mySegment")
+	for i := 0; i < maxSpanAnnotations+1; i++ {
+		seg.AddEvent("event", nil)
+	}
+	for i := 0; i < maxSpanLinks+1; i++ {
+		seg.AddLink(TraceMetadata{TraceID: "trace-id", SpanID: "span-id"})
+	}
+	seg.End()
+	txn.End()
+
+	counts := make(map[string]int)
+	for _, e := range harvestedSpans(tapp) {
+		counts[e.Type]++
+	}
+	if counts["SpanEvent"] != maxSpanAnnotations || counts["SpanLink"] != maxSpanLinks {
+		t.Error(counts)
+	}
+}
+
+func TestSpanEventsKeepAnnotationsWithSpan(t *testing.T) {
+	events := newSpanEvents(2)
+	withExtras := sampleSpanEvent
+	withExtras.GUID = "with-extras"
+	withExtras.Priority = 0.5
+	withExtras.Annotations = []spanAnnotation{{Name: "retry"}, {Name: "cache miss"}}
+	withExtras.Links = []spanLink{{LinkedTraceID: "other-trace-id", LinkedSpanID: "other-span-id"}}
+	events.addEventPopulated(&withExtras)
+
+	// The events and links do not take places in the reservoir.
+	high := sampleSpanEvent
+	high.GUID = "high"
+	high.Priority = 0.9
+	events.addEventPopulated(&high)
+	if events.NumSeen() != 2 || events.NumSaved() != 2 {
+		t.Fatal(events.NumSeen(), events.NumSaved())
+	}
+	js, err := events.Data("agentRunID", time.Now())
+	if nil != err {
+		t.Fatal(err)
+	}
+	var payload []json.RawMessage
+	if err := json.Unmarshal(js, &payload); nil != err {
+		t.Fatal(err)
+	}
+	var written [][]map[string]interface{}
+	if err := json.Unmarshal(payload[2], &written); nil != err {
+		t.Fatal(err)
+	}
+	if len(written) != 5 {
+		t.Fatal(string(js))
+	}
+	if written[0][0]["guid"] != "with-extras" || written[1][0]["span.id"] != "with-extras" ||
+		written[2][0]["span.id"] != "with-extras" || written[3][0]["type"] != "SpanLink" ||
+		written[4][0]["guid"] != "high" {
+		t.Error(string(js))
+	}
+
+	// When the span is evicted, its events and links go with it.
+	higher := sampleSpanEvent
+	higher.GUID = "higher"
+	higher.Priority = 0.95
+	events.addEventPopulated(&higher)
+	js, err = events.Data("agentRunID", time.Now())
+	if nil != err {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(js), "with-extras") || strings.Contains(string(js), "SpanLink") {
+		t.Error(string(js))
+	}
+}
+
+func TestSegmentAddEventWithChildOpen(t *testing.T) {
+	tapp := testApp(distributedTracingReplyFields, enableBetterCAT, t)
+	txn := tapp.StartTransaction("consumer")
+	parent := txn.StartSegment("parent")
+	child := txn.StartSegment("child")
+	// The event and link are added to the parent, not to the open child.
+	parent.AddEvent("retry", nil)
+	parent.AddLink(TraceMetadata{TraceID: "other-trace-id", SpanID: "other-span-id"})
+	child.End()
+	parent.End()
+	txn.End()
+
+	guids := make(map[string]string)
+	var extras []HarvestEvent
+	for _, e := range harvestedSpans(tapp) {
+		switch e.Type {
+		case "Span":
+			guids[e.Intrinsics["name"].(string)] = e.Intrinsics["guid"].(string)
+		default:
+			extras = append(extras, e)
+		}
+	}
+	if len(extras) != 2 {
+		t.Fatal(extras)
+	}
+	if extras[0].Intrinsics["span.id"] != guids["Custom/parent"] {
+		t.Error(extras[0].Intrinsics, guids)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// +build go1.11
+
+package newrelic
+
+import (
+	"database/sql"
+)
+
+// SampleDBStats registers a database so that the statistics of its
+// connection pool are sampled along with the runtime statistics, at the
+// period of the runtime sampler.  The statistics are recorded as metrics
+// beginning with "Go/SQL/" followed by the name given, which distinguishes
+// multiple databases:  The maximum and current number of open connections,
+// the number of connections in use and idle, and the number of waits for a
+// connection, the total time waited, and the number of connections closed
+// because of the idle and lifetime limits since the previous sample.
+// Waiting for a connection indicates that the pool is too small.
+//
+// Nothing is sampled if Config.RuntimeSampler.Enabled is false.
+//
+//	db, _ := sql.Open("nrmysql", dsn)
+//	app.SampleDBStats("orders", db)
+func (app *Application) SampleDBStats(name string, db *sql.DB) {
+	if nil == app || nil == app.app || nil == db {
+		return
+	}
+	app.app.sampleDBStats(name, db.Stats)
+}
+
+func (app *app) sampleDBStats(name string, stats func() sql.DBStats) {
+	previous := stats()
+	app.samplers.add(func() harvestable {
+		current := stats()
+		sample := dbStatsSample{
+			name:     name,
+			previous: previous,
+			current:  current,
+		}
+		previous = current
+		return sample
+	})
+}
+
+// dbStatsSample contains two consecutive samples of the statistics of a
+// connection pool.  The cumulative statistics are recorded as the difference
+// between the two.
+type dbStatsSample struct {
+	name     string
+	previous sql.DBStats
+	current  sql.DBStats
+}
+
+// MergeIntoHarvest implements harvestable.
+func (s dbStatsSample) MergeIntoHarvest(h *harvest) {
+	prefix := dbStatsPrefix + s.name
+	cur := s.current
+	prev := s.previous
+	h.Metrics.addValue(prefix+dbStatsMaxOpen, "", float64(cur.MaxOpenConnections), forced)
+	h.Metrics.addValue(prefix+dbStatsOpen, "", float64(cur.OpenConnections), forced)
+	h.Metrics.addValue(prefix+dbStatsInUse, "", float64(cur.InUse), forced)
+	h.Metrics.addValue(prefix+dbStatsIdle, "", float64(cur.Idle), forced)
+	h.Metrics.addValue(prefix+dbStatsWaitCount, "", float64(cur.WaitCount-prev.WaitCount), forced)
+	h.Metrics.addValue(prefix+dbStatsWaitDuration, "", (cur.WaitDuration - prev.WaitDuration).Seconds(), forced)
+	h.Metrics.addValue(prefix+dbStatsMaxIdleClosed, "", float64(cur.MaxIdleClosed-prev.MaxIdleClosed), forced)
+	h.Metrics.addValue(prefix+dbStatsMaxLifetimeClosed, "", float64(cur.MaxLifetimeClosed-prev.MaxLifetimeClosed), forced)
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// +build go1.11
+
+package newrelic
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/newrelic/go-agent/v3/internal"
+)
+
+func TestSampleDBStats(t *testing.T) {
+	tapp := testApp(nil, nil, t)
+	a := tapp.Private.(*app)
+	stats := sql.DBStats{
+		MaxOpenConnections: 10,
+		OpenConnections:    4,
+		InUse:              3,
+		Idle:               1,
+		WaitCount:          5,
+		WaitDuration:       2 * time.Second,
+		MaxIdleClosed:      1,
+		MaxLifetimeClosed:  2,
+	}
+	a.sampleDBStats("orders", func() sql.DBStats { return stats })
+	stats.OpenConnections = 10
+	stats.InUse = 10
+	stats.Idle = 0
+	stats.WaitCount = 12
+	stats.WaitDuration = 5 * time.Second
+	stats.MaxLifetimeClosed = 3
+
+	samples := a.samplers.sample()
+	if len(samples) != 1 {
+		t.Fatal(samples)
+	}
+	h := newHarvest(now, dfltHarvestCfgr)
+	samples[0].MergeIntoHarvest(h)
+	expectMetrics(t, h.Metrics, []internal.WantMetric{
+		{Name: "Go/SQL/orders/MaxOpenConnections", Scope: "", Forced: true, Data: []float64{1, 10, 10, 10, 10, 100}},
+		{Name: "Go/SQL/orders/OpenConnections", Scope: "", Forced: true, Data: []float64{1, 10, 10, 10, 10, 100}},
+		{Name: "Go/SQL/orders/InUse", Scope: "", Forced: true, Data: []float64{1, 10, 10, 10, 10, 100}},
+		{Name: "Go/SQL/orders/Idle", Scope: "", Forced: true, Data: []float64{1, 0, 0, 0, 0, 0}},
+		{Name: "Go/SQL/orders/WaitCount", Scope: "", Forced: true, Data: []float64{1, 7, 7, 7, 7, 49}},
+		{Name: "Go/SQL/orders/WaitDuration", Scope: "", Forced: true, Data: []float64{1, 3, 3, 3, 3, 9}},
+		{Name: "Go/SQL/orders/MaxIdleClosed", Scope: "", Forced: true, Data: []float64{1, 0, 0, 0, 0, 0}},
+		{Name: "Go/SQL/orders/MaxLifetimeClosed", Scope: "", Forced: true, Data: []float64{1, 1, 1, 1, 1, 1}},
+	})
+
+	// The next sample is compared with the previous one.
+	stats.WaitCount = 13
+	h = newHarvest(now, dfltHarvestCfgr)
+	a.samplers.sample()[0].MergeIntoHarvest(h)
+	expectMetricsPresent(t, h.Metrics, []internal.WantMetric{
+		{Name: "Go/SQL/orders/WaitCount", Scope: "", Forced: true, Data: []float64{1, 1, 1, 1, 1, 1}},
+		{Name: "Go/SQL/orders/WaitDuration", Scope: "", Forced: true, Data: []float64{1, 0, 0, 0, 0, 0}},
+	})
+}
+
+func TestSampleDBStatsNil(t *testing.T) {
+	var nilApp *Application
+	nilApp.SampleDBStats("orders", &sql.DB{})
+	tapp := testApp(nil, nil, t)
+	tapp.SampleDBStats("orders", nil)
+	if samples := tapp.Private.(*app).samplers.sample(); len(samples) != 0 {
+		t.Error(samples)
+	}
+}
@@ -8,6 +8,9 @@ package newrelic
 import (
 	"context"
 	"database/sql/driver"
+	"io"
+	"reflect"
+	"sync"
 	"time"
 )
 
@@ -20,26 +23,45 @@ type SQLDriverSegmentBuilder struct {
 	BaseSegment DatastoreSegment
 	ParseQuery  func(segment *DatastoreSegment, query string)
 	ParseDSN    func(segment *DatastoreSegment, dataSourceName string)
+	// ExplainQuery, if not nil, returns the statement which explains the
+	// plan of the query, such as "EXPLAIN " + query, or "" if the query
+	// should not be explained.  It is used to capture the plans of slow
+	// queries when Config.DatastoreTracer.SlowQuery.ExplainPlans.Enabled
+	// is true.  The statement is run asynchronously, with the arguments of
+	// the query, so it must not modify data.  It is only run for the
+	// slow queries which are kept to be sent to New Relic, at most
+	// Config.DatastoreTracer.SlowQuery.ExplainPlans.MaxPerMinute times per
+	// minute, on a separate connection which is reused for the queries of
+	// the same data source.
+	ExplainQuery func(query string) string
+
+	// explainConn is the separate connection used to explain queries.
+	explainConn *explainConn
 }
 
 // InstrumentSQLDriver wraps a driver.Driver, adding instrumentation for exec
-// and query calls made with a transaction-containing context.  Use this to
+// and query calls made with a transaction-containing context.  The iteration
+// of the rows returned by queries, the beginning, commit, and rollback of
+// database transactions, and the opening of connections by a
+// driver.Connector are also instrumented.  Use this to
 // instrument a database driver that is not supported by an existing integration
 // package (nrmysql, nrpq, and nrsqlite3). See
 // https://github.com/newrelic/go-agent/blob/master/v3/integrations/nrmysql/nrmysql.go
 // for example use.
 func InstrumentSQLDriver(d driver.Driver, bld SQLDriverSegmentBuilder) driver.Driver {
-	return optionalMethodsDriver(&wrapDriver{bld: bld, original: d})
+	return optionalMethodsDriver(newWrapDriver(d, bld))
 }
 
 // InstrumentSQLConnector wraps a driver.Connector, adding instrumentation for
-// exec and query calls made with a transaction-containing context.  Use this to
+// exec and query calls made with a transaction-containing context.  As with
+// InstrumentSQLDriver, rows, database transactions, and the opening of
+// connections are also instrumented.  Use this to
 // instrument a database connector that is not supported by an existing
 // integration package (nrmysql, nrpq, and nrsqlite3). See
 // https://github.com/newrelic/go-agent/blob/master/v3/integrations/nrmysql/nrmysql.go
 // for example use.
 func InstrumentSQLConnector(connector driver.Connector, bld SQLDriverSegmentBuilder) driver.Connector {
-	return &wrapConnector{original: connector, bld: bld}
+	return newWrapConnector(connector, bld)
 }
 
 func (bld SQLDriverSegmentBuilder) useDSN(dsn string) SQLDriverSegmentBuilder {
@@ -56,6 +78,166 @@ func (bld SQLDriverSegmentBuilder) useQuery(query string) SQLDriverSegmentBuilde
 	return bld
 }
 
+// prepareExplain returns the function set as DatastoreSegment.explain for
+// the query, or nil if the plans of queries cannot be captured.
+func (bld SQLDriverSegmentBuilder) prepareExplain(query string, args []driver.NamedValue) func() sqlExplainFunc {
+	if nil == bld.ExplainQuery || nil == bld.explainConn {
+		return nil
+	}
+	return func() sqlExplainFunc {
+		explain := bld.ExplainQuery(query)
+		if "" == explain {
+			return nil
+		}
+		// The arguments are copied since the query is explained after
+		// it has returned.
+		cpy := make([]driver.NamedValue, len(args))
+		copy(cpy, args)
+		for idx, arg := range cpy {
+			if b, ok := arg.Value.([]byte); ok {
+				cpy[idx].Value = append([]byte(nil), b...)
+			}
+		}
+		conn := bld.explainConn
+		return func(ctx context.Context) ([]string, [][]interface{}, error) {
+			return conn.run(ctx, explain, cpy)
+		}
+	}
+}
+
+// explainConnIdleTimeout is the time after which the connection used to
+// explain queries is closed if it is not used.
+const explainConnIdleTimeout = time.Minute
+
+// explainConn is the connection used to explain the queries of a data
+// source.  It is opened when the first query is explained, and is closed
+// after an error or once it has been idle for explainConnIdleTimeout.
+// Queries are explained one at a time.
+type explainConn struct {
+	sync.Mutex
+	open func(context.Context) (driver.Conn, error)
+	conn driver.Conn
+	idle *time.Timer
+}
+
+func (c *explainConn) run(ctx context.Context, explain string, args []driver.NamedValue) ([]string, [][]interface{}, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if nil != c.idle {
+		c.idle.Stop()
+	}
+	if nil == c.conn {
+		conn, err := c.open(ctx)
+		if nil != err {
+			return nil, nil, err
+		}
+		c.conn = conn
+	}
+	columns, result, err := runExplain(ctx, c.conn, explain, args)
+	if nil != err {
+		c.conn.Close()
+		c.conn = nil
+		return nil, nil, err
+	}
+	c.idle = time.AfterFunc(explainConnIdleTimeout, c.close)
+	return columns, result, nil
+}
+
+func (c *explainConn) close() {
+	c.Lock()
+	defer c.Unlock()
+
+	if nil != c.conn {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+// runExplain runs the EXPLAIN statement on the connection and returns its
+// result.
+func runExplain(ctx context.Context, conn driver.Conn, explain string, args []driver.NamedValue) ([]string, [][]interface{}, error) {
+	var rows driver.Rows
+	err := driver.ErrSkip
+	if queryer, ok := conn.(driver.QueryerContext); ok {
+		rows, err = queryer.QueryContext(ctx, explain, args)
+	}
+	if driver.ErrSkip == err {
+		var stmt driver.Stmt
+		if preparer, ok := conn.(driver.ConnPrepareContext); ok {
+			stmt, err = preparer.PrepareContext(ctx, explain)
+		} else {
+			stmt, err = conn.Prepare(explain)
+		}
+		if nil != err {
+			return nil, nil, err
+		}
+		defer stmt.Close()
+		if queryer, ok := stmt.(driver.StmtQueryContext); ok {
+			rows, err = queryer.QueryContext(ctx, args)
+		} else {
+			values := make([]driver.Value, len(args))
+			for idx, arg := range args {
+				values[idx] = arg.Value
+			}
+			rows, err = stmt.Query(values)
+		}
+	}
+	if nil != err {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	columns := rows.Columns()
+	var result [][]interface{}
+	for len(result) < maxExplainPlanRows {
+		dest := make([]driver.Value, len(columns))
+		if err := rows.Next(dest); io.EOF == err {
+			break
+		} else if nil != err {
+			return nil, nil, err
+		}
+		row := make([]interface{}, len(dest))
+		for idx, v := range dest {
+			row[idx] = v
+		}
+		result = append(result, row)
+	}
+	return columns, result, nil
+}
+
+func (bld SQLDriverSegmentBuilder) useOperation(operation string) SQLDriverSegmentBuilder {
+	bld.BaseSegment.Operation = operation
+	return bld
+}
+
+// rowsSegmentName returns the name of the segment which times the iteration
+// of the rows returned by a query, such as "Rows/MySQL/users".
+func (bld SQLDriverSegmentBuilder) rowsSegmentName() string {
+	name := "Rows/" + string(bld.BaseSegment.Product)
+	if "" != bld.BaseSegment.Collection {
+		name += "/" + bld.BaseSegment.Collection
+	}
+	return name
+}
+
+// wrapRows instruments the rows returned by a query made with a
+// transaction-containing context.
+func (bld SQLDriverSegmentBuilder) wrapRows(ctx context.Context, rows driver.Rows) driver.Rows {
+	txn := FromContext(ctx)
+	if nil == txn || nil == rows {
+		return rows
+	}
+	// The segment is started on a goroutine of its own, as an async
+	// segment, since it remains open until the rows are closed: on the
+	// transaction's goroutine, it would be ended out of order with the
+	// segments started while iterating the rows, or with other rows.
+	return optionalMethodsRows(&wrapRows{
+		original: rows,
+		segment:  txn.NewGoroutine().StartSegment(bld.rowsSegmentName()),
+	})
+}
+
 func (bld SQLDriverSegmentBuilder) startSegment(ctx context.Context) DatastoreSegment {
 	return bld.startSegmentAt(ctx, time.Now())
 }
@@ -69,6 +251,35 @@ func (bld SQLDriverSegmentBuilder) startSegmentAt(ctx context.Context, at time.T
 type wrapDriver struct {
 	bld      SQLDriverSegmentBuilder
 	original driver.Driver
+
+	// explainConns are the connections used to explain queries, by data
+	// source name.
+	explainLock  sync.Mutex
+	explainConns map[string]*explainConn
+}
+
+func newWrapDriver(d driver.Driver, bld SQLDriverSegmentBuilder) *wrapDriver {
+	return &wrapDriver{
+		bld:          bld,
+		original:     d,
+		explainConns: make(map[string]*explainConn),
+	}
+}
+
+// explainConnFor returns the connection used to explain the queries of the
+// data source.
+func (w *wrapDriver) explainConnFor(name string) *explainConn {
+	w.explainLock.Lock()
+	defer w.explainLock.Unlock()
+
+	c, ok := w.explainConns[name]
+	if !ok {
+		c = &explainConn{open: func(context.Context) (driver.Conn, error) {
+			return w.original.Open(name)
+		}}
+		w.explainConns[name] = c
+	}
+	return c
 }
 
 type wrapConnector struct {
@@ -76,6 +287,11 @@ type wrapConnector struct {
 	original driver.Connector
 }
 
+func newWrapConnector(connector driver.Connector, bld SQLDriverSegmentBuilder) *wrapConnector {
+	bld.explainConn = &explainConn{open: connector.Connect}
+	return &wrapConnector{original: connector, bld: bld}
+}
+
 type wrapConn struct {
 	bld      SQLDriverSegmentBuilder
 	original driver.Conn
@@ -83,17 +299,67 @@ type wrapConn struct {
 
 type wrapStmt struct {
 	bld      SQLDriverSegmentBuilder
+	query    string
 	original driver.Stmt
 }
 
+// wrapTx records the commit or rollback of a database transaction begun
+// with a transaction-containing context.
+type wrapTx struct {
+	bld      SQLDriverSegmentBuilder
+	original driver.Tx
+	ctx      context.Context
+}
+
+// The optional interfaces of driver.Rows embed driver.Rows, so these
+// interfaces containing only their additional methods are used to wrap rows.
+type (
+	rowsColumnTypeDatabaseTypeName interface {
+		ColumnTypeDatabaseTypeName(index int) string
+	}
+	rowsColumnTypeLength interface {
+		ColumnTypeLength(index int) (length int64, ok bool)
+	}
+	rowsColumnTypeNullable interface {
+		ColumnTypeNullable(index int) (nullable, ok bool)
+	}
+	rowsColumnTypePrecisionScale interface {
+		ColumnTypePrecisionScale(index int) (precision, scale int64, ok bool)
+	}
+	rowsColumnTypeScanType interface {
+		ColumnTypeScanType(index int) reflect.Type
+	}
+	rowsNextResultSet interface {
+		HasNextResultSet() bool
+		NextResultSet() error
+	}
+)
+
+// wrapRows times the iteration of rows.  Its async segment starts when the
+// query returns and ends when the rows are closed, which database/sql does
+// once the rows are exhausted.  The number of rows and the time spent fetching
+// them, which excludes the time spent by the application between rows, are
+// added as attributes.
+type wrapRows struct {
+	original driver.Rows
+	segment  *Segment
+	numRows  int
+	fetch    time.Duration
+	closed   bool
+}
+
 func (w *wrapDriver) Open(name string) (driver.Conn, error) {
 	original, err := w.original.Open(name)
 	if err != nil {
 		return nil, err
 	}
+	bld := w.bld.useDSN(name)
+	if nil != bld.ExplainQuery {
+		bld.explainConn = w.explainConnFor(name)
+	}
 	return optionalMethodsConn(&wrapConn{
 		original: original,
-		bld:      w.bld.useDSN(name),
+		bld:      bld,
 	}), nil
 }
 
@@ -103,14 +369,13 @@ func (w *wrapDriver) OpenConnector(name string) (driver.Connector, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &wrapConnector{
-		original: original,
-		bld:      w.bld.useDSN(name),
-	}, nil
+	return newWrapConnector(original, w.bld.useDSN(name)), nil
 }
 
 func (w *wrapConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	segment := w.bld.useOperation("connect").startSegment(ctx)
 	original, err := w.original.Connect(ctx)
+	segment.End()
 	if nil != err {
 		return nil, err
 	}
@@ -121,10 +386,7 @@ func (w *wrapConnector) Connect(ctx context.Context) (driver.Conn, error) {
 }
 
 func (w *wrapConnector) Driver() driver.Driver {
-	return optionalMethodsDriver(&wrapDriver{
-		bld:      w.bld,
-		original: w.original.Driver(),
-	})
+	return optionalMethodsDriver(newWrapDriver(w.original.Driver(), w.bld))
 }
 
 func prepare(original driver.Stmt, err error, bld SQLDriverSegmentBuilder, query string) (driver.Stmt, error) {
@@ -133,6 +395,7 @@ func prepare(original driver.Stmt, err error, bld SQLDriverSegmentBuilder, query
 	}
 	return optionalMethodsStmt(&wrapStmt{
 		bld:      bld.useQuery(query),
+		query:    query,
 		original: original,
 	}), nil
 }
@@ -158,7 +421,17 @@ func (w *wrapConn) Begin() (driver.Tx, error) {
 
 // BeginTx implements ConnBeginTx.
 func (w *wrapConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
-	return w.original.(driver.ConnBeginTx).BeginTx(ctx, opts)
+	segment := w.bld.useOperation("begin").startSegment(ctx)
+	tx, err := w.original.(driver.ConnBeginTx).BeginTx(ctx, opts)
+	segment.End()
+	if nil != err {
+		return nil, err
+	}
+	return &wrapTx{
+		bld:      w.bld,
+		original: tx,
+		ctx:      ctx,
+	}, nil
 }
 
 // Exec implements Execer.
@@ -172,6 +445,7 @@ func (w *wrapConn) ExecContext(ctx context.Context, query string, args []driver.
 	result, err := w.original.(driver.ExecerContext).ExecContext(ctx, query, args)
 	if err != driver.ErrSkip {
 		seg := w.bld.useQuery(query).startSegmentAt(ctx, startTime)
+		seg.explain = w.bld.prepareExplain(query, args)
 		seg.End()
 	}
 	return result, err
@@ -196,8 +470,11 @@ func (w *wrapConn) QueryContext(ctx context.Context, query string, args []driver
 	startTime := time.Now()
 	rows, err := w.original.(driver.QueryerContext).QueryContext(ctx, query, args)
 	if err != driver.ErrSkip {
-		seg := w.bld.useQuery(query).startSegmentAt(ctx, startTime)
+		bld := w.bld.useQuery(query)
+		seg := bld.startSegmentAt(ctx, startTime)
+		seg.explain = bld.prepareExplain(query, args)
 		seg.End()
+		rows = bld.wrapRows(ctx, rows)
 	}
 	return rows, err
 }
@@ -237,6 +514,7 @@ func (w *wrapStmt) CheckNamedValue(v *driver.NamedValue) error {
 func (w *wrapStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
 	segment := w.bld.startSegment(ctx)
 	result, err := w.original.(driver.StmtExecContext).ExecContext(ctx, args)
+	segment.explain = w.bld.prepareExplain(w.query, args)
 	segment.End()
 	return result, err
 }
@@ -245,8 +523,90 @@ func (w *wrapStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (d
 func (w *wrapStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
 	segment := w.bld.startSegment(ctx)
 	rows, err := w.original.(driver.StmtQueryContext).QueryContext(ctx, args)
+	segment.explain = w.bld.prepareExplain(w.query, args)
 	segment.End()
-	return rows, err
+	return w.bld.wrapRows(ctx, rows), err
+}
+
+// end records the commit or rollback of the transaction.  It is skipped if
+// the context is done, since database/sql then rolls back the transaction
+// from another goroutine.
+func (w *wrapTx) end(operation string, fn func() error) error {
+	if nil != w.ctx.Err() {
+		return fn()
+	}
+	segment := w.bld.useOperation(operation).startSegment(w.ctx)
+	err := fn()
+	segment.End()
+	return err
+}
+
+func (w *wrapTx) Commit() error {
+	return w.end("commit", w.original.Commit)
+}
+
+func (w *wrapTx) Rollback() error {
+	return w.end("rollback", w.original.Rollback)
+}
+
+func (w *wrapRows) Columns() []string {
+	return w.original.Columns()
+}
+
+func (w *wrapRows) Close() error {
+	err := w.original.Close()
+	if !w.closed {
+		w.closed = true
+		w.segment.AddAttribute("db.rowCount", w.numRows)
+		w.segment.AddAttribute("db.fetchDuration", w.fetch.Seconds())
+		w.segment.End()
+	}
+	return err
+}
+
+func (w *wrapRows) Next(dest []driver.Value) error {
+	start := time.Now()
+	err := w.original.Next(dest)
+	w.fetch += time.Since(start)
+	if nil == err {
+		w.numRows++
+	}
+	return err
+}
+
+// ColumnTypeDatabaseTypeName implements RowsColumnTypeDatabaseTypeName.
+func (w *wrapRows) ColumnTypeDatabaseTypeName(index int) string {
+	return w.original.(rowsColumnTypeDatabaseTypeName).ColumnTypeDatabaseTypeName(index)
+}
+
+// ColumnTypeLength implements RowsColumnTypeLength.
+func (w *wrapRows) ColumnTypeLength(index int) (int64, bool) {
+	return w.original.(rowsColumnTypeLength).ColumnTypeLength(index)
+}
+
+// ColumnTypeNullable implements RowsColumnTypeNullable.
+func (w *wrapRows) ColumnTypeNullable(index int) (bool, bool) {
+	return w.original.(rowsColumnTypeNullable).ColumnTypeNullable(index)
+}
+
+// ColumnTypePrecisionScale implements RowsColumnTypePrecisionScale.
+func (w *wrapRows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return w.original.(rowsColumnTypePrecisionScale).ColumnTypePrecisionScale(index)
+}
+
+// ColumnTypeScanType implements RowsColumnTypeScanType.
+func (w *wrapRows) ColumnTypeScanType(index int) reflect.Type {
+	return w.original.(rowsColumnTypeScanType).ColumnTypeScanType(index)
+}
+
+// HasNextResultSet implements RowsNextResultSet.
+func (w *wrapRows) HasNextResultSet() bool {
+	return w.original.(rowsNextResultSet).HasNextResultSet()
+}
+
+// NextResultSet implements RowsNextResultSet.
+func (w *wrapRows) NextResultSet() error {
+	return w.original.(rowsNextResultSet).NextResultSet()
 }
 
 var (
@@ -275,4 +635,16 @@ var (
 		driver.StmtExecContext
 		driver.StmtQueryContext
 	} = &wrapStmt{}
+	_ interface {
+		driver.Tx
+	} = &wrapTx{}
+	_ interface {
+		driver.Rows
+		rowsColumnTypeDatabaseTypeName
+		rowsColumnTypeLength
+		rowsColumnTypeNullable
+		rowsColumnTypePrecisionScale
+		rowsColumnTypeScanType
+		rowsNextResultSet
+	} = &wrapRows{}
 )
@@ -1,6 +1,7 @@
 // Copyright 2020 New Relic Corporation. All rights reserved.
 // SPDX-License-Identifier: Apache-2.0
 
+//go:build go1.10
 // +build go1.10
 
 package newrelic
@@ -2241,3 +2242,485 @@ func optionalMethodsConn(conn *wrapConn) driver.Conn {
 		}{conn, conn, conn, conn, conn, conn, conn, conn, conn}
 	}
 }
+
+func optionalMethodsRows(rows *wrapRows) driver.Rows {
+	// GENERATED CODE DO NOT MODIFY
+	// This code generated by internal/tools/interface-wrapping
+	var (
+		i0 int32 = 1 << 0
+		i1 int32 = 1 << 1
+		i2 int32 = 1 << 2
+		i3 int32 = 1 << 3
+		i4 int32 = 1 << 4
+		i5 int32 = 1 << 5
+	)
+	var interfaceSet int32
+	if _, ok := rows.original.(rowsColumnTypeDatabaseTypeName); ok {
+		interfaceSet |= i0
+	}
+	if _, ok := rows.original.(rowsColumnTypeLength); ok {
+		interfaceSet |= i1
+	}
+	if _, ok := rows.original.(rowsColumnTypeNullable); ok {
+		interfaceSet |= i2
+	}
+	if _, ok := rows.original.(rowsColumnTypePrecisionScale); ok {
+		interfaceSet |= i3
+	}
+	if _, ok := rows.original.(rowsColumnTypeScanType); ok {
+		interfaceSet |= i4
+	}
+	if _, ok := rows.original.(rowsNextResultSet); ok {
+		interfaceSet |= i5
+	}
+	switch interfaceSet {
+	default: // No optional interfaces implemented
+		return struct {
+			driver.Rows
+		}{rows}
+	case i0:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+		}{rows, rows}
+	case i1:
+		return struct {
+			driver.Rows
+			rowsColumnTypeLength
+		}{rows, rows}
+	case i0 | i1:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+			rowsColumnTypeLength
+		}{rows, rows, rows}
+	case i2:
+		return struct {
+			driver.Rows
+			rowsColumnTypeNullable
+		}{rows, rows}
+	case i0 | i2:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+			rowsColumnTypeNullable
+		}{rows, rows, rows}
+	case i1 | i2:
+		return struct {
+			driver.Rows
+			rowsColumnTypeLength
+			rowsColumnTypeNullable
+		}{rows, rows, rows}
+	case i0 | i1 | i2:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+			rowsColumnTypeLength
+			rowsColumnTypeNullable
+		}{rows, rows, rows, rows}
+	case i3:
+		return struct {
+			driver.Rows
+			rowsColumnTypePrecisionScale
+		}{rows, rows}
+	case i0 | i3:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+			rowsColumnTypePrecisionScale
+		}{rows, rows, rows}
+	case i1 | i3:
+		return struct {
+			driver.Rows
+			rowsColumnTypeLength
+			rowsColumnTypePrecisionScale
+		}{rows, rows, rows}
+	case i0 | i1 | i3:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+			rowsColumnTypeLength
+			rowsColumnTypePrecisionScale
+		}{rows, rows, rows, rows}
+	case i2 | i3:
+		return struct {
+			driver.Rows
+			rowsColumnTypeNullable
+			rowsColumnTypePrecisionScale
+		}{rows, rows, rows}
+	case i0 | i2 | i3:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+			rowsColumnTypeNullable
+			rowsColumnTypePrecisionScale
+		}{rows, rows, rows, rows}
+	case i1 | i2 | i3:
+		return struct {
+			driver.Rows
+			rowsColumnTypeLength
+			rowsColumnTypeNullable
+			rowsColumnTypePrecisionScale
+		}{rows, rows, rows, rows}
+	case i0 | i1 | i2 | i3:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+			rowsColumnTypeLength
+			rowsColumnTypeNullable
+			rowsColumnTypePrecisionScale
+		}{rows, rows, rows, rows, rows}
+	case i4:
+		return struct {
+			driver.Rows
+			rowsColumnTypeScanType
+		}{rows, rows}
+	case i0 | i4:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+			rowsColumnTypeScanType
+		}{rows, rows, rows}
+	case i1 | i4:
+		return struct {
+			driver.Rows
+			rowsColumnTypeLength
+			rowsColumnTypeScanType
+		}{rows, rows, rows}
+	case i0 | i1 | i4:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+			rowsColumnTypeLength
+			rowsColumnTypeScanType
+		}{rows, rows, rows, rows}
+	case i2 | i4:
+		return struct {
+			driver.Rows
+			rowsColumnTypeNullable
+			rowsColumnTypeScanType
+		}{rows, rows, rows}
+	case i0 | i2 | i4:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+			rowsColumnTypeNullable
+			rowsColumnTypeScanType
+		}{rows, rows, rows, rows}
+	case i1 | i2 | i4:
+		return struct {
+			driver.Rows
+			rowsColumnTypeLength
+			rowsColumnTypeNullable
+			rowsColumnTypeScanType
+		}{rows, rows, rows, rows}
+	case i0 | i1 | i2 | i4:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+			rowsColumnTypeLength
+			rowsColumnTypeNullable
+			rowsColumnTypeScanType
+		}{rows, rows, rows, rows, rows}
+	case i3 | i4:
+		return struct {
+			driver.Rows
+			rowsColumnTypePrecisionScale
+			rowsColumnTypeScanType
+		}{rows, rows, rows}
+	case i0 | i3 | i4:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+			rowsColumnTypePrecisionScale
+			rowsColumnTypeScanType
+		}{rows, rows, rows, rows}
+	case i1 | i3 | i4:
+		return struct {
+			driver.Rows
+			rowsColumnTypeLength
+			rowsColumnTypePrecisionScale
+			rowsColumnTypeScanType
+		}{rows, rows, rows, rows}
+	case i0 | i1 | i3 | i4:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+			rowsColumnTypeLength
+			rowsColumnTypePrecisionScale
+			rowsColumnTypeScanType
+		}{rows, rows, rows, rows, rows}
+	case i2 | i3 | i4:
+		return struct {
+			driver.Rows
+			rowsColumnTypeNullable
+			rowsColumnTypePrecisionScale
+			rowsColumnTypeScanType
+		}{rows, rows, rows, rows}
+	case i0 | i2 | i3 | i4:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+			rowsColumnTypeNullable
+			rowsColumnTypePrecisionScale
+			rowsColumnTypeScanType
+		}{rows, rows, rows, rows, rows}
+	case i1 | i2 | i3 | i4:
+		return struct {
+			driver.Rows
+			rowsColumnTypeLength
+			rowsColumnTypeNullable
+			rowsColumnTypePrecisionScale
+			rowsColumnTypeScanType
+		}{rows, rows, rows, rows, rows}
+	case i0 | i1 | i2 | i3 | i4:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+			rowsColumnTypeLength
+			rowsColumnTypeNullable
+			rowsColumnTypePrecisionScale
+			rowsColumnTypeScanType
+		}{rows, rows, rows, rows, rows, rows}
+	case i5:
+		return struct {
+			driver.Rows
+			rowsNextResultSet
+		}{rows, rows}
+	case i0 | i5:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+			rowsNextResultSet
+		}{rows, rows, rows}
+	case i1 | i5:
+		return struct {
+			driver.Rows
+			rowsColumnTypeLength
+			rowsNextResultSet
+		}{rows, rows, rows}
+	case i0 | i1 | i5:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+			rowsColumnTypeLength
+			rowsNextResultSet
+		}{rows, rows, rows, rows}
+	case i2 | i5:
+		return struct {
+			driver.Rows
+			rowsColumnTypeNullable
+			rowsNextResultSet
+		}{rows, rows, rows}
+	case i0 | i2 | i5:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+			rowsColumnTypeNullable
+			rowsNextResultSet
+		}{rows, rows, rows, rows}
+	case i1 | i2 | i5:
+		return struct {
+			driver.Rows
+			rowsColumnTypeLength
+			rowsColumnTypeNullable
+			rowsNextResultSet
+		}{rows, rows, rows, rows}
+	case i0 | i1 | i2 | i5:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+			rowsColumnTypeLength
+			rowsColumnTypeNullable
+			rowsNextResultSet
+		}{rows, rows, rows, rows, rows}
+	case i3 | i5:
+		return struct {
+			driver.Rows
+			rowsColumnTypePrecisionScale
+			rowsNextResultSet
+		}{rows, rows, rows}
+	case i0 | i3 | i5:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+			rowsColumnTypePrecisionScale
+			rowsNextResultSet
+		}{rows, rows, rows, rows}
+	case i1 | i3 | i5:
+		return struct {
+			driver.Rows
+			rowsColumnTypeLength
+			rowsColumnTypePrecisionScale
+			rowsNextResultSet
+		}{rows, rows, rows, rows}
+	case i0 | i1 | i3 | i5:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+			rowsColumnTypeLength
+			rowsColumnTypePrecisionScale
+			rowsNextResultSet
+		}{rows, rows, rows, rows, rows}
+	case i2 | i3 | i5:
+		return struct {
+			driver.Rows
+			rowsColumnTypeNullable
+			rowsColumnTypePrecisionScale
+			rowsNextResultSet
+		}{rows, rows, rows, rows}
+	case i0 | i2 | i3 | i5:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+			rowsColumnTypeNullable
+			rowsColumnTypePrecisionScale
+			rowsNextResultSet
+		}{rows, rows, rows, rows, rows}
+	case i1 | i2 | i3 | i5:
+		return struct {
+			driver.Rows
+			rowsColumnTypeLength
+			rowsColumnTypeNullable
+			rowsColumnTypePrecisionScale
+			rowsNextResultSet
+		}{rows, rows, rows, rows, rows}
+	case i0 | i1 | i2 | i3 | i5:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+			rowsColumnTypeLength
+			rowsColumnTypeNullable
+			rowsColumnTypePrecisionScale
+			rowsNextResultSet
+		}{rows, rows, rows, rows, rows, rows}
+	case i4 | i5:
+		return struct {
+			driver.Rows
+			rowsColumnTypeScanType
+			rowsNextResultSet
+		}{rows, rows, rows}
+	case i0 | i4 | i5:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+			rowsColumnTypeScanType
+			rowsNextResultSet
+		}{rows, rows, rows, rows}
+	case i1 | i4 | i5:
+		return struct {
+			driver.Rows
+			rowsColumnTypeLength
+			rowsColumnTypeScanType
+			rowsNextResultSet
+		}{rows, rows, rows, rows}
+	case i0 | i1 | i4 | i5:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+			rowsColumnTypeLength
+			rowsColumnTypeScanType
+			rowsNextResultSet
+		}{rows, rows, rows, rows, rows}
+	case i2 | i4 | i5:
+		return struct {
+			driver.Rows
+			rowsColumnTypeNullable
+			rowsColumnTypeScanType
+			rowsNextResultSet
+		}{rows, rows, rows, rows}
+	case i0 | i2 | i4 | i5:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+			rowsColumnTypeNullable
+			rowsColumnTypeScanType
+			rowsNextResultSet
+		}{rows, rows, rows, rows, rows}
+	case i1 | i2 | i4 | i5:
+		return struct {
+			driver.Rows
+			rowsColumnTypeLength
+			rowsColumnTypeNullable
+			rowsColumnTypeScanType
+			rowsNextResultSet
+		}{rows, rows, rows, rows, rows}
+	case i0 | i1 | i2 | i4 | i5:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+			rowsColumnTypeLength
+			rowsColumnTypeNullable
+			rowsColumnTypeScanType
+			rowsNextResultSet
+		}{rows, rows, rows, rows, rows, rows}
+	case i3 | i4 | i5:
+		return struct {
+			driver.Rows
+			rowsColumnTypePrecisionScale
+			rowsColumnTypeScanType
+			rowsNextResultSet
+		}{rows, rows, rows, rows}
+	case i0 | i3 | i4 | i5:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+			rowsColumnTypePrecisionScale
+			rowsColumnTypeScanType
+			rowsNextResultSet
+		}{rows, rows, rows, rows, rows}
+	case i1 | i3 | i4 | i5:
+		return struct {
+			driver.Rows
+			rowsColumnTypeLength
+			rowsColumnTypePrecisionScale
+			rowsColumnTypeScanType
+			rowsNextResultSet
+		}{rows, rows, rows, rows, rows}
+	case i0 | i1 | i3 | i4 | i5:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+			rowsColumnTypeLength
+			rowsColumnTypePrecisionScale
+			rowsColumnTypeScanType
+			rowsNextResultSet
+		}{rows, rows, rows, rows, rows, rows}
+	case i2 | i3 | i4 | i5:
+		return struct {
+			driver.Rows
+			rowsColumnTypeNullable
+			rowsColumnTypePrecisionScale
+			rowsColumnTypeScanType
+			rowsNextResultSet
+		}{rows, rows, rows, rows, rows}
+	case i0 | i2 | i3 | i4 | i5:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+			rowsColumnTypeNullable
+			rowsColumnTypePrecisionScale
+			rowsColumnTypeScanType
+			rowsNextResultSet
+		}{rows, rows, rows, rows, rows, rows}
+	case i1 | i2 | i3 | i4 | i5:
+		return struct {
+			driver.Rows
+			rowsColumnTypeLength
+			rowsColumnTypeNullable
+			rowsColumnTypePrecisionScale
+			rowsColumnTypeScanType
+			rowsNextResultSet
+		}{rows, rows, rows, rows, rows, rows}
+	case i0 | i1 | i2 | i3 | i4 | i5:
+		return struct {
+			driver.Rows
+			rowsColumnTypeDatabaseTypeName
+			rowsColumnTypeLength
+			rowsColumnTypeNullable
+			rowsColumnTypePrecisionScale
+			rowsColumnTypeScanType
+			rowsNextResultSet
+		}{rows, rows, rows, rows, rows, rows, rows}
+	}
+}
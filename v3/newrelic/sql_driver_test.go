@@ -1,6 +1,7 @@
 // Copyright 2020 New Relic Corporation. All rights reserved.
 // SPDX-License-Identifier: Apache-2.0
 
+//go:build go1.10
 // +build go1.10
 
 package newrelic
@@ -8,8 +9,11 @@ package newrelic
 import (
 	"context"
 	"database/sql/driver"
+	"io"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/newrelic/go-agent/v3/internal"
 )
@@ -278,3 +282,338 @@ func TestSQLNoTxnNoCry(t *testing.T) {
 	conn, _ := connector.Connect(nil)
 	conn.(driver.QueryerContext).QueryContext(context.Background(), "myoperation,mycollection", nil)
 }
+
+type testRows struct {
+	remaining int
+	closed    int
+}
+
+func (r *testRows) Columns() []string { return []string{"id"} }
+func (r *testRows) Close() error      { r.closed++; return nil }
+func (r *testRows) Next(dest []driver.Value) error {
+	if r.remaining == 0 {
+		return io.EOF
+	}
+	r.remaining--
+	dest[0] = int64(r.remaining)
+	return nil
+}
+func (r *testRows) HasNextResultSet() bool { return false }
+func (r *testRows) NextResultSet() error   { return io.EOF }
+
+type testTx struct {
+	ended *string
+}
+
+func (tx testTx) Commit() error   { *tx.ended = "commit"; return nil }
+func (tx testTx) Rollback() error { *tx.ended = "rollback"; return nil }
+
+type testConnectorRows struct {
+	testConnector
+	rows  *testRows
+	ended *string
+}
+
+func (c testConnectorRows) Connect(context.Context) (driver.Conn, error) {
+	return testConnRows{rows: c.rows, ended: c.ended}, nil
+}
+
+type testConnRows struct {
+	testConn
+	rows  *testRows
+	ended *string
+}
+
+func (c testConnRows) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return c.rows, nil
+}
+
+func (c testConnRows) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return testTx{ended: c.ended}, nil
+}
+
+func TestDriverRows(t *testing.T) {
+	// Test that the iteration of rows is timed by a segment.
+	tapp := testApp(distributedTracingReplyFields, enableBetterCAT, t)
+	rows := &testRows{remaining: 2}
+	connector := InstrumentSQLConnector(testConnectorRows{rows: rows}, testBuilder)
+	txn := tapp.StartTransaction("hello")
+	conn, _ := connector.Connect(nil)
+	ctx := NewContext(context.Background(), txn)
+	wrapped, err := conn.(driver.QueryerContext).QueryContext(ctx, "myoperation,mycollection", nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if _, ok := wrapped.(driver.RowsNextResultSet); !ok {
+		t.Error("optional interface of rows not implemented")
+	}
+	if _, ok := wrapped.(driver.RowsColumnTypeLength); ok {
+		t.Error("optional interface of rows unexpectedly implemented")
+	}
+	dest := make([]driver.Value, 1)
+	for nil == wrapped.Next(dest) {
+	}
+	wrapped.Close()
+	wrapped.Close()
+	if rows.closed != 2 {
+		t.Error(rows.closed)
+	}
+	txn.End()
+	tapp.ExpectMetricsPresent(t, []internal.WantMetric{
+		{Name: "Datastore/statement/MySQL/mycollection/myoperation", Scope: "OtherTransaction/Go/hello", Forced: false, Data: []float64{1}},
+		{Name: "Custom/Rows/MySQL/mycollection", Scope: "OtherTransaction/Go/hello", Forced: false, Data: []float64{1}},
+	})
+	tapp.ExpectSpanEvents(t, []internal.WantEvent{
+		{
+			Intrinsics: map[string]interface{}{
+				"name":      "Datastore/statement/MySQL/mycollection/myoperation",
+				"parentId":  internal.MatchAnything,
+				"category":  "datastore",
+				"component": "MySQL",
+				"span.kind": "client",
+			},
+			AgentAttributes: map[string]interface{}{
+				"db.statement":  "'myoperation' on 'mycollection' using 'MySQL'",
+				"db.collection": "mycollection",
+			},
+		},
+		{
+			Intrinsics: map[string]interface{}{
+				"name":     "Custom/Rows/MySQL/mycollection",
+				"parentId": internal.MatchAnything,
+				"category": "generic",
+			},
+			UserAttributes: map[string]interface{}{
+				"db.rowCount":      2,
+				"db.fetchDuration": internal.MatchAnything,
+			},
+			AgentAttributes: map[string]interface{}{},
+		},
+		{
+			Intrinsics: map[string]interface{}{
+				"name":             "OtherTransaction/Go/hello",
+				"nr.entryPoint":    true,
+				"category":         "generic",
+				"transaction.name": "OtherTransaction/Go/hello",
+			},
+			AgentAttributes: map[string]interface{}{},
+		},
+	})
+}
+
+func TestDriverRowsNoTxn(t *testing.T) {
+	// Test that rows are not wrapped without a transaction.
+	rows := &testRows{}
+	connector := InstrumentSQLConnector(testConnectorRows{rows: rows}, testBuilder)
+	conn, _ := connector.Connect(nil)
+	wrapped, _ := conn.(driver.QueryerContext).QueryContext(context.Background(), "myoperation,mycollection", nil)
+	if wrapped != driver.Rows(rows) {
+		t.Error(wrapped)
+	}
+}
+
+func TestDriverTx(t *testing.T) {
+	// Test that the beginning and end of database transactions and the
+	// opening of connections are instrumented.
+	tapp := testApp(nil, nil, t)
+	var ended string
+	connector := InstrumentSQLConnector(testConnectorRows{ended: &ended}, testBuilder)
+	txn := tapp.StartTransaction("hello")
+	ctx := NewContext(context.Background(), txn)
+	conn, _ := connector.Connect(ctx)
+	tx, err := conn.(driver.ConnBeginTx).BeginTx(ctx, driver.TxOptions{})
+	if nil != err {
+		t.Fatal(err)
+	}
+	tx.Commit()
+	if ended != "commit" {
+		t.Error(ended)
+	}
+	tx, _ = conn.(driver.ConnBeginTx).BeginTx(ctx, driver.TxOptions{})
+	tx.Rollback()
+	if ended != "rollback" {
+		t.Error(ended)
+	}
+	// The rollback of a transaction whose context is done is not
+	// recorded.
+	cancelCtx, cancel := context.WithCancel(ctx)
+	tx, _ = conn.(driver.ConnBeginTx).BeginTx(cancelCtx, driver.TxOptions{})
+	cancel()
+	tx.Rollback()
+	txn.End()
+	scope := "OtherTransaction/Go/hello"
+	tapp.ExpectMetricsPresent(t, []internal.WantMetric{
+		{Name: "Datastore/operation/MySQL/connect", Scope: "", Forced: false, Data: []float64{1}},
+		{Name: "Datastore/operation/MySQL/connect", Scope: scope, Forced: false, Data: []float64{1}},
+		{Name: "Datastore/operation/MySQL/begin", Scope: scope, Forced: false, Data: []float64{3}},
+		{Name: "Datastore/operation/MySQL/commit", Scope: scope, Forced: false, Data: []float64{1}},
+		{Name: "Datastore/operation/MySQL/rollback", Scope: scope, Forced: false, Data: []float64{1}},
+	})
+}
+
+type testExplainRows struct {
+	testRows
+}
+
+func (r *testExplainRows) Columns() []string { return []string{"id", "detail"} }
+func (r *testExplainRows) Next(dest []driver.Value) error {
+	if r.remaining == 0 {
+		return io.EOF
+	}
+	r.remaining--
+	dest[0] = int64(1)
+	dest[1] = []byte("SCAN users WHERE name = 'bob'")
+	return nil
+}
+
+type testConnectorExplain struct {
+	testConnector
+	explained chan []driver.NamedValue
+	connects  *int32
+}
+
+func (c testConnectorExplain) Connect(context.Context) (driver.Conn, error) {
+	if nil != c.connects {
+		atomic.AddInt32(c.connects, 1)
+	}
+	return testConnExplain{explained: c.explained}, nil
+}
+
+type testConnExplain struct {
+	testConn
+	explained chan []driver.NamedValue
+}
+
+func (c testConnExplain) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if strings.HasPrefix(query, "EXPLAIN ") {
+		c.explained <- args
+		return &testExplainRows{testRows{remaining: 1}}, nil
+	}
+	return &testRows{}, nil
+}
+
+func explainTestApp(t *testing.T, cfgfn func(*Config)) expectApp {
+	return testApp(nil, func(cfg *Config) {
+		cfg.DatastoreTracer.SlowQuery.Threshold = 0
+		cfg.DatastoreTracer.SlowQuery.ExplainPlans.Enabled = true
+		if nil != cfgfn {
+			cfgfn(cfg)
+		}
+	}, t)
+}
+
+func explainTestQuery(tapp expectApp, explained chan []driver.NamedValue) {
+	bld := testBuilder
+	bld.ExplainQuery = func(query string) string {
+		return "EXPLAIN " + query
+	}
+	connector := InstrumentSQLConnector(testConnectorExplain{explained: explained}, bld)
+	txn := tapp.StartTransaction("hello")
+	conn, _ := connector.Connect(nil)
+	ctx := NewContext(context.Background(), txn)
+	args := []driver.NamedValue{{Ordinal: 1, Value: []byte("bob")}}
+	conn.(driver.QueryerContext).QueryContext(ctx, "myoperation,mycollection", args)
+	// The arguments are copied before the query returns.
+	args[0].Value.([]byte)[0] = 'B'
+	txn.End()
+}
+
+func TestDriverExplainPlan(t *testing.T) {
+	tapp := explainTestApp(t, nil)
+	explained := make(chan []driver.NamedValue, 1)
+	explainTestQuery(tapp, explained)
+	args := <-explained
+	if len(args) != 1 || string(args[0].Value.([]byte)) != "bob" {
+		t.Error(args)
+	}
+	slows := tapp.Private.(*app).testHarvest.SlowSQLs
+	if len(slows.priorityQueue) != 1 {
+		t.Fatal(slows.priorityQueue)
+	}
+	plan := slows.priorityQueue[0].ExplainPlan
+	if nil == plan {
+		t.Fatal("explain plan missing")
+	}
+	<-plan.done
+	js, err := slows.Data("agentRunID", time.Now())
+	if nil != err {
+		t.Fatal(err)
+	}
+	// Literals are obfuscated by default.
+	expect := `"explain_plan":[["id","detail"],[[1,"SCAN users WHERE name = ?"]]]`
+	if !strings.Contains(string(js), expect) {
+		t.Error(string(js))
+	}
+}
+
+func TestDriverExplainPlanReusesConn(t *testing.T) {
+	tapp := explainTestApp(t, nil)
+	bld := testBuilder
+	bld.ExplainQuery = func(query string) string {
+		return "EXPLAIN " + query
+	}
+	explained := make(chan []driver.NamedValue, 2)
+	var connects int32
+	connector := InstrumentSQLConnector(testConnectorExplain{
+		explained: explained,
+		connects:  &connects,
+	}, bld)
+	conn, _ := connector.Connect(nil)
+	for _, query := range []string{"myoperation,mycollection", "myoperation,othercollection"} {
+		txn := tapp.StartTransaction("hello")
+		ctx := NewContext(context.Background(), txn)
+		conn.(driver.QueryerContext).QueryContext(ctx, query, nil)
+		txn.End()
+		<-explained
+	}
+	slows := tapp.Private.(*app).testHarvest.SlowSQLs
+	for _, slow := range slows.priorityQueue {
+		<-slow.ExplainPlan.done
+	}
+	// One connection for the queries and one for the explains.
+	if c := atomic.LoadInt32(&connects); c != 2 {
+		t.Error(c)
+	}
+}
+
+func TestDriverExplainPlanDisabled(t *testing.T) {
+	for name, cfgfn := range map[string]func(*Config){
+		"disabled":      func(cfg *Config) { cfg.DatastoreTracer.SlowQuery.ExplainPlans.Enabled = false },
+		"high-security": func(cfg *Config) { cfg.HighSecurity = true },
+		"record-sql":    func(cfg *Config) { cfg.DatastoreTracer.RecordSQL = RecordSQLOff },
+		"rate-limit":    func(cfg *Config) { cfg.DatastoreTracer.SlowQuery.ExplainPlans.MaxPerMinute = 0 },
+	} {
+		tapp := explainTestApp(t, cfgfn)
+		explainTestQuery(tapp, make(chan []driver.NamedValue, 1))
+		slows := tapp.Private.(*app).testHarvest.SlowSQLs
+		if len(slows.priorityQueue) != 1 || nil != slows.priorityQueue[0].ExplainPlan {
+			t.Error(name, slows.priorityQueue)
+		}
+	}
+}
+
+func TestDriverRowsSegmentOrder(t *testing.T) {
+	// Test that segments started while iterating rows, and ended after the
+	// rows are closed, are not affected by the rows' segment.
+	tapp := testApp(distributedTracingReplyFields, enableBetterCAT, t)
+	connector := InstrumentSQLConnector(testConnectorRows{rows: &testRows{remaining: 1}}, testBuilder)
+	txn := tapp.StartTransaction("hello")
+	conn, _ := connector.Connect(nil)
+	ctx := NewContext(context.Background(), txn)
+	first, _ := conn.(driver.QueryerContext).QueryContext(ctx, "myoperation,mycollection", nil)
+	second, _ := conn.(driver.QueryerContext).QueryContext(ctx, "myoperation,othercollection", nil)
+	seg := txn.StartSegment("processRows")
+	dest := make([]driver.Value, 1)
+	for nil == first.Next(dest) {
+	}
+	first.Close()
+	seg.End()
+	second.Close()
+	txn.End()
+	tapp.expectNoLoggedErrors(t)
+	tapp.ExpectMetricsPresent(t, []internal.WantMetric{
+		{Name: "Custom/processRows", Scope: "OtherTransaction/Go/hello", Forced: false, Data: []float64{1}},
+		{Name: "Custom/Rows/MySQL/mycollection", Scope: "OtherTransaction/Go/hello", Forced: false, Data: []float64{1}},
+		{Name: "Custom/Rows/MySQL/othercollection", Scope: "OtherTransaction/Go/hello", Forced: false, Data: []float64{1}},
+	})
+}
@@ -0,0 +1,322 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package newrelic
+
+import (
+	"bytes"
+	"strings"
+)
+
+// RecordSQLMode controls how the query of a datastore segment is recorded.
+// It is used for the Config.DatastoreTracer.RecordSQL field.
+type RecordSQLMode string
+
+// These constants are the supported values of Config.DatastoreTracer.RecordSQL.
+const (
+	// RecordSQLObfuscated records queries with their literal values, such
+	// as strings and numbers, replaced by "?".
+	RecordSQLObfuscated RecordSQLMode = "obfuscated"
+	// RecordSQLRaw records queries as they are provided.  Queries may
+	// contain sensitive data.
+	RecordSQLRaw RecordSQLMode = "raw"
+	// RecordSQLOff does not record queries.
+	RecordSQLOff RecordSQLMode = "off"
+)
+
+// sqlDialect describes the lexical rules of a SQL dialect which affect
+// obfuscation.
+type sqlDialect struct {
+	// doubleQuotedStrings is true if double quotes delimit string literals
+	// rather than identifiers.
+	doubleQuotedStrings bool
+	// backtickIdentifiers is true if backticks delimit identifiers.
+	backtickIdentifiers bool
+	// dollarQuotes is true if $$ delimits string literals.
+	dollarQuotes bool
+	// dollarQuoteTags is true if dollar quotes may contain a tag, as in
+	// $tag$string$tag$.
+	dollarQuoteTags bool
+	// slashComments is true if // begins a comment.
+	slashComments bool
+	// uuids is true if unquoted UUID literals are allowed.
+	uuids bool
+}
+
+var (
+	sqlDialectMySQL = sqlDialect{
+		doubleQuotedStrings: true,
+		backtickIdentifiers: true,
+	}
+	sqlDialectPostgres = sqlDialect{
+		dollarQuotes:    true,
+		dollarQuoteTags: true,
+		uuids:           true,
+	}
+	sqlDialectSQLite = sqlDialect{
+		backtickIdentifiers: true,
+	}
+	sqlDialectSnowflake = sqlDialect{
+		dollarQuotes:  true,
+		slashComments: true,
+	}
+)
+
+// sqlDialectForProduct returns the dialect of the datastore product.  The
+// MySQL rules are used for other products, since treating double quoted
+// text as a string literal errs on the side of obfuscation.
+func sqlDialectForProduct(product string) sqlDialect {
+	switch DatastoreProduct(product) {
+	case DatastorePostgres:
+		return sqlDialectPostgres
+	case DatastoreSQLite:
+		return sqlDialectSQLite
+	case DatastoreSnowflake:
+		return sqlDialectSnowflake
+	default:
+		return sqlDialectMySQL
+	}
+}
+
+// sqlObfuscationPlaceholder replaces literals and comments.  A query which
+// cannot be obfuscated, such as one containing an unterminated string, is
+// replaced entirely by the placeholder.
+const sqlObfuscationPlaceholder = "?"
+
+func isSQLIdentifierStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isSQLIdentifierChar(c byte) bool {
+	return isSQLIdentifierStart(c) || isSQLDigit(c) || c == '$'
+}
+
+func isSQLDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isSQLHexDigit(c byte) bool {
+	return isSQLDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// endOfLine returns the index of the first line break at or after i, or the
+// length of s.
+func endOfLine(s string, i int) int {
+	if idx := strings.IndexAny(s[i:], "\r\n"); idx >= 0 {
+		return i + idx
+	}
+	return len(s)
+}
+
+// scanQuoted returns the index after the quoted literal beginning at i.  The
+// quote character is escaped by doubling it.  An escaped quote preceded by a
+// backslash is treated as unreliable: Whether the backslash escapes the
+// quote depends on server settings, so the rest of the line is considered
+// part of the literal.  ok is false if the literal is unterminated.
+func scanQuoted(s string, i int) (end int, ok bool) {
+	quote := s[i]
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			if j+1 < len(s) && s[j+1] == quote {
+				return endOfLine(s, j), true
+			}
+		case quote:
+			if j+1 < len(s) && s[j+1] == quote {
+				j++
+				continue
+			}
+			return j + 1, true
+		}
+	}
+	return len(s), false
+}
+
+// scanDollarQuote returns the index after the dollar quoted literal
+// beginning at i, or -1 if there is no dollar quote at i.  ok is false if
+// the literal is unterminated.
+func scanDollarQuote(s string, i int, d sqlDialect) (end int, ok bool) {
+	j := i + 1
+	if d.dollarQuoteTags && j < len(s) && isSQLIdentifierStart(s[j]) {
+		for j < len(s) && isSQLIdentifierChar(s[j]) && s[j] != '$' {
+			j++
+		}
+	}
+	if j >= len(s) || s[j] != '$' {
+		return -1, true
+	}
+	tag := s[i : j+1]
+	idx := strings.Index(s[j+1:], tag)
+	if idx < 0 {
+		return len(s), false
+	}
+	return j + 1 + idx + len(tag), true
+}
+
+// scanUUID returns the index after the unquoted UUID beginning at i, or -1
+// if there is none: 32 hexadecimal digits, optionally separated by dashes
+// and enclosed in braces.
+func scanUUID(s string, i int) int {
+	j := i
+	braced := s[j] == '{'
+	if braced {
+		j++
+	}
+	digits := 0
+	for j < len(s) && digits < 32 {
+		if !isSQLHexDigit(s[j]) {
+			return -1
+		}
+		digits++
+		j++
+		if digits < 32 && j < len(s) && s[j] == '-' {
+			j++
+		}
+	}
+	if digits < 32 {
+		return -1
+	}
+	if braced {
+		if j >= len(s) || s[j] != '}' {
+			return -1
+		}
+		j++
+	}
+	if j < len(s) && isSQLIdentifierChar(s[j]) {
+		return -1
+	}
+	return j
+}
+
+// scanNumber returns the index after the numeric literal beginning at i:
+// An integer, decimal, exponential, or hexadecimal number.
+func scanNumber(s string, i int) int {
+	j := i
+	if j+1 < len(s) && s[j] == '0' && (s[j+1] == 'x' || s[j+1] == 'X') &&
+		j+2 < len(s) && isSQLHexDigit(s[j+2]) {
+		j += 2
+		for j < len(s) && isSQLHexDigit(s[j]) {
+			j++
+		}
+		return j
+	}
+	for j < len(s) && isSQLDigit(s[j]) {
+		j++
+	}
+	if j+1 < len(s) && s[j] == '.' && isSQLDigit(s[j+1]) {
+		j++
+		for j < len(s) && isSQLDigit(s[j]) {
+			j++
+		}
+	}
+	if j < len(s) && (s[j] == 'e' || s[j] == 'E') {
+		k := j + 1
+		if k < len(s) && (s[k] == '+' || s[k] == '-') {
+			k++
+		}
+		if k < len(s) && isSQLDigit(s[k]) {
+			for k < len(s) && isSQLDigit(s[k]) {
+				k++
+			}
+			j = k
+		}
+	}
+	return j
+}
+
+// signAllowed returns true if a minus sign following out is a unary sign
+// rather than a subtraction.
+func signAllowed(out *bytes.Buffer) bool {
+	b := bytes.TrimRight(out.Bytes(), " \t\r\n")
+	if len(b) == 0 {
+		return true
+	}
+	c := b[len(b)-1]
+	return !isSQLIdentifierChar(c) && c != ')' && c != '?' && c != '\'' && c != '"' && c != '`'
+}
+
+// obfuscateSQL replaces the literal values and comments of the query with
+// "?", following the quoting rules of the dialect.  Identifiers, keywords,
+// operators, and placeholders are kept.  If the query cannot be reliably
+// obfuscated because a string, comment, or dollar quote is unterminated,
+// "?" is returned.
+func obfuscateSQL(query string, d sqlDialect) string {
+	out := bytes.NewBuffer(make([]byte, 0, len(query)))
+	s := query
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\'' || (c == '"' && d.doubleQuotedStrings):
+			end, ok := scanQuoted(s, i)
+			if !ok {
+				return sqlObfuscationPlaceholder
+			}
+			out.WriteString(sqlObfuscationPlaceholder)
+			i = end
+		case c == '"' || (c == '`' && d.backtickIdentifiers):
+			end := strings.IndexByte(s[i+1:], c)
+			if end < 0 {
+				out.WriteString(s[i:])
+				return out.String()
+			}
+			out.WriteString(s[i : i+end+2])
+			i += end + 2
+		case c == '#' ||
+			(c == '-' && i+1 < len(s) && s[i+1] == '-') ||
+			(c == '/' && d.slashComments && i+1 < len(s) && s[i+1] == '/'):
+			out.WriteString(sqlObfuscationPlaceholder)
+			i = endOfLine(s, i)
+		case c == '/' && i+1 < len(s) && s[i+1] == '*':
+			end := strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				return sqlObfuscationPlaceholder
+			}
+			out.WriteString(sqlObfuscationPlaceholder)
+			i += end + 4
+		case c == '$' && i+1 < len(s) && isSQLDigit(s[i+1]):
+			// Numbered placeholders such as $1 are kept.
+			j := i + 1
+			for j < len(s) && isSQLDigit(s[j]) {
+				j++
+			}
+			out.WriteString(s[i:j])
+			i = j
+		case c == '$' && d.dollarQuotes:
+			end, ok := scanDollarQuote(s, i, d)
+			if !ok {
+				return sqlObfuscationPlaceholder
+			}
+			if end < 0 {
+				out.WriteByte(c)
+				i++
+				continue
+			}
+			out.WriteString(sqlObfuscationPlaceholder)
+			i = end
+		case d.uuids && (c == '{' || isSQLHexDigit(c)) && scanUUID(s, i) > 0:
+			out.WriteString(sqlObfuscationPlaceholder)
+			i = scanUUID(s, i)
+		case isSQLDigit(c):
+			out.WriteString(sqlObfuscationPlaceholder)
+			i = scanNumber(s, i)
+		case c == '-' && i+1 < len(s) && isSQLDigit(s[i+1]) && signAllowed(out):
+			out.WriteString(sqlObfuscationPlaceholder)
+			i = scanNumber(s, i+1)
+		case isSQLIdentifierStart(c):
+			j := i + 1
+			for j < len(s) && isSQLIdentifierChar(s[j]) {
+				j++
+			}
+			if word := s[i:j]; strings.EqualFold(word, "true") || strings.EqualFold(word, "false") {
+				out.WriteString(sqlObfuscationPlaceholder)
+			} else {
+				out.WriteString(word)
+			}
+			i = j
+		default:
+			out.WriteByte(c)
+			i++
+		}
+	}
+	return out.String()
+}
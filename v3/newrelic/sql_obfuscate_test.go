@@ -0,0 +1,120 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package newrelic
+
+import (
+	"testing"
+
+	"github.com/newrelic/go-agent/v3/internal/crossagent"
+)
+
+func TestSQLObfuscationCrossAgent(t *testing.T) {
+	var tcs []struct {
+		Name       string   `json:"name"`
+		SQL        string   `json:"sql"`
+		Obfuscated []string `json:"obfuscated"`
+		Dialects   []string `json:"dialects"`
+	}
+	if err := crossagent.ReadJSON("sql_obfuscation/sql_obfuscation.json", &tcs); nil != err {
+		t.Fatal(err)
+	}
+	// Numbered placeholders are not literals, and are kept rather than
+	// obfuscated to "$?".
+	overrides := map[string]string{
+		"variable_substitution_not_mistaken_for_dollar_quotes": `INSERT INTO "foo" ("bar", "baz", "qux") VALUES ($1, $2, $3) RETURNING "id"`,
+	}
+	dialects := map[string]sqlDialect{
+		"mysql":    sqlDialectMySQL,
+		"postgres": sqlDialectPostgres,
+		"sqlite":   sqlDialectSQLite,
+	}
+	for _, tc := range tcs {
+		for _, name := range tc.Dialects {
+			d, ok := dialects[name]
+			if !ok {
+				continue
+			}
+			out := obfuscateSQL(tc.SQL, d)
+			if expect, ok := overrides[tc.Name]; ok {
+				tc.Obfuscated = []string{expect}
+			}
+			matched := false
+			for _, expect := range tc.Obfuscated {
+				if out == expect {
+					matched = true
+				}
+			}
+			if !matched {
+				t.Errorf("%s (%s): got=%q want=%q", tc.Name, name, out, tc.Obfuscated)
+			}
+		}
+	}
+}
+
+func TestSQLObfuscationSnowflake(t *testing.T) {
+	testcases := []struct {
+		input  string
+		expect string
+	}{
+		{
+			input:  "SELECT $$it's a secret$$, col FROM t WHERE id = 5",
+			expect: "SELECT ?, col FROM t WHERE id = ?",
+		},
+		{
+			input:  "SELECT * FROM t WHERE \"Name\" = $1 // hunter2\nAND x = 'y'",
+			expect: "SELECT * FROM t WHERE \"Name\" = $1 ?\nAND x = ?",
+		},
+		{
+			input:  "SELECT $$unterminated",
+			expect: "?",
+		},
+		{
+			input:  "SELECT * FROM t WHERE a = 'it\\'s'",
+			expect: "SELECT * FROM t WHERE a = ?",
+		},
+	}
+	for _, tc := range testcases {
+		if out := obfuscateSQL(tc.input, sqlDialectSnowflake); out != tc.expect {
+			t.Errorf("input=%q got=%q want=%q", tc.input, out, tc.expect)
+		}
+	}
+}
+
+func TestSQLObfuscationKeepsOperatorsAndPlaceholders(t *testing.T) {
+	testcases := []struct {
+		input  string
+		expect string
+	}{
+		{input: "SELECT a-1, b - 2 FROM t WHERE c = ?", expect: "SELECT a-?, b - ? FROM t WHERE c = ?"},
+		{input: "UPDATE t SET n = n + 1 WHERE id IN (-1, -2)", expect: "UPDATE t SET n = n + ? WHERE id IN (?, ?)"},
+		{input: "SELECT * FROM t WHERE x IS NULL", expect: "SELECT * FROM t WHERE x IS NULL"},
+		{input: "SELECT * FROM t2 /* unterminated", expect: "?"},
+		{input: "SELECT \"unterminated FROM t", expect: "?"},
+		{input: "", expect: ""},
+	}
+	for _, tc := range testcases {
+		if out := obfuscateSQL(tc.input, sqlDialectMySQL); out != tc.expect {
+			t.Errorf("input=%q got=%q want=%q", tc.input, out, tc.expect)
+		}
+	}
+	// Double quotes delimit identifiers in Postgres.
+	if out := obfuscateSQL(`SELECT "unterminated FROM t`, sqlDialectPostgres); out != `SELECT "unterminated FROM t` {
+		t.Error(out)
+	}
+}
+
+func TestSQLDialectForProduct(t *testing.T) {
+	if d := sqlDialectForProduct(string(DatastorePostgres)); d != sqlDialectPostgres {
+		t.Error(d)
+	}
+	if d := sqlDialectForProduct(string(DatastoreSnowflake)); d != sqlDialectSnowflake {
+		t.Error(d)
+	}
+	if d := sqlDialectForProduct(string(DatastoreSQLite)); d != sqlDialectSQLite {
+		t.Error(d)
+	}
+	if d := sqlDialectForProduct("unknown"); d != sqlDialectMySQL {
+		t.Error(d)
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package sqlparse
+
+import (
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	// tokenWord is an unquoted keyword or identifier.
+	tokenWord tokenKind = iota
+	// tokenQuoted is an identifier quoted with double quotes or backticks.
+	tokenQuoted
+	// tokenString is a string literal, including dollar quoted strings.
+	tokenString
+	tokenNumber
+	// tokenPlaceholder is a bind parameter such as ?, $1, or :name.
+	tokenPlaceholder
+	// tokenPunct is one of the characters ( ) [ ] { } , . ;
+	tokenPunct
+	tokenOperator
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// space is true if the token is preceded by whitespace or a comment.
+	space bool
+}
+
+func (t token) isPunct(text string) bool {
+	return t.kind == tokenPunct && t.text == text
+}
+
+// isWord returns true if the token is an unquoted word equal to one of the
+// lowercase keywords.
+func (t token) isWord(keywords ...string) bool {
+	if t.kind != tokenWord {
+		return false
+	}
+	for _, k := range keywords {
+		if strings.EqualFold(t.text, k) {
+			return true
+		}
+	}
+	return false
+}
+
+func isIdentifierStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isIdentifierChar(c byte) bool {
+	return isIdentifierStart(c) || isDigit(c) || c == '$'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+func isOperatorChar(c byte) bool {
+	return strings.IndexByte("<>=!|&+-*/%^~:@#", c) >= 0
+}
+
+// scanQuoted returns the index after the quoted text beginning at i.  The
+// quote is escaped either by doubling it or, in string literals, by a
+// backslash.  Unterminated text extends to the end of the query.
+func scanQuoted(s string, i int, backslash bool) int {
+	quote := s[i]
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			if backslash {
+				j++
+			}
+		case quote:
+			if j+1 < len(s) && s[j+1] == quote {
+				j++
+				continue
+			}
+			return j + 1
+		}
+	}
+	return len(s)
+}
+
+// scanDollarQuote returns the index after the dollar quoted string beginning
+// at i, as in $$text$$ or $tag$text$tag$, or -1 if there is no terminated
+// dollar quoted string at i.
+func scanDollarQuote(s string, i int) int {
+	j := i + 1
+	for j < len(s) && isIdentifierChar(s[j]) && s[j] != '$' {
+		j++
+	}
+	if j >= len(s) || s[j] != '$' || (j > i+1 && !isIdentifierStart(s[i+1])) {
+		return -1
+	}
+	tag := s[i : j+1]
+	idx := strings.Index(s[j+1:], tag)
+	if idx < 0 {
+		return -1
+	}
+	return j + 1 + idx + len(tag)
+}
+
+// scanNumber returns the index after the numeric literal beginning at i.
+func scanNumber(s string, i int) int {
+	j := i
+	if j+2 < len(s) && s[j] == '0' && (s[j+1] == 'x' || s[j+1] == 'X') && isHexDigit(s[j+2]) {
+		j += 2
+		for j < len(s) && isHexDigit(s[j]) {
+			j++
+		}
+		return j
+	}
+	for j < len(s) && isDigit(s[j]) {
+		j++
+	}
+	if j+1 < len(s) && s[j] == '.' && isDigit(s[j+1]) {
+		j++
+		for j < len(s) && isDigit(s[j]) {
+			j++
+		}
+	}
+	if j < len(s) && (s[j] == 'e' || s[j] == 'E') {
+		k := j + 1
+		if k < len(s) && (s[k] == '+' || s[k] == '-') {
+			k++
+		}
+		if k < len(s) && isDigit(s[k]) {
+			for k < len(s) && isDigit(s[k]) {
+				k++
+			}
+			j = k
+		}
+	}
+	return j
+}
+
+func scanWord(s string, i int) int {
+	for i < len(s) && isIdentifierChar(s[i]) {
+		i++
+	}
+	return i
+}
+
+// isStringPrefix returns true if the word is the prefix of a string
+// literal, as in N'text', E'text', X'0A', or B'01'.
+func isStringPrefix(word string) bool {
+	switch word {
+	case "n", "N", "e", "E", "x", "X", "b", "B":
+		return true
+	}
+	return false
+}
+
+// lex splits the query into tokens, discarding whitespace and comments.
+// Comments begin with --, #, or /*.  Lexing never fails: Unterminated
+// strings, quoted identifiers, and comments extend to the end of the query.
+func lex(s string) []token {
+	var tokens []token
+	space := false
+	for i := 0; i < len(s); {
+		c := s[i]
+		start := i
+		kind := tokenOperator
+		switch {
+		case isSpace(c):
+			space = true
+			i++
+			continue
+		case c == '#' || (c == '-' && i+1 < len(s) && s[i+1] == '-'):
+			if idx := strings.IndexAny(s[i:], "\r\n"); idx >= 0 {
+				i += idx
+			} else {
+				i = len(s)
+			}
+			space = true
+			continue
+		case c == '/' && i+1 < len(s) && s[i+1] == '*':
+			if idx := strings.Index(s[i+2:], "*/"); idx >= 0 {
+				i += idx + 4
+			} else {
+				i = len(s)
+			}
+			space = true
+			continue
+		case c == '\'':
+			kind = tokenString
+			i = scanQuoted(s, i, true)
+		case c == '"' || c == '`':
+			kind = tokenQuoted
+			i = scanQuoted(s, i, false)
+		case isDigit(c):
+			kind = tokenNumber
+			i = scanNumber(s, i)
+		case c == '?':
+			kind = tokenPlaceholder
+			i++
+		case c == '$' && i+1 < len(s) && isDigit(s[i+1]):
+			kind = tokenPlaceholder
+			i = scanWord(s, i+1)
+		case c == '$':
+			if end := scanDollarQuote(s, i); end > 0 {
+				kind = tokenString
+				i = end
+			} else {
+				// Some databases allow identifiers beginning with $.
+				kind = tokenWord
+				i = scanWord(s, i+1)
+			}
+		case c == ':' && i+1 < len(s) && (isIdentifierStart(s[i+1]) || isDigit(s[i+1])):
+			kind = tokenPlaceholder
+			i = scanWord(s, i+1)
+		case c == '@' && i+1 < len(s) && (isIdentifierStart(s[i+1]) || s[i+1] == '@'):
+			// Variables such as @name and @@name.
+			kind = tokenWord
+			i++
+			if s[i] == '@' {
+				i++
+			}
+			i = scanWord(s, i)
+		case isIdentifierStart(c):
+			kind = tokenWord
+			i = scanWord(s, i)
+			if i < len(s) && s[i] == '\'' && isStringPrefix(s[start:i]) {
+				kind = tokenString
+				i = scanQuoted(s, i, true)
+			}
+		case strings.IndexByte("()[]{},.;", c) >= 0:
+			kind = tokenPunct
+			i++
+		default:
+			// Operators are runs of operator characters.  Signs are only
+			// accepted as the first character so that "=-1" is lexed as an
+			// operator followed by a signed number.
+			i++
+			for i < len(s) && isOperatorChar(s[i]) && s[i] != '+' && s[i] != '-' && s[i] != '#' &&
+				!(s[i] == '/' && i+1 < len(s) && s[i+1] == '*') {
+				i++
+			}
+		}
+		tokens = append(tokens, token{kind: kind, text: s[start:i], space: space})
+		space = false
+	}
+	return tokens
+}
+
+// unquote returns the text of an identifier or string literal token without
+// its quotes.
+func unquote(t token) string {
+	if t.kind != tokenQuoted && t.kind != tokenString {
+		return t.text
+	}
+	s := t.text
+	if len(s) < 2 || s[0] != s[len(s)-1] {
+		return strings.Trim(s, "'\"`")
+	}
+	quote := s[:1]
+	return strings.Replace(s[1:len(s)-1], quote+quote, quote, -1)
+}
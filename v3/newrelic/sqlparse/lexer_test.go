@@ -0,0 +1,91 @@
+// Copyright 2020 New Relic Corporation. All rights reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package sqlparse
+
+import (
+	"testing"
+)
+
+func TestLex(t *testing.T) {
+	query := "SELECT t.`a`, \"b\", 'c''d', $$e$$, 1.5e3, ?, $1, :name, @v " +
+		"/* comment */ FROM [t] WHERE x>=-1 # comment\n AND y::int"
+	expect := []token{
+		{kind: tokenWord, text: "SELECT"},
+		{kind: tokenWord, text: "t", space: true},
+		{kind: tokenPunct, text: "."},
+		{kind: tokenQuoted, text: "`a`"},
+		{kind: tokenPunct, text: ","},
+		{kind: tokenQuoted, text: `"b"`, space: true},
+		{kind: tokenPunct, text: ","},
+		{kind: tokenString, text: "'c''d'", space: true},
+		{kind: tokenPunct, text: ","},
+		{kind: tokenString, text: "$$e$$", space: true},
+		{kind: tokenPunct, text: ","},
+		{kind: tokenNumber, text: "1.5e3", space: true},
+		{kind: tokenPunct, text: ","},
+		{kind: tokenPlaceholder, text: "?", space: true},
+		{kind: tokenPunct, text: ","},
+		{kind: tokenPlaceholder, text: "$1", space: true},
+		{kind: tokenPunct, text: ","},
+		{kind: tokenPlaceholder, text: ":name", space: true},
+		{kind: tokenPunct, text: ","},
+		{kind: tokenWord, text: "@v", space: true},
+		{kind: tokenWord, text: "FROM", space: true},
+		{kind: tokenPunct, text: "[", space: true},
+		{kind: tokenWord, text: "t"},
+		{kind: tokenPunct, text: "]"},
+		{kind: tokenWord, text: "WHERE", space: true},
+		{kind: tokenWord, text: "x", space: true},
+		{kind: tokenOperator, text: ">="},
+		{kind: tokenOperator, text: "-"},
+		{kind: tokenNumber, text: "1"},
+		{kind: tokenWord, text: "AND", space: true},
+		{kind: tokenWord, text: "y", space: true},
+		{kind: tokenOperator, text: "::"},
+		{kind: tokenWord, text: "int"},
+	}
+	tokens := lex(query)
+	if len(tokens) != len(expect) {
+		t.Fatal(len(tokens), tokens)
+	}
+	for i := range expect {
+		if tokens[i] != expect[i] {
+			t.Errorf("token %d: got=%+v want=%+v", i, tokens[i], expect[i])
+		}
+	}
+}
+
+func TestLexUnterminated(t *testing.T) {
+	for _, tc := range []struct {
+		input string
+		last  token
+	}{
+		{input: "SELECT 'abc", last: token{kind: tokenString, text: "'abc", space: true}},
+		{input: "SELECT `abc", last: token{kind: tokenQuoted, text: "`abc", space: true}},
+		{input: "SELECT $abc$ def", last: token{kind: tokenWord, text: "def", space: true}},
+		{input: "SELECT a /* comment", last: token{kind: tokenWord, text: "a", space: true}},
+	} {
+		tokens := lex(tc.input)
+		if last := tokens[len(tokens)-1]; last != tc.last {
+			t.Errorf("input=%q got=%+v want=%+v", tc.input, last, tc.last)
+		}
+	}
+}
+
+func TestUnquote(t *testing.T) {
+	for _, tc := range []struct {
+		input  token
+		expect string
+	}{
+		{input: token{kind: tokenWord, text: "abc"}, expect: "abc"},
+		{input: token{kind: tokenQuoted, text: `"a""b"`}, expect: `a"b`},
+		{input: token{kind: tokenQuoted, text: "`a``b`"}, expect: "a`b"},
+		{input: token{kind: tokenString, text: "'a''b'"}, expect: "a'b"},
+		{input: token{kind: tokenQuoted, text: `"abc`}, expect: "abc"},
+	} {
+		if out := unquote(tc.input); out != tc.expect {
+			t.Errorf("input=%q got=%q want=%q", tc.input.text, out, tc.expect)
+		}
+	}
+}
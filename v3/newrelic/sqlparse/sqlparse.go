@@ -4,67 +4,522 @@
 package sqlparse
 
 import (
-	"regexp"
+	"bytes"
 	"strings"
 
 	newrelic "github.com/newrelic/go-agent/v3/newrelic"
 )
 
-func extractTable(s string) string {
-	s = extractTableRegex.ReplaceAllString(s, "")
-	if idx := strings.Index(s, "."); idx > 0 {
-		s = s[idx+1:]
+// Statement describes a SQL statement.
+type Statement struct {
+	// Operation is the lowercase name of the operation, such as "select"
+	// or "insert".  It is empty if the statement is not recognized.
+	// Statements beginning with a WITH clause have the operation of their
+	// main statement.  INSERT statements which update conflicting rows,
+	// using ON CONFLICT DO UPDATE or ON DUPLICATE KEY UPDATE, have the
+	// operation "upsert".
+	Operation string
+	// Collection is the primary table of the statement, without any
+	// qualifiers or quotes.  When the primary table is a subquery or a
+	// common table expression, its primary table is used.
+	Collection string
+	// Schema and Database are the qualifiers of the primary table.  A
+	// table with a single qualifier, as in "sales.orders", has only a
+	// Schema, since some databases call it a database and others a
+	// schema.  A table with two qualifiers, as in "shop.sales.orders", has
+	// both.
+	Schema   string
+	Database string
+}
+
+// tableLocation describes where the primary table of a statement is found.
+type tableLocation int
+
+const (
+	// tableNone is used for operations without a primary table.
+	tableNone tableLocation = iota
+	// tableFrom is used for operations whose primary table follows FROM.
+	tableFrom
+	// tableAfterModifiers is used for operations whose primary table
+	// follows the operation and its modifiers.
+	tableAfterModifiers
+)
+
+// sqlOperations are the operations which are recognized.
+var sqlOperations = map[string]tableLocation{
+	"select":   tableFrom,
+	"delete":   tableFrom,
+	"insert":   tableAfterModifiers,
+	"replace":  tableAfterModifiers,
+	"upsert":   tableAfterModifiers,
+	"update":   tableAfterModifiers,
+	"merge":    tableAfterModifiers,
+	"call":     tableNone,
+	"create":   tableNone,
+	"drop":     tableNone,
+	"show":     tableNone,
+	"set":      tableNone,
+	"exec":     tableNone,
+	"execute":  tableNone,
+	"alter":    tableNone,
+	"commit":   tableNone,
+	"rollback": tableNone,
+}
+
+// tableModifiers are the keywords which may appear between the operation
+// and the table, as in "INSERT LOW_PRIORITY IGNORE INTO" or "UPDATE OR
+// ROLLBACK".
+var tableModifiers = map[string]bool{
+	"low_priority":  true,
+	"high_priority": true,
+	"delayed":       true,
+	"ignore":        true,
+	"into":          true,
+	"or":            true,
+	"rollback":      true,
+	"abort":         true,
+	"replace":       true,
+	"fail":          true,
+	"only":          true,
+	"overwrite":     true,
+	"all":           true,
+	"first":         true,
+	"table":         true,
+}
+
+// maxParseDepth limits the nesting of subqueries and common table
+// expressions which are searched for the primary table.
+const maxParseDepth = 16
+
+type parser struct {
+	// ctes maps the lowercase names of the common table expressions of the
+	// statement to their bodies.
+	ctes  map[string][]token
+	depth int
+}
+
+// closing returns the index of the parenthesis closing the one at i, or the
+// number of tokens if it is unclosed.
+func closing(ts []token, i int) int {
+	depth := 0
+	for ; i < len(ts); i++ {
+		if ts[i].isPunct("(") {
+			depth++
+		} else if ts[i].isPunct(")") {
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(ts)
+}
+
+// findWord returns the index of the first word at parenthesis depth zero
+// which is one of the keywords, or -1.
+func findWord(ts []token, keywords ...string) int {
+	for i := 0; i < len(ts); i++ {
+		if ts[i].isPunct("(") {
+			i = closing(ts, i)
+		} else if ts[i].isWord(keywords...) {
+			return i
+		}
+	}
+	return -1
+}
+
+// statement returns the operation and the qualified name of the primary
+// table of the statement.
+func (p *parser) statement(ts []token) (string, []string) {
+	for len(ts) > 0 && (ts[0].isPunct(";") || ts[0].isPunct("(")) {
+		ts = ts[1:]
+	}
+	if len(ts) == 0 || ts[0].kind != tokenWord {
+		return "", nil
+	}
+	op := strings.ToLower(ts[0].text)
+	if op == "with" {
+		rest, ok := p.with(ts[1:])
+		if !ok {
+			return "", nil
+		}
+		return p.statement(rest)
+	}
+	loc, ok := sqlOperations[op]
+	if !ok {
+		return "", nil
+	}
+	if op == "insert" && isUpsert(ts) {
+		op = "upsert"
+	}
+	switch loc {
+	case tableFrom:
+		return op, p.fromTable(ts[1:])
+	case tableAfterModifiers:
+		return op, p.modifiedTable(ts[1:])
+	}
+	return op, nil
+}
+
+// with records the common table expressions of a WITH clause and returns
+// the tokens of the main statement.
+func (p *parser) with(ts []token) ([]token, bool) {
+	i := 0
+	if i < len(ts) && ts[i].isWord("recursive") {
+		i++
+	}
+	for {
+		if i >= len(ts) || (ts[i].kind != tokenWord && ts[i].kind != tokenQuoted) {
+			return nil, false
+		}
+		name := strings.ToLower(unquote(ts[i]))
+		i++
+		if i < len(ts) && ts[i].isPunct("(") {
+			// Column names.
+			i = closing(ts, i) + 1
+		}
+		if i >= len(ts) || !ts[i].isWord("as") {
+			return nil, false
+		}
+		i++
+		for i < len(ts) && ts[i].isWord("not", "materialized") {
+			i++
+		}
+		if i >= len(ts) || !ts[i].isPunct("(") {
+			return nil, false
+		}
+		end := closing(ts, i)
+		if nil == p.ctes {
+			p.ctes = make(map[string][]token)
+		}
+		p.ctes[name] = ts[i+1 : end]
+		i = end + 1
+		if i < len(ts) && ts[i].isPunct(",") {
+			i++
+			continue
+		}
+		if i > len(ts) {
+			return nil, false
+		}
+		return ts[i:], true
+	}
+}
+
+// isUpsert returns true if the INSERT statement updates conflicting rows.
+func isUpsert(ts []token) bool {
+	for {
+		on := findWord(ts, "on")
+		if on < 0 || on+1 >= len(ts) {
+			return false
+		}
+		ts = ts[on+1:]
+		if ts[0].isWord("duplicate") {
+			return true
+		}
+		if ts[0].isWord("conflict") {
+			if do := findWord(ts, "do"); do >= 0 && do+1 < len(ts) {
+				return ts[do+1].isWord("update")
+			}
+			return false
+		}
+	}
+}
+
+// fromTable finds the primary table of a SELECT or DELETE statement: The
+// first table following FROM.
+func (p *parser) fromTable(ts []token) []string {
+	from := findWord(ts, "from")
+	if from < 0 {
+		return nil
+	}
+	return p.table(ts[from+1:])
+}
+
+// modifiedTable finds the primary table of an INSERT, UPDATE, or MERGE
+// statement: The table following the operation and its modifiers.
+func (p *parser) modifiedTable(ts []token) []string {
+	i := 0
+	for i < len(ts) && ts[i].kind == tokenWord && tableModifiers[strings.ToLower(ts[i].text)] {
+		i++
+	}
+	return p.table(ts[i:])
+}
+
+// table returns the qualified name of the table at the beginning of the
+// tokens.  The name may be enclosed in parentheses, brackets, or braces, and
+// its parts may be quoted.  A subquery or common table expression is
+// searched for its own primary table.
+func (p *parser) table(ts []token) []string {
+	i := 0
+	if i < len(ts) && ts[i].isWord("only", "lateral") {
+		i++
+	}
+	for ; i < len(ts) && ts[i].kind == tokenPunct && strings.Contains("([{", ts[i].text) && !isBracketed(ts, i); i++ {
+		if ts[i].isPunct("(") && i+1 < len(ts) && ts[i+1].isWord("select", "with") {
+			return p.nested(ts[i+1 : closing(ts, i)])
+		}
+	}
+	var name []string
+	for i < len(ts) {
+		if isBracketed(ts, i) {
+			name = append(name, unquote(ts[i+1]))
+			i += 3
+		} else if ts[i].kind == tokenWord || ts[i].kind == tokenQuoted || ts[i].kind == tokenString {
+			// Quoted names containing dots are treated as qualified
+			// names, since the whole name is sometimes mistakenly quoted.
+			name = append(name, strings.Split(unquote(ts[i]), ".")...)
+			i++
+		} else {
+			break
+		}
+		if i >= len(ts) || !ts[i].isPunct(".") {
+			break
+		}
+		i++
+	}
+	for idx, part := range name {
+		name[idx] = strings.TrimSpace(part)
+	}
+	if len(name) == 1 {
+		if body, ok := p.ctes[strings.ToLower(name[0])]; ok {
+			if cte := p.nested(body); nil != cte {
+				return cte
+			}
+		}
+	}
+	return name
+}
+
+// isBracketed returns true if the tokens at i are a part of a name quoted
+// with brackets, as in "[dbo].[users]".
+func isBracketed(ts []token, i int) bool {
+	return i+2 < len(ts) && ts[i].isPunct("[") && ts[i+2].isPunct("]") &&
+		(ts[i+1].kind == tokenWord || ts[i+1].kind == tokenQuoted || ts[i+1].kind == tokenString)
+}
+
+// nested returns the primary table of a subquery or common table
+// expression.
+func (p *parser) nested(ts []token) []string {
+	if p.depth >= maxParseDepth {
+		return nil
+	}
+	p.depth++
+	defer func() { p.depth-- }()
+	_, name := p.statement(ts)
+	return name
+}
+
+// fingerprintText returns the normalized text of the token.
+func fingerprintText(t token) string {
+	switch t.kind {
+	case tokenString, tokenNumber, tokenPlaceholder:
+		return "?"
+	case tokenWord:
+		if t.isWord("true", "false") {
+			return "?"
+		}
+		return strings.ToLower(t.text)
+	}
+	return t.text
+}
+
+// isValueList returns true if the tokens are a comma separated list of
+// literal values and placeholders.
+func isValueList(ts []token) bool {
+	if len(ts) == 0 {
+		return false
+	}
+	for _, t := range ts {
+		switch {
+		case t.kind == tokenString || t.kind == tokenNumber || t.kind == tokenPlaceholder:
+		case t.isPunct(",") || t.isWord("true", "false", "null"):
+		case t.kind == tokenOperator && (t.text == "-" || t.text == "+"):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// isSign returns true if the + or - operator at i is the sign of a number
+// rather than an addition or subtraction.
+func isSign(ts []token, i int) bool {
+	if ts[i].kind != tokenOperator || (ts[i].text != "-" && ts[i].text != "+") {
+		return false
+	}
+	if i+1 >= len(ts) || ts[i+1].kind != tokenNumber || ts[i+1].space {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	prev := ts[i-1]
+	return prev.kind == tokenOperator ||
+		(prev.kind == tokenPunct && prev.text != ")" && prev.text != "]") ||
+		prev.isWord("select", "where", "and", "or", "not", "in", "values", "set", "then", "else", "when", "by", "between", "like", "is", "return", "returning")
+}
+
+// spacedKeywords are the keywords which are followed by a space when
+// followed by a parenthesis in fingerprints.
+var spacedKeywords = map[string]bool{
+	"all": true, "and": true, "any": true, "as": true, "between": true,
+	"by": true, "distinct": true, "else": true, "except": true,
+	"exists": true, "from": true, "in": true, "intersect": true,
+	"into": true, "is": true, "join": true, "lateral": true, "like": true,
+	"materialized": true, "not": true, "on": true, "or": true,
+	"returning": true, "select": true, "set": true, "some": true,
+	"then": true, "union": true, "using": true, "values": true,
+	"when": true, "where": true, "with": true,
+}
+
+// fingerprint returns the normalized statement: Comments are removed,
+// literals and placeholders are replaced by "?", unquoted words are
+// lowercased, lists of values in IN clauses are replaced by "(?+)", only the
+// first row of a VALUES clause is kept, and tokens are separated by a single
+// space where required.
+func fingerprint(ts []token) string {
+	buf := &bytes.Buffer{}
+	var prev string
+	write := func(text string) {
+		space := prev != "" &&
+			prev != "(" && prev != "[" && prev != "." && prev != "::" &&
+			text != ")" && text != "]" && text != "," && text != "." && text != ";" && text != "::"
+		if text == "(" && prev != "" && !spacedKeywords[prev] {
+			// Function calls and column lists are written without a
+			// space, as in "count(*)" and "users(id, name)".
+			last := prev[len(prev)-1]
+			if isIdentifierChar(last) || last == '"' || last == '`' || last == ']' {
+				space = false
+			}
+		}
+		if space {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(text)
+		prev = text
+	}
+	for i := 0; i < len(ts); i++ {
+		t := ts[i]
+		switch {
+		case isSign(ts, i):
+			continue
+		case t.isPunct("(") && prev == "in":
+			end := closing(ts, i)
+			if end < len(ts) && isValueList(ts[i+1:end]) {
+				write("(")
+				write("?+")
+				write(")")
+				i = end
+				continue
+			}
+		case t.isPunct("(") && prev == "values":
+			// Subsequent rows are skipped.
+			end := closing(ts, i)
+			for j := i; j <= end && j < len(ts); j++ {
+				if !isSign(ts, j) {
+					write(fingerprintText(ts[j]))
+				}
+			}
+			for end+2 < len(ts) && ts[end+1].isPunct(",") && ts[end+2].isPunct("(") {
+				end = closing(ts, end+2)
+			}
+			i = end
+			continue
+		}
+		write(fingerprintText(t))
+	}
+	return buf.String()
+}
+
+// Parse parses the operation and primary table of the SQL statement.  It is
+// designed to work with MySQL, Postgres, SQLite, and Snowflake statements.
+// Both double quotes and backticks are treated as quoting identifiers, and
+// backslashes are treated as escaping quotes in string literals.
+func Parse(query string) Statement {
+	ts := lex(query)
+	p := &parser{}
+	op, name := p.statement(ts)
+	s := Statement{Operation: op}
+	if n := len(name); n > 0 {
+		s.Collection = name[n-1]
+		if n > 1 {
+			s.Schema = name[n-2]
+		}
+		if n > 2 {
+			s.Database = name[n-3]
+		}
 	}
 	return s
 }
 
-var (
-	basicTable        = `[^)(\]\[\}\{\s,;]+`
-	enclosedTable     = `[\[\(\{]` + `\s*` + basicTable + `\s*` + `[\]\)\}]`
-	tablePattern      = `(` + `\s+` + basicTable + `|` + `\s*` + enclosedTable + `)`
-	extractTableRegex = regexp.MustCompile(`[\s` + "`" + `"'\(\)\{\}\[\]]*`)
-	updateRegex       = regexp.MustCompile(`(?is)^update(?:\s+(?:low_priority|ignore|or|rollback|abort|replace|fail|only))*` + tablePattern)
-	sqlOperations     = map[string]*regexp.Regexp{
-		"select":   regexp.MustCompile(`(?is)^.*?\sfrom` + tablePattern),
-		"delete":   regexp.MustCompile(`(?is)^.*?\sfrom` + tablePattern),
-		"insert":   regexp.MustCompile(`(?is)^.*?\sinto?` + tablePattern),
-		"update":   updateRegex,
-		"call":     nil,
-		"create":   nil,
-		"drop":     nil,
-		"show":     nil,
-		"set":      nil,
-		"exec":     nil,
-		"execute":  nil,
-		"alter":    nil,
-		"commit":   nil,
-		"rollback": nil,
-	}
-	firstWordRegex   = regexp.MustCompile(`^\w+`)
-	cCommentRegex    = regexp.MustCompile(`(?is)/\*.*?\*/`)
-	lineCommentRegex = regexp.MustCompile(`(?im)(?:--|#).*?$`)
-	sqlPrefixRegex   = regexp.MustCompile(`^[\s;]*`)
-)
+// Fingerprint returns the SQL statement normalized so that statements which
+// only differ in their literal values, placeholder style, comments,
+// whitespace, keyword case, or the number of values in IN lists and VALUES
+// clauses have the same fingerprint.  Like Parse, it is designed to work with
+// MySQL, Postgres, SQLite, and Snowflake statements.
+func Fingerprint(query string) string {
+	return fingerprint(lex(query))
+}
+
+// extractTable returns the table of a qualified name such as
+// "`database`.`table`".
+func extractTable(s string) string {
+	name := (&parser{}).table(lex(s))
+	if len(name) == 0 {
+		return ""
+	}
+	return name[len(name)-1]
+}
 
 // ParseQuery parses table and operation from the SQL query string.  It is
 // a helper meant to be used when writing database/sql driver instrumentation.
 // Check out full example usage here:
 // https://github.com/newrelic/go-agent/blob/master/v3/integrations/nrmysql/nrmysql.go
 //
-// ParseQuery is designed to work with MySQL, Postgres, and SQLite drivers.
-// Ability to correctly parse queries for other SQL databases is not
-// guaranteed.
+// ParseQuery sets the DatabaseName of the segment when the table is
+// qualified by its database, as in "shop.sales.orders", or, for MySQL,
+// where databases and schemas are the same, as in "shop.orders".
+//
+// ParseQuery is designed to work with MySQL, Postgres, SQLite, and Snowflake
+// drivers.  Ability to correctly parse queries for other SQL databases is
+// not guaranteed.
 func ParseQuery(segment *newrelic.DatastoreSegment, query string) {
-	s := cCommentRegex.ReplaceAllString(query, "")
-	s = lineCommentRegex.ReplaceAllString(s, "")
-	s = sqlPrefixRegex.ReplaceAllString(s, "")
-	op := strings.ToLower(firstWordRegex.FindString(s))
-	if rg, ok := sqlOperations[op]; ok {
-		segment.Operation = op
-		if nil != rg {
-			if m := rg.FindStringSubmatch(s); len(m) > 1 {
-				segment.Collection = extractTable(m[1])
+	s := Parse(query)
+	if "" == s.Operation {
+		return
+	}
+	segment.Operation = s.Operation
+	if "" != s.Collection {
+		segment.Collection = s.Collection
+	}
+	database := s.Database
+	if "" == database && segment.Product == newrelic.DatastoreMySQL {
+		database = s.Schema
+	}
+	if "" != database {
+		segment.DatabaseName = database
+	}
+}
+
+// ExplainQuery returns a function which prefixes SELECT statements with the
+// prefix, such as "EXPLAIN ", to create the statement which explains the
+// plan of the query.  The function returns "" for other statements and for
+// queries containing multiple statements, which are not explained.  It is a
+// helper meant to be used as SQLDriverSegmentBuilder.ExplainQuery.
+func ExplainQuery(prefix string) func(query string) string {
+	return func(query string) string {
+		ts := lex(query)
+		for len(ts) > 0 && ts[len(ts)-1].isPunct(";") {
+			ts = ts[:len(ts)-1]
+		}
+		for _, t := range ts {
+			if t.isPunct(";") {
+				return ""
 			}
 		}
+		if op, _ := (&parser{}).statement(ts); op != "select" {
+			return ""
+		}
+		return prefix + query
 	}
 }
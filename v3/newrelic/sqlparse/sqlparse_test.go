@@ -4,6 +4,7 @@
 package sqlparse
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/newrelic/go-agent/v3/internal/crossagent"
@@ -192,3 +193,233 @@ func TestExtractTable(t *testing.T) {
 		}
 	}
 }
+
+func TestParseQueryCorpus(t *testing.T) {
+	for _, tc := range []sqlTestcase{
+		// Common table expressions use the operation of the main statement
+		// and the table of the expression the main statement reads.
+		{Input: "WITH recent AS (SELECT * FROM orders WHERE created > ?) SELECT * FROM recent", Operation: "select", Table: "orders"},
+		{Input: "with recent as (select * from orders) select * from recent r join users u on r.uid = u.id", Operation: "select", Table: "orders"},
+		{Input: "WITH a AS (SELECT * FROM alpha), b AS (SELECT * FROM a) SELECT * FROM b", Operation: "select", Table: "alpha"},
+		{Input: "WITH RECURSIVE t(n) AS (SELECT 1 UNION ALL SELECT n+1 FROM t WHERE n < 100) SELECT sum(n) FROM t", Operation: "select", Table: "t"},
+		{Input: "WITH x AS (SELECT * FROM users) INSERT INTO audit SELECT * FROM x", Operation: "insert", Table: "audit"},
+		{Input: "WITH x AS NOT MATERIALIZED (SELECT * FROM a) UPDATE b SET c = 1", Operation: "update", Table: "b"},
+		{Input: "WITH x AS MATERIALIZED (SELECT id FROM a) DELETE FROM b WHERE id IN (SELECT id FROM x)", Operation: "delete", Table: "b"},
+		{Input: `WITH "Quoted" AS (SELECT * FROM inner_table) SELECT * FROM "Quoted"`, Operation: "select", Table: "inner_table"},
+		{Input: "WITH broken AS SELECT * FROM foo", Operation: "other", Table: ""},
+		// MERGE, UPSERT, REPLACE, and conflict handling.
+		{Input: "MERGE INTO target t USING source s ON t.id = s.id WHEN MATCHED THEN UPDATE SET t.v = s.v", Operation: "merge", Table: "target"},
+		{Input: "MERGE dbo.target AS t USING source AS s ON t.id = s.id", Operation: "merge", Table: "target"},
+		{Input: "INSERT INTO users (id, name) VALUES ($1, $2) ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name", Operation: "upsert", Table: "users"},
+		{Input: "INSERT INTO users (id) VALUES (1) ON CONFLICT DO NOTHING", Operation: "insert", Table: "users"},
+		{Input: "INSERT INTO users (id, n) VALUES (1, 2) ON DUPLICATE KEY UPDATE n = n + 1", Operation: "upsert", Table: "users"},
+		{Input: "INSERT INTO t (a) SELECT a FROM u WHERE u.x IN (SELECT x FROM v ON CONFLICT)", Operation: "insert", Table: "t"},
+		{Input: "UPSERT INTO kv (k, v) VALUES ('a', 1)", Operation: "upsert", Table: "kv"},
+		{Input: "REPLACE INTO `shop`.`users` (id) VALUES (5)", Operation: "replace", Table: "users"},
+		{Input: "REPLACE LOW_PRIORITY users SET id = 5", Operation: "replace", Table: "users"},
+		{Input: "INSERT OR REPLACE INTO t VALUES (1)", Operation: "insert", Table: "t"},
+		{Input: "INSERT OVERWRITE INTO sales SELECT * FROM staging", Operation: "insert", Table: "sales"},
+		{Input: "INSERT employee VALUES ('Tom')", Operation: "insert", Table: "employee"},
+		// Qualified and quoted identifiers.
+		{Input: `SELECT * FROM "public"."Users" WHERE id = :id`, Operation: "select", Table: "Users"},
+		{Input: "SELECT * FROM db.schema.tbl", Operation: "select", Table: "tbl"},
+		{Input: `SELECT * FROM "my ""odd"" table"`, Operation: "select", Table: `my "odd" table`},
+		{Input: "SELECT * FROM `weird``name`", Operation: "select", Table: "weird`name"},
+		{Input: "SELECT * FROM [dbo].[Users]", Operation: "select", Table: "Users"},
+		{Input: "SELECT * FROM sales . orders", Operation: "select", Table: "orders"},
+		{Input: "SELECT * FROM ONLY parent", Operation: "select", Table: "parent"},
+		{Input: "SELECT * FROM réservations", Operation: "select", Table: "réservations"},
+		{Input: "UPDATE `db`.`t` SET a = 1", Operation: "update", Table: "t"},
+		{Input: "DELETE FROM \"schema\".\"t\" WHERE id = $1", Operation: "delete", Table: "t"},
+		// Subqueries and keywords within parentheses are skipped unless
+		// they are the primary table.
+		{Input: "SELECT (SELECT max(id) FROM other) FROM main_table", Operation: "select", Table: "main_table"},
+		{Input: "SELECT EXTRACT(YEAR FROM created) FROM events", Operation: "select", Table: "events"},
+		{Input: "SELECT TRIM(BOTH 'x' FROM name), SUBSTRING(s FROM 2) FROM people", Operation: "select", Table: "people"},
+		{Input: "SELECT * FROM (SELECT * FROM (SELECT * FROM deepest) a) b", Operation: "select", Table: "deepest"},
+		{Input: "SELECT * FROM (WITH c AS (SELECT * FROM cte_table) SELECT * FROM c) s", Operation: "select", Table: "cte_table"},
+		{Input: "(SELECT * FROM a) UNION (SELECT * FROM b)", Operation: "select", Table: "a"},
+		{Input: "SELECT count(*) FROM t WHERE id IN (SELECT id FROM u)", Operation: "select", Table: "t"},
+		{Input: "DELETE t1 FROM t1 INNER JOIN t2 ON t1.id = t2.id", Operation: "delete", Table: "t1"},
+		{Input: "DELETE LOW_PRIORITY QUICK IGNORE FROM logs WHERE ts < ?", Operation: "delete", Table: "logs"},
+		// Literals, comments, and placeholders which resemble keywords.
+		{Input: "SELECT 'FROM fake' FROM real_table", Operation: "select", Table: "real_table"},
+		{Input: `SELECT "from" FROM real_table`, Operation: "select", Table: "real_table"},
+		{Input: "SELECT $$ FROM fake $$ FROM real_table", Operation: "select", Table: "real_table"},
+		{Input: "SELECT $tag$ FROM fake $tag$ FROM real_table", Operation: "select", Table: "real_table"},
+		{Input: "SELECT 'it\\'s FROM fake' FROM real_table", Operation: "select", Table: "real_table"},
+		{Input: "SELECT 'it''s FROM fake' FROM real_table", Operation: "select", Table: "real_table"},
+		{Input: "SELECT /* FROM fake */ a FROM real_table", Operation: "select", Table: "real_table"},
+		{Input: "SELECT a FROM real_table WHERE b = 'unterminated FROM fake", Operation: "select", Table: "real_table"},
+		{Input: "SELECT a /* unterminated FROM fake", Operation: "select", Table: ""},
+		{Input: "SELECT 1", Operation: "select", Table: ""},
+		// Operations without tables.
+		{Input: "CALL my_procedure(1, 2)", Operation: "call", Table: ""},
+		{Input: "SET NAMES utf8", Operation: "set", Table: ""},
+		{Input: "COMMIT", Operation: "commit", Table: ""},
+		{Input: "  rollback;", Operation: "rollback", Table: ""},
+		{Input: "CREATE TABLE foo (id int)", Operation: "create", Table: ""},
+		// Unrecognized statements.
+		{Input: "", Operation: "other", Table: ""},
+		{Input: ";;", Operation: "other", Table: ""},
+		{Input: "VACUUM", Operation: "other", Table: ""},
+		{Input: "'select' * from foo", Operation: "other", Table: ""},
+		{Input: "123 select", Operation: "other", Table: ""},
+	} {
+		tc.test(t)
+	}
+}
+
+func TestParseQualifiers(t *testing.T) {
+	for _, tc := range []struct {
+		input    string
+		expect   Statement
+		database string
+	}{
+		{
+			input:  "SELECT * FROM orders",
+			expect: Statement{Operation: "select", Collection: "orders"},
+		},
+		{
+			input:  "SELECT * FROM sales.orders",
+			expect: Statement{Operation: "select", Collection: "orders", Schema: "sales"},
+		},
+		{
+			input:  `INSERT INTO "shop"."sales"."orders" VALUES (1)`,
+			expect: Statement{Operation: "insert", Collection: "orders", Schema: "sales", Database: "shop"},
+		},
+		{
+			input:  "SELECT * FROM `shop.orders`",
+			expect: Statement{Operation: "select", Collection: "orders", Schema: "shop"},
+		},
+	} {
+		if s := Parse(tc.input); s != tc.expect {
+			t.Errorf("query=%q got=%+v want=%+v", tc.input, s, tc.expect)
+		}
+	}
+}
+
+func TestParseFingerprint(t *testing.T) {
+	for _, tc := range []struct {
+		inputs []string
+		expect string
+	}{
+		{
+			inputs: []string{
+				"SELECT * FROM users WHERE id = 1",
+				"select  *\n from   users where  ID='abc' -- comment\n",
+				"/* leading */ SELECT * FROM users WHERE id = ?",
+				"SELECT * FROM users WHERE id = $1",
+				"SELECT * FROM users WHERE id = :id",
+				"SELECT * FROM users WHERE id = -12.5e3",
+				"SELECT * FROM users WHERE id = TRUE",
+			},
+			expect: "select * from users where id = ?",
+		},
+		{
+			inputs: []string{
+				"SELECT a FROM t WHERE id IN (1, 2, 3)",
+				"SELECT a FROM t WHERE id IN(?)",
+				"SELECT a FROM t WHERE id in ( -1 , 'x' )",
+			},
+			expect: "select a from t where id in (?+)",
+		},
+		{
+			inputs: []string{
+				"INSERT INTO t (a, b) VALUES (1, 'x')",
+				"INSERT INTO t(a,b) VALUES (1, 'x'), (2, 'y'), (-3, 'z')",
+				"insert into T (A, B) values ($1, $2)",
+			},
+			expect: "insert into t(a, b) values (?, ?)",
+		},
+		{
+			inputs: []string{
+				`SELECT count(*), "Name" FROM "Users" WHERE x IN (SELECT y FROM z WHERE w = 5)`,
+			},
+			expect: `select count(*), "Name" from "Users" where x in (select y from z where w = ?)`,
+		},
+		{
+			inputs: []string{
+				"SELECT a - 1, b::int, c->>'k' FROM t WHERE d @> '{}' AND e IS NULL",
+			},
+			expect: "select a - ?, b::int, c ->> ? from t where d @> ? and e is null",
+		},
+		{
+			inputs: []string{
+				"SELECT $$secret$$, E'x\\'y', N'abc', X'0A', 0x1F FROM t",
+			},
+			expect: "select ?, ?, ?, ?, ? from t",
+		},
+		{
+			inputs: []string{"SELECT * FROM [dbo].[Users] WHERE [Id] = @p1"},
+			expect: "select * from [dbo].[users] where [id] = @p1",
+		},
+		{
+			inputs: []string{""},
+			expect: "",
+		},
+	} {
+		for _, input := range tc.inputs {
+			if fp := Fingerprint(input); fp != tc.expect {
+				t.Errorf("query=%q got=%q want=%q", input, fp, tc.expect)
+			}
+		}
+	}
+}
+
+func TestParseQueryDatabaseName(t *testing.T) {
+	for _, tc := range []struct {
+		product  newrelic.DatastoreProduct
+		dsnName  string
+		input    string
+		expected string
+	}{
+		{product: newrelic.DatastoreMySQL, dsnName: "dsn", input: "SELECT * FROM orders", expected: "dsn"},
+		{product: newrelic.DatastoreMySQL, dsnName: "dsn", input: "SELECT * FROM shop.orders", expected: "shop"},
+		{product: newrelic.DatastorePostgres, dsnName: "dsn", input: "SELECT * FROM sales.orders", expected: "dsn"},
+		{product: newrelic.DatastoreSnowflake, dsnName: "", input: "SELECT * FROM shop.sales.orders", expected: "shop"},
+		{product: newrelic.DatastoreMySQL, dsnName: "dsn", input: "mystoredprocedure shop.orders", expected: "dsn"},
+	} {
+		segment := newrelic.DatastoreSegment{
+			Product:      tc.product,
+			DatabaseName: tc.dsnName,
+		}
+		ParseQuery(&segment, tc.input)
+		if segment.DatabaseName != tc.expected {
+			t.Errorf("query=%q got=%q want=%q", tc.input, segment.DatabaseName, tc.expected)
+		}
+	}
+}
+
+func TestParseDepthLimit(t *testing.T) {
+	query := strings.Repeat("SELECT * FROM (", 100) + "SELECT * FROM deep" + strings.Repeat(")", 100)
+	if s := Parse(query); s.Operation != "select" || s.Collection != "" {
+		t.Error(s.Operation, s.Collection)
+	}
+	cycle := "WITH a AS (SELECT * FROM b), b AS (SELECT * FROM a) SELECT * FROM a"
+	if s := Parse(cycle); s.Operation != "select" {
+		t.Error(s.Operation, s.Collection)
+	}
+}
+
+func TestExplainQuery(t *testing.T) {
+	explain := ExplainQuery("EXPLAIN ")
+	for _, tc := range []struct {
+		input    string
+		expected string
+	}{
+		{input: "SELECT * FROM users WHERE id = ?", expected: "EXPLAIN SELECT * FROM users WHERE id = ?"},
+		{input: "select * from users;", expected: "EXPLAIN select * from users;"},
+		{input: "WITH u AS (SELECT * FROM users) SELECT * FROM u", expected: "EXPLAIN WITH u AS (SELECT * FROM users) SELECT * FROM u"},
+		{input: "SELECT * FROM users WHERE name = ';'", expected: "EXPLAIN SELECT * FROM users WHERE name = ';'"},
+		{input: "SELECT * FROM users; DELETE FROM users", expected: ""},
+		{input: "DELETE FROM users WHERE id = ?", expected: ""},
+		{input: "INSERT INTO users SELECT * FROM admins", expected: ""},
+		{input: "EXPLAIN SELECT * FROM users", expected: ""},
+		{input: "", expected: ""},
+	} {
+		if out := explain(tc.input); out != tc.expected {
+			t.Errorf("query=%q got=%q want=%q", tc.input, out, tc.expected)
+		}
+	}
+}
@@ -21,6 +21,43 @@ func getStackTrace() stackTrace {
 	return callers[:written]
 }
 
+// getPanicStackTrace returns the stack trace of the panic being recovered by
+// the caller, starting at the panic site.  The frames of the deferred calls
+// and of the runtime's panic machinery are removed.  If the goroutine is not
+// panicking, the whole stack trace is returned.
+func getPanicStackTrace() stackTrace {
+	skip := 1 // skip runtime.Callers
+	callers := make([]uintptr, 2*maxStackTraceFrames)
+	callers = callers[:runtime.Callers(skip, callers)]
+	for i, pc := range callers {
+		if fn := runtime.FuncForPC(pc - 1); nil != fn && "runtime.gopanic" == fn.Name() {
+			callers = callers[i+1:]
+			// Runtime errors such as nil dereferences are raised
+			// by functions like runtime.panicmem and
+			// runtime.sigpanic.
+			for len(callers) > 0 {
+				fn := runtime.FuncForPC(callers[0] - 1)
+				if nil == fn || !strings.HasPrefix(fn.Name(), "runtime.") {
+					break
+				}
+				callers = callers[1:]
+			}
+			break
+		}
+	}
+	if len(callers) > maxStackTraceFrames {
+		callers = callers[:maxStackTraceFrames]
+	}
+	return callers
+}
+
+// goroutineDump returns the stack traces of all goroutines, truncated to
+// maxGoroutineDumpBytes.
+func goroutineDump() string {
+	buf := make([]byte, maxGoroutineDumpBytes)
+	return string(buf[:runtime.Stack(buf, true)])
+}
+
 type stacktraceFrame struct {
 	Name string
 	File string
@@ -99,6 +136,18 @@ func (st stackTrace) frames() []stacktraceFrame {
 	return fs
 }
 
+// topFunction returns the name of the first function of the stack trace which
+// is neither part of the agent nor of the runtime.
+func (st stackTrace) topFunction() string {
+	for _, f := range st.frames() {
+		if "" == f.Name || f.isAgent() || strings.HasPrefix(f.Name, "runtime.") {
+			continue
+		}
+		return f.formattedName()
+	}
+	return ""
+}
+
 // WriteJSON adds the stack trace to the buffer in the JSON form expected by the
 // collector.
 func (st stackTrace) WriteJSON(buf *bytes.Buffer) {
@@ -386,13 +386,15 @@ func errShouldBackoff(err error) bool {
 
 func (to *gRPCtraceObserver) sendSpan(spanClient v1.IngestService_RecordSpanClient, msg *spanEvent) error {
 	span := transformEvent(msg)
-	to.supportability.increment <- observerSent
-	if err := spanClient.Send(span); err != nil {
-		to.log.Error("trace observer send error", map[string]interface{}{
-			"err": err.Error(),
-		})
-		to.supportabilityError(err)
-		return err
+	for _, s := range append([]*v1.Span{span}, transformSpanExtras(msg)...) {
+		to.supportability.increment <- observerSent
+		if err := spanClient.Send(s); err != nil {
+			to.log.Error("trace observer send error", map[string]interface{}{
+				"err": err.Error(),
+			})
+			to.supportabilityError(err)
+			return err
+		}
 	}
 	return nil
 }
@@ -517,6 +519,46 @@ func transformEvent(e *spanEvent) *v1.Span {
 	return span
 }
 
+// transformSpanExtras transforms the events and links of a span into the
+// messages which are sent following the span itself.
+func transformSpanExtras(e *spanEvent) []*v1.Span {
+	if 0 == len(e.Annotations) && 0 == len(e.Links) {
+		return nil
+	}
+	spans := make([]*v1.Span, 0, len(e.Annotations)+len(e.Links))
+	for _, a := range e.Annotations {
+		span := &v1.Span{
+			TraceId:         e.TraceID,
+			Intrinsics:      make(map[string]*v1.AttributeValue),
+			UserAttributes:  make(map[string]*v1.AttributeValue),
+			AgentAttributes: make(map[string]*v1.AttributeValue),
+		}
+		span.Intrinsics["type"] = obsvString("SpanEvent")
+		span.Intrinsics["span.id"] = obsvString(e.GUID)
+		span.Intrinsics["trace.id"] = obsvString(e.TraceID)
+		span.Intrinsics["timestamp"] = obsvInt(timeToIntMillis(a.Timestamp))
+		span.Intrinsics["name"] = obsvString(a.Name)
+		copyAttrs(a.Attributes, span.UserAttributes)
+		spans = append(spans, span)
+	}
+	for _, l := range e.Links {
+		span := &v1.Span{
+			TraceId:         e.TraceID,
+			Intrinsics:      make(map[string]*v1.AttributeValue),
+			UserAttributes:  make(map[string]*v1.AttributeValue),
+			AgentAttributes: make(map[string]*v1.AttributeValue),
+		}
+		span.Intrinsics["type"] = obsvString("SpanLink")
+		span.Intrinsics["id"] = obsvString(e.GUID)
+		span.Intrinsics["trace.id"] = obsvString(e.TraceID)
+		span.Intrinsics["timestamp"] = obsvInt(timeToIntMillis(l.Timestamp))
+		span.Intrinsics["linkedSpanId"] = obsvString(l.LinkedSpanID)
+		span.Intrinsics["linkedTraceId"] = obsvString(l.LinkedTraceID)
+		spans = append(spans, span)
+	}
+	return spans
+}
+
 func copyAttrs(source spanAttributeMap, dest map[string]*v1.AttributeValue) {
 	for key, val := range source {
 		switch v := val.(type) {
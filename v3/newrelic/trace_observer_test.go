@@ -238,6 +238,64 @@ func TestSendSpanMetrics(t *testing.T) {
 		"Supportability/InfiniteTracing/Span/Seen": 0,
 		"Supportability/InfiniteTracing/Span/Sent": 1,
 	})
+
+	// The events and links of a span are sent as messages of their own.
+	withExtras := &spanEvent{
+		Annotations: []spanAnnotation{{Name: "retry"}},
+		Links:       []spanLink{{LinkedTraceID: "other-trace-id", LinkedSpanID: "other-span-id"}},
+	}
+	if err := to.sendSpan(clientWithoutError, withExtras); err != nil {
+		t.Error("spendSpan should not have returned an error when Send returns a nil error")
+	}
+	expectSupportabilityMetrics(t, to, map[string]float64{
+		"Supportability/InfiniteTracing/Span/Seen": 0,
+		"Supportability/InfiniteTracing/Span/Sent": 3,
+	})
+}
+
+func TestTransformSpanExtras(t *testing.T) {
+	e := &spanEvent{
+		TraceID: "trace-id",
+		GUID:    "guid",
+		Annotations: []spanAnnotation{{
+			Name:      "retry",
+			Timestamp: timeFromUnixMilliseconds(1488393111500),
+		}},
+		Links: []spanLink{{
+			Timestamp:     timeFromUnixMilliseconds(1488393111500),
+			LinkedTraceID: "other-trace-id",
+			LinkedSpanID:  "other-span-id",
+		}},
+	}
+	e.Annotations[0].Attributes.addInt("attempt", 2)
+	spans := transformSpanExtras(e)
+	if len(spans) != 2 {
+		t.Fatal(len(spans))
+	}
+	expectObserverAttributes(t, spans[0].Intrinsics, map[string]interface{}{
+		"type":      "SpanEvent",
+		"span.id":   "guid",
+		"trace.id":  "trace-id",
+		"timestamp": 1488393111500,
+		"name":      "retry",
+	})
+	expectObserverAttributes(t, spans[0].UserAttributes, map[string]interface{}{
+		"attempt": 2,
+	})
+	expectObserverAttributes(t, spans[1].Intrinsics, map[string]interface{}{
+		"type":          "SpanLink",
+		"id":            "guid",
+		"trace.id":      "trace-id",
+		"timestamp":     1488393111500,
+		"linkedSpanId":  "other-span-id",
+		"linkedTraceId": "other-trace-id",
+	})
+	if spans[1].TraceId != "trace-id" {
+		t.Error(spans[1].TraceId)
+	}
+	if spans := transformSpanExtras(&spanEvent{}); nil != spans {
+		t.Error(spans)
+	}
 }
 
 const runToken = "aRunToken"
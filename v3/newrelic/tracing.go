@@ -5,6 +5,7 @@ package newrelic
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -65,6 +66,7 @@ func (bc *betterCAT) SetTraceAndTxnIDs(traceID string) {
 type txnData struct {
 	txnEvent
 	IsWeb          bool
+	IsMessage      bool
 	Name           string    // Work in progress name.
 	Errors         txnErrors // Lazily initialized.
 	Stop           time.Time
@@ -84,6 +86,8 @@ type txnData struct {
 	datastoreSegments map[datastoreMetricKey]*metricData
 	externalSegments  map[externalMetricKey]*metricData
 	messageSegments   map[internal.MessageMetricKey]*metricData
+	// segmentErrors counts the failed segments by metric name.
+	segmentErrors map[string]int
 
 	TxnTrace txnTrace
 
@@ -91,6 +95,10 @@ type txnData struct {
 	SlowQueryThreshold time.Duration
 	SlowQueries        *slowQueries
 
+	// Logs contains the log events recorded by the transaction.  It is
+	// lazily initialized.
+	Logs *logEvents
+
 	// These better CAT supportability fields are left outside of
 	// TxnEvent.BetterCAT to minimize the size of transaction event memory.
 	DistributedTracingSupport distributedTracingSupport
@@ -109,6 +117,21 @@ type tracingThread struct {
 	// start and end are used to track the TotalTime this tracingThread was active.
 	start time.Time
 	end   time.Time
+	// profilerLabels are the pprof labels set by the agent on the
+	// goroutine, and profilerLabelFrames contains the labels to restore
+	// when segments end.  The labels are added to those of
+	// profilerLabelsContext, which are restored when the transaction
+	// ends.
+	profilerLabels        []string
+	profilerLabelFrames   []profilerLabelFrame
+	profilerLabelsContext context.Context
+}
+
+// profilerLabelFrame contains the pprof labels to restore when the segment
+// started at stamp ends.
+type profilerLabelFrame struct {
+	stamp    segmentStamp
+	previous []string
 }
 
 // RecordActivity indicates that activity happened at this time on this
@@ -285,6 +308,10 @@ type segmentFrame struct {
 	spanID          string
 	agentAttributes spanAttributeMap
 	userAttributes  spanAttributeMap
+	annotations     []spanAnnotation
+	links           []spanLink
+	// failed is true if an unexpected error was noticed on the segment.
+	failed bool
 }
 
 type segmentEnd struct {
@@ -297,6 +324,9 @@ type segmentEnd struct {
 	threadID        uint64
 	agentAttributes spanAttributeMap
 	userAttributes  spanAttributeMap
+	annotations     []spanAnnotation
+	links           []spanLink
+	failed          bool
 }
 
 func (end segmentEnd) spanEvent() *spanEvent {
@@ -310,6 +340,8 @@ func (end segmentEnd) spanEvent() *spanEvent {
 		Duration:        end.duration,
 		AgentAttributes: end.agentAttributes,
 		UserAttributes:  end.userAttributes,
+		Annotations:     end.annotations,
+		Links:           end.links,
 		IsEntrypoint:    false,
 	}
 }
@@ -319,9 +351,21 @@ const (
 	datastoreOperationUnknown = "other"
 )
 
-// HasErrors indicates whether the transaction had errors.
+// HasErrors indicates whether the transaction had errors which were not
+// expected.
 func (t *txnData) HasErrors() bool {
-	return len(t.Errors) > 0
+	for _, e := range t.Errors {
+		if !e.Expect {
+			return true
+		}
+	}
+	return false
+}
+
+// hasExpectedErrorsOnly indicates whether the transaction had errors which
+// were all expected.
+func (t *txnData) hasExpectedErrorsOnly() bool {
+	return len(t.Errors) > 0 && !t.HasErrors()
 }
 
 func (t *txnData) time(now time.Time) segmentTime {
@@ -353,6 +397,73 @@ func (thread *tracingThread) AddUserSpanAttribute(key string, val interface{}) {
 	}
 }
 
+// frame returns the frame of the segment started at start, or nil if the
+// segment has ended.
+func (thread *tracingThread) frame(start segmentStartTime) *segmentFrame {
+	if start.Depth < 0 || start.Depth >= len(thread.stack) || thread.stack[start.Depth].Stamp != start.Stamp {
+		return nil
+	}
+	return &thread.stack[start.Depth]
+}
+
+// AddSpanAnnotation adds an event to the span of the segment.  The segment
+// must not have ended.
+func (thread *tracingThread) AddSpanAnnotation(start segmentStartTime, a spanAnnotation) error {
+	frame := thread.frame(start)
+	if nil == frame {
+		return errSegmentEnded
+	}
+	if len(frame.annotations) >= maxSpanAnnotations {
+		return errSpanAnnotationLimit
+	}
+	frame.annotations = append(frame.annotations, a)
+	return nil
+}
+
+// AddSpanLink adds a link to the span of the segment.  The segment must not
+// have ended.
+func (thread *tracingThread) AddSpanLink(start segmentStartTime, l spanLink) error {
+	frame := thread.frame(start)
+	if nil == frame {
+		return errSegmentEnded
+	}
+	if len(frame.links) >= maxSpanLinks {
+		return errSpanLinkLimit
+	}
+	frame.links = append(frame.links, l)
+	return nil
+}
+
+// noticeSegmentError marks the segment with the error.  The segment must not
+// have ended.
+func (thread *tracingThread) noticeSegmentError(start segmentStartTime, err errorData) error {
+	frame := thread.frame(start)
+	if nil == frame {
+		return errSegmentEnded
+	}
+	frame.agentAttributes.addString(SpanAttributeErrorClass, err.Klass)
+	frame.agentAttributes.addString(SpanAttributeErrorMessage, err.Msg)
+	if err.Expect {
+		frame.agentAttributes.addBool(SpanAttributeErrorExpected, true)
+	} else {
+		delete(frame.agentAttributes, SpanAttributeErrorExpected)
+		frame.failed = true
+	}
+	return nil
+}
+
+// recordSegmentError counts the segment if an unexpected error was noticed on
+// it.
+func (t *txnData) recordSegmentError(end segmentEnd, metric string) {
+	if !end.failed {
+		return
+	}
+	if nil == t.segmentErrors {
+		t.segmentErrors = make(map[string]int)
+	}
+	t.segmentErrors[metric]++
+}
+
 // RemoveErrorSpanAttribute allows attributes to be removed from spans.
 func (thread *tracingThread) RemoveErrorSpanAttribute(key string) {
 	stackLen := len(thread.stack)
@@ -409,6 +520,9 @@ var (
 	// incorrect order.
 	errSegmentOrder = errors.New(`improper segment use: segments must be ended in "last started first ended" order: ` +
 		`use https://godoc.org/github.com/newrelic/go-agent/v3/newrelic#Transaction.NewGoroutine to use the transaction in multiple goroutines`)
+	errSpanAnnotationLimit = fmt.Errorf("too many events: limit is %d per segment", maxSpanAnnotations)
+	errSpanLinkLimit       = fmt.Errorf("too many links: limit is %d per segment", maxSpanLinks)
+	errSegmentEnded        = errors.New("segment has already ended")
 )
 
 func endSegment(t *txnData, thread *tracingThread, start segmentStartTime, now time.Time) (segmentEnd, error) {
@@ -435,6 +549,9 @@ func endSegment(t *txnData, thread *tracingThread, start segmentStartTime, now t
 		start:           frame.segmentTime,
 		agentAttributes: frame.agentAttributes,
 		userAttributes:  frame.userAttributes,
+		annotations:     frame.annotations,
+		links:           frame.links,
+		failed:          frame.failed,
 	}
 	if s.stop.Time.After(s.start.Time) {
 		s.duration = s.stop.Time.Sub(s.start.Time)
@@ -494,6 +611,7 @@ func endBasicSegment(t *txnData, thread *tracingThread, start segmentStartTime,
 		*cpy = m
 		t.customSegments[name] = cpy
 	}
+	t.recordSegmentError(end, customSegmentMetric(name))
 
 	if t.TxnTrace.considerNode(end) {
 		attributes := end.agentAttributes.copy()
@@ -588,6 +706,7 @@ func endExternalSegment(p endExternalParams) error {
 		*cpy = m
 		t.externalSegments[key] = cpy
 	}
+	t.recordSegmentError(end, key.scopedMetric())
 
 	if t.TxnTrace.considerNode(end) {
 		attributes := end.agentAttributes.copy()
@@ -628,9 +747,10 @@ type endMessageParams struct {
 	Library         string
 	DestinationType string
 	DestinationTemp bool
+	Consumer        bool
 }
 
-// endMessageSegment ends an external segment.
+// endMessageSegment ends a message producer or consumer segment.
 func endMessageSegment(p endMessageParams) error {
 	t := p.TxnData
 	end, err := endSegment(t, p.Thread, p.Start, p.Now)
@@ -643,6 +763,7 @@ func endMessageSegment(p endMessageParams) error {
 		DestinationType: p.DestinationType,
 		DestinationName: p.DestinationName,
 		DestinationTemp: p.DestinationTemp,
+		Consumer:        p.Consumer,
 	}
 
 	if nil == t.messageSegments {
@@ -661,11 +782,11 @@ func endMessageSegment(p endMessageParams) error {
 
 	if t.TxnTrace.considerNode(end) {
 		attributes := end.agentAttributes.copy()
-		t.saveTraceSegment(end, key.Name(), attributes, "")
+		t.saveTraceSegment(end, key.SegmentName(), attributes, "")
 	}
 
 	if evt := end.spanEvent(); evt != nil {
-		evt.Name = key.Name()
+		evt.Name = key.SegmentName()
 		evt.Category = spanCategoryGeneric
 		t.saveSpanEvent(evt)
 	}
@@ -683,11 +804,17 @@ type endDatastoreParams struct {
 	Collection         string
 	Operation          string
 	ParameterizedQuery string
-	QueryParameters    map[string]interface{}
-	Host               string
-	PortPathOrID       string
-	Database           string
-	ThisHost           string
+	// RecordSQL controls how ParameterizedQuery is recorded.  Any value
+	// other than RecordSQLRaw or RecordSQLOff obfuscates the query.
+	RecordSQL       RecordSQLMode
+	QueryParameters map[string]interface{}
+	Host            string
+	PortPathOrID    string
+	Database        string
+	ThisHost        string
+	// Explain, if not nil, prepares capturing the plan of the query if it
+	// is a slow query.  It returns nil if no plan will be captured.
+	Explain func() *pendingExplainPlan
 }
 
 const (
@@ -727,6 +854,15 @@ func endDatastoreSegment(p endDatastoreParams) error {
 	if nil != err {
 		return err
 	}
+	switch p.RecordSQL {
+	case RecordSQLRaw:
+	case RecordSQLOff:
+		p.ParameterizedQuery = ""
+	default:
+		if "" != p.ParameterizedQuery {
+			p.ParameterizedQuery = obfuscateSQL(p.ParameterizedQuery, sqlDialectForProduct(p.Product))
+		}
+	}
 	if p.Operation == "" {
 		p.Operation = datastoreOperationUnknown
 	}
@@ -779,6 +915,7 @@ func endDatastoreSegment(p endDatastoreParams) error {
 	}
 
 	scopedMetric := datastoreScopedMetric(key)
+	p.TxnData.recordSegmentError(end, scopedMetric)
 	// errors in QueryParameters must not stop the recording of the segment
 	queryParams, err := vetQueryParameters(p.QueryParameters)
 
@@ -798,7 +935,7 @@ func endDatastoreSegment(p endDatastoreParams) error {
 		if nil == p.TxnData.SlowQueries {
 			p.TxnData.SlowQueries = newSlowQueries(maxTxnSlowQueries)
 		}
-		p.TxnData.SlowQueries.observeInstance(slowQueryInstance{
+		slow := slowQueryInstance{
 			Duration:           end.duration,
 			DatastoreMetric:    scopedMetric,
 			ParameterizedQuery: p.ParameterizedQuery,
@@ -807,7 +944,11 @@ func endDatastoreSegment(p endDatastoreParams) error {
 			PortPathOrID:       p.PortPathOrID,
 			DatabaseName:       p.Database,
 			StackTrace:         getStackTrace(),
-		})
+		}
+		if nil != p.Explain {
+			slow.pendingExplain = p.Explain()
+		}
+		p.TxnData.SlowQueries.observeInstance(slow)
 	}
 
 	if evt := end.spanEvent(); evt != nil {
@@ -886,8 +1027,13 @@ func mergeBreakdownMetrics(t *txnData, metrics *metricTable) {
 	}
 	// Message Segment Metrics
 	for key, data := range t.messageSegments {
-		metric := key.Name()
+		metric := key.SegmentName()
 		metrics.add(metric, scope, *data, unforced)
 		metrics.add(metric, "", *data, unforced)
 	}
+	// Segment Error Metrics
+	for metric, count := range t.segmentErrors {
+		metrics.addCount(segmentErrorsRollup, float64(count), forced)
+		metrics.addCount(segmentErrorsPrefix+metric, float64(count), unforced)
+	}
 }
@@ -4,6 +4,7 @@
 package newrelic
 
 import (
+	"context"
 	"net/http"
 	"net/url"
 	"strings"
@@ -31,6 +32,10 @@ func (txn *Transaction) End() {
 	if nil == txn.thread {
 		return
 	}
+	if txn.thread.Config.profilerLabelsEnabled() {
+		// Deferred so that the labels are restored when End re-panics.
+		defer txn.thread.endTxnProfilerLabels()
+	}
 
 	var r interface{}
 	if txn.thread.Config.ErrorCollector.RecordPanics {
@@ -41,6 +46,82 @@ func (txn *Transaction) End() {
 	txn.thread.logAPIError(txn.thread.End(r), "end transaction", nil)
 }
 
+// SetProfilerLabelsContext sets the context holding the pprof labels the
+// calling goroutine had before the Transaction, such as the context passed to
+// the function run by pprof.Do.  When Config.ProfilerLabels is enabled, the
+// labels of the Transaction and of its segments are added to those of the
+// context, and End restores the labels of the context.  Goroutines using a
+// Transaction returned by NewGoroutine must set their own context.  Without
+// it, the goroutine's previous labels are replaced, since runtime/pprof does
+// not allow reading them.
+//
+//	pprof.Do(ctx, pprof.Labels("worker", "billing"), func(ctx context.Context) {
+//		txn := app.StartTransaction("charge")
+//		txn.SetProfilerLabelsContext(ctx)
+//		defer txn.End()
+//		// ...
+//	})
+func (txn *Transaction) SetProfilerLabelsContext(ctx context.Context) {
+	if nil == txn {
+		return
+	}
+	if nil == txn.thread {
+		return
+	}
+	if nil == ctx || !txn.thread.Config.profilerLabelsEnabled() {
+		return
+	}
+	txn.thread.setProfilerLabelsContext(ctx)
+}
+
+// RecordPanic records a panic as an error without ending the Transaction.
+// It is useful in goroutines using a Transaction returned by NewGoroutine,
+// whose panics are not seen by the deferred End of the original goroutine.
+// Like End, it only recovers panics when Config.ErrorCollector.RecordPanics
+// is true, and it must be deferred directly:
+//
+//	go func(txn *newrelic.Transaction) {
+//		defer txn.RecordPanic()
+//		// ...
+//	}(txn.NewGoroutine())
+//
+// The panic is re-panicked unless Config.ErrorCollector.PanicPolicy is
+// PanicPolicySwallow.
+func (txn *Transaction) RecordPanic() {
+	if nil == txn {
+		return
+	}
+	if nil == txn.thread {
+		return
+	}
+	if !txn.thread.Config.ErrorCollector.RecordPanics {
+		return
+	}
+	// recover must be called in the function directly being deferred.
+	r := recover()
+	if nil == r {
+		return
+	}
+	_, err := txn.thread.RecordPanic(r)
+	txn.thread.logAPIError(err, "record panic", nil)
+	if txn.thread.Config.ErrorCollector.PanicPolicy != PanicPolicySwallow {
+		panic(r)
+	}
+}
+
+// swallowsPanics returns whether a deferred End recovers panics without
+// re-panicking them.
+func (txn *Transaction) swallowsPanics() bool {
+	if nil == txn {
+		return false
+	}
+	if nil == txn.thread {
+		return false
+	}
+	return txn.thread.Config.ErrorCollector.RecordPanics &&
+		txn.thread.Config.ErrorCollector.PanicPolicy == PanicPolicySwallow
+}
+
 // Ignore prevents this transaction's data from being recorded.
 func (txn *Transaction) Ignore() {
 	if nil == txn {
@@ -74,8 +155,10 @@ func (txn *Transaction) SetName(name string) {
 // below 100 that is not in the IgnoreStatusCodes configuration list.  This
 // method is unaffected by the IgnoreStatusCodes configuration list.
 //
-// NoticeError examines whether the error implements the following optional
-// methods:
+// NoticeError examines whether the error, or one of the errors it wraps,
+// implements the following optional methods.  The wrapped errors are found
+// using errors.As, following both Unwrap() error and Unwrap() []error, and the
+// first non-empty value is used:
 //
 //   // StackTrace records a stack trace
 //   StackTrace() []uintptr
@@ -86,9 +169,19 @@ func (txn *Transaction) SetName(name string) {
 //   // ErrorAttributes sets the errors attributes
 //   ErrorAttributes() map[string]interface{}
 //
+//   // ErrorExpected marks the error as expected
+//   ErrorExpected() bool
+//
 // The newrelic.Error type, which implements these methods, is the recommended
 // way to directly control the recorded error's message, class, stacktrace,
-// and attributes.
+// attributes, and whether it is expected.
+//
+// Errors matching Config.ErrorCollector.IgnoreClasses or IgnoreMessages are
+// not recorded.  Errors matching ExpectedClasses or ExpectedMessages are
+// recorded as expected errors, which do not affect the error rate or apdex.
+//
+// The class, message, and stack trace of each wrapped error are recorded with
+// the traced error.
 func (txn *Transaction) NoticeError(err error) {
 	if nil == txn {
 		return
@@ -117,6 +210,28 @@ func (txn *Transaction) AddAttribute(key string, value interface{}) {
 	txn.thread.logAPIError(txn.thread.AddAttribute(key, value), "add attribute", nil)
 }
 
+// RecordLog records a log record which was logged during the transaction.
+// The record is counted by the Logging/lines metrics.  If
+// Config.ApplicationLogging.Forwarding.Enabled is true, the record is sent to
+// New Relic as a log event when the transaction ends.  The log event
+// contains the trace and span IDs of the transaction's current segment, and
+// is sampled together with the transaction.
+//
+// An error is returned if the record's attributes are invalid or if the
+// transaction has ended, in which case the record is not counted either.
+// Unlike the other methods, RecordLog does not log its errors, so that it may
+// be called by a logging integration while the logger used by the agent is
+// locked.
+func (txn *Transaction) RecordLog(data LogData) error {
+	if nil == txn {
+		return nil
+	}
+	if nil == txn.thread {
+		return nil
+	}
+	return txn.thread.RecordLog(data, time.Now())
+}
+
 // SetWebRequestHTTP marks the transaction as a web transaction.  If
 // the request is non-nil, SetWebRequestHTTP will additionally collect
 // details on request attributes, url, and method.  If headers are
@@ -162,6 +277,27 @@ func (txn *Transaction) SetWebRequest(r WebRequest) {
 	txn.thread.logAPIError(txn.thread.SetWebRequest(r), "set web request", nil)
 }
 
+// SetMessageRequest marks the transaction as a message consumer transaction,
+// which is a background transaction.  The transaction is named using the
+// message library, destination type, and destination name, eg.
+// "OtherTransaction/Message/RabbitMQ/Queue/Named/MyQueue".  The routing key,
+// queue name, exchange type, reply to, and correlation ID fields are recorded
+// as the message.* agent attributes.  If headers are present, the agent will
+// look for distributed tracing headers using
+// Transaction.AcceptDistributedTraceHeaders.
+//
+// A subsequent call to Transaction.SetName will replace the message
+// transaction name.
+func (txn *Transaction) SetMessageRequest(r MessageRequest) {
+	if nil == txn {
+		return
+	}
+	if nil == txn.thread {
+		return
+	}
+	txn.thread.logAPIError(txn.thread.SetMessageRequest(r), "set message request", nil)
+}
+
 // SetWebResponse allows the Transaction to instrument response code and
 // response headers.  Use the return value of this method in place of the input
 // parameter http.ResponseWriter in your instrumentation.
@@ -217,11 +353,18 @@ func (txn *Transaction) startSegmentAt(at time.Time) SegmentStartTime {
 //	segment := txn.StartSegment("myBlock")
 //	// ... code you want to time here ...
 //	segment.End()
+//
+// When Config.ProfilerLabels is enabled, the name of the segment is added to
+// the pprof labels of the calling goroutine until the segment ends.
 func (txn *Transaction) StartSegment(name string) *Segment {
-	return &Segment{
+	s := &Segment{
 		StartTime: txn.StartSegmentNow(),
 		Name:      name,
 	}
+	if thd := s.StartTime.thread; nil != thd && thd.Config.profilerLabelsEnabled() {
+		thd.startSegmentProfilerLabels(s.StartTime.start, name)
+	}
+	return s
 }
 
 // InsertDistributedTraceHeaders adds the Distributed Trace headers used to
@@ -316,7 +459,8 @@ func (txn *Transaction) BrowserTimingHeader() *BrowserTimingHeader {
 // All Transaction methods can be used in any Transaction reference.
 // The Transaction will end when End() is called in any goroutine.
 // Note that any segments that end after the transaction ends will not
-// be reported.
+// be reported.  Use RecordPanic to record the panics of the other
+// goroutine.
 func (txn *Transaction) NewGoroutine() *Transaction {
 	if nil == txn {
 		return nil
@@ -423,6 +567,41 @@ type WebRequest struct {
 	Host string
 }
 
+// MessageRequest is used to provide consumed message information to
+// Transaction.SetMessageRequest.
+type MessageRequest struct {
+	// Library is the name of the library instrumented.  eg. "RabbitMQ",
+	// "JMS"
+	Library string
+	// DestinationType is the destination type.  If empty, MessageQueue is
+	// used.
+	DestinationType MessageDestinationType
+	// DestinationName is the name of your queue or topic.  eg. "UsersQueue".
+	DestinationName string
+	// DestinationTemporary must be set to true if destination is temporary
+	// to improve metric grouping.
+	DestinationTemporary bool
+	// Header may be nil if the message has no headers or you don't want to
+	// transform them to http.Header format.  Distributed tracing headers
+	// found in Header are accepted.
+	Header http.Header
+	// If a distributed tracing header is found in the MessageRequest.Header,
+	// this TransportType will be used in the distributed tracing metrics.
+	Transport TransportType
+	// RoutingKey is recorded as the AttributeMessageRoutingKey attribute.
+	RoutingKey string
+	// QueueName is recorded as the AttributeMessageQueueName attribute.
+	QueueName string
+	// ExchangeType is recorded as the AttributeMessageExchangeType
+	// attribute.
+	ExchangeType string
+	// ReplyTo is recorded as the AttributeMessageReplyTo attribute.
+	ReplyTo string
+	// CorrelationID is recorded as the AttributeMessageCorrelationID
+	// attribute.
+	CorrelationID string
+}
+
 // LinkingMetadata is returned by Transaction.GetLinkingMetadata.  It contains
 // identifiers needed to link data to a trace or entity.
 type LinkingMetadata struct {